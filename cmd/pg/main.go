@@ -19,6 +19,7 @@ import (
 	"github.com/packet-guardian/packet-guardian/src/db"
 	"github.com/packet-guardian/packet-guardian/src/models"
 	"github.com/packet-guardian/packet-guardian/src/models/stores"
+	"github.com/packet-guardian/packet-guardian/src/oui"
 	"github.com/packet-guardian/packet-guardian/src/server"
 	"github.com/packet-guardian/packet-guardian/src/tasks"
 )
@@ -76,12 +77,23 @@ func main() {
 	}
 
 	appStores := stores.StoreCollection{
-		Blacklist: stores.GetBlacklistStore(e),
-		Devices:   stores.GetDeviceStore(e),
-		Leases:    stores.GetLeaseStore(e),
-		Users:     stores.GetUserStore(e),
+		Blacklist:    stores.GetBlacklistStore(e),
+		DeviceEvents: stores.GetDeviceEventStore(e),
+		Devices:      stores.GetDeviceStore(e),
+		JobRuns:      stores.GetJobRunStore(e),
+		Leases:       stores.GetLeaseStore(e),
+		Notes:        stores.GetNoteStore(e),
+		Policies:     stores.GetPolicyStore(e),
+		TaskLocks:    stores.GetTaskLockStore(e),
+		Terms:        stores.GetTermStore(e),
+		Transfers:    stores.GetTransferStore(e),
+		Trash:        stores.GetTrashStore(e),
+		Users:        stores.GetUserStore(e),
+		Webhooks:     stores.GetWebhookStore(e),
 	}
 
+	models.SetTermCalendar(appStores.Terms)
+
 	go tasks.StartTaskScheduler(e, appStores)
 
 	// Start web server
@@ -124,6 +136,11 @@ func setupEnvironment() *common.Environment {
 		e.Log.WithField("error", err).Fatal("Error loading frontend templates")
 	}
 
+	if err := oui.Load(); err != nil {
+		e.Log.WithField("error", err).Warning("Error loading OUI database")
+	}
+	e.Log.WithField("assignments", oui.Len()).Debug("Loaded OUI database")
+
 	e.Views, err = common.NewViews(e, "templates", template.FuncMap{
 		"userCan": func(user *models.User, perm string) bool {
 			return user.Can(models.StrToPermission(perm))
@@ -28,6 +28,45 @@ function initManage() {
         );
     });
 
+    // Device renewals
+    $("[name=renew-selected-btn]").click(renewSelectedDevices);
+
+    // Registration policy
+    $("[name=accept-policy-btn]").click((e) => {
+        const version = $(e.target).data("version") ?? "";
+        api.acceptPolicy(version, () => location.reload(), apiError);
+    });
+
+    // Device transfers
+    $("[name=transfer-selected-btn]").click(() => {
+        const pmodal = new ModalPrompt();
+        pmodal.show("Transfer selected devices to username:", (username) =>
+            offerSelectedDevices(username.trim())
+        );
+    });
+
+    $(".accept-transfer-btn").click((e) => {
+        const id = $(e.target).data("transfer") ?? "";
+        api.acceptDeviceTransfer(id, () => location.reload(), apiError);
+    });
+
+    $(".decline-transfer-btn").click((e) => {
+        const id = $(e.target).data("transfer") ?? "";
+        const cmodal = new ModalConfirm();
+        cmodal.show("Decline this device?", () =>
+            api.declineDeviceTransfer(
+                id,
+                () => location.reload(),
+                apiError
+            )
+        );
+    });
+
+    $(".cancel-transfer-btn").click((e) => {
+        const id = $(e.target).data("transfer") ?? "";
+        api.cancelDeviceTransfer(id, () => location.reload(), apiError);
+    });
+
     $("#select-all").click((e) => {
         const state = !$("#select-all-checkbox").prop("checked");
         $(".device-checkbox").prop("checked", state);
@@ -75,4 +114,66 @@ function deleteSelectedDevices() {
     );
 }
 
+// Device renewals
+function renewSelectedDevices() {
+    const devicesToRenew = $(".device-checkbox:checked").map(
+        (elem) => (elem as HTMLInputElement).value
+    );
+    if (devicesToRenew.length === 0) {
+        return;
+    }
+
+    let remaining = devicesToRenew.length;
+    const done = () => {
+        remaining--;
+        if (remaining === 0) {
+            location.reload();
+        }
+    };
+
+    devicesToRenew.forEach((mac) =>
+        api.renewDevice(mac, done, (req) => {
+            apiError(req);
+            remaining = -1; // Don't reload so the error is visible
+        })
+    );
+}
+
+// Device transfers
+function offerSelectedDevices(username: string) {
+    const devicesToTransfer = $(".device-checkbox:checked").map(
+        (elem) => (elem as HTMLInputElement).value
+    );
+    if (devicesToTransfer.length === 0 || username === "") {
+        return;
+    }
+
+    let remaining = devicesToTransfer.length;
+    const done = () => {
+        remaining--;
+        if (remaining === 0) {
+            location.reload();
+        }
+    };
+
+    devicesToTransfer.forEach((mac) =>
+        api.offerDeviceTransfer(mac, username, done, (req) => {
+            apiError(req);
+            remaining = -1; // Don't reload so the error is visible
+        })
+    );
+}
+
+function apiError(req: XMLHttpRequest) {
+    const resp = JSON.parse(req.responseText);
+    switch (req.status) {
+        case 500:
+            flashMessage(`Internal Server Error - ${resp.Message}`);
+            break;
+        default:
+            flashMessage(resp.Message);
+            break;
+    }
+}
+
 initManage();
@@ -0,0 +1,30 @@
+import $ from "@/jlib2";
+import api from "@/pg-api";
+import flashMessage from "@/flash";
+
+// Wire up the add note form of the notes-log template. The page is reloaded
+// after a note is added so the log shows the new entry.
+function bindNotesLog() {
+    const log = document.querySelector<HTMLElement>(".notes-log");
+    if (!log) {
+        return;
+    }
+
+    $("#add-note-btn").click(() => {
+        const text = $("#add-note-text").value().trim();
+        if (text === "") {
+            flashMessage("Note text is required");
+            return;
+        }
+
+        api.addNote(
+            log.dataset["entity"] ?? "",
+            log.dataset["key"] ?? "",
+            text,
+            () => location.reload(),
+            () => flashMessage("Error adding note")
+        );
+    });
+}
+
+export { bindNotesLog };
@@ -26,6 +26,7 @@ export interface SaveUserInput {
     can_autoreg: number;
     delegates: string; // Comma separated list of colon separated username:permission pairs
     notes: string;
+    email: string;
 }
 
 export interface RegisterDeviceInput {
@@ -33,6 +34,14 @@ export interface RegisterDeviceInput {
     "mac-address": string;
     description: string;
     platform?: string;
+    "policy-version"?: string;
+    attributes?: { [index: string]: string }; // Keys are prefixed with attr_
+}
+
+export interface FlagDeviceInput {
+    category: string;
+    reason?: string;
+    clears?: string; // YYYY-MM-DD, never, or empty for the category default
 }
 
 // API is a collection of methods used to interact with the API
@@ -138,6 +147,20 @@ class API {
         );
     }
 
+    renewDevice(
+        mac: string,
+        success?: APISuccessCallback<DeviceExpirationResp>,
+        error?: ErrorCallback
+    ) {
+        mac = encodeURIComponent(mac);
+        post(
+            `/api/device/mac/${mac}/renew`,
+            {},
+            apiRespWrapper(success),
+            error
+        );
+    }
+
     saveDeviceNotes(
         mac: string,
         notes: string,
@@ -153,17 +176,51 @@ class API {
         );
     }
 
-    // flagged is bool
+    // entity is "device" or "user", key is the MAC address or username
+    addNote(
+        entity: string,
+        key: string,
+        text: string,
+        success?: APISuccessCallback<EmptyResp>,
+        error?: ErrorCallback
+    ) {
+        key = encodeURIComponent(key);
+        post(
+            `/api/notes/${entity}/${key}`,
+            { text },
+            apiRespWrapper(success),
+            error
+        );
+    }
+
+    // attributes keys are prefixed with attr_
+    saveDeviceAttributes(
+        mac: string,
+        attributes: { [index: string]: string },
+        success?: APISuccessCallback<EmptyResp>,
+        error?: ErrorCallback
+    ) {
+        mac = encodeURIComponent(mac);
+        post(
+            `/api/device/mac/${mac}/attributes`,
+            attributes,
+            apiRespWrapper(success),
+            error
+        );
+    }
+
+    // flag is required when flagging a device
     flagDevice(
         mac: string,
         flagged: boolean,
+        flag: FlagDeviceInput | null,
         success?: APISuccessCallback<EmptyResp>,
         error?: ErrorCallback
     ) {
         mac = encodeURIComponent(mac);
         post(
             `/api/device/mac/${mac}/flag`,
-            { flagged },
+            { flagged, ...flag },
             apiRespWrapper(success),
             error
         );
@@ -259,6 +316,74 @@ class API {
         );
     }
 
+    // Device transfer functions
+    offerDeviceTransfer(
+        mac: string,
+        username: string,
+        success?: APISuccessCallback<EmptyResp>,
+        error?: ErrorCallback
+    ) {
+        mac = encodeURIComponent(mac);
+        post(
+            `/api/device/mac/${mac}/transfer`,
+            { username },
+            apiRespWrapper(success),
+            error
+        );
+    }
+
+    acceptDeviceTransfer(
+        id: string,
+        success?: APISuccessCallback<EmptyResp>,
+        error?: ErrorCallback
+    ) {
+        post(
+            `/api/transfer/id/${id}/accept`,
+            {},
+            apiRespWrapper(success),
+            error
+        );
+    }
+
+    declineDeviceTransfer(
+        id: string,
+        success?: APISuccessCallback<EmptyResp>,
+        error?: ErrorCallback
+    ) {
+        post(
+            `/api/transfer/id/${id}/decline`,
+            {},
+            apiRespWrapper(success),
+            error
+        );
+    }
+
+    cancelDeviceTransfer(
+        id: string,
+        success?: APISuccessCallback<EmptyResp>,
+        error?: ErrorCallback
+    ) {
+        ajax({
+            method: HTTPMethod.Delete,
+            url: `/api/transfer/id/${id}`,
+            success: apiRespWrapper(success),
+            error,
+        });
+    }
+
+    acceptPolicy(
+        version: string,
+        success?: APISuccessCallback<EmptyResp>,
+        error?: ErrorCallback
+    ) {
+        post(
+            "/api/policy/accept",
+            { version },
+            apiRespWrapper(success),
+            error
+        );
+    }
+
     registerDevice(
         data: RegisterDeviceInput,
         success?: APISuccessCallback<DeviceRegisterResp>,
@@ -271,6 +396,8 @@ class API {
                 "mac-address": data["mac-address"],
                 description: data.description,
                 platform: data.platform ?? "",
+                "policy-version": data["policy-version"] ?? "",
+                ...data.attributes,
             },
             apiRespWrapper(success),
             error
@@ -294,6 +421,7 @@ interface DeviceExpirationResp extends EmptyResp {
 interface DeviceRegisterResp extends EmptyResp {
     Data: {
         Location: string;
+        Warning?: string;
     };
 }
 
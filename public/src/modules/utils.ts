@@ -18,4 +18,21 @@ function setTextboxToToday(el: string) {
     ).value = `${dateStr} ${timeStr}`;
 }
 
-export { setTextboxToToday };
+// Collect custom attribute inputs into a map of form field names to values.
+// Inputs are marked with a data-attr attribute containing the field name.
+function getAttributeInputs(): { [index: string]: string } {
+    const attrs: { [index: string]: string } = {};
+    document
+        .querySelectorAll<HTMLInputElement>("input[data-attr]")
+        .forEach((input) => {
+            const name = `attr_${input.dataset["attr"]}`;
+            if (input.type === "checkbox") {
+                attrs[name] = input.checked ? "true" : "false";
+            } else {
+                attrs[name] = input.value;
+            }
+        });
+    return attrs;
+}
+
+export { setTextboxToToday, getAttributeInputs };
@@ -1,7 +1,8 @@
 import $ from "@/jlib2";
 import api, { SaveUserInput } from "@/pg-api";
 import flashMessage from "@/flash";
-import { setTextboxToToday } from "@/utils";
+import { setTextboxToToday, getAttributeInputs } from "@/utils";
+import { bindNotesLog } from "@/notes";
 import { ModalPrompt } from "@/modals";
 
 const devExpirationTypes = {
@@ -11,6 +12,7 @@ const devExpirationTypes = {
     duration: 3,
     daily: 4,
     rolling: 5,
+    term: 6,
 };
 
 // Device limit select box init
@@ -60,6 +62,11 @@ function checkExpires() {
             limit.value("");
             limit.prop("disabled", true);
             break;
+        case "6":
+            devExpSel.value("term");
+            limit.value("");
+            limit.prop("disabled", true);
+            break;
         default:
             devExpSel.value("specific");
     }
@@ -178,6 +185,8 @@ $("#user-form").submit((e) => {
         api_group: $("[name=user-api-group]").value(),
         delegates: getDelegatesList(),
         notes: $("[name=notes]").value(),
+        email: $("[name=email]").value(),
+        ...getAttributeInputs(),
     };
 
     if ($("[name=clear-pass]").prop("checked")) {
@@ -193,6 +202,14 @@ $("#user-form").submit((e) => {
         formData.device_limit = parseInt($("[name=device-limit]").value());
     }
 
+    // Only shown when device categories are configured
+    const categoryLimits = document.querySelector<HTMLInputElement>(
+        "[name=category-limits]"
+    );
+    if (categoryLimits) {
+        formData.category_limits = categoryLimits.value;
+    }
+
     const devExpSel = $("[name=dev-exp-sel]").value();
     if (devExpSel in devExpirationTypes) {
         formData.expiration_type = (<any>devExpirationTypes)[<any>devExpSel];
@@ -314,3 +331,5 @@ function removeDelegate(e: Event) {
     const delegateName = target?.dataset["delegate"];
     document.querySelector(`p[data-delegate=${delegateName}]`)?.remove();
 }
+
+bindNotesLog();
@@ -2,7 +2,8 @@ import $ from "@/jlib2";
 import api from "@/pg-api";
 import flashMessage from "@/flash";
 import { ModalPrompt, ModalConfirm } from "@/modals";
-import { setTextboxToToday } from "@/utils";
+import { setTextboxToToday, getAttributeInputs } from "@/utils";
+import { bindNotesLog } from "@/notes";
 
 let oldExpiration = "";
 
@@ -18,21 +19,34 @@ $("#delete-btn").click(() => {
 $("#unflag-dev-btn").click(() => {
     const cmodal = new ModalConfirm();
     cmodal.show("Are you sure you want to unflag this device?", () =>
-        api.flagDevice(getMacAddress(), false, reloadPage, () =>
+        api.flagDevice(getMacAddress(), false, null, reloadPage, () =>
             flashMessage("Error unflagging device")
         )
     );
 });
 
 $("#flag-dev-btn").click(() => {
-    const cmodal = new ModalConfirm();
-    cmodal.show("Are you sure you want to flag this device?", () =>
-        api.flagDevice(getMacAddress(), true, reloadPage, () =>
-            flashMessage("Error flagging device")
-        )
-    );
+    $("#flag-controls").style("display", "block");
 });
 
+$("#flag-cancel-btn").click(() => {
+    $("#flag-controls").style("display", "none");
+});
+
+$("#flag-save-btn").click(() =>
+    api.flagDevice(
+        getMacAddress(),
+        true,
+        {
+            category: $("#flag-category").value(),
+            reason: $("#flag-reason").value(),
+            clears: $("#flag-clears").value(),
+        },
+        reloadPage,
+        apiResponseCheck
+    )
+);
+
 $("#unblacklist-btn").click(() => {
     const cmodal = new ModalConfirm();
     cmodal.show(
@@ -78,6 +92,15 @@ $("#register-btn").click(() => {
     );
 });
 
+$("#save-attributes-btn").click(() =>
+    api.saveDeviceAttributes(
+        getMacAddress(),
+        getAttributeInputs(),
+        () => flashMessage("Device attributes saved", "success"),
+        apiResponseCheck
+    )
+);
+
 function getMacAddress() {
     return $("#mac-address").text();
 }
@@ -222,3 +245,5 @@ function apiResponseCheck(req: XMLHttpRequest) {
 }
 
 const reloadPage = () => location.reload();
+
+bindNotesLog();
@@ -1,6 +1,7 @@
 import $ from "@/jlib2";
 import api, { RegisterDeviceInput } from "@/pg-api";
 import flashMessage from "@/flash";
+import { getAttributeInputs } from "@/utils";
 
 function register() {
     disableRegBtn();
@@ -9,6 +10,8 @@ function register() {
         "mac-address": "",
         description: $("[name=dev-desc]").value(),
         platform: "",
+        "policy-version": $("[name=policy-version]").value(),
+        attributes: getAttributeInputs(),
     };
 
     // It's not guaranteed that all fields will be shown
@@ -88,9 +91,24 @@ function registerDevice(data: RegisterDeviceInput, logout: boolean) {
         data,
         (resp) => {
             window.scrollTo(0, 0);
-            flashMessage("Registration successful", "success");
             $(".register-box").hide();
 
+            if (resp.Data.Warning) {
+                // Give the user time to read the warning before redirecting
+                flashMessage(`Registration successful. ${resp.Data.Warning}`);
+                if (logout) {
+                    api.logout();
+                }
+                if (data["mac-address"] === "") {
+                    $("#suc-msg-auto").show();
+                    return;
+                }
+                setTimeout(() => (location.href = resp.Data.Location), 8000);
+                return;
+            }
+
+            flashMessage("Registration successful", "success");
+
             if (logout) {
                 // If the user had to login to register, let's log them out.
                 // It may be a bit confusing if they go back and forget they
@@ -0,0 +1,165 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package attribution finds who had an IP or MAC address at a given time.
+// Leases come from the retained lease history and owners from the device
+// history so answers are still available after an address is reused or a
+// device is deleted.
+package attribution
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+var (
+	// ErrNoLease is returned when the address didn't have a lease at the time.
+	ErrNoLease = errors.New("No lease found for that address and time")
+	// ErrInvalidAddress is returned when a lookup isn't an IPv4 or MAC address.
+	ErrInvalidAddress = errors.New("Address must be an IPv4 or MAC address")
+)
+
+var timeFormats = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	common.TimeFormat,
+	"2006-01-02T15:04",
+}
+
+// Result is the lease of an address at a time and who it belonged to.
+type Result struct {
+	Time       time.Time
+	Lease      models.LeaseHistory
+	Device     *models.Device // Current device record, nil if the MAC isn't registered
+	Owner      string         // Owner of the device when the lease was active
+	AuthMethod string         // How the owner registered the device
+}
+
+func (r *Result) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Time       time.Time              `json:"time"`
+		Lease      map[string]interface{} `json:"lease"`
+		Device     *models.Device         `json:"device"`
+		Owner      string                 `json:"owner"`
+		AuthMethod string                 `json:"auth_method"`
+	}{
+		Time: r.Time.UTC(),
+		Lease: map[string]interface{}{
+			"ip":       r.Lease.GetIP().String(),
+			"mac":      r.Lease.GetMAC().String(),
+			"network":  r.Lease.GetNetworkName(),
+			"start":    r.Lease.GetStartTime().UTC(),
+			"end":      r.Lease.GetEndTime().UTC(),
+			"hostname": r.Lease.GetHostname(),
+		},
+		Device:     r.Device,
+		Owner:      r.Owner,
+		AuthMethod: r.AuthMethod,
+	})
+}
+
+type Attributor struct {
+	e       *common.Environment
+	leases  stores.LeaseStore
+	devices stores.DeviceStore
+	events  stores.DeviceEventStore
+}
+
+func New(e *common.Environment, ls stores.LeaseStore, ds stores.DeviceStore, es stores.DeviceEventStore) *Attributor {
+	return &Attributor{
+		e:       e,
+		leases:  ls,
+		devices: ds,
+		events:  es,
+	}
+}
+
+// Lookup finds the lease of address at time t. Address may be an IP or MAC
+// address.
+func (a *Attributor) Lookup(address string, t time.Time) (*Result, error) {
+	address = strings.TrimSpace(address)
+
+	if ip := net.ParseIP(address); ip != nil && ip.To4() != nil {
+		return a.ByIP(ip.To4(), t)
+	}
+	if mac, err := net.ParseMAC(address); err == nil {
+		return a.ByMAC(mac, t)
+	}
+	return nil, ErrInvalidAddress
+}
+
+// ByIP finds the lease of an IP address at time t.
+func (a *Attributor) ByIP(ip net.IP, t time.Time) (*Result, error) {
+	lease, err := a.leases.GetLeaseAt(ip, t)
+	if err != nil {
+		return nil, err
+	}
+	return a.resolve(lease, t)
+}
+
+// ByMAC finds the lease of a MAC address at time t.
+func (a *Attributor) ByMAC(mac net.HardwareAddr, t time.Time) (*Result, error) {
+	lease, err := a.leases.GetLeaseAtByMAC(mac, t)
+	if err != nil {
+		return nil, err
+	}
+	return a.resolve(lease, t)
+}
+
+func (a *Attributor) resolve(lease models.LeaseHistory, t time.Time) (*Result, error) {
+	if lease == nil {
+		return nil, ErrNoLease
+	}
+
+	result := &Result{
+		Time:  t,
+		Lease: lease,
+	}
+
+	events, err := a.events.GetDeviceEvents(lease.GetMAC())
+	if err != nil {
+		return nil, err
+	}
+	result.Owner = models.DeviceOwnerAt(events, t)
+	result.AuthMethod = models.DeviceAuthMethodAt(events, t)
+
+	device, err := a.devices.GetDeviceByMAC(lease.GetMAC())
+	if err != nil {
+		return nil, err
+	}
+	if device.ID == 0 {
+		return result, nil
+	}
+	result.Device = device
+
+	// Devices without history have had the same owner since registration
+	if len(events) == 0 && !device.DateRegistered.After(t) {
+		result.Owner = device.Username
+	}
+	return result, nil
+}
+
+// ParseTime parses the time of a lookup in the server's time zone unless the
+// zone is given. An empty string is the current time.
+func ParseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Now(), nil
+	}
+
+	for _, format := range timeFormats {
+		if t, err := time.ParseInLocation(format, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid time '%s', use YYYY-MM-DD HH:MM:SS", s)
+}
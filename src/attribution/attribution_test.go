@@ -0,0 +1,134 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package attribution
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	dhcp "github.com/packet-guardian/dhcp-lib"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+func day(d int) time.Time {
+	return time.Date(2026, time.March, d, 12, 0, 0, 0, time.Local)
+}
+
+// attributionTestSetup leases 10.0.0.1 to alice's device, which is later
+// deleted, then to a device registered by carol and reassigned to bob.
+func attributionTestSetup() *Attributor {
+	e := common.NewTestEnvironment()
+	leaseStore := &stores.TestLeaseStore{}
+	deviceStore := &stores.TestDeviceStore{}
+	eventStore := &stores.TestDeviceEventStore{}
+
+	macA, _ := net.ParseMAC("12:34:56:00:00:0a")
+	macB, _ := net.ParseMAC("12:34:56:00:00:0b")
+
+	for _, l := range []struct {
+		mac        net.HardwareAddr
+		start, end time.Time
+	}{
+		{macA, day(1), day(5)},
+		{macB, day(10), day(15)},
+	} {
+		lease := dhcp.NewLease(leaseStore)
+		lease.IP = net.ParseIP("10.0.0.1")
+		lease.MAC = l.mac
+		lease.Network = "main"
+		lease.Start = l.start
+		lease.End = l.end
+		leaseStore.Leases = append(leaseStore.Leases, lease)
+	}
+
+	for _, ev := range []struct {
+		mac       net.HardwareAddr
+		eventType string
+		username  string
+		method    string
+		created   time.Time
+	}{
+		{macA, models.DeviceEventRegistered, "alice", "ldap", day(1).Add(-time.Hour)},
+		{macA, models.DeviceEventDeleted, "alice", "", day(6)},
+		{macB, models.DeviceEventRegistered, "carol", "guest", day(8)},
+		{macB, models.DeviceEventReassigned, "bob", "", day(12)},
+	} {
+		event := models.NewDeviceEvent(eventStore, ev.mac, ev.eventType)
+		event.Username = ev.username
+		event.AuthMethod = ev.method
+		event.Created = ev.created
+		event.Save()
+	}
+
+	device := models.NewDevice(deviceStore, leaseStore, &stores.TestBlacklistItem{})
+	device.ID = 1
+	device.MAC = macB
+	device.Username = "bob"
+	deviceStore.Devices = append(deviceStore.Devices, device)
+
+	return New(e, leaseStore, deviceStore, eventStore)
+}
+
+func TestLookup(t *testing.T) {
+	a := attributionTestSetup()
+
+	tests := []struct {
+		address    string
+		time       time.Time
+		mac        string
+		owner      string
+		authMethod string
+		registered bool
+	}{
+		{"10.0.0.1", day(3), "12:34:56:00:00:0a", "alice", "ldap", false},
+		{"10.0.0.1", day(11), "12:34:56:00:00:0b", "carol", "guest", true},
+		{"10.0.0.1", day(14), "12:34:56:00:00:0b", "bob", "guest", true},
+		{"12:34:56:00:00:0a", day(2), "12:34:56:00:00:0a", "alice", "ldap", false},
+	}
+
+	for _, test := range tests {
+		result, err := a.Lookup(test.address, test.time)
+		if err != nil {
+			t.Fatalf("Lookup %s at %s: %s", test.address, test.time, err)
+		}
+		if mac := result.Lease.GetMAC().String(); mac != test.mac {
+			t.Errorf("Lookup %s at %s: expected MAC %s, got %s", test.address, test.time, test.mac, mac)
+		}
+		if result.Owner != test.owner || result.AuthMethod != test.authMethod {
+			t.Errorf("Lookup %s at %s: expected %s by %s, got %s by %s",
+				test.address, test.time, test.owner, test.authMethod, result.Owner, result.AuthMethod)
+		}
+		if (result.Device != nil) != test.registered {
+			t.Errorf("Lookup %s at %s: expected registered %t", test.address, test.time, test.registered)
+		}
+	}
+
+	if _, err := a.Lookup("10.0.0.1", day(7)); err != ErrNoLease {
+		t.Errorf("Expected no lease between grants, got %v", err)
+	}
+	if _, err := a.Lookup("not an address", day(3)); err != ErrInvalidAddress {
+		t.Errorf("Expected invalid address, got %v", err)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	expected := time.Date(2026, time.March, 1, 15, 4, 5, 0, time.Local)
+	for _, s := range []string{"2026-03-01 15:04:05", expected.Format(time.RFC3339)} {
+		parsed, err := ParseTime(s)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %s", s, err)
+		}
+		if !parsed.Equal(expected) {
+			t.Errorf("Parsing %s: expected %s, got %s", s, expected, parsed)
+		}
+	}
+
+	if _, err := ParseTime("yesterday"); err == nil {
+		t.Error("Expected error parsing invalid time")
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/lfkeitel/verbose/v4"
 	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/metrics"
 	"github.com/packet-guardian/packet-guardian/src/models/stores"
 )
 
@@ -19,6 +20,10 @@ type authenticator interface {
 
 var authFunctions = make(map[string]authenticator)
 
+// passwordMethod is the login metrics method of failed username and password
+// logins. A password login only fails after every configured method rejected it.
+const passwordMethod = "password"
+
 // LoginUser will verify the username and password against several login methods
 // If one method succeeds, true will be returned. False otherwise.
 func LoginUser(w http.ResponseWriter, r *http.Request, users stores.UserStore) bool {
@@ -39,6 +44,7 @@ func LoginUser(w http.ResponseWriter, r *http.Request, users stores.UserStore) b
 		"username": username,
 		"package":  "auth",
 	}).Info("Failed login")
+	metrics.Logins.Inc(passwordMethod, metrics.ResultFailure)
 	return false
 }
 
@@ -62,6 +68,7 @@ func SetLoginUser(w http.ResponseWriter, r *http.Request, username, method strin
 		"action":   "login",
 		"package":  "auth",
 	}).Info("Logged in user")
+	metrics.Logins.Inc(method, metrics.ResultSuccess)
 	return true
 }
 
@@ -86,6 +93,7 @@ func CheckLogin(username, password string, r *http.Request, users stores.UserSto
 					"action":   "login",
 					"package":  "auth",
 				}).Info("Logged in user")
+				metrics.Logins.Inc(method, metrics.ResultSuccess)
 				return true
 			}
 		}
@@ -94,6 +102,7 @@ func CheckLogin(username, password string, r *http.Request, users stores.UserSto
 		"username": username,
 		"package":  "auth",
 	}).Info("Failed login")
+	metrics.Logins.Inc(passwordMethod, metrics.ResultFailure)
 	return false
 }
 
@@ -28,6 +28,11 @@ func SetCustomDir(dir string) error {
 	return nil
 }
 
+// CustomDir returns the directory containing custom assets.
+func CustomDir() string {
+	return customDir
+}
+
 // GetAsset wraps go-bindata's Asset function and checks if a file
 // with the same path/name exists in the custom directory it will
 // be loaded and used instead of the builtin asset. Otherwise, the
@@ -0,0 +1,91 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"fmt"
+)
+
+// Notifier types
+const (
+	NotifierEmail   = "email"
+	NotifierWebhook = "webhook"
+	NotifierSyslog  = "syslog"
+)
+
+// NotifierConfig configures a destination for flagged device alerts. To is
+// used by email notifiers, URL by webhooks, and Network, Address, and Tag by
+// syslog. An empty syslog address logs to the local syslog daemon.
+type NotifierConfig struct {
+	Name    string
+	Type    string
+	To      []string
+	URL     string
+	Network string
+	Address string
+	Tag     string
+}
+
+// AlertRoute sends alerts about devices matching every non-empty condition
+// to its notifiers. A device matches Tags if it has any of the tags and
+// Categories if it's flagged with one of the flag categories.
+type AlertRoute struct {
+	Tags       []string
+	Usernames  []string
+	Networks   []string
+	Categories []string
+	Notifiers  []string
+}
+
+func validateAlerts(c *Config) error {
+	// Alerts were sent to the email recipients before notifiers existed
+	if len(c.Alerts.Notifiers) == 0 && c.Email.Address != "" && len(c.Email.ToAddresses) > 0 {
+		c.Alerts.Notifiers = []NotifierConfig{{
+			Name: NotifierEmail,
+			Type: NotifierEmail,
+			To:   c.Email.ToAddresses,
+		}}
+	}
+
+	names := make(map[string]bool, len(c.Alerts.Notifiers))
+	for _, n := range c.Alerts.Notifiers {
+		if n.Name == "" {
+			return fmt.Errorf("Alert notifiers must have a name")
+		}
+		if names[n.Name] {
+			return fmt.Errorf("Alert notifier %s is defined twice", n.Name)
+		}
+		names[n.Name] = true
+
+		switch n.Type {
+		case NotifierEmail:
+			if c.Email.Address == "" {
+				return fmt.Errorf("Alert notifier %s needs an SMTP server in [email]", n.Name)
+			}
+			if len(n.To) == 0 {
+				return fmt.Errorf("Alert notifier %s has no recipients", n.Name)
+			}
+		case NotifierWebhook:
+			if n.URL == "" {
+				return fmt.Errorf("Alert notifier %s has no URL", n.Name)
+			}
+		case NotifierSyslog:
+		default:
+			return fmt.Errorf("Alert notifier %s has unknown type '%s'", n.Name, n.Type)
+		}
+	}
+
+	for i, r := range c.Alerts.Routes {
+		if len(r.Notifiers) == 0 {
+			return fmt.Errorf("Alert route %d has no notifiers", i+1)
+		}
+		for _, name := range r.Notifiers {
+			if !names[name] {
+				return fmt.Errorf("Alert route %d uses unknown notifier %s", i+1, name)
+			}
+		}
+	}
+	return nil
+}
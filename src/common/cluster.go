@@ -0,0 +1,34 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// ClusterLeaseTTL returns how long a scheduler or job lock is held without
+// being renewed. Another instance takes over a lock once it expires.
+func (c *Config) ClusterLeaseTTL() time.Duration {
+	d, _ := time.ParseDuration(c.Cluster.LeaseTTL)
+	return d
+}
+
+func validateCluster(c *Config) error {
+	if c.Cluster.InstanceName == "" {
+		c.Cluster.InstanceName, _ = os.Hostname()
+	}
+	c.Cluster.LeaseTTL = setStringOrDefault(c.Cluster.LeaseTTL, "1m")
+
+	d, err := time.ParseDuration(c.Cluster.LeaseTTL)
+	if err != nil {
+		return fmt.Errorf("Invalid cluster lease TTL: %s", err.Error())
+	}
+	if d < 15*time.Second {
+		return fmt.Errorf("Cluster lease TTL must be at least 15s")
+	}
+	return nil
+}
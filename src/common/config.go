@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -56,6 +57,22 @@ type Config struct {
 		RollingExpirationLength     string
 		DefaultDeviceExpiration     string
 		ManualRegPlatforms          []string
+
+		RandomizedMAC struct {
+			Policy     string
+			Guidance   string
+			Expiration string
+			Rules      []RandomizedMACRule
+		}
+
+		DeviceCategories []DeviceCategory
+
+		Renewal struct {
+			Enabled     bool
+			Window      string
+			MaxRenewals int
+			Modes       []string
+		}
 	}
 	Guest struct {
 		Enabled              bool
@@ -144,7 +161,51 @@ type Config struct {
 		Password    string
 		FromAddress string
 		ToAddresses []string
+		UserDomain  string
+	}
+	ExpirationNotice struct {
+		Enabled    bool
+		Days       []int
+		Subject    string
+		RenewalURL string
+	}
+	LeaseHistory struct {
+		SnapshotInterval string
+		Retention        string
+	}
+	Trash struct {
+		Retention string
 	}
+	Purge struct {
+		DryRun           bool
+		Archive          bool
+		DeviceUnseenFor  string
+		DeviceExpiredFor string
+		UserExpiredFor   string
+	}
+	Cluster struct {
+		InstanceName string
+		LeaseTTL     string
+	}
+	Alerts struct {
+		Notifiers []NotifierConfig
+		Routes    []AlertRoute
+	}
+	Flags struct {
+		Categories []FlagCategory
+	}
+	Webhooks struct {
+		MaxAttempts  int
+		LogRetention string
+		Endpoints    []WebhookEndpoint
+	}
+	Metrics struct {
+		Enabled    bool
+		Token      string
+		AllowedIPs []string
+	}
+	Jobs         map[string]JobConfig
+	CustomFields []CustomField
 }
 
 // FindConfigFile searches for a configuration file. The order of search is
@@ -242,6 +303,20 @@ func setSensibleDefaults(c *Config) (*Config, error) {
 	if _, err := time.ParseDuration(c.Registration.RollingExpirationLength); err != nil {
 		c.Registration.RollingExpirationLength = "4380h"
 	}
+	if c.Registration.DefaultDeviceExpirationType == "term" {
+		if _, err := time.ParseDuration(c.Registration.DefaultDeviceExpiration); err != nil {
+			return nil, errors.New("Registration.DefaultDeviceExpiration must be a duration with the term expiration type")
+		}
+	}
+	if err := validateRandomizedMACPolicy(c); err != nil {
+		return nil, err
+	}
+	if err := validateDeviceCategories(c); err != nil {
+		return nil, err
+	}
+	if err := validateRenewalPolicy(c); err != nil {
+		return nil, err
+	}
 
 	// Guest registrations
 	c.Guest.DeviceExpirationType = setStringOrDefault(c.Guest.DeviceExpirationType, "daily")
@@ -323,6 +398,11 @@ func setSensibleDefaults(c *Config) (*Config, error) {
 		}
 	}
 
+	// Custom fields
+	if err := validateCustomFields(c); err != nil {
+		return nil, err
+	}
+
 	// DHCP
 	c.DHCP.ConfigFile = setStringOrDefault(c.DHCP.ConfigFile, "config/dhcp.conf")
 
@@ -336,9 +416,86 @@ func setSensibleDefaults(c *Config) (*Config, error) {
 		}
 		c.Email.Port = setIntOrDefault(c.Email.Port, 25)
 	}
+
+	// Expiration notices
+	if err := validateExpirationNotice(c); err != nil {
+		return nil, err
+	}
+
+	// Lease history
+	if err := validateLeaseHistory(c); err != nil {
+		return nil, err
+	}
+
+	// Trash
+	if err := validateTrash(c); err != nil {
+		return nil, err
+	}
+
+	// Purge thresholds
+	if err := validatePurge(c); err != nil {
+		return nil, err
+	}
+
+	// Job schedules
+	if err := validateJobs(c); err != nil {
+		return nil, err
+	}
+
+	// Scheduler locks
+	if err := validateCluster(c); err != nil {
+		return nil, err
+	}
+
+	// Flagged device alerts
+	if err := validateAlerts(c); err != nil {
+		return nil, err
+	}
+
+	// Flag categories
+	if err := validateFlags(c); err != nil {
+		return nil, err
+	}
+
+	// Outbound webhooks
+	if err := validateWebhooks(c); err != nil {
+		return nil, err
+	}
+
+	// Metrics scrape access
+	if err := validateMetrics(c); err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
+func validateExpirationNotice(c *Config) error {
+	en := &c.ExpirationNotice
+	if !en.Enabled {
+		return nil
+	}
+	if c.Email.Address == "" {
+		return errors.New("ExpirationNotice requires an Email server")
+	}
+
+	if len(en.Days) == 0 {
+		en.Days = []int{7}
+	}
+	for _, d := range en.Days {
+		if d < 1 {
+			return fmt.Errorf("Invalid expiration notice days %d", d)
+		}
+	}
+	// Notices are checked from the earliest reminder to the last
+	sort.Sort(sort.Reverse(sort.IntSlice(en.Days)))
+
+	en.Subject = setStringOrDefault(en.Subject, "Your registered devices will expire soon")
+	if en.RenewalURL == "" && c.Core.SiteDomainName != "" {
+		en.RenewalURL = "https://" + c.Core.SiteDomainName + "/manage"
+	}
+	return nil
+}
+
 type openIDDiscoveryConfResp struct {
 	AuthorizationEndpoint string   `json:"authorization_endpoint"`
 	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
@@ -0,0 +1,149 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Custom field value types
+const (
+	CustomFieldString = "string"
+	CustomFieldNumber = "number"
+	CustomFieldBool   = "bool"
+	CustomFieldDate   = "date"
+)
+
+// Custom field entities
+const (
+	CustomFieldDevice = "device"
+	CustomFieldUser   = "user"
+)
+
+// Registration forms a custom field may be shown on
+const (
+	RegFormAuto   = "auto"
+	RegFormManual = "manual"
+	RegFormAdmin  = "admin"
+)
+
+// CustomFieldDateFormat is the format used for date custom fields
+const CustomFieldDateFormat = "2006-01-02"
+
+var customFieldNameRegex = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// CustomField is an admin defined attribute that can be attached to a device or user.
+type CustomField struct {
+	Name     string
+	Label    string
+	Type     string
+	Entity   string
+	Required bool
+	Forms    []string
+}
+
+// ShownOn returns if the field should be displayed on the registration form.
+func (f CustomField) ShownOn(form string) bool {
+	return StringInSlice(form, f.Forms)
+}
+
+// Normalize checks value against the field type and returns it in its canonical form.
+func (f CustomField) Normalize(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+
+	switch f.Type {
+	case CustomFieldNumber:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", fmt.Errorf("%s must be a number", f.Label)
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	case CustomFieldBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%s must be true or false", f.Label)
+		}
+		return strconv.FormatBool(b), nil
+	case CustomFieldDate:
+		if _, err := time.Parse(CustomFieldDateFormat, value); err != nil {
+			return "", fmt.Errorf("%s must be a date in YYYY-MM-DD format", f.Label)
+		}
+	}
+	return value, nil
+}
+
+// CustomFieldsFor returns the custom fields defined for an entity type.
+func (c *Config) CustomFieldsFor(entity string) []CustomField {
+	fields := make([]CustomField, 0, len(c.CustomFields))
+	for _, f := range c.CustomFields {
+		if f.Entity == entity {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// CustomFieldsOnForm returns the custom fields for an entity type shown on a registration form.
+func (c *Config) CustomFieldsOnForm(entity, form string) []CustomField {
+	fields := make([]CustomField, 0, len(c.CustomFields))
+	for _, f := range c.CustomFields {
+		if f.Entity == entity && f.ShownOn(form) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// GetCustomField returns the custom field with name for entity.
+func (c *Config) GetCustomField(entity, name string) (CustomField, bool) {
+	for _, f := range c.CustomFields {
+		if f.Entity == entity && f.Name == name {
+			return f, true
+		}
+	}
+	return CustomField{}, false
+}
+
+func validateCustomFields(c *Config) error {
+	seen := make(map[string]bool, len(c.CustomFields))
+
+	for i := range c.CustomFields {
+		f := &c.CustomFields[i]
+		if !customFieldNameRegex.MatchString(f.Name) {
+			return fmt.Errorf("Custom field name '%s' may only contain lowercase letters, numbers, and underscores", f.Name)
+		}
+
+		f.Label = setStringOrDefault(f.Label, f.Name)
+		f.Type = setStringOrDefault(f.Type, CustomFieldString)
+		f.Entity = setStringOrDefault(f.Entity, CustomFieldDevice)
+
+		if !StringInSlice(f.Type, []string{CustomFieldString, CustomFieldNumber, CustomFieldBool, CustomFieldDate}) {
+			return fmt.Errorf("Custom field '%s' has an invalid type '%s'", f.Name, f.Type)
+		}
+		if f.Entity != CustomFieldDevice && f.Entity != CustomFieldUser {
+			return fmt.Errorf("Custom field '%s' has an invalid entity '%s'", f.Name, f.Entity)
+		}
+		for _, form := range f.Forms {
+			if !StringInSlice(form, []string{RegFormAuto, RegFormManual, RegFormAdmin}) {
+				return fmt.Errorf("Custom field '%s' has an invalid form '%s'", f.Name, form)
+			}
+		}
+
+		key := f.Entity + ":" + f.Name
+		if seen[key] {
+			return errors.New("Duplicate custom field " + f.Name)
+		}
+		seen[key] = true
+	}
+	return nil
+}
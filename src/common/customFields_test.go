@@ -0,0 +1,87 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import "testing"
+
+var customFieldNormalizeTests = []struct {
+	fieldType string
+	input     string
+	expected  string
+	err       bool
+}{
+	{CustomFieldString, " room 101 ", "room 101", false},
+	{CustomFieldNumber, "0042", "42", false},
+	{CustomFieldNumber, "1.50", "1.5", false},
+	{CustomFieldNumber, "abc", "", true},
+	{CustomFieldBool, "1", "true", false},
+	{CustomFieldBool, "FALSE", "false", false},
+	{CustomFieldBool, "maybe", "", true},
+	{CustomFieldDate, "2020-02-29", "2020-02-29", false},
+	{CustomFieldDate, "02/29/2020", "", true},
+	{CustomFieldNumber, "", "", false},
+}
+
+func TestCustomFieldNormalize(t *testing.T) {
+	for _, test := range customFieldNormalizeTests {
+		f := CustomField{Name: "test", Label: "Test", Type: test.fieldType}
+		out, err := f.Normalize(test.input)
+		if test.err {
+			if err == nil {
+				t.Errorf("Normalize(%q) as %s expected an error", test.input, test.fieldType)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Normalize(%q) as %s returned error %s", test.input, test.fieldType, err)
+			continue
+		}
+		if out != test.expected {
+			t.Errorf("Normalize(%q) as %s: expected %q, got %q", test.input, test.fieldType, test.expected, out)
+		}
+	}
+}
+
+func TestValidateCustomFields(t *testing.T) {
+	c := &Config{
+		CustomFields: []CustomField{
+			{Name: "asset_tag"},
+			{Name: "student_id", Entity: CustomFieldUser, Type: CustomFieldNumber, Forms: []string{RegFormAuto}},
+		},
+	}
+
+	if err := validateCustomFields(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if f := c.CustomFields[0]; f.Label != "asset_tag" || f.Type != CustomFieldString || f.Entity != CustomFieldDevice {
+		t.Errorf("Defaults not applied: %#v", f)
+	}
+
+	if len(c.CustomFieldsOnForm(CustomFieldUser, RegFormAuto)) != 1 {
+		t.Error("Expected one user field on the auto registration form")
+	}
+	if len(c.CustomFieldsOnForm(CustomFieldDevice, RegFormAuto)) != 0 {
+		t.Error("Expected no device fields on the auto registration form")
+	}
+
+	bad := []CustomField{
+		{Name: "Asset Tag"},
+		{Name: "tag", Type: "list"},
+		{Name: "tag", Entity: "lease"},
+		{Name: "tag", Forms: []string{"guest"}},
+	}
+	for _, f := range bad {
+		c := &Config{CustomFields: []CustomField{f}}
+		if err := validateCustomFields(c); err == nil {
+			t.Errorf("Expected error for field %#v", f)
+		}
+	}
+
+	c = &Config{CustomFields: []CustomField{{Name: "tag"}, {Name: "tag"}}}
+	if err := validateCustomFields(c); err == nil {
+		t.Error("Expected error for duplicate fields")
+	}
+}
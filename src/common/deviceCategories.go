@@ -0,0 +1,99 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var deviceCategoryNameRegex = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// DeviceCategory groups platforms together for device limits. A category
+// without platforms catches every platform not in another category.
+// GroupLimits overrides Limit for users in a UI group. A limit of 0 is unlimited.
+type DeviceCategory struct {
+	Name        string
+	Platforms   []string
+	Limit       int
+	GroupLimits map[string]int
+}
+
+// LimitFor returns the category limit for a user in the UI group uiGroup.
+func (c DeviceCategory) LimitFor(uiGroup string) int {
+	if limit, ok := c.GroupLimits[uiGroup]; ok {
+		return limit
+	}
+	return c.Limit
+}
+
+// PlatformMatches returns if platform is name or a version of name.
+// Detected platforms include a version such as "Android (11)" or "Windows 10"
+// while configuration only names the platform.
+func PlatformMatches(platform, name string) bool {
+	if len(platform) < len(name) || !strings.EqualFold(platform[:len(name)], name) {
+		return false
+	}
+	return len(platform) == len(name) || platform[len(name)] == ' '
+}
+
+// DeviceCategoryFor returns the device category of platform. If no category
+// matches and there's no catch-all category, ok is false.
+func (c *Config) DeviceCategoryFor(platform string) (category DeviceCategory, ok bool) {
+	for _, cat := range c.Registration.DeviceCategories {
+		if len(cat.Platforms) == 0 {
+			category, ok = cat, true
+			continue
+		}
+		for _, p := range cat.Platforms {
+			if PlatformMatches(platform, p) {
+				return cat, true
+			}
+		}
+	}
+	return category, ok
+}
+
+// DeviceCategory returns the device category named name.
+func (c *Config) DeviceCategory(name string) (DeviceCategory, bool) {
+	for _, cat := range c.Registration.DeviceCategories {
+		if cat.Name == name {
+			return cat, true
+		}
+	}
+	return DeviceCategory{}, false
+}
+
+func validateDeviceCategories(c *Config) error {
+	catchAll := ""
+	seen := make(map[string]bool)
+	for _, cat := range c.Registration.DeviceCategories {
+		if !deviceCategoryNameRegex.MatchString(cat.Name) {
+			return fmt.Errorf("Invalid device category name '%s'", cat.Name)
+		}
+		if seen[cat.Name] {
+			return fmt.Errorf("Duplicate device category '%s'", cat.Name)
+		}
+		seen[cat.Name] = true
+
+		if len(cat.Platforms) == 0 {
+			if catchAll != "" {
+				return fmt.Errorf("Device categories '%s' and '%s' both have no platforms", catchAll, cat.Name)
+			}
+			catchAll = cat.Name
+		}
+
+		if cat.Limit < 0 {
+			return fmt.Errorf("Device category '%s' has a negative limit", cat.Name)
+		}
+		for group, limit := range cat.GroupLimits {
+			if limit < 0 {
+				return fmt.Errorf("Device category '%s' has a negative limit for group '%s'", cat.Name, group)
+			}
+		}
+	}
+	return nil
+}
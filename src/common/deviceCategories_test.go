@@ -0,0 +1,66 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import "testing"
+
+func TestDeviceCategoryFor(t *testing.T) {
+	c := &Config{}
+	c.Registration.DeviceCategories = []DeviceCategory{
+		{Name: "phones", Platforms: []string{"iPhone", "Android"}, Limit: 3, GroupLimits: map[string]int{"helpdesk": 0}},
+		{Name: "other", Limit: 5},
+		{Name: "computers", Platforms: []string{"Windows", "macOS"}, Limit: 2},
+	}
+	if err := validateDeviceCategories(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	tests := map[string]string{
+		"iPhone":           "phones",
+		"android (11)":     "phones",
+		"Windows 10":       "computers",
+		"macOS (10.15)":    "computers",
+		"Windowsphone":     "other",
+		"Kindle":           "other",
+		"":                 "other",
+		"Ubuntu (Focal)":   "other",
+		"iPhone (16.1.2)":  "phones",
+		"macOS Big Sur(1)": "computers",
+	}
+	for platform, expected := range tests {
+		cat, ok := c.DeviceCategoryFor(platform)
+		if !ok || cat.Name != expected {
+			t.Errorf("DeviceCategoryFor(%q): expected %s, got %s", platform, expected, cat.Name)
+		}
+	}
+
+	phones, _ := c.DeviceCategory("phones")
+	if phones.LimitFor("default") != 3 || phones.LimitFor("helpdesk") != 0 {
+		t.Errorf("Wrong group limits for phones: %d, %d", phones.LimitFor("default"), phones.LimitFor("helpdesk"))
+	}
+
+	c.Registration.DeviceCategories = c.Registration.DeviceCategories[:1]
+	if _, ok := c.DeviceCategoryFor("Kindle"); ok {
+		t.Error("Expected no category without a catch-all")
+	}
+}
+
+func TestValidateDeviceCategories(t *testing.T) {
+	invalid := [][]DeviceCategory{
+		{{Name: "Phones"}},
+		{{Name: "phones", Platforms: []string{"iPhone"}}, {Name: "phones", Platforms: []string{"Android"}}},
+		{{Name: "other"}, {Name: "misc"}},
+		{{Name: "phones", Limit: -1}},
+		{{Name: "phones", GroupLimits: map[string]int{"default": -2}}},
+	}
+
+	for i, categories := range invalid {
+		c := &Config{}
+		c.Registration.DeviceCategories = categories
+		if err := validateDeviceCategories(c); err == nil {
+			t.Errorf("Case %d: expected error", i)
+		}
+	}
+}
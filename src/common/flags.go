@@ -0,0 +1,91 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// FlagCategory is a kind of flag set on a device such as stolen or
+// compromised. Flags in a silent category never alert. Notifiers replaces the
+// alert routes for devices in the category. ClearAfter is the default time
+// until a flag in the category is cleared, empty keeps flags until they're
+// removed.
+type FlagCategory struct {
+	Name        string
+	Description string
+	Silent      bool
+	Notifiers   []string
+	ClearAfter  string
+}
+
+// ClearAfterDuration returns how long a new flag in the category lasts. Zero
+// means the flag doesn't clear on its own.
+func (f FlagCategory) ClearAfterDuration() time.Duration {
+	d, _ := time.ParseDuration(f.ClearAfter)
+	return d
+}
+
+var defaultFlagCategories = []FlagCategory{
+	{Name: "stolen", Description: "Reported stolen"},
+	{Name: "compromised", Description: "Compromised or infected"},
+	{Name: "investigation", Description: "Under investigation"},
+	{Name: "other", Description: "Other"},
+}
+
+// DefaultFlagCategory is used when a device is flagged without a category.
+const DefaultFlagCategory = "other"
+
+// FlagCategory returns the flag category named name.
+func (c *Config) FlagCategory(name string) (FlagCategory, bool) {
+	for _, cat := range c.Flags.Categories {
+		if cat.Name == name {
+			return cat, true
+		}
+	}
+	return FlagCategory{}, false
+}
+
+func validateFlags(c *Config) error {
+	if len(c.Flags.Categories) == 0 {
+		c.Flags.Categories = append([]FlagCategory(nil), defaultFlagCategories...)
+	}
+
+	notifiers := make(map[string]bool, len(c.Alerts.Notifiers))
+	for _, n := range c.Alerts.Notifiers {
+		notifiers[n.Name] = true
+	}
+
+	seen := make(map[string]bool)
+	for i, cat := range c.Flags.Categories {
+		if !deviceCategoryNameRegex.MatchString(cat.Name) {
+			return fmt.Errorf("Invalid flag category name '%s'", cat.Name)
+		}
+		if seen[cat.Name] {
+			return fmt.Errorf("Duplicate flag category '%s'", cat.Name)
+		}
+		seen[cat.Name] = true
+
+		c.Flags.Categories[i].Description = setStringOrDefault(cat.Description, cat.Name)
+
+		if cat.ClearAfter != "" {
+			d, err := time.ParseDuration(cat.ClearAfter)
+			if err != nil {
+				return fmt.Errorf("Invalid clearAfter for flag category '%s': %s", cat.Name, err.Error())
+			}
+			if d < 0 {
+				return fmt.Errorf("Flag category '%s' clearAfter can't be negative", cat.Name)
+			}
+		}
+
+		for _, name := range cat.Notifiers {
+			if !notifiers[name] {
+				return fmt.Errorf("Flag category '%s' uses unknown notifier %s", cat.Name, name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateFlags(t *testing.T) {
+	c := &Config{}
+	if err := validateFlags(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, ok := c.FlagCategory("stolen"); !ok || len(c.Flags.Categories) != len(defaultFlagCategories) {
+		t.Errorf("Expected default categories, got %v", c.Flags.Categories)
+	}
+
+	c = &Config{}
+	c.Alerts.Notifiers = []NotifierConfig{{Name: "security", Type: NotifierSyslog}}
+	c.Flags.Categories = []FlagCategory{
+		{Name: "stolen", Notifiers: []string{"security"}},
+		{Name: "investigation", Silent: true, ClearAfter: "72h"},
+	}
+	if err := validateFlags(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	cat, _ := c.FlagCategory("investigation")
+	if cat.ClearAfterDuration() != 72*time.Hour || cat.Description != "investigation" {
+		t.Errorf("Wrong investigation category: %#v", cat)
+	}
+	if _, ok := c.FlagCategory("other"); ok {
+		t.Error("Expected configured categories to replace the defaults")
+	}
+
+	invalid := [][]FlagCategory{
+		{{Name: "Stolen"}},
+		{{Name: "stolen"}, {Name: "stolen"}},
+		{{Name: "stolen", ClearAfter: "soon"}},
+		{{Name: "stolen", ClearAfter: "-1h"}},
+		{{Name: "stolen", Notifiers: []string{"pager"}}},
+	}
+	for i, categories := range invalid {
+		c := &Config{}
+		c.Flags.Categories = categories
+		if err := validateFlags(c); err == nil {
+			t.Errorf("Case %d: expected error", i)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"fmt"
+
+	"github.com/packet-guardian/packet-guardian/src/cron"
+)
+
+// JobConfig overrides the schedule of a scheduled job. Jobs are configured by
+// name in the [jobs] table.
+type JobConfig struct {
+	Schedule string
+	Disabled bool
+}
+
+func validateJobs(c *Config) error {
+	for name, job := range c.Jobs {
+		if job.Schedule == "" {
+			continue
+		}
+		if _, err := cron.Parse(job.Schedule); err != nil {
+			return fmt.Errorf("Job %s: %s", name, err.Error())
+		}
+	}
+	return nil
+}
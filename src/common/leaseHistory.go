@@ -0,0 +1,47 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// LeaseSnapshotInterval returns how often the lease table is copied to the
+// lease history.
+func (c *Config) LeaseSnapshotInterval() time.Duration {
+	d, _ := time.ParseDuration(c.LeaseHistory.SnapshotInterval)
+	return d
+}
+
+// LeaseHistoryRetention returns how long lease history is kept after a lease
+// ends. A zero duration means history is kept forever.
+func (c *Config) LeaseHistoryRetention() time.Duration {
+	d, _ := time.ParseDuration(c.LeaseHistory.Retention)
+	return d
+}
+
+func validateLeaseHistory(c *Config) error {
+	h := &c.LeaseHistory
+	h.SnapshotInterval = setStringOrDefault(h.SnapshotInterval, "5m")
+	h.Retention = setStringOrDefault(h.Retention, "8760h")
+
+	d, err := time.ParseDuration(h.SnapshotInterval)
+	if err != nil {
+		return fmt.Errorf("Invalid lease snapshot interval: %s", err.Error())
+	}
+	if d < time.Minute {
+		return fmt.Errorf("Lease snapshot interval must be at least 1m")
+	}
+
+	d, err = time.ParseDuration(h.Retention)
+	if err != nil {
+		return fmt.Errorf("Invalid lease history retention: %s", err.Error())
+	}
+	if d < 0 {
+		return fmt.Errorf("Lease history retention can't be negative")
+	}
+	return nil
+}
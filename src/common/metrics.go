@@ -0,0 +1,61 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// MetricsAllowed returns if a scrape from ip is in the metrics allowlist.
+func (c *Config) MetricsAllowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, allowed := range c.Metrics.AllowedIPs {
+		if n := parseAllowedNet(allowed); n != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAllowedNet parses a CIDR network or a single IP address.
+func parseAllowedNet(s string) *net.IPNet {
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil
+		}
+		return n
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+func validateMetrics(c *Config) error {
+	if !c.Metrics.Enabled {
+		return nil
+	}
+
+	for _, allowed := range c.Metrics.AllowedIPs {
+		if parseAllowedNet(allowed) == nil {
+			return fmt.Errorf("Invalid metrics allowed IP '%s'", allowed)
+		}
+	}
+
+	if c.Metrics.Token == "" && len(c.Metrics.AllowedIPs) == 0 {
+		return fmt.Errorf("Metrics requires a token or allowed IPs")
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"net"
+	"testing"
+)
+
+func TestValidateMetrics(t *testing.T) {
+	c := &Config{}
+	c.Metrics.Enabled = true
+	if err := validateMetrics(c); err == nil {
+		t.Error("Expected error without a token or allowed IPs")
+	}
+
+	c.Metrics.AllowedIPs = []string{"10.0.0.0/8", "192.168.1.5", "::1", "not-an-ip"}
+	if err := validateMetrics(c); err == nil {
+		t.Error("Expected error for an invalid allowed IP")
+	}
+
+	c.Metrics.AllowedIPs = c.Metrics.AllowedIPs[:3]
+	if err := validateMetrics(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	for ip, expected := range map[string]bool{
+		"10.20.30.40": true,
+		"192.168.1.5": true,
+		"192.168.1.6": false,
+		"::1":         true,
+	} {
+		if allowed := c.MetricsAllowed(net.ParseIP(ip)); allowed != expected {
+			t.Errorf("%s: expected %t, got %t", ip, expected, allowed)
+		}
+	}
+}
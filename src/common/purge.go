@@ -0,0 +1,52 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// PurgeDeviceUnseenFor returns how long a device can go unseen before the
+// purge job moves it to the trash. Zero disables purging unseen devices.
+func (c *Config) PurgeDeviceUnseenFor() time.Duration {
+	d, _ := time.ParseDuration(c.Purge.DeviceUnseenFor)
+	return d
+}
+
+// PurgeDeviceExpiredFor returns how long after a device expires the purge
+// job moves it to the trash.
+func (c *Config) PurgeDeviceExpiredFor() time.Duration {
+	d, _ := time.ParseDuration(c.Purge.DeviceExpiredFor)
+	return d
+}
+
+// PurgeUserExpiredFor returns how long after a user expires the purge job
+// moves it to the trash.
+func (c *Config) PurgeUserExpiredFor() time.Duration {
+	d, _ := time.ParseDuration(c.Purge.UserExpiredFor)
+	return d
+}
+
+func validatePurge(c *Config) error {
+	c.Purge.DeviceUnseenFor = setStringOrDefault(c.Purge.DeviceUnseenFor, c.Registration.RollingExpirationLength)
+	c.Purge.DeviceExpiredFor = setStringOrDefault(c.Purge.DeviceExpiredFor, "0")
+	c.Purge.UserExpiredFor = setStringOrDefault(c.Purge.UserExpiredFor, "168h")
+
+	for name, value := range map[string]string{
+		"deviceUnseenFor":  c.Purge.DeviceUnseenFor,
+		"deviceExpiredFor": c.Purge.DeviceExpiredFor,
+		"userExpiredFor":   c.Purge.UserExpiredFor,
+	} {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("Invalid purge %s: %s", name, err.Error())
+		}
+		if d < 0 {
+			return fmt.Errorf("Purge %s can't be negative", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Policies applied when registering a device with a randomized MAC address
+const (
+	RandomizedMACAllow  = "allow"
+	RandomizedMACWarn   = "warn"
+	RandomizedMACReject = "reject"
+)
+
+const defaultRandomizedMACGuidance = "This device is using a private (randomized) MAC address which may change. " +
+	"Please turn off the private address setting for this network, reconnect, and register again."
+
+// RandomizedMACRule applies a policy to randomized MAC registrations for
+// a set of platforms and networks. An empty list matches everything.
+type RandomizedMACRule struct {
+	Policy    string
+	Platforms []string
+	Networks  []string
+}
+
+func (r RandomizedMACRule) matches(platform, network string) bool {
+	return matchesPlatform(platform, r.Platforms) && matchesFold(network, r.Networks)
+}
+
+func matchesPlatform(platform string, list []string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if PlatformMatches(platform, item) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesFold(s string, list []string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if strings.EqualFold(s, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLocallyAdministered returns if the locally administered bit is set in mac.
+// Devices using randomized MAC addresses set this bit.
+func IsLocallyAdministered(mac net.HardwareAddr) bool {
+	return len(mac) > 0 && mac[0]&0x02 == 0x02
+}
+
+// RandomizedMACPolicy returns the policy for a randomized MAC registration
+// for platform on network. The first matching rule is used, otherwise the
+// default policy applies.
+func (c *Config) RandomizedMACPolicy(platform, network string) string {
+	for _, rule := range c.Registration.RandomizedMAC.Rules {
+		if rule.matches(platform, network) {
+			return rule.Policy
+		}
+	}
+	return c.Registration.RandomizedMAC.Policy
+}
+
+func validateRandomizedMACPolicy(c *Config) error {
+	policies := []string{RandomizedMACAllow, RandomizedMACWarn, RandomizedMACReject}
+	rm := &c.Registration.RandomizedMAC
+
+	rm.Policy = setStringOrDefault(rm.Policy, RandomizedMACAllow)
+	rm.Guidance = setStringOrDefault(rm.Guidance, defaultRandomizedMACGuidance)
+
+	if !StringInSlice(rm.Policy, policies) {
+		return fmt.Errorf("Invalid randomized MAC policy '%s'", rm.Policy)
+	}
+	for _, rule := range rm.Rules {
+		if !StringInSlice(rule.Policy, policies) {
+			return fmt.Errorf("Invalid randomized MAC policy '%s'", rule.Policy)
+		}
+	}
+
+	if rm.Expiration != "" {
+		if _, err := time.ParseDuration(rm.Expiration); err != nil {
+			return fmt.Errorf("Invalid randomized MAC expiration: %s", err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsLocallyAdministered(t *testing.T) {
+	tests := map[string]bool{
+		"12:34:56:78:9a:bc": true,
+		"da:a1:19:00:00:01": true,
+		"00:1b:63:84:45:e6": false,
+		"f0:18:98:00:00:01": false,
+	}
+
+	for macStr, expected := range tests {
+		mac, _ := net.ParseMAC(macStr)
+		if IsLocallyAdministered(mac) != expected {
+			t.Errorf("IsLocallyAdministered(%s): expected %t", macStr, expected)
+		}
+	}
+}
+
+func TestRandomizedMACPolicy(t *testing.T) {
+	c := &Config{}
+	c.Registration.RandomizedMAC.Rules = []RandomizedMACRule{
+		{Policy: RandomizedMACReject, Platforms: []string{"iPhone"}, Networks: []string{"Dorms"}},
+		{Policy: RandomizedMACWarn, Networks: []string{"dorms"}},
+	}
+	if err := validateRandomizedMACPolicy(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		platform, network, expected string
+	}{
+		{"iPhone", "Dorms", RandomizedMACReject},
+		{"iPhone (16.1)", "Dorms", RandomizedMACReject},
+		{"Android", "Dorms", RandomizedMACWarn},
+		{"iPhone", "Library", RandomizedMACAllow},
+		{"", "", RandomizedMACAllow},
+	}
+
+	for _, test := range tests {
+		if p := c.RandomizedMACPolicy(test.platform, test.network); p != test.expected {
+			t.Errorf("RandomizedMACPolicy(%s, %s): expected %s, got %s", test.platform, test.network, test.expected, p)
+		}
+	}
+
+	c.Registration.RandomizedMAC.Policy = "block"
+	if err := validateRandomizedMACPolicy(c); err == nil {
+		t.Error("Expected error for invalid policy")
+	}
+}
@@ -0,0 +1,43 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// RenewalModes are the expiration modes a renewal policy may allow. They're
+// named the same as the default device expiration types.
+var RenewalModes = []string{"date", "duration", "daily", "term"}
+
+// RenewalWindow returns how long before a device expires it can be renewed.
+// A zero duration means there's no limit.
+func (c *Config) RenewalWindow() time.Duration {
+	d, _ := time.ParseDuration(c.Registration.Renewal.Window)
+	return d
+}
+
+func validateRenewalPolicy(c *Config) error {
+	r := &c.Registration.Renewal
+	if r.Modes == nil {
+		r.Modes = []string{"duration", "daily"}
+	}
+	for _, mode := range r.Modes {
+		if !StringInSlice(mode, RenewalModes) {
+			return fmt.Errorf("Invalid renewal expiration mode '%s'", mode)
+		}
+	}
+
+	if r.Window != "" {
+		if _, err := time.ParseDuration(r.Window); err != nil {
+			return fmt.Errorf("Invalid renewal window: %s", err.Error())
+		}
+	}
+	if r.MaxRenewals < 0 {
+		return fmt.Errorf("Invalid maximum renewals %d", r.MaxRenewals)
+	}
+	return nil
+}
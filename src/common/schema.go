@@ -9,11 +9,27 @@ var (
 	DatabaseTableNames = []string{
 		"blacklist",
 		"device",
+		"device_archive",
+		"device_event",
+		"device_notice",
+		"device_transfer",
+		"device_trash",
+		"flagged_alert",
+		"job_run",
 		"lease",
 		"lease_history",
+		"lease_log",
+		"note",
+		"policy",
+		"policy_acceptance",
 		"sessions",
 		"settings",
+		"task_lock",
+		"term",
 		"user",
+		"user_archive",
+		"user_trash",
+		"webhook_delivery",
 	}
 
 	BlacklistTableCols = []string{
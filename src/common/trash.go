@@ -0,0 +1,30 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// TrashRetention returns how long deleted devices and users are kept in the
+// trash. A zero duration means they're kept until restored.
+func (c *Config) TrashRetention() time.Duration {
+	d, _ := time.ParseDuration(c.Trash.Retention)
+	return d
+}
+
+func validateTrash(c *Config) error {
+	c.Trash.Retention = setStringOrDefault(c.Trash.Retention, "720h")
+
+	d, err := time.ParseDuration(c.Trash.Retention)
+	if err != nil {
+		return fmt.Errorf("Invalid trash retention: %s", err.Error())
+	}
+	if d < 0 {
+		return fmt.Errorf("Trash retention can't be negative")
+	}
+	return nil
+}
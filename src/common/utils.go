@@ -8,6 +8,7 @@ import (
 	"bufio"
 	"errors"
 	"html/template"
+	"io"
 	"net"
 	"os"
 	"strconv"
@@ -88,25 +89,12 @@ func ParseTime(time string) (int64, error) {
 	return int64((hours * secondsInHour) + (minutes * secondsInMinute)), nil
 }
 
-var policyText []template.HTML
-
-// LoadPolicyText loads a file and wraps it in a template type to ensure
-// custom HTML is allowed. The file should be secured so unauthorized
-// HTML/JS isn't allowed.
-func LoadPolicyText(file string) []template.HTML {
-	if policyText != nil {
-		return policyText
-	}
-
-	f, err := os.Open(file)
-	if err != nil {
-		return nil
-	}
-	defer f.Close()
-
+// ParsePolicyText splits policy text into paragraphs separated by blank lines.
+// The paragraphs are not escaped so the text must come from a trusted source.
+func ParsePolicyText(r io.Reader) []template.HTML {
 	var policy []template.HTML
 	currentParagraph := ""
-	scanner := bufio.NewScanner(f)
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		t := strings.TrimSpace(scanner.Text())
 		if t == "" {
@@ -116,8 +104,7 @@ func LoadPolicyText(file string) []template.HTML {
 		}
 		currentParagraph += " " + t
 	}
-	policyText = append(policy, template.HTML(currentParagraph))
-	return policyText
+	return append(policy, template.HTML(currentParagraph))
 }
 
 func StringSliceEqual(a, b []string) bool {
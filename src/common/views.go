@@ -185,6 +185,11 @@ func (v *Views) NewView(file string, r *http.Request) *View {
 	}
 }
 
+// TemplateCount returns the number of loaded page templates.
+func (v *Views) TemplateCount() int {
+	return len(v.templates)
+}
+
 // InjectData will always inject a specific key, value pair into every template
 func (v *Views) InjectData(key string, val interface{}) {
 	v.injectedData[key] = val
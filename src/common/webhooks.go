@@ -0,0 +1,103 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Webhook events
+const (
+	WebhookDeviceRegistered    = "device.registered"
+	WebhookDeviceDeleted       = "device.deleted"
+	WebhookDeviceReassigned    = "device.reassigned"
+	WebhookDeviceBlacklisted   = "device.blacklisted"
+	WebhookDeviceUnblacklisted = "device.unblacklisted"
+	WebhookDeviceFlagged       = "device.flagged"
+	WebhookDeviceUnflagged     = "device.unflagged"
+	WebhookDeviceExpired       = "device.expired"
+)
+
+// WebhookEvents are the events webhook endpoints can subscribe to.
+var WebhookEvents = []string{
+	WebhookDeviceRegistered,
+	WebhookDeviceDeleted,
+	WebhookDeviceReassigned,
+	WebhookDeviceBlacklisted,
+	WebhookDeviceUnblacklisted,
+	WebhookDeviceFlagged,
+	WebhookDeviceUnflagged,
+	WebhookDeviceExpired,
+}
+
+// WebhookEndpoint receives a signed JSON POST for each event it subscribes
+// to. An endpoint without events subscribes to every event. Payloads aren't
+// signed if Secret is empty.
+type WebhookEndpoint struct {
+	Name   string
+	URL    string
+	Secret string
+	Events []string
+}
+
+// Subscribes returns if the endpoint receives event.
+func (w WebhookEndpoint) Subscribes(event string) bool {
+	return len(w.Events) == 0 || StringInSlice(event, w.Events)
+}
+
+// WebhookEndpoint returns the webhook endpoint named name.
+func (c *Config) WebhookEndpoint(name string) (WebhookEndpoint, bool) {
+	for _, ep := range c.Webhooks.Endpoints {
+		if ep.Name == name {
+			return ep, true
+		}
+	}
+	return WebhookEndpoint{}, false
+}
+
+// WebhookLogRetention returns how long finished webhook deliveries are kept.
+func (c *Config) WebhookLogRetention() time.Duration {
+	d, _ := time.ParseDuration(c.Webhooks.LogRetention)
+	return d
+}
+
+func validateWebhooks(c *Config) error {
+	c.Webhooks.MaxAttempts = setIntOrDefault(c.Webhooks.MaxAttempts, 8)
+	c.Webhooks.LogRetention = setStringOrDefault(c.Webhooks.LogRetention, "720h")
+
+	if c.Webhooks.MaxAttempts < 1 {
+		return fmt.Errorf("Webhook maxAttempts must be at least 1")
+	}
+	if d, err := time.ParseDuration(c.Webhooks.LogRetention); err != nil {
+		return fmt.Errorf("Invalid webhook logRetention: %s", err.Error())
+	} else if d <= 0 {
+		return fmt.Errorf("Webhook logRetention must be positive")
+	}
+
+	names := make(map[string]bool, len(c.Webhooks.Endpoints))
+	for _, ep := range c.Webhooks.Endpoints {
+		if ep.Name == "" {
+			return fmt.Errorf("Webhook endpoints must have a name")
+		}
+		if names[ep.Name] {
+			return fmt.Errorf("Webhook endpoint %s is defined twice", ep.Name)
+		}
+		names[ep.Name] = true
+
+		u, err := url.Parse(ep.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Webhook endpoint %s has an invalid URL", ep.Name)
+		}
+
+		for _, event := range ep.Events {
+			if !StringInSlice(event, WebhookEvents) {
+				return fmt.Errorf("Webhook endpoint %s has unknown event '%s'", ep.Name, event)
+			}
+		}
+	}
+	return nil
+}
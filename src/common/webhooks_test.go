@@ -0,0 +1,45 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateWebhooks(t *testing.T) {
+	c := &Config{}
+	c.Webhooks.Endpoints = []WebhookEndpoint{
+		{Name: "all", URL: "https://example.com/hook"},
+		{Name: "flags", URL: "http://example.com/flags", Events: []string{WebhookDeviceFlagged}},
+	}
+	if err := validateWebhooks(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if c.Webhooks.MaxAttempts != 8 || c.WebhookLogRetention() != 720*time.Hour {
+		t.Errorf("Expected defaults, got %d attempts and %s retention", c.Webhooks.MaxAttempts, c.Webhooks.LogRetention)
+	}
+
+	all, _ := c.WebhookEndpoint("all")
+	flags, _ := c.WebhookEndpoint("flags")
+	if !all.Subscribes(WebhookDeviceDeleted) || flags.Subscribes(WebhookDeviceDeleted) || !flags.Subscribes(WebhookDeviceFlagged) {
+		t.Error("Wrong event subscriptions")
+	}
+
+	invalid := [][]WebhookEndpoint{
+		{{URL: "https://example.com/hook"}},
+		{{Name: "a", URL: "https://example.com/a"}, {Name: "a", URL: "https://example.com/b"}},
+		{{Name: "a", URL: "ftp://example.com/a"}},
+		{{Name: "a", URL: "example.com/a"}},
+		{{Name: "a", URL: "https://example.com/a", Events: []string{"device.stolen"}}},
+	}
+	for i, endpoints := range invalid {
+		c := &Config{}
+		c.Webhooks.Endpoints = endpoints
+		if err := validateWebhooks(c); err == nil {
+			t.Errorf("Case %d: expected error", i)
+		}
+	}
+}
@@ -5,12 +5,14 @@
 package controllers
 
 import (
-	"encoding/csv"
+	"bytes"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
@@ -20,11 +22,17 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/lfkeitel/verbose/v4"
 	dhcp "github.com/packet-guardian/dhcp-lib"
+	"github.com/packet-guardian/packet-guardian/src/attribution"
+	"github.com/packet-guardian/packet-guardian/src/bindata"
 	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/exporter"
+	"github.com/packet-guardian/packet-guardian/src/importer"
 	"github.com/packet-guardian/packet-guardian/src/models"
 	"github.com/packet-guardian/packet-guardian/src/models/stores"
+	"github.com/packet-guardian/packet-guardian/src/oui"
 	"github.com/packet-guardian/packet-guardian/src/reports"
 	"github.com/packet-guardian/packet-guardian/src/stats"
+	"github.com/packet-guardian/packet-guardian/src/tasks"
 )
 
 var (
@@ -115,6 +123,23 @@ func (a *Admin) ManageHandler(w http.ResponseWriter, r *http.Request, p httprout
 		pageEnd = deviceCnt
 	}
 
+	incoming, err := a.stores.Transfers.GetPendingTransfersToUser(user.Username)
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:admin",
+			"username": user.Username,
+		}).Error("Error getting device transfers")
+	}
+	outgoing, err := a.stores.Transfers.GetPendingTransfersFromUser(user.Username)
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:admin",
+			"username": user.Username,
+		}).Error("Error getting device transfers")
+	}
+
 	data := map[string]interface{}{
 		"user":          user,
 		"devices":       results,
@@ -126,6 +151,12 @@ func (a *Admin) ManageHandler(w http.ResponseWriter, r *http.Request, p httprout
 		"pageStart":     ((pageNum - 1) * common.PageSize) + 1,
 		"pageEnd":       pageEnd,
 		"canEditDevice": sessionUser.Can(models.EditDevice),
+		"userFields":    a.e.Config.CustomFieldsFor(common.CustomFieldUser),
+
+		"currentUser":        user.Username,
+		"incomingTransfers":  incoming,
+		"outgoingTransfers":  outgoing,
+		"canRespondTransfer": sessionUser.Username == user.Username,
 	}
 
 	a.e.Views.NewView("admin-manage", r).Render(w, data)
@@ -168,9 +199,41 @@ func (a *Admin) ShowDeviceHandler(w http.ResponseWriter, r *http.Request, p http
 		return
 	}
 
+	transfers, err := a.stores.Transfers.GetTransfersForDevice(device.MAC)
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin",
+			"mac":     device.MAC.String(),
+		}).Error("Error getting device transfers")
+	}
+
+	notes, err := a.stores.Notes.GetNotes(models.NoteEntityDevice, device.MAC.String())
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin",
+			"mac":     device.MAC.String(),
+		}).Error("Error getting device notes")
+	}
+
+	events, err := a.stores.DeviceEvents.GetDeviceEvents(device.MAC)
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin",
+			"mac":     device.MAC.String(),
+		}).Error("Error getting device history")
+	}
+
 	data := map[string]interface{}{
-		"user":   user,
-		"device": device,
+		"user":           user,
+		"device":         device,
+		"deviceFields":   a.e.Config.CustomFieldsFor(common.CustomFieldDevice),
+		"flagCategories": a.e.Config.Flags.Categories,
+		"transfers":      transfers,
+		"notes":          notes,
+		"timeline":       models.DeviceTimeline(events, device.Leases),
 	}
 
 	a.e.Views.NewView("admin-manage-device", r).Render(w, data)
@@ -235,10 +298,91 @@ func (a *Admin) search(query string) ([]*searchResults, string, error) {
 		return a.macSearch(query)
 	} else if ipStartRegex.MatchString(query) {
 		return a.ipSearch(query)
+	} else if name, value, found := strings.Cut(query, ":"); found {
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if results, searchType, ok, err := a.attributeSearch(name, value); ok {
+			return results, searchType, err
+		}
+		if strings.EqualFold(name, "vendor") {
+			return a.vendorSearch(value)
+		}
 	}
 	return a.userSearch(query)
 }
 
+// attributeSearch searches custom field values using a query in the form
+// "field:value". The returned bool is false if name isn't a custom field.
+func (a *Admin) attributeSearch(name, value string) ([]*searchResults, string, bool, error) {
+	pattern := models.AttributeSearchPattern(name, value)
+
+	if _, ok := a.e.Config.GetCustomField(common.CustomFieldDevice, name); ok {
+		devices, err := a.stores.Devices.SearchDevicesByField("attributes", pattern)
+		results := make([]*searchResults, len(devices))
+		for i, d := range devices {
+			results[i] = &searchResults{D: d}
+		}
+		return results, "attribute", true, err
+	}
+
+	if _, ok := a.e.Config.GetCustomField(common.CustomFieldUser, name); ok {
+		users, err := a.stores.Users.SearchUsersByField("attributes", pattern)
+		if err != nil {
+			return nil, "attribute", true, err
+		}
+		if len(users) == 1 {
+			return []*searchResults{{U: users[0].Username}}, "user", true, nil
+		}
+
+		var results []*searchResults
+		for _, u := range users {
+			devices, err := a.stores.Devices.GetDevicesForUser(u)
+			if err != nil {
+				return results, "attribute", true, err
+			}
+			for _, d := range devices {
+				results = append(results, &searchResults{D: d})
+			}
+		}
+		return results, "attribute", true, nil
+	}
+	return nil, "", false, nil
+}
+
+// vendorSearch finds devices with a MAC address assigned to a manufacturer
+// whose name contains vendor.
+func (a *Admin) vendorSearch(vendor string) ([]*searchResults, string, error) {
+	prefixes := oui.Prefixes(vendor)
+	if len(prefixes) == 0 {
+		return nil, "vendor", nil
+	}
+
+	// Group prefixes by length so each assignment size is a single IN clause
+	byLength := make(map[int][]interface{})
+	lengths := make([]int, 0, 3)
+	for _, prefix := range prefixes {
+		if _, exists := byLength[len(prefix)]; !exists {
+			lengths = append(lengths, len(prefix))
+		}
+		byLength[len(prefix)] = append(byLength[len(prefix)], prefix)
+	}
+	sort.Ints(lengths)
+
+	clauses := make([]string, 0, len(lengths))
+	args := make([]interface{}, 0, len(prefixes))
+	for _, length := range lengths {
+		group := byLength[length]
+		clauses = append(clauses, fmt.Sprintf(`LEFT("mac", %d) IN (?%s)`, length, strings.Repeat(",?", len(group)-1)))
+		args = append(args, group...)
+	}
+
+	devices, err := a.stores.Devices.Search(`(`+strings.Join(clauses, " OR ")+`) ORDER BY "username", "mac"`, args...)
+	results := make([]*searchResults, len(devices))
+	for i, d := range devices {
+		results[i] = &searchResults{D: d}
+	}
+	return results, "vendor", err
+}
+
 func (a *Admin) macSearch(query string) ([]*searchResults, string, error) {
 	mac, _ := common.FormatMacAddress(query)
 
@@ -343,9 +487,21 @@ func (a *Admin) AdminUserHandler(w http.ResponseWriter, r *http.Request, p httpr
 		}).Error("Error getting user")
 	}
 
+	notes, err := a.stores.Notes.GetNotes(models.NoteEntityUser, user.Username)
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:admin",
+			"username": user.Username,
+		}).Error("Error getting user notes")
+	}
+
 	data := map[string]interface{}{
-		"user":        user,
-		"delegateFor": user.Delegated(),
+		"user":             user,
+		"delegateFor":      user.Delegated(),
+		"userFields":       a.e.Config.CustomFieldsFor(common.CustomFieldUser),
+		"deviceCategories": a.e.Config.Registration.DeviceCategories,
+		"notes":            notes,
 	}
 
 	a.e.Views.NewView("admin-user", r).Render(w, data)
@@ -381,6 +537,563 @@ func (a *Admin) ReportHandler(w http.ResponseWriter, r *http.Request, p httprout
 	a.e.Views.NewView("admin-reports", r).Render(w, data)
 }
 
+// termDateFormat is the format of dates entered on the term calendar page
+const termDateFormat = "2006-01-02"
+
+func (a *Admin) TermsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	if !sessionUser.Can(models.ManageTerms) {
+		a.redirectToRoot(w, r)
+		return
+	}
+	a.renderTerms(w, r)
+}
+
+func (a *Admin) renderTerms(w http.ResponseWriter, r *http.Request) {
+	terms, err := a.stores.Terms.GetTerms()
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin",
+		}).Error("Error getting terms")
+	}
+
+	data := map[string]interface{}{
+		"terms": terms,
+	}
+	a.e.Views.NewView("admin-terms", r).Render(w, data)
+}
+
+// SaveTermHandler adds a term to the calendar. Devices registered before the
+// start of the cutoff date expire at the end of the term's end date.
+func (a *Admin) SaveTermHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	session := common.GetSessionFromContext(r)
+	sessionUser := models.GetUserFromContext(r)
+	if !sessionUser.Can(models.ManageTerms) {
+		a.redirectToRoot(w, r)
+		return
+	}
+
+	term := models.NewTerm(a.stores.Terms)
+	term.Name = strings.TrimSpace(r.FormValue("name"))
+
+	end, err := time.ParseInLocation(termDateFormat, r.FormValue("end"), time.Local)
+	if err != nil {
+		session.AddFlash(common.FlashMessage{
+			Message: "Invalid term end date",
+			Type:    common.FlashMessageError,
+		})
+		a.renderTerms(w, r)
+		return
+	}
+	term.End = end.AddDate(0, 0, 1).Add(-time.Second)
+
+	if cutoff := r.FormValue("cutoff"); cutoff != "" {
+		term.Cutoff, err = time.ParseInLocation(termDateFormat, cutoff, time.Local)
+		if err != nil || !term.Cutoff.Before(term.End) {
+			session.AddFlash(common.FlashMessage{
+				Message: "Cutoff date must be a date before the end of the term",
+				Type:    common.FlashMessageError,
+			})
+			a.renderTerms(w, r)
+			return
+		}
+	}
+
+	if err := term.Save(); err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin",
+		}).Error("Error saving term")
+		session.AddFlash(common.FlashMessage{
+			Message: "Error saving term: " + err.Error(),
+			Type:    common.FlashMessageError,
+		})
+		a.renderTerms(w, r)
+		return
+	}
+
+	a.e.Log.WithFields(verbose.Fields{
+		"package":    "controllers:admin",
+		"changed-by": sessionUser.Username,
+		"term":       term.Name,
+		"end":        term.End.Format(common.TimeFormat),
+		"action":     "add_term",
+	}).Info("Term added")
+
+	session.AddFlash(common.FlashMessage{Message: "Term added"})
+	a.renderTerms(w, r)
+}
+
+func (a *Admin) DeleteTermHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	session := common.GetSessionFromContext(r)
+	sessionUser := models.GetUserFromContext(r)
+	if !sessionUser.Can(models.ManageTerms) {
+		a.redirectToRoot(w, r)
+		return
+	}
+
+	id, _ := strconv.Atoi(p.ByName("id"))
+	term, err := a.stores.Terms.GetTermByID(id)
+	if err != nil || term.ID == 0 {
+		session.AddFlash(common.FlashMessage{
+			Message: "Term not found",
+			Type:    common.FlashMessageError,
+		})
+		a.renderTerms(w, r)
+		return
+	}
+
+	if err := term.Delete(); err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin",
+		}).Error("Error deleting term")
+		session.AddFlash(common.FlashMessage{
+			Message: "Error deleting term",
+			Type:    common.FlashMessageError,
+		})
+		a.renderTerms(w, r)
+		return
+	}
+
+	a.e.Log.WithFields(verbose.Fields{
+		"package":    "controllers:admin",
+		"changed-by": sessionUser.Username,
+		"term":       term.Name,
+		"action":     "delete_term",
+	}).Info("Term deleted")
+
+	session.AddFlash(common.FlashMessage{Message: "Term deleted"})
+	a.renderTerms(w, r)
+}
+
+func (a *Admin) PolicyHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	if !sessionUser.Can(models.ManagePolicy) {
+		a.redirectToRoot(w, r)
+		return
+	}
+	a.renderPolicy(w, r, "")
+}
+
+// renderPolicy shows the policy page. text is shown in the editor instead of
+// the current policy so a rejected edit isn't lost.
+func (a *Admin) renderPolicy(w http.ResponseWriter, r *http.Request, text string) {
+	current, err := a.stores.Policies.GetCurrentPolicy()
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin",
+		}).Error("Error getting current policy")
+		a.e.Views.RenderError(w, r, nil)
+		return
+	}
+
+	policies, err := a.stores.Policies.GetPolicies()
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin",
+		}).Error("Error getting policies")
+	}
+
+	acceptances, err := a.stores.Policies.GetAcceptanceCounts()
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin",
+		}).Error("Error getting policy acceptances")
+	}
+
+	if text == "" {
+		text = current.Text
+	}
+
+	data := map[string]interface{}{
+		"current":     current,
+		"text":        text,
+		"policies":    policies,
+		"acceptances": acceptances,
+	}
+	a.e.Views.NewView("admin-policy", r).Render(w, data)
+}
+
+// PublishPolicyHandler publishes a new version of the registration policy.
+// Users must accept the new version before registering more devices.
+func (a *Admin) PublishPolicyHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	session := common.GetSessionFromContext(r)
+	sessionUser := models.GetUserFromContext(r)
+	if !sessionUser.Can(models.ManagePolicy) {
+		a.redirectToRoot(w, r)
+		return
+	}
+
+	text := strings.TrimSpace(strings.ReplaceAll(r.FormValue("policy-text"), "\r\n", "\n"))
+	if text == "" {
+		session.AddFlash(common.FlashMessage{
+			Message: "Policy text cannot be empty",
+			Type:    common.FlashMessageError,
+		})
+		a.renderPolicy(w, r, "")
+		return
+	}
+
+	current, err := a.stores.Policies.GetCurrentPolicy()
+	if err == nil && current.Versioned() && current.Text == text {
+		session.AddFlash(common.FlashMessage{
+			Message: "The policy hasn't changed",
+			Type:    common.FlashMessageError,
+		})
+		a.renderPolicy(w, r, text)
+		return
+	}
+
+	policy := models.NewPolicy(a.stores.Policies)
+	policy.Text = text
+	policy.PublishedBy = sessionUser.Username
+	if err := policy.Save(); err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin",
+		}).Error("Error saving policy")
+		session.AddFlash(common.FlashMessage{
+			Message: "Error publishing policy",
+			Type:    common.FlashMessageError,
+		})
+		a.renderPolicy(w, r, text)
+		return
+	}
+
+	a.e.Log.WithFields(verbose.Fields{
+		"package":    "controllers:admin",
+		"changed-by": sessionUser.Username,
+		"version":    policy.ID,
+		"action":     "publish_policy",
+	}).Info("Registration policy published")
+
+	session.AddFlash(common.FlashMessage{
+		Message: fmt.Sprintf("Published policy version %d", policy.ID),
+	})
+	a.renderPolicy(w, r, "")
+}
+
+// AttributionHandler shows who had an IP or MAC address at a given time.
+func (a *Admin) AttributionHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	if !sessionUser.Can(models.ViewDevices) {
+		a.redirectToRoot(w, r)
+		return
+	}
+
+	address := r.FormValue("address")
+	data := map[string]interface{}{
+		"address": address,
+		"time":    r.FormValue("time"),
+	}
+	if address == "" {
+		a.e.Views.NewView("admin-attribution", r).Render(w, data)
+		return
+	}
+
+	result, err := a.attribute(address, r.FormValue("time"))
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	data["result"] = result
+	a.e.Views.NewView("admin-attribution", r).Render(w, data)
+}
+
+func (a *Admin) attribute(address, timeStr string) (*attribution.Result, error) {
+	t, err := attribution.ParseTime(timeStr)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := attribution.New(a.e, a.stores.Leases, a.stores.Devices, a.stores.DeviceEvents).Lookup(address, t)
+	if err != nil && err != attribution.ErrNoLease && err != attribution.ErrInvalidAddress {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin",
+			"address": address,
+		}).Error("Error looking up address")
+	}
+	return result, err
+}
+
+// TrashHandler lists deleted devices and users that can be restored.
+func (a *Admin) TrashHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	if !sessionUser.Can(models.DeleteDevice) && !sessionUser.Can(models.DeleteUser) {
+		a.redirectToRoot(w, r)
+		return
+	}
+	a.renderTrash(w, r)
+}
+
+func (a *Admin) renderTrash(w http.ResponseWriter, r *http.Request) {
+	sessionUser := models.GetUserFromContext(r)
+
+	items, err := a.stores.Trash.GetTrash()
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin",
+		}).Error("Error getting trash")
+	}
+
+	visible := make([]*models.TrashItem, 0, len(items))
+	for _, item := range items {
+		if sessionUser.Can(models.TrashPermission(item.Entity)) {
+			visible = append(visible, item)
+		}
+	}
+
+	data := map[string]interface{}{
+		"items":     visible,
+		"retention": a.e.Config.TrashRetention(),
+	}
+	a.e.Views.NewView("admin-trash", r).Render(w, data)
+}
+
+// RestoreHandler moves a device or user out of the trash.
+func (a *Admin) RestoreHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	session := common.GetSessionFromContext(r)
+	sessionUser := models.GetUserFromContext(r)
+	entity := p.ByName("entity")
+	if !sessionUser.Can(models.TrashPermission(entity)) {
+		a.redirectToRoot(w, r)
+		return
+	}
+
+	id, _ := strconv.Atoi(p.ByName("id"))
+	item, err := a.stores.Trash.GetTrashItem(entity, id)
+	if err != nil || item == nil {
+		session.AddFlash(common.FlashMessage{
+			Message: "Item not found in trash",
+			Type:    common.FlashMessageError,
+		})
+		a.renderTrash(w, r)
+		return
+	}
+
+	if err := a.stores.Trash.Restore(item, sessionUser.Username); err != nil {
+		message := err.Error()
+		if err != stores.ErrRestoreConflict && err != stores.ErrTrashItemNotFound {
+			a.e.Log.WithFields(verbose.Fields{
+				"error":   err,
+				"package": "controllers:admin",
+				"entity":  item.Entity,
+				"key":     item.Key,
+			}).Error("Error restoring from trash")
+			message = "Error restoring from trash"
+		}
+		session.AddFlash(common.FlashMessage{
+			Message: message,
+			Type:    common.FlashMessageError,
+		})
+		a.renderTrash(w, r)
+		return
+	}
+
+	a.e.Log.WithFields(verbose.Fields{
+		"package":    "controllers:admin",
+		"action":     "restore_" + item.Entity,
+		"key":        item.Key,
+		"changed-by": sessionUser.Username,
+	}).Info("Restored from trash")
+
+	session.AddFlash(common.FlashMessage{Message: "Restored " + item.Key})
+	a.renderTrash(w, r)
+}
+
+// JobsHandler lists the scheduled jobs with their last and next run.
+func (a *Admin) JobsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	if !sessionUser.Can(models.ManageJobs) {
+		a.redirectToRoot(w, r)
+		return
+	}
+	a.renderJobs(w, r)
+}
+
+type jobRow struct {
+	*tasks.JobInfo
+	Status *models.JobStatus
+}
+
+func (a *Admin) renderJobs(w http.ResponseWriter, r *http.Request) {
+	infos := tasks.RegisteredJobs(a.e.Config)
+	jobs := make([]*jobRow, 0, len(infos))
+	for _, info := range infos {
+		status, err := a.stores.JobRuns.GetJobStatus(info.Name)
+		if err != nil {
+			a.e.Log.WithFields(verbose.Fields{
+				"error":   err,
+				"package": "controllers:admin",
+				"job":     info.Name,
+			}).Error("Error getting job status")
+			status = &models.JobStatus{Job: info.Name}
+		}
+		jobs = append(jobs, &jobRow{JobInfo: info, Status: status})
+	}
+
+	leader, _, err := a.stores.TaskLocks.GetHolder(tasks.SchedulerLock)
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin",
+		}).Error("Error getting scheduler lock")
+	}
+
+	data := map[string]interface{}{
+		"jobs":     jobs,
+		"leader":   leader,
+		"instance": tasks.InstanceID(a.e.Config),
+	}
+	a.e.Views.NewView("admin-jobs", r).Render(w, data)
+}
+
+// JobHistoryHandler shows the recent runs of a job.
+func (a *Admin) JobHistoryHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	if !sessionUser.Can(models.ManageJobs) {
+		a.redirectToRoot(w, r)
+		return
+	}
+
+	var job *tasks.JobInfo
+	for _, info := range tasks.RegisteredJobs(a.e.Config) {
+		if info.Name == p.ByName("name") {
+			job = info
+			break
+		}
+	}
+	if job == nil {
+		a.e.Views.RenderError(w, r, map[string]interface{}{
+			"title": "Job not found",
+			"body":  "No job named " + p.ByName("name"),
+		})
+		return
+	}
+
+	runs, err := a.stores.JobRuns.GetJobRuns(job.Name, 100)
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin",
+			"job":     job.Name,
+		}).Error("Error getting job runs")
+	}
+
+	data := map[string]interface{}{
+		"job":  job,
+		"runs": runs,
+	}
+	a.e.Views.NewView("admin-job-history", r).Render(w, data)
+}
+
+// RunJobHandler starts a job from the jobs page.
+func (a *Admin) RunJobHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	session := common.GetSessionFromContext(r)
+	sessionUser := models.GetUserFromContext(r)
+	if !sessionUser.Can(models.ManageJobs) {
+		a.redirectToRoot(w, r)
+		return
+	}
+
+	name := p.ByName("name")
+	if err := tasks.RunJob(a.e, a.stores, name, sessionUser.Username); err != nil {
+		session.AddFlash(common.FlashMessage{
+			Message: err.Error(),
+			Type:    common.FlashMessageError,
+		})
+		a.renderJobs(w, r)
+		return
+	}
+
+	a.e.Log.WithFields(verbose.Fields{
+		"package":    "controllers:admin",
+		"action":     "run_job",
+		"job":        name,
+		"changed-by": sessionUser.Username,
+	}).Info("Job started manually")
+
+	session.AddFlash(common.FlashMessage{Message: "Started " + name})
+	a.renderJobs(w, r)
+}
+
+// WebhooksHandler shows the webhook delivery log.
+func (a *Admin) WebhooksHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	if !sessionUser.Can(models.ManageWebhooks) {
+		a.redirectToRoot(w, r)
+		return
+	}
+	a.renderWebhooks(w, r)
+}
+
+func (a *Admin) renderWebhooks(w http.ResponseWriter, r *http.Request) {
+	status := r.FormValue("status")
+	if status != models.WebhookPending && status != models.WebhookDelivered && status != models.WebhookFailed {
+		status = ""
+	}
+
+	deliveries, err := a.stores.Webhooks.GetDeliveries(status, 200)
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin",
+		}).Error("Error getting webhook deliveries")
+	}
+
+	data := map[string]interface{}{
+		"status":     status,
+		"statuses":   []string{models.WebhookPending, models.WebhookDelivered, models.WebhookFailed},
+		"deliveries": deliveries,
+		"endpoints":  a.e.Config.Webhooks.Endpoints,
+	}
+	a.e.Views.NewView("admin-webhooks", r).Render(w, data)
+}
+
+// RetryWebhookHandler requeues a webhook delivery.
+func (a *Admin) RetryWebhookHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	session := common.GetSessionFromContext(r)
+	sessionUser := models.GetUserFromContext(r)
+	if !sessionUser.Can(models.ManageWebhooks) {
+		a.redirectToRoot(w, r)
+		return
+	}
+
+	id, _ := strconv.Atoi(p.ByName("id"))
+	delivery, err := a.stores.Webhooks.GetDelivery(id)
+	if err == nil && delivery == nil {
+		err = fmt.Errorf("Delivery %d not found", id)
+	}
+	if err == nil {
+		err = a.stores.Webhooks.Retry(id)
+	}
+	if err != nil {
+		session.AddFlash(common.FlashMessage{
+			Message: err.Error(),
+			Type:    common.FlashMessageError,
+		})
+		a.renderWebhooks(w, r)
+		return
+	}
+
+	a.e.Log.WithFields(verbose.Fields{
+		"package":    "controllers:admin",
+		"action":     "retry_webhook",
+		"delivery":   id,
+		"endpoint":   delivery.Endpoint,
+		"changed-by": sessionUser.Username,
+	}).Info("Webhook delivery requeued")
+
+	session.AddFlash(common.FlashMessage{Message: "Requeued delivery " + strconv.Itoa(id)})
+	a.renderWebhooks(w, r)
+}
+
 func (a *Admin) RenderImportExportPage(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	a.e.Views.NewView("admin-import-export", r).Render(w, nil)
 }
@@ -391,130 +1104,260 @@ func (a *Admin) Import(w http.ResponseWriter, r *http.Request, p httprouter.Para
 	switch resource {
 	case "devices":
 		a.importDevices(w, r)
+	case "users":
+		a.importUsers(w, r)
+	case "oui":
+		a.importOUI(w, r)
 	default:
 		common.NewAPIResponse("", nil).WriteResponse(w, http.StatusNotFound)
 	}
 }
 
-func (a *Admin) importDevices(w http.ResponseWriter, r *http.Request) {
+// importOUI replaces the OUI database with an uploaded IEEE registry file.
+// The file is saved in the custom data directory so it's used after a restart.
+func (a *Admin) importOUI(w http.ResponseWriter, r *http.Request) {
 	session := common.GetSessionFromContext(r)
 	sessionUser := models.GetUserFromContext(r)
-	ip := common.GetIPFromContext(r)
 
-	csvr := csv.NewReader(strings.NewReader(r.PostFormValue("import-data")))
-	csvr.Comment = '#'
-	csvr.ReuseRecord = true
-	csvr.TrimLeadingSpace = true
-	csvr.FieldsPerRecord = 4
+	if !sessionUser.Can(models.EditDevice) {
+		session.AddFlash(common.FlashMessage{
+			Message: "Permission denied",
+			Type:    common.FlashMessageError,
+		})
+		a.e.Views.NewView("admin-import-export", r).Render(w, nil)
+		return
+	}
+
+	file, _, err := r.FormFile("oui-file")
+	if err != nil {
+		session.AddFlash(common.FlashMessage{
+			Message: "No OUI file uploaded",
+			Type:    common.FlashMessageError,
+		})
+		a.e.Views.NewView("admin-import-export", r).Render(w, nil)
+		return
+	}
+	defer file.Close()
 
-	var record []string
-	var err error
-	userCache := make(map[string]*models.User)
+	data, err := io.ReadAll(file)
+	if err != nil {
+		session.AddFlash(common.FlashMessage{
+			Message: "Error reading OUI file",
+			Type:    common.FlashMessageError,
+		})
+		a.e.Views.NewView("admin-import-export", r).Render(w, nil)
+		return
+	}
 
-	errors := make([]string, 0, 5)
+	db, err := oui.Parse(bytes.NewReader(data))
+	if err != nil {
+		session.AddFlash(common.FlashMessage{
+			Message: "Invalid OUI file: " + err.Error(),
+			Type:    common.FlashMessageError,
+		})
+		a.e.Views.NewView("admin-import-export", r).Render(w, nil)
+		return
+	}
 
-	record, err = csvr.Read() // header
-	if !common.StringSliceEqual(record, []string{"username", "mac", "description", "platform"}) {
+	// The file is only saved for this instance, other instances sharing the
+	// database need their own upload.
+	dest := filepath.Join(bindata.CustomDir(), oui.AssetName)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err == nil {
+		err = os.WriteFile(dest, data, 0644)
+	}
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:admin:importOUI",
+			"path":    dest,
+		}).Error("Error saving OUI file")
 		session.AddFlash(common.FlashMessage{
-			Message: "Import data missing CSV headers",
+			Message: "Error saving OUI file",
 			Type:    common.FlashMessageError,
 		})
 		a.e.Views.NewView("admin-import-export", r).Render(w, nil)
 		return
 	}
 
-	record, err = csvr.Read()
-	for err != io.EOF {
-		var username string
-		var description string
-		var platform string
-		var mac net.HardwareAddr
-		var device *models.Device
-		var deviceUser *models.User
+	oui.SetDefault(db)
+	a.e.Log.WithFields(verbose.Fields{
+		"package":     "controllers:admin:importOUI",
+		"changed-by":  sessionUser.Username,
+		"assignments": db.Len(),
+		"action":      "import_oui",
+	}).Info("OUI database updated")
+
+	session.AddFlash(common.FlashMessage{
+		Message: fmt.Sprintf("OUI database updated with %d assignments", db.Len()),
+	})
+	a.e.Views.NewView("admin-import-export", r).Render(w, nil)
+}
 
-		if err != nil {
-			errors = append(errors, err.Error())
-			a.e.Log.Error(err.Error())
-			goto next
-		}
+// importDevices registers or updates devices from CSV or JSON data. A dry run
+// shows the outcome of each row without saving. The result can be downloaded
+// as a CSV report.
+func (a *Admin) importDevices(w http.ResponseWriter, r *http.Request) {
+	session := common.GetSessionFromContext(r)
+	sessionUser := models.GetUserFromContext(r)
 
-		username = record[0]
-		description = record[2]
-		platform = record[3]
-		mac, err = common.FormatMacAddress(record[1])
-		if err != nil {
-			errors = append(errors, fmt.Sprintf("Invalid MAC address '%s'", record[1]))
-			a.e.Log.Errorf("Invalid MAC address '%s'", record[1])
-			goto next
-		}
+	opts := importer.Options{
+		Mode:      r.FormValue("mode"),
+		DryRun:    r.FormValue("dry-run") == "1",
+		ChangedBy: sessionUser.Username,
+		IP:        common.GetIPFromContext(r),
+		Editor:    sessionUser,
+	}
 
-		device, err = a.stores.Devices.GetDeviceByMAC(mac)
-		if err != nil {
-			a.e.Log.WithFields(verbose.Fields{
-				"error":   err,
-				"package": "controllers:admin:importDevices",
-				"mac":     mac.String(),
-			}).Error("Error getting device")
-			goto next
-		}
+	if !sessionUser.Can(models.CreateDevice) ||
+		(opts.Mode == importer.ModeUpsert && !sessionUser.Can(models.EditDevice)) {
+		session.AddFlash(common.FlashMessage{
+			Message: "Permission denied",
+			Type:    common.FlashMessageError,
+		})
+		a.e.Views.NewView("admin-import-export", r).Render(w, nil)
+		return
+	}
 
-		if device.ID != 0 {
-			errors = append(errors, fmt.Sprintf("Device already registered '%s'", record[1]))
-			goto next
-		}
+	records, err := importer.ParseRequest(r)
+	var result *importer.Result
+	if err == nil {
+		result, err = importer.New(a.e, a.stores.Users, a.stores.Devices, a.stores.Webhooks).Import(records, opts)
+	}
+	if err != nil {
+		session.AddFlash(common.FlashMessage{
+			Message: "Error: " + err.Error(),
+			Type:    common.FlashMessageError,
+		})
+		a.e.Views.NewView("admin-import-export", r).Render(w, nil)
+		return
+	}
 
-		deviceUser = userCache[username]
-		if deviceUser == nil {
-			deviceUser, err = a.stores.Users.GetUserByUsername(username)
-			if err != nil {
-				errors = append(errors, fmt.Sprintf("Error getting user '%s'", username))
-				a.e.Log.WithFields(verbose.Fields{
-					"error":    err,
-					"package":  "controllers:admin:importDevices",
-					"username": username,
-				}).Error("Error getting user")
-				goto next
-			}
-			userCache[username] = deviceUser
-		}
+	a.renderImportResult(w, r, "devices", result)
+}
 
-		device.Username = username
-		device.Description = description
-		device.RegisteredFrom = ip
-		device.Platform = platform
-		device.Expires = deviceUser.DeviceExpiration.NextExpiration(a.e, time.Now())
-		device.DateRegistered = time.Now()
-		device.LastSeen = time.Now()
-		device.UserAgent = "Manual"
-
-		if err = device.Save(); err != nil {
-			errors = append(errors, fmt.Sprintf("Error saving device '%s'", record[1]))
-			a.e.Log.WithFields(verbose.Fields{
-				"error":   err,
-				"package": "controllers:admin:importDevices",
-			}).Error("Error saving device")
-			goto next
-		}
-		a.e.Log.WithFields(verbose.Fields{
-			"package":    "controllers:admin:importDevices",
-			"mac":        mac.String(),
-			"changed-by": sessionUser.Username,
-			"username":   username,
-			"action":     "register_device",
-			"manual":     true,
-		}).Info("Device registered")
+// importUsers creates or updates users from CSV or JSON data. Values are
+// validated the same as when saving a user through the API.
+func (a *Admin) importUsers(w http.ResponseWriter, r *http.Request) {
+	session := common.GetSessionFromContext(r)
+	sessionUser := models.GetUserFromContext(r)
 
-	next:
-		record, err = csvr.Read()
+	opts := importer.Options{
+		Mode:      r.FormValue("mode"),
+		DryRun:    r.FormValue("dry-run") == "1",
+		ChangedBy: sessionUser.Username,
+		IP:        common.GetIPFromContext(r),
+		Editor:    sessionUser,
+	}
+
+	if !sessionUser.Can(models.CreateUser) ||
+		(opts.Mode == importer.ModeUpsert && !sessionUser.Can(models.EditUser)) {
+		session.AddFlash(common.FlashMessage{
+			Message: "Permission denied",
+			Type:    common.FlashMessageError,
+		})
+		a.e.Views.NewView("admin-import-export", r).Render(w, nil)
+		return
 	}
 
-	if len(errors) != 0 {
+	records, err := importer.ParseRequest(r)
+	var result *importer.Result
+	if err == nil {
+		result, err = importer.New(a.e, a.stores.Users, a.stores.Devices, a.stores.Webhooks).ImportUsers(records, opts)
+	}
+	if err != nil {
 		session.AddFlash(common.FlashMessage{
-			Message: "Error: " + strings.Join(errors, "<br>"),
+			Message: "Error: " + err.Error(),
+			Type:    common.FlashMessageError,
+		})
+		a.e.Views.NewView("admin-import-export", r).Render(w, nil)
+		return
+	}
+
+	a.renderImportResult(w, r, "users", result)
+}
+
+// renderImportResult shows the outcome of importing resource, or sends it as
+// a CSV report if requested.
+func (a *Admin) renderImportResult(w http.ResponseWriter, r *http.Request, resource string, result *importer.Result) {
+	session := common.GetSessionFromContext(r)
+
+	if r.FormValue("report") == "1" {
+		filename := strings.TrimSuffix(resource, "s") + "-import-report.csv"
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		result.WriteCSV(w)
+		return
+	}
+
+	summary := fmt.Sprintf("%d created, %d updated, %d failed", result.Created, result.Updated, result.Failed)
+	if result.DryRun {
+		session.AddFlash(common.FlashMessage{Message: "Dry run: " + summary})
+	} else if result.Failed > 0 {
+		session.AddFlash(common.FlashMessage{
+			Message: "Import finished with errors: " + summary,
 			Type:    common.FlashMessageError,
 		})
 	} else {
-		session.AddFlash(common.FlashMessage{Message: "Import Successful"})
+		session.AddFlash(common.FlashMessage{Message: "Import Successful: " + summary})
 	}
-	a.e.Views.NewView("admin-import-export", r).Render(w, nil)
+
+	data := map[string]interface{}{
+		"importResult":   result,
+		"importResource": resource,
+	}
+	a.e.Views.NewView("admin-import-export", r).Render(w, data)
+}
+
+// Export downloads devices or users as CSV or JSON. The records are filtered
+// by the values read by exporter.ParseFilter.
+func (a *Admin) Export(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	session := common.GetSessionFromContext(r)
+	sessionUser := models.GetUserFromContext(r)
+	resource := p.ByName("resource")
+
+	permission, ok := exporter.RequiredPermission(resource)
+	if !ok {
+		common.NewAPIResponse("", nil).WriteResponse(w, http.StatusNotFound)
+		return
+	}
+	if !sessionUser.Can(permission) {
+		session.AddFlash(common.FlashMessage{
+			Message: "Permission denied",
+			Type:    common.FlashMessageError,
+		})
+		a.e.Views.NewView("admin-import-export", r).Render(w, nil)
+		return
+	}
+
+	format, err := exporter.ParseFormat(r.FormValue("format"))
+	var filter exporter.Filter
+	if err == nil {
+		filter, err = exporter.ParseFilter(r)
+	}
+	if err != nil {
+		session.AddFlash(common.FlashMessage{
+			Message: "Error: " + err.Error(),
+			Type:    common.FlashMessageError,
+		})
+		a.e.Views.NewView("admin-import-export", r).Render(w, nil)
+		return
+	}
+
+	count, err := exporter.New(a.e, a.stores.Users, a.stores.Devices).WriteResponse(w, resource, format, filter)
+	if err != nil {
+		a.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:admin:export",
+			"resource": resource,
+		}).Error("Error exporting records")
+		return
+	}
+
+	a.e.Log.WithFields(verbose.Fields{
+		"package":    "controllers:admin:export",
+		"action":     "export",
+		"resource":   resource,
+		"records":    count,
+		"changed-by": sessionUser.Username,
+	}).Info("Records exported")
 }
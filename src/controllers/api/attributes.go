@@ -0,0 +1,91 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+)
+
+// attributeFormPrefix is prepended to custom field names in form data
+const attributeFormPrefix = "attr_"
+
+// formAttributeGetter returns a function that looks up custom field values
+// in the request form data.
+func formAttributeGetter(r *http.Request) func(string) (string, bool) {
+	if r.Form == nil {
+		r.ParseMultipartForm(32 << 20)
+	}
+	return func(name string) (string, bool) {
+		v, ok := r.Form[attributeFormPrefix+name]
+		if !ok || len(v) == 0 {
+			return "", false
+		}
+		return v[0], true
+	}
+}
+
+// nonEmptyAttributeGetter is like formAttributeGetter but treats empty values as not submitted.
+func nonEmptyAttributeGetter(r *http.Request) func(string) (string, bool) {
+	get := formAttributeGetter(r)
+	return func(name string) (string, bool) {
+		v, ok := get(name)
+		return v, ok && v != ""
+	}
+}
+
+func (d *Device) EditAttributesHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	mac, err := net.ParseMAC(p.ByName("mac"))
+	if err != nil {
+		common.NewAPIResponse("Invalid MAC address", nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	device, err := d.devices.GetDeviceByMAC(mac)
+	if err != nil {
+		d.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:device",
+			"mac":     mac.String(),
+		}).Error("Error getting device")
+		common.NewAPIResponse("Server error", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	if device.ID == 0 {
+		common.NewAPIResponse("Device not found", nil).WriteResponse(w, http.StatusNotFound)
+		return
+	}
+
+	fields := d.e.Config.CustomFieldsFor(common.CustomFieldDevice)
+	if err := device.Attributes.ApplyCustomFields(fields, formAttributeGetter(r), true); err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	if err := device.Save(); err != nil {
+		d.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:device",
+		}).Error("Error saving device")
+		common.NewAPIResponse("Error saving device", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	d.e.Log.WithFields(verbose.Fields{
+		"mac":        device.MAC.String(),
+		"username":   device.Username,
+		"changed-by": sessionUser.Username,
+		"package":    "controllers:api:device",
+		"action":     "edit_attributes_device",
+	}).Info("Device attributes changed")
+	common.NewAPIResponse("Device saved successfully", device.Attributes).WriteResponse(w, http.StatusOK)
+}
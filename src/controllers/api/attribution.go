@@ -0,0 +1,62 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/attribution"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+// Attribution answers who had an IP or MAC address at a given time.
+type Attribution struct {
+	e          *common.Environment
+	attributor *attribution.Attributor
+}
+
+func NewAttributionController(e *common.Environment, ls stores.LeaseStore, ds stores.DeviceStore, es stores.DeviceEventStore) *Attribution {
+	return &Attribution{
+		e:          e,
+		attributor: attribution.New(e, ls, ds, es),
+	}
+}
+
+// LookupHandler returns the lease, device, and owner of an address at a time.
+// The address is given as "address" and may be an IP or MAC address, "time"
+// defaults to now.
+func (a *Attribution) LookupHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	address := r.FormValue("address")
+	if address == "" {
+		common.NewAPIResponse("Address required", nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	t, err := attribution.ParseTime(r.FormValue("time"))
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	result, err := a.attributor.Lookup(address, t)
+	switch err {
+	case nil:
+		common.NewAPIResponse("", result).WriteResponse(w, http.StatusOK)
+	case attribution.ErrInvalidAddress:
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusBadRequest)
+	case attribution.ErrNoLease:
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusNotFound)
+	default:
+		a.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:attribution",
+			"address": address,
+		}).Error("Error looking up address")
+		common.NewAPIResponse("Error looking up address", nil).WriteResponse(w, http.StatusInternalServerError)
+	}
+}
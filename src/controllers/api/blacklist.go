@@ -15,21 +15,24 @@ import (
 	"github.com/packet-guardian/packet-guardian/src/common"
 	"github.com/packet-guardian/packet-guardian/src/models"
 	"github.com/packet-guardian/packet-guardian/src/models/stores"
+	"github.com/packet-guardian/packet-guardian/src/webhooks"
 )
 
 var errInvalidMAC = errors.New("Incorrect MAC address format")
 
 type Blacklist struct {
-	e       *common.Environment
-	users   stores.UserStore
-	devices stores.DeviceStore
+	e        *common.Environment
+	users    stores.UserStore
+	devices  stores.DeviceStore
+	webhooks stores.WebhookStore
 }
 
-func NewBlacklistController(e *common.Environment, us stores.UserStore, ds stores.DeviceStore) *Blacklist {
+func NewBlacklistController(e *common.Environment, us stores.UserStore, ds stores.DeviceStore, ws stores.WebhookStore) *Blacklist {
 	return &Blacklist{
-		e:       e,
-		users:   us,
-		devices: ds,
+		e:        e,
+		users:    us,
+		devices:  ds,
+		webhooks: ws,
 	}
 }
 
@@ -101,6 +104,7 @@ func (b *Blacklist) BlacklistDeviceHandler(w http.ResponseWriter, r *http.Reques
 
 	// Blacklist selected devices
 	for _, device := range devices {
+		device.ChangedBy = sessionUser.Username
 		device.SetBlacklist(addToBlacklist)
 		if err := device.SaveToBlacklist(); err != nil {
 			b.e.Log.WithFields(verbose.Fields{
@@ -120,6 +124,7 @@ func (b *Blacklist) BlacklistDeviceHandler(w http.ResponseWriter, r *http.Reques
 				"changed-by": sessionUser.Username,
 				"username":   device.GetUsername(),
 			}).Info("Device added to block list")
+			webhooks.FireDevice(b.e, b.webhooks, common.WebhookDeviceBlacklisted, sessionUser.Username, device)
 		} else {
 			b.e.Log.WithFields(verbose.Fields{
 				"package":    "controllers:api:blacklist",
@@ -128,6 +133,7 @@ func (b *Blacklist) BlacklistDeviceHandler(w http.ResponseWriter, r *http.Reques
 				"changed-by": sessionUser.Username,
 				"username":   device.GetUsername(),
 			}).Info("Device removed from block list")
+			webhooks.FireDevice(b.e, b.webhooks, common.WebhookDeviceUnblacklisted, sessionUser.Username, device)
 		}
 	}
 
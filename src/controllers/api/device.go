@@ -7,8 +7,10 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,24 +18,33 @@ import (
 	"github.com/lfkeitel/verbose/v4"
 	"github.com/packet-guardian/dhcp-lib"
 	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/importer"
+	"github.com/packet-guardian/packet-guardian/src/metrics"
 	"github.com/packet-guardian/packet-guardian/src/models"
 	"github.com/packet-guardian/packet-guardian/src/models/stores"
+	"github.com/packet-guardian/packet-guardian/src/webhooks"
 	"github.com/packet-guardian/useragent"
 )
 
 type Device struct {
-	e       *common.Environment
-	users   stores.UserStore
-	devices stores.DeviceStore
-	leases  stores.LeaseStore
+	e        *common.Environment
+	users    stores.UserStore
+	devices  stores.DeviceStore
+	leases   stores.LeaseStore
+	policies stores.PolicyStore
+	notes    stores.NoteStore
+	webhooks stores.WebhookStore
 }
 
-func NewDeviceController(e *common.Environment, us stores.UserStore, ds stores.DeviceStore, ls stores.LeaseStore) *Device {
+func NewDeviceController(e *common.Environment, us stores.UserStore, ds stores.DeviceStore, ls stores.LeaseStore, ps stores.PolicyStore, ns stores.NoteStore, ws stores.WebhookStore) *Device {
 	return &Device{
-		e:       e,
-		users:   us,
-		devices: ds,
-		leases:  ls,
+		e:        e,
+		users:    us,
+		devices:  ds,
+		leases:   ls,
+		policies: ps,
+		notes:    ns,
+		webhooks: ws,
 	}
 }
 
@@ -51,9 +62,16 @@ func (d *Device) RegistrationHandler(w http.ResponseWriter, r *http.Request, _ h
 		return
 	}
 
+	// The registration policy the session user agreed to
+	acceptance, httpCode, err := d.checkPolicyAcceptance(r, sessionUser)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, httpCode)
+		return
+	}
+
 	// Get MAC address
 	ip := common.GetIPFromContext(r)
-	mac, httpCode, err := d.getRegMACAddress(manual, ip, macPost, sessionUser)
+	mac, network, httpCode, err := d.getRegMACAddress(manual, ip, macPost, sessionUser)
 	if err != nil {
 		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, httpCode)
 		return
@@ -93,8 +111,51 @@ func (d *Device) RegistrationHandler(w http.ResponseWriter, r *http.Request, _ h
 		platform = useragent.ParseUserAgent(r.UserAgent()).String()
 	}
 
+	// Device limits only apply to users registering their own devices
+	if formUser.Username == sessionUser.Username && !sessionUser.Can(models.CreateDevice) {
+		httpCode, err := d.checkCategoryLimitRegister(formUser, platform)
+		if err != nil {
+			common.NewAPIResponse(err.Error(), nil).WriteResponse(w, httpCode)
+			return
+		}
+	}
+
+	// Check for a randomized MAC address
+	warning, httpCode, err := d.checkRandomizedMAC(mac, platform, network, sessionUser, formUser)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, httpCode)
+		return
+	}
+
+	// Custom fields shown on the registration form
+	regForm := common.RegFormAuto
+	if manual {
+		regForm = common.RegFormManual
+		if sessionUser.Can(models.CreateDevice) {
+			regForm = common.RegFormAdmin
+		}
+	}
+
+	deviceFields := d.e.Config.CustomFieldsOnForm(common.CustomFieldDevice, regForm)
+	if err := device.Attributes.ApplyCustomFields(deviceFields, formAttributeGetter(r), false); err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	userFields := d.e.Config.CustomFieldsOnForm(common.CustomFieldUser, regForm)
+	oldUserAttributes := formUser.Attributes.String()
+	if err := formUser.Attributes.ApplyCustomFields(userFields, nonEmptyAttributeGetter(r), true); err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
 	// Fill in device information
 	device.Username = formUser.Username
+	device.ChangedBy = sessionUser.Username
+	device.AuthMethod = common.GetSessionFromContext(r).GetString("_authMethod")
+	if manual {
+		device.AuthMethod = "manual"
+	}
 	device.Description = r.FormValue("description")
 	device.RegisteredFrom = ip
 	device.Platform = platform
@@ -105,6 +166,11 @@ func (d *Device) RegistrationHandler(w http.ResponseWriter, r *http.Request, _ h
 	if manual {
 		device.UserAgent = "Manual"
 	}
+	device.LimitRandomizedExpiration(d.e, time.Now())
+	if acceptance != nil {
+		device.PolicyVersion = acceptance.Version
+		device.PolicyAccepted = acceptance.Accepted
+	}
 
 	// Save new device
 	if err := device.Save(); err != nil {
@@ -115,6 +181,20 @@ func (d *Device) RegistrationHandler(w http.ResponseWriter, r *http.Request, _ h
 		common.NewAPIResponse("Error saving device", nil).WriteResponse(w, http.StatusInternalServerError)
 		return
 	}
+
+	// The user is only changed once the device is registered
+	if formUser.Attributes.String() != oldUserAttributes {
+		if err := formUser.Save(); err != nil {
+			d.e.Log.WithFields(verbose.Fields{
+				"error":    err,
+				"package":  "controllers:api:device",
+				"username": formUser.Username,
+			}).Error("Error saving user")
+			common.NewAPIResponse("Error saving user", nil).WriteResponse(w, http.StatusInternalServerError)
+			return
+		}
+	}
+
 	d.e.Log.WithFields(verbose.Fields{
 		"package":    "controllers:api:device",
 		"mac":        mac.String(),
@@ -122,10 +202,20 @@ func (d *Device) RegistrationHandler(w http.ResponseWriter, r *http.Request, _ h
 		"username":   formUser.Username,
 		"action":     "register_device",
 		"manual":     manual,
+		"randomized": device.IsRandomized(),
 	}).Info("Device registered")
+	if manual {
+		metrics.Registrations.Inc("manual")
+	} else {
+		metrics.Registrations.Inc("auto")
+	}
+	webhooks.FireDevice(d.e, d.webhooks, common.WebhookDeviceRegistered, sessionUser.Username, device)
 
 	// Redirect client as needed
-	resp := struct{ Location string }{Location: "/manage"}
+	resp := struct {
+		Location string
+		Warning  string `json:",omitempty"`
+	}{Location: "/manage", Warning: warning}
 	if sessionUser.Can(models.ViewDevices) {
 		resp.Location = "/admin/manage/user/" + formUser.Username
 	}
@@ -133,6 +223,54 @@ func (d *Device) RegistrationHandler(w http.ResponseWriter, r *http.Request, _ h
 	common.NewAPIResponse("Registration successful", resp).WriteResponse(w, http.StatusOK)
 }
 
+// checkPolicyAcceptance returns the session user's acceptance of the current
+// registration policy. Submitting the policy version shown on the registration
+// page accepts it. Users who haven't accepted the current version can't
+// register devices unless they can register devices for anyone.
+func (d *Device) checkPolicyAcceptance(r *http.Request, sessionUser *models.User) (*models.PolicyAcceptance, int, error) {
+	if d.policies == nil {
+		return nil, 0, nil
+	}
+
+	policy, err := d.policies.GetCurrentPolicy()
+	if err != nil {
+		d.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:device",
+		}).Error("Error getting policy")
+		return nil, http.StatusInternalServerError, errors.New("Error registering device")
+	}
+	if !policy.Versioned() {
+		return nil, 0, nil
+	}
+
+	if r.FormValue("policy-version") == strconv.Itoa(policy.ID) {
+		acceptance, err := acceptPolicy(d.e, d.policies, r, sessionUser, policy)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		return acceptance, 0, nil
+	}
+
+	acceptance, err := d.policies.GetAcceptance(sessionUser.Username, policy.ID)
+	if err != nil {
+		d.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:api:device",
+			"username": sessionUser.Username,
+		}).Error("Error getting policy acceptance")
+		return nil, http.StatusInternalServerError, errors.New("Error registering device")
+	}
+
+	if acceptance.ID == 0 {
+		if sessionUser.Can(models.CreateDevice) {
+			return nil, 0, nil
+		}
+		return nil, http.StatusForbidden, errors.New("You must accept the current registration policy")
+	}
+	return acceptance, 0, nil
+}
+
 func (d *Device) checkRegisterPermissions(sessionUser *models.User, username string, manual bool) (*models.User, int, error) {
 	// Username is required
 	if username == "" {
@@ -228,18 +366,59 @@ func (d *Device) checkDeviceLimitRegister(formUser *models.User) (int, error) {
 	return 0, nil
 }
 
-func (d *Device) getRegMACAddress(manual bool, ip net.IP, macPost string, sessionUser *models.User) (net.HardwareAddr, int, error) {
+// checkCategoryLimitRegister enforces the limit of the device category platform
+// belongs to. Existing devices are counted by the category of their platform.
+func (d *Device) checkCategoryLimitRegister(formUser *models.User, platform string) (int, error) {
+	category, ok := d.e.Config.DeviceCategoryFor(platform)
+	if !ok {
+		return 0, nil
+	}
+
+	limit := formUser.DeviceCategoryLimit(category)
+	if limit == int(models.UserDeviceLimitUnlimited) {
+		return 0, nil
+	}
+
+	devices, err := d.devices.GetDevicesForUser(formUser)
+	if err != nil {
+		d.e.Log.WithFields(verbose.Fields{
+			"package": "controllers:api:device",
+			"error":   err,
+		}).Error("Error getting devices")
+		return http.StatusInternalServerError, errors.New("Error registering device")
+	}
+
+	count := 0
+	for _, device := range devices {
+		if c, ok := d.e.Config.DeviceCategoryFor(device.Platform); ok && c.Name == category.Name {
+			count++
+		}
+	}
+	if count >= limit {
+		return http.StatusConflict, fmt.Errorf("Device limit reached for %s", category.Name)
+	}
+	return 0, nil
+}
+
+// getRegMACAddress returns the MAC address to register and the name of the
+// network the device was last seen on, if known.
+func (d *Device) getRegMACAddress(manual bool, ip net.IP, macPost string, sessionUser *models.User) (net.HardwareAddr, string, int, error) {
 	if manual {
 		// Manual registration
 		// if manual registeration are not allowed and not admin
 		if !d.e.Config.Registration.AllowManualRegistrations && !sessionUser.Can(models.CreateDevice) {
-			return nil, http.StatusForbidden, errors.New("Manual registrations not allowed")
+			return nil, "", http.StatusForbidden, errors.New("Manual registrations not allowed")
 		}
 		mac, err := common.FormatMacAddress(macPost)
 		if err != nil {
-			return nil, http.StatusBadRequest, errors.New("Incorrect MAC address format")
+			return nil, "", http.StatusBadRequest, errors.New("Incorrect MAC address format")
+		}
+
+		network := ""
+		if lease, err := d.leases.GetRecentLeaseByMAC(mac); err == nil && lease != nil && lease.ID != 0 {
+			network = lease.Network
 		}
-		return mac, 0, nil
+		return mac, network, 0, nil
 	}
 
 	// Automatic registration
@@ -250,7 +429,7 @@ func (d *Device) getRegMACAddress(manual bool, ip net.IP, macPost string, sessio
 			"package": "controllers:api:device",
 			"ip":      ip.String(),
 		}).Error("Error getting MAC for IP")
-		return nil, http.StatusInternalServerError, errors.New("Failed detecting MAC address")
+		return nil, "", http.StatusInternalServerError, errors.New("Failed detecting MAC address")
 	}
 
 	if lease.ID == 0 {
@@ -258,9 +437,78 @@ func (d *Device) getRegMACAddress(manual bool, ip net.IP, macPost string, sessio
 			"package": "controllers:api:device",
 			"ip":      ip.String(),
 		}).Notice("Attempted auto reg from non-leased device")
-		return nil, http.StatusInternalServerError, errors.New("Error detecting MAC address")
+		return nil, "", http.StatusInternalServerError, errors.New("Error detecting MAC address")
+	}
+	return lease.MAC, lease.Network, 0, nil
+}
+
+// checkRandomizedMAC applies the randomized MAC policy to a registration. If the
+// user should be warned, the guidance text is returned. Admins are only warned.
+func (d *Device) checkRandomizedMAC(mac net.HardwareAddr, platform, network string, sessionUser, formUser *models.User) (string, int, error) {
+	if !common.IsLocallyAdministered(mac) {
+		return "", 0, nil
+	}
+
+	guidance := d.e.Config.Registration.RandomizedMAC.Guidance
+	switch d.e.Config.RandomizedMACPolicy(platform, network) {
+	case common.RandomizedMACReject:
+		if sessionUser.Can(models.CreateDevice) {
+			return guidance, 0, nil
+		}
+		d.e.Log.WithFields(verbose.Fields{
+			"package":    "controllers:api:device",
+			"mac":        mac.String(),
+			"platform":   platform,
+			"network":    network,
+			"changed-by": sessionUser.Username,
+			"username":   formUser.Username,
+		}).Notice("Rejected registration of randomized MAC address")
+		return "", http.StatusForbidden, errors.New(guidance)
+	case common.RandomizedMACWarn:
+		return guidance, 0, nil
 	}
-	return lease.MAC, 0, nil
+	return "", 0, nil
+}
+
+// ImportHandler registers or updates devices in bulk. Data is given as an uploaded
+// file, form value, or JSON body. Errors for individual rows are reported in the
+// result, the result is returned as a CSV report if report=1.
+func (d *Device) ImportHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+
+	opts := importer.Options{
+		Mode:      r.FormValue("mode"),
+		DryRun:    r.FormValue("dry-run") == "1",
+		ChangedBy: sessionUser.Username,
+		IP:        common.GetIPFromContext(r),
+		Editor:    sessionUser,
+	}
+
+	if opts.Mode == importer.ModeUpsert && !sessionUser.Can(models.EditDevice) {
+		common.NewAPIResponse("Permission denied", nil).WriteResponse(w, http.StatusForbidden)
+		return
+	}
+
+	records, err := importer.ParseRequest(r)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	result, err := importer.New(d.e, d.users, d.devices, d.webhooks).Import(records, opts)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	if r.FormValue("report") == "1" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="device-import-report.csv"`)
+		result.WriteCSV(w)
+		return
+	}
+
+	common.NewAPIResponse("Import finished", result).WriteResponse(w, http.StatusOK)
 }
 
 func (d *Device) DeleteHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -303,6 +551,7 @@ func (d *Device) DeleteHandler(w http.ResponseWriter, r *http.Request, p httprou
 			continue
 		}
 
+		device.ChangedBy = sessionUser.Username
 		if err := device.Delete(); err != nil {
 			d.e.Log.WithFields(verbose.Fields{
 				"error":   err,
@@ -320,6 +569,7 @@ func (d *Device) DeleteHandler(w http.ResponseWriter, r *http.Request, p httprou
 			"username":   formUser.Username,
 			"action":     "delete_device",
 		}).Notice("Device deleted")
+		webhooks.FireDevice(d.e, d.webhooks, common.WebhookDeviceDeleted, sessionUser.Username, device)
 	}
 
 	if finishedWithErrors {
@@ -457,6 +707,7 @@ func (d *Device) ReassignHandler(w http.ResponseWriter, r *http.Request, _ httpr
 		}
 		originalUser := dev.Username
 		dev.Username = user.Username
+		dev.ChangedBy = sessionUser.Username
 		// Change expiration to reflect new owner
 		dev.Expires = user.DeviceExpiration.NextExpiration(d.e, time.Now())
 		if err := dev.Save(); err != nil {
@@ -474,6 +725,10 @@ func (d *Device) ReassignHandler(w http.ResponseWriter, r *http.Request, _ httpr
 			"mac":          mac.String(),
 			"action":       "reassign_device",
 		}).Info("Reassigned device to another user")
+		webhooks.Fire(d.e, d.webhooks, common.WebhookDeviceReassigned, sessionUser.Username, &webhooks.DeviceData{
+			Device:           dev,
+			PreviousUsername: originalUser,
+		})
 	}
 
 	common.NewAPIResponse("Devices reassigned successfully", nil).WriteResponse(w, http.StatusOK)
@@ -591,6 +846,8 @@ func (d *Device) EditExpirationHandler(w http.ResponseWriter, r *http.Request, p
 		newExpire.Mode = models.UserDeviceExpirationNever
 	case "rolling":
 		newExpire.Mode = models.UserDeviceExpirationRolling
+	case "term":
+		newExpire.Mode = models.UserDeviceExpirationTerm
 	case "specific":
 		newExpire.Mode = models.UserDeviceExpirationSpecific
 		expTime, err := time.ParseInLocation(common.TimeFormat, expValue, time.Local)
@@ -610,6 +867,8 @@ func (d *Device) EditExpirationHandler(w http.ResponseWriter, r *http.Request, p
 	newExpireResp := newExpire.String()
 
 	device.Expires = newExpire.NextExpiration(d.e, time.Now())
+	device.Renewals = 0 // An admin set expiration starts a new renewal count
+	device.ChangedBy = models.GetUserFromContext(r).Username
 	if err := device.Save(); err != nil {
 		d.e.Log.WithFields(verbose.Fields{
 			"error":   err,
@@ -621,7 +880,7 @@ func (d *Device) EditExpirationHandler(w http.ResponseWriter, r *http.Request, p
 
 	if newExpire.Mode == models.UserDeviceExpirationGlobal {
 		newExpireResp = models.GetGlobalDefaultExpiration(d.e).String()
-	} else if newExpire.Mode == models.UserDeviceExpirationSpecific {
+	} else if newExpire.Mode == models.UserDeviceExpirationSpecific || newExpire.Mode == models.UserDeviceExpirationTerm {
 		newExpireResp = device.Expires.Format(common.TimeFormat)
 	}
 
@@ -637,6 +896,87 @@ func (d *Device) EditExpirationHandler(w http.ResponseWriter, r *http.Request, p
 	common.NewAPIResponse("Device saved successfully", resp).WriteResponse(w, http.StatusOK)
 }
 
+// RenewHandler lets owners and delegates extend a device's expiration using the
+// owner's device expiration, limited by the renewal policy.
+func (d *Device) RenewHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	if !d.e.Config.Registration.Renewal.Enabled {
+		common.NewAPIResponse("Device renewals are disabled", nil).WriteResponse(w, http.StatusForbidden)
+		return
+	}
+
+	mac, err := net.ParseMAC(p.ByName("mac"))
+	if err != nil {
+		common.NewAPIResponse("Invalid MAC address", nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	device, err := d.devices.GetDeviceByMAC(mac)
+	if err != nil {
+		d.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:device",
+			"mac":     mac.String(),
+		}).Error("Error getting device")
+		common.NewAPIResponse("Server error", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+	if device.ID == 0 {
+		common.NewAPIResponse("Device not found", nil).WriteResponse(w, http.StatusNotFound)
+		return
+	}
+
+	httpCode, err := d.editDevicePermissionCheck(sessionUser, device)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, httpCode)
+		return
+	}
+
+	if device.IsBlacklisted() {
+		common.NewAPIResponse("Blocked devices can't be renewed", nil).WriteResponse(w, http.StatusForbidden)
+		return
+	}
+
+	owner, err := d.users.GetUserByUsername(device.Username)
+	if err != nil {
+		d.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:api:device",
+			"username": device.Username,
+		}).Error("Error getting user")
+		common.NewAPIResponse("Server error", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	if err := device.Renew(d.e, owner.DeviceExpiration, time.Now()); err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusConflict)
+		return
+	}
+
+	device.ChangedBy = sessionUser.Username
+	if err := device.Save(); err != nil {
+		d.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:device",
+		}).Error("Error saving device")
+		common.NewAPIResponse("Error saving device", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	newExpiration := device.Expires.Format(common.TimeFormat)
+	d.e.Log.WithFields(verbose.Fields{
+		"mac":        device.MAC.String(),
+		"username":   device.Username,
+		"changed-by": sessionUser.Username,
+		"expiration": newExpiration,
+		"renewals":   device.Renewals,
+		"package":    "controllers:api:device",
+		"action":     "renew_device",
+	}).Info("Device renewed")
+	resp := map[string]string{"newExpiration": newExpiration}
+	common.NewAPIResponse("Device renewed", resp).WriteResponse(w, http.StatusOK)
+}
+
 func (d *Device) GetDeviceHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	sessionUser := models.GetUserFromContext(r)
 	macParam := p.ByName("mac")
@@ -666,11 +1006,16 @@ func (d *Device) GetDeviceHandler(w http.ResponseWriter, r *http.Request, p http
 	common.NewAPIResponse("", device).WriteResponse(w, http.StatusOK)
 }
 
+// EditFlaggedHandler flags or unflags a device. A flag needs a category and
+// may have a reason. The flag clears at the time given in clears, or after
+// the category's clearAfter if clears is empty. A clears value of never keeps
+// the flag until it's removed.
 func (d *Device) EditFlaggedHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	var err error
 	mac, err := net.ParseMAC(p.ByName("mac"))
 	if err != nil {
 		common.NewAPIResponse("Invalid MAC address", nil).WriteResponse(w, http.StatusBadRequest)
+		return
 	}
 
 	device, err := d.devices.GetDeviceByMAC(mac)
@@ -684,10 +1029,32 @@ func (d *Device) EditFlaggedHandler(w http.ResponseWriter, r *http.Request, p ht
 		return
 	}
 
+	sessionUser := models.GetUserFromContext(r)
+	wasFlagged := device.Flagged
+
 	flagged := r.FormValue("flagged")
-	if flagged != "" {
-		device.Flagged = (flagged == "1" || flagged == "true")
+	if flagged == "1" || flagged == "true" {
+		// Clients from before flag categories don't send one. If the default
+		// category isn't configured the flag has no category like imported flags.
+		categoryName := r.FormValue("category")
+		category, ok := d.e.Config.FlagCategory(categoryName)
+		if categoryName == "" {
+			category, _ = d.e.Config.FlagCategory(common.DefaultFlagCategory)
+		} else if !ok {
+			common.NewAPIResponse("Invalid flag category", nil).WriteResponse(w, http.StatusBadRequest)
+			return
+		}
+
+		clears, err := parseFlagClears(r.FormValue("clears"), category, time.Now())
+		if err != nil {
+			common.NewAPIResponse("Invalid clear date", nil).WriteResponse(w, http.StatusBadRequest)
+			return
+		}
+		device.Flag(category.Name, strings.TrimSpace(r.FormValue("reason")), sessionUser.Username, clears)
+	} else if flagged != "" {
+		device.Unflag()
 	}
+	device.ChangedBy = sessionUser.Username
 
 	if err := device.Save(); err != nil {
 		d.e.Log.WithFields(verbose.Fields{
@@ -701,14 +1068,48 @@ func (d *Device) EditFlaggedHandler(w http.ResponseWriter, r *http.Request, p ht
 	d.e.Log.WithFields(verbose.Fields{
 		"mac":        device.MAC.String(),
 		"username":   device.Username,
-		"changed-by": models.GetUserFromContext(r).Username,
+		"changed-by": sessionUser.Username,
 		"flagged":    device.Flagged,
+		"category":   device.FlagCategory,
+		"reason":     device.FlagReason,
 		"package":    "controllers:api:device",
 		"action":     "edit_flagged_device",
 	}).Info("Device flagged status changed")
+
+	if device.Flagged {
+		webhooks.FireDevice(d.e, d.webhooks, common.WebhookDeviceFlagged, sessionUser.Username, device)
+	} else if wasFlagged {
+		webhooks.FireDevice(d.e, d.webhooks, common.WebhookDeviceUnflagged, sessionUser.Username, device)
+	}
 	common.NewAPIResponse("Device saved successfully", nil).WriteResponse(w, http.StatusOK)
 }
 
+// parseFlagClears returns when a flag set at now clears. Value is a date or
+// date and time, never, or empty to use the category default.
+func parseFlagClears(value string, category common.FlagCategory, now time.Time) (time.Time, error) {
+	switch value {
+	case "":
+		if after := category.ClearAfterDuration(); after > 0 {
+			return now.Add(after), nil
+		}
+		return time.Time{}, nil
+	case "never":
+		return time.Time{}, nil
+	}
+
+	clears, err := time.ParseInLocation(common.TimeFormat, value, time.Local)
+	if err != nil {
+		clears, err = time.ParseInLocation(time.DateOnly, value, time.Local)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !clears.After(now) {
+		return time.Time{}, errors.New("Clear date is in the past")
+	}
+	return clears, nil
+}
+
 func (d *Device) GetSelfStatusHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	ip := common.GetIPFromContext(r)
 	reg, _ := dhcp.IsRegisteredByIP(d.leases, ip)
@@ -748,6 +1149,7 @@ func (d *Device) EditNotesHandler(w http.ResponseWriter, r *http.Request, p http
 		return
 	}
 
+	notesChanged := device.Notes != r.FormValue("notes")
 	device.Notes = r.FormValue("notes")
 	if err := device.Save(); err != nil {
 		d.e.Log.WithFields(verbose.Fields{
@@ -758,6 +1160,14 @@ func (d *Device) EditNotesHandler(w http.ResponseWriter, r *http.Request, p http
 		return
 	}
 
+	// Record the new text in the notes log
+	if notesChanged && device.Notes != "" {
+		if _, err := addNote(d.e, d.notes, models.NoteEntityDevice, device.MAC.String(), sessionUser.Username, device.Notes); err != nil {
+			common.NewAPIResponse("Device saved, but notes log not updated", nil).WriteResponse(w, http.StatusInternalServerError)
+			return
+		}
+	}
+
 	d.e.Log.WithFields(verbose.Fields{
 		"mac":        device.MAC.String(),
 		"username":   device.Username,
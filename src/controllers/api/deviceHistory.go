@@ -0,0 +1,70 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+// DeviceHistory handles the history timeline of MAC addresses.
+type DeviceHistory struct {
+	e      *common.Environment
+	leases stores.LeaseStore
+	events stores.DeviceEventStore
+}
+
+func NewDeviceHistoryController(e *common.Environment, ls stores.LeaseStore, es stores.DeviceEventStore) *DeviceHistory {
+	return &DeviceHistory{
+		e:      e,
+		leases: ls,
+		events: es,
+	}
+}
+
+// GetHistoryHandler returns the timeline of a MAC address, newest first. The
+// history is kept after the device is deleted.
+func (h *DeviceHistory) GetHistoryHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	mac, err := net.ParseMAC(p.ByName("mac"))
+	if err != nil {
+		common.NewAPIResponse("Invalid MAC address", nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	timeline, err := deviceTimeline(h.leases, h.events, mac)
+	if err != nil {
+		h.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:device-history",
+			"mac":     mac.String(),
+		}).Error("Error getting device history")
+		common.NewAPIResponse("Error getting device history", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	common.NewAPIResponse("", map[string]interface{}{
+		"mac":      mac.String(),
+		"timeline": timeline,
+	}).WriteResponse(w, http.StatusOK)
+}
+
+func deviceTimeline(leases stores.LeaseStore, events stores.DeviceEventStore, mac net.HardwareAddr) ([]*models.TimelineEntry, error) {
+	deviceEvents, err := events.GetDeviceEvents(mac)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := leases.GetLeaseHistory(mac)
+	if err != nil {
+		return nil, err
+	}
+	return models.DeviceTimeline(deviceEvents, history), nil
+}
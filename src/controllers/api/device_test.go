@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -57,7 +58,7 @@ func editDescriptionTestSetup(duser, user string, perms models.Permission) (*Dev
 		},
 	}
 
-	return NewDeviceController(e, testUserStore, testDeviceStore, nil), params, testDevice, req
+	return NewDeviceController(e, testUserStore, testDeviceStore, nil, nil, nil, nil), params, testDevice, req
 }
 
 func TestDeviceEditDescriptionHandlerSameUser(t *testing.T) {
@@ -219,7 +220,7 @@ func registrationTestSetup(sessionUser *registerTestUser, otherUsers []*register
 	req = models.SetUserToContext(req, sessionuser)
 	req = common.SetIPToContext(req)
 
-	return NewDeviceController(e, testUserStore, testDeviceStore, testLeaseStore), testDeviceStore, req
+	return NewDeviceController(e, testUserStore, testDeviceStore, testLeaseStore, nil, nil, nil), testDeviceStore, req
 }
 
 type registrationTestCase struct {
@@ -416,6 +417,150 @@ func TestRegistrationHandler(t *testing.T) {
 	}
 }
 
+func TestRegistrationSavesUserAfterDevice(t *testing.T) {
+	for _, saveErr := range []error{nil, errors.New("database is locked")} {
+		testHandler, devStore, req := registrationTestSetup(&registerTestUser{
+			username:    "testuser",
+			permissions: models.ManageOwnRights,
+		}, nil, false)
+		testHandler.e.Config.CustomFields = []common.CustomField{
+			{Name: "phone", Type: common.CustomFieldString, Entity: common.CustomFieldUser, Forms: []string{common.RegFormManual}},
+		}
+		devStore.SaveErr = saveErr
+		userStore := testHandler.users.(*stores.TestUserStore)
+
+		req.PostForm = map[string][]string{
+			"mac-address": {"12:34:56:ab:cd:ef"},
+			"username":    {"testuser"},
+			"platform":    {"tester"},
+			"attr_phone":  {"555-1234"},
+		}
+
+		w := httptest.NewRecorder()
+		testHandler.RegistrationHandler(w, req, nil)
+
+		if saveErr != nil {
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("Wrong HTTP code. Expected 500, got %d", w.Code)
+			}
+			if len(userStore.Saved) != 0 {
+				t.Error("User was saved when the device wasn't")
+			}
+			continue
+		}
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Wrong HTTP code. Expected 200, got %d", w.Code)
+		}
+		if len(userStore.Saved) != 1 {
+			t.Errorf("Expected the user to be saved once, got %d", len(userStore.Saved))
+		}
+	}
+}
+
+func TestRegistrationCategoryLimit(t *testing.T) {
+	cases := []struct {
+		name           string
+		platform       string
+		categoryLimits models.CategoryLimits
+		code           int
+	}{
+		{"category full", "iPhone", nil, http.StatusConflict},
+		{"other category", "Windows", nil, http.StatusOK},
+		{"user override", "iPhone", models.CategoryLimits{"phones": 2}, http.StatusOK},
+		{"user unlimited", "iPhone", models.CategoryLimits{"phones": 0}, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		testHandler, devStore, req := registrationTestSetup(&registerTestUser{
+			username:    "testuser",
+			permissions: models.ManageOwnRights,
+		}, nil, false)
+
+		config := testHandler.e.Config
+		config.Registration.ManualRegPlatforms = []string{"iPhone", "Windows"}
+		config.Registration.DeviceCategories = []common.DeviceCategory{
+			{Name: "phones", Platforms: []string{"iPhone", "Android"}, Limit: 1},
+			{Name: "other", Limit: 5},
+		}
+
+		sessionUser := models.GetUserFromContext(req)
+		sessionUser.CategoryLimits = c.categoryLimits
+
+		phone := models.NewDevice(devStore, nil, &stores.TestBlacklistItem{})
+		phone.ID = 1
+		phone.MAC, _ = net.ParseMAC("12:34:56:00:00:01")
+		phone.Username = "testuser"
+		phone.Platform = "iPhone (16.1)"
+		devStore.Devices = append(devStore.Devices, phone)
+
+		req.PostForm = map[string][]string{
+			"mac-address": {"12:34:56:ab:cd:ef"},
+			"username":    {"testuser"},
+			"platform":    {c.platform},
+		}
+
+		w := httptest.NewRecorder()
+		testHandler.RegistrationHandler(w, req, nil)
+		if w.Code != c.code {
+			t.Errorf("%s: expected HTTP %d, got %d", c.name, c.code, w.Code)
+		}
+		if c.code == http.StatusConflict && !strings.Contains(w.Body.String(), "phones") {
+			t.Errorf("%s: error doesn't name the category: %s", c.name, w.Body.String())
+		}
+	}
+}
+
+func TestRegistrationPolicyAcceptance(t *testing.T) {
+	cases := []struct {
+		name          string
+		permissions   models.Permission
+		policyVersion string
+		accepted      bool
+		code          int
+	}{
+		{"not accepted", models.ManageOwnRights, "", false, http.StatusForbidden},
+		{"old version", models.ManageOwnRights, "1", false, http.StatusForbidden},
+		{"accepted on form", models.ManageOwnRights, "2", true, http.StatusOK},
+		{"admin not accepted", models.AdminRights, "", false, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		testHandler, devStore, req := registrationTestSetup(&registerTestUser{
+			username:    "testuser",
+			permissions: c.permissions,
+		}, nil, false)
+
+		policyStore := &stores.TestPolicyStore{}
+		for _, text := range []string{"First policy", "Second policy"} {
+			p := models.NewPolicy(policyStore)
+			p.Text = text
+			p.Save()
+		}
+		testHandler.policies = policyStore
+
+		req.PostForm = map[string][]string{
+			"mac-address":    {"12:34:56:ab:cd:ef"},
+			"username":       {"testuser"},
+			"policy-version": {c.policyVersion},
+		}
+
+		w := httptest.NewRecorder()
+		testHandler.RegistrationHandler(w, req, nil)
+		if w.Code != c.code {
+			t.Errorf("%s: expected HTTP %d, got %d", c.name, c.code, w.Code)
+			continue
+		}
+
+		if len(policyStore.Acceptances) > 0 != c.accepted {
+			t.Errorf("%s: expected acceptance recorded %t", c.name, c.accepted)
+		}
+		if c.accepted && (len(devStore.Devices) != 1 || devStore.Devices[0].PolicyVersion != 2) {
+			t.Errorf("%s: device doesn't record the accepted policy version", c.name)
+		}
+	}
+}
+
 /// Delete Device Tests
 func deleteDeviceTestSetup(sessionUser *registerTestUser, otherUsers []*registerTestUser) (*Device, *stores.TestDeviceStore, *http.Request) {
 	e := common.NewTestEnvironment()
@@ -465,7 +610,7 @@ func deleteDeviceTestSetup(sessionUser *registerTestUser, otherUsers []*register
 	req = models.SetUserToContext(req, sessionuser)
 	req = common.SetIPToContext(req)
 
-	return NewDeviceController(e, testUserStore, testDeviceStore, testLeaseStore), testDeviceStore, req
+	return NewDeviceController(e, testUserStore, testDeviceStore, testLeaseStore, nil, nil, nil), testDeviceStore, req
 }
 
 type deleteDeviceTestCase struct {
@@ -627,3 +772,146 @@ func TestDeleteDeviceHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestRenewHandler(t *testing.T) {
+	cases := []struct {
+		name        string
+		sessionUser string
+		expires     time.Duration
+		renewals    int
+		code        int
+	}{
+		{"owner", "testuser", 24 * time.Hour, 0, http.StatusOK},
+		{"not owner", "other", 24 * time.Hour, 0, http.StatusUnauthorized},
+		{"outside window", "testuser", 72 * time.Hour, 0, http.StatusConflict},
+		{"max renewals", "testuser", 24 * time.Hour, 2, http.StatusConflict},
+	}
+
+	for _, c := range cases {
+		e := common.NewTestEnvironment()
+		e.Config.Registration.Renewal.Enabled = true
+		e.Config.Registration.Renewal.Window = "48h"
+		e.Config.Registration.Renewal.MaxRenewals = 2
+		e.Config.Registration.Renewal.Modes = []string{"duration"}
+
+		userStore := &stores.TestUserStore{}
+		users := make(map[string]*models.User)
+		for _, username := range []string{"testuser", "other"} {
+			user := models.NewUser(e, userStore, &stores.TestBlacklistItem{}, username)
+			user.Rights = models.ManageOwnRights
+			user.DeviceExpiration = &models.UserDeviceExpiration{
+				Mode:  models.UserDeviceExpirationDuration,
+				Value: int64(7 * 24 * time.Hour / time.Second),
+			}
+			userStore.Users = append(userStore.Users, user)
+			users[username] = user
+		}
+
+		devStore := &stores.TestDeviceStore{}
+		device := models.NewDevice(devStore, nil, &stores.TestBlacklistItem{})
+		device.ID = 1
+		device.MAC, _ = net.ParseMAC("12:34:56:ab:cd:ef")
+		device.Username = "testuser"
+		device.Expires = time.Now().Add(c.expires)
+		device.Renewals = c.renewals
+		devStore.Devices = append(devStore.Devices, device)
+		oldExpires := device.Expires
+
+		req, _ := http.NewRequest("", "", nil)
+		req = common.SetEnvironmentToContext(req, e)
+		req = models.SetUserToContext(req, users[c.sessionUser])
+
+		w := httptest.NewRecorder()
+		params := httprouter.Params{{Key: "mac", Value: device.MAC.String()}}
+		NewDeviceController(e, userStore, devStore, nil, nil, nil, nil).RenewHandler(w, req, params)
+		if w.Code != c.code {
+			t.Errorf("%s: expected HTTP %d, got %d", c.name, c.code, w.Code)
+		}
+
+		renewed := device.Expires.After(oldExpires.Add(5 * 24 * time.Hour))
+		if renewed != (c.code == http.StatusOK) {
+			t.Errorf("%s: device expiration is %s", c.name, device.Expires)
+		}
+		if c.code == http.StatusOK && device.Renewals != c.renewals+1 {
+			t.Errorf("%s: expected %d renewals, got %d", c.name, c.renewals+1, device.Renewals)
+		}
+	}
+}
+
+func TestEditFlaggedHandler(t *testing.T) {
+	e := common.NewTestEnvironment()
+	e.Config.Flags.Categories = []common.FlagCategory{
+		{Name: "stolen"},
+		{Name: "investigation", ClearAfter: "72h"},
+	}
+
+	devStore := &stores.TestDeviceStore{}
+	device := models.NewDevice(devStore, nil, &stores.TestBlacklistItem{})
+	device.ID = 1
+	device.MAC, _ = net.ParseMAC("12:34:56:12:34:56")
+	device.Username = "testuser"
+	devStore.Devices = []*models.Device{device}
+
+	admin := models.NewUser(e, &stores.TestUserStore{}, &stores.TestBlacklistItem{}, "admin")
+	admin.Rights = models.AdminRights
+	handler := NewDeviceController(e, &stores.TestUserStore{}, devStore, nil, nil, nil, nil)
+	params := httprouter.Params{{Key: "mac", Value: "12:34:56:12:34:56"}}
+
+	edit := func(form map[string][]string) int {
+		req, _ := http.NewRequest("", "", nil)
+		req = common.SetEnvironmentToContext(req, e)
+		req = models.SetUserToContext(req, admin)
+		req.PostForm = form
+
+		w := httptest.NewRecorder()
+		handler.EditFlaggedHandler(w, req, params)
+		return w.Code
+	}
+
+	if code := edit(map[string][]string{"flagged": {"true"}, "category": {"lost"}}); code != http.StatusBadRequest {
+		t.Errorf("Unknown category: expected 400, got %d", code)
+	}
+
+	// The default category isn't configured
+	if code := edit(map[string][]string{"flagged": {"true"}}); code != http.StatusOK {
+		t.Fatalf("No category: expected 200, got %d", code)
+	}
+	if !device.Flagged || device.FlagCategory != "" {
+		t.Errorf("Expected flag without a category, got %q", device.FlagCategory)
+	}
+	e.Config.Flags.Categories = append(e.Config.Flags.Categories, common.FlagCategory{Name: common.DefaultFlagCategory})
+	device.Unflag()
+	if code := edit(map[string][]string{"flagged": {"1"}}); code != http.StatusOK {
+		t.Fatalf("No category: expected 200, got %d", code)
+	}
+	if device.FlagCategory != common.DefaultFlagCategory {
+		t.Errorf("Expected default flag category, got %q", device.FlagCategory)
+	}
+	if code := edit(map[string][]string{"flagged": {"true"}, "category": {"stolen"}, "clears": {"2001-01-01"}}); code != http.StatusBadRequest {
+		t.Errorf("Past clear date: expected 400, got %d", code)
+	}
+
+	if code := edit(map[string][]string{"flagged": {"true"}, "category": {"investigation"}, "reason": {" Port scanning "}}); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if !device.Flagged || device.FlagCategory != "investigation" || device.FlagReason != "Port scanning" || device.FlaggedBy != "admin" {
+		t.Errorf("Wrong flag: %s %q %s", device.FlagCategory, device.FlagReason, device.FlaggedBy)
+	}
+	if clears := time.Until(device.FlagClears); clears < 71*time.Hour || clears > 72*time.Hour {
+		t.Errorf("Expected flag to clear after the category default, clears in %s", clears)
+	}
+
+	if code := edit(map[string][]string{"flagged": {"true"}, "category": {"investigation"}, "clears": {"never"}}); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if !device.FlagClears.IsZero() {
+		t.Errorf("Expected flag to never clear, clears %s", device.FlagClears)
+	}
+
+	if code := edit(map[string][]string{"flagged": {"false"}}); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if device.Flagged || device.FlagCategory != "" || !device.FlaggedAt.IsZero() {
+		t.Error("Expected flag details to be removed")
+	}
+}
@@ -0,0 +1,76 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/exporter"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+type Export struct {
+	e       *common.Environment
+	users   stores.UserStore
+	devices stores.DeviceStore
+}
+
+func NewExportController(e *common.Environment, us stores.UserStore, ds stores.DeviceStore) *Export {
+	return &Export{
+		e:       e,
+		users:   us,
+		devices: ds,
+	}
+}
+
+// ExportHandler streams devices or users as CSV or JSON. Results are limited
+// by the filters read by exporter.ParseFilter.
+func (ex *Export) ExportHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	resource := p.ByName("resource")
+
+	permission, ok := exporter.RequiredPermission(resource)
+	if !ok {
+		common.NewAPIResponse("Unknown export", nil).WriteResponse(w, http.StatusNotFound)
+		return
+	}
+	if !sessionUser.Can(permission) {
+		common.NewAPIResponse("Permission denied", nil).WriteResponse(w, http.StatusForbidden)
+		return
+	}
+
+	format, err := exporter.ParseFormat(r.FormValue("format"))
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+	filter, err := exporter.ParseFilter(r)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	count, err := exporter.New(ex.e, ex.users, ex.devices).WriteResponse(w, resource, format, filter)
+	if err != nil {
+		ex.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:api:export",
+			"resource": resource,
+		}).Error("Error exporting records")
+		return
+	}
+
+	ex.e.Log.WithFields(verbose.Fields{
+		"package":    "controllers:api:export",
+		"action":     "export",
+		"resource":   resource,
+		"records":    count,
+		"changed-by": sessionUser.Username,
+	}).Info("Records exported")
+}
@@ -0,0 +1,144 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lfkeitel/verbose/v4"
+	dhcp "github.com/packet-guardian/dhcp-lib"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/db"
+)
+
+// Time allowed for each readiness check
+const healthCheckTimeout = 2 * time.Second
+
+// Health serves the unauthenticated liveness and readiness endpoints used by
+// load balancers and service managers.
+type Health struct {
+	e      *common.Environment
+	checks []healthCheck
+}
+
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// HealthCheckResp is the public result of a readiness check. Errors may
+// reveal paths and database details so they're only logged.
+type HealthCheckResp struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+func NewHealthController(e *common.Environment) *Health {
+	h := &Health{e: e}
+	h.checks = []healthCheck{
+		{"database", h.checkDatabase},
+		{"schema", h.checkSchema},
+		{"sessions", h.checkSessions},
+		{"templates", h.checkTemplates},
+		{"dhcp_config", h.checkDHCPConfig},
+	}
+	return h
+}
+
+// LivenessHandler reports the process is running. It doesn't check any
+// dependencies so a busy database never gets the process restarted.
+func (h *Health) LivenessHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	common.NewAPIResponse("ok", nil).WriteResponse(w, http.StatusOK)
+}
+
+// ReadinessHandler runs each readiness check and reports their results. The
+// status is 503 if any check failed.
+func (h *Health) ReadinessHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	results := make([]*HealthCheckResp, 0, len(h.checks))
+	failed := verbose.Fields{}
+	for _, c := range h.checks {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		start := time.Now()
+		err := c.check(ctx)
+		cancel()
+
+		result := &HealthCheckResp{
+			Name:   c.name,
+			Status: "ok",
+		}
+		if err != nil {
+			failed[c.name] = fmt.Sprintf("%s (%s)", err, time.Since(start))
+			result.Status = "fail"
+		}
+		results = append(results, result)
+	}
+
+	if len(failed) > 0 {
+		failed["package"] = "controllers:api:health"
+		h.e.Log.WithFields(failed).Warning("Readiness check failed")
+		common.NewAPIResponse("not ready", results).WriteResponse(w, http.StatusServiceUnavailable)
+		return
+	}
+	common.NewAPIResponse("ready", results).WriteResponse(w, http.StatusOK)
+}
+
+func (h *Health) checkDatabase(ctx context.Context) error {
+	if h.e.DB == nil || h.e.DB.DB == nil {
+		return errors.New("Database not connected")
+	}
+	return h.e.DB.PingContext(ctx)
+}
+
+func (h *Health) checkSchema(ctx context.Context) error {
+	if h.e.DB == nil || h.e.DB.DB == nil {
+		return errors.New("Database not connected")
+	}
+	if ver := h.e.DB.SchemaVersion(); ver != db.DBVersion {
+		return fmt.Errorf("Database schema is version %d, expected %d", ver, db.DBVersion)
+	}
+	return nil
+}
+
+func (h *Health) checkSessions(ctx context.Context) error {
+	if h.e.Sessions == nil {
+		return errors.New("Session store not initialized")
+	}
+
+	switch h.e.Config.Webserver.SessionStore {
+	case "filesystem":
+		info, err := os.Stat(h.e.Config.Webserver.SessionsDir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", h.e.Config.Webserver.SessionsDir)
+		}
+	case "database":
+		rows, err := h.e.DB.QueryContext(ctx, `SELECT 1 FROM "sessions" LIMIT 1`)
+		if err != nil {
+			return err
+		}
+		rows.Close()
+	}
+	return nil
+}
+
+func (h *Health) checkTemplates(ctx context.Context) error {
+	if h.e.Views == nil || h.e.Views.TemplateCount() == 0 {
+		return errors.New("Templates not loaded")
+	}
+	return nil
+}
+
+func (h *Health) checkDHCPConfig(ctx context.Context) error {
+	_, err := dhcp.ParseFile(h.e.Config.DHCP.ConfigFile)
+	return err
+}
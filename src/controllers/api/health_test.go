@@ -0,0 +1,102 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/db"
+)
+
+func TestLivenessHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	NewHealthController(common.NewTestEnvironment()).LivenessHandler(w, req, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+}
+
+func TestReadinessHandler(t *testing.T) {
+	database, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer database.Close()
+
+	dir, err := os.MkdirTemp("", "pg-health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dhcpConfig := filepath.Join(dir, "dhcp.conf")
+	os.WriteFile(dhcpConfig, []byte("global\n    server-identifier 10.0.0.1\nend\n"), 0644)
+
+	e := common.NewTestEnvironment()
+	e.DB = &common.DatabaseAccessor{DB: database, Driver: "mysql"}
+	e.Sessions = &common.SessionStore{}
+	e.Config.Webserver.SessionStore = "database"
+	e.Config.DHCP.ConfigFile = dhcpConfig
+
+	readiness := func(schemaVersion int) (int, map[string]*HealthCheckResp) {
+		mock.ExpectQuery(`SELECT "value" FROM "settings"`).
+			WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(schemaVersion))
+		mock.ExpectQuery(`SELECT 1 FROM "sessions"`).
+			WillReturnRows(sqlmock.NewRows([]string{"1"}))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/readyz", nil)
+		controller := NewHealthController(e)
+		for i, c := range controller.checks {
+			if c.name == "templates" {
+				controller.checks[i].check = func(ctx context.Context) error { return nil }
+			}
+		}
+		controller.ReadinessHandler(w, req, nil)
+
+		var resp struct {
+			Data []*HealthCheckResp
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		checks := make(map[string]*HealthCheckResp, len(resp.Data))
+		for _, c := range resp.Data {
+			checks[c.Name] = c
+		}
+		return w.Code, checks
+	}
+
+	code, checks := readiness(db.DBVersion)
+	if code != http.StatusOK {
+		for _, c := range checks {
+			t.Logf("%s: %s", c.Name, c.Status)
+		}
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if len(checks) != 5 {
+		t.Errorf("Expected 5 checks, got %d", len(checks))
+	}
+
+	code, checks = readiness(db.DBVersion - 1)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", code)
+	}
+	if checks["schema"].Status != "fail" || checks["database"].Status != "ok" {
+		t.Errorf("Expected only the schema check to fail, got schema %s, database %s", checks["schema"].Status, checks["database"].Status)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
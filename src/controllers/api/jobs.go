@@ -0,0 +1,172 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+	"github.com/packet-guardian/packet-guardian/src/tasks"
+)
+
+const defaultJobHistoryLimit = 50
+
+// Jobs handles scheduled job history and manual runs.
+type Jobs struct {
+	e      *common.Environment
+	stores stores.StoreCollection
+}
+
+type jobResp struct {
+	Name     string            `json:"name"`
+	Schedule string            `json:"schedule"`
+	Disabled bool              `json:"disabled"`
+	Running  bool              `json:"running"`
+	NextRun  *time.Time        `json:"next_run"`
+	Status   *models.JobStatus `json:"status"`
+}
+
+type jobHistoryResp struct {
+	*jobResp
+	Runs []*models.JobRun `json:"runs"`
+}
+
+func NewJobsController(e *common.Environment, stores stores.StoreCollection) *Jobs {
+	return &Jobs{
+		e:      e,
+		stores: stores,
+	}
+}
+
+// GetJobsHandler lists the registered jobs with their schedule and last run.
+func (j *Jobs) GetJobsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	infos := tasks.RegisteredJobs(j.e.Config)
+	resp := make([]*jobResp, 0, len(infos))
+	for _, info := range infos {
+		job, err := j.jobResponse(info)
+		if err != nil {
+			j.e.Log.WithFields(verbose.Fields{
+				"error":   err,
+				"package": "controllers:api:jobs",
+				"job":     info.Name,
+			}).Error("Error getting job status")
+			common.NewAPIResponse("Error getting jobs", nil).WriteResponse(w, http.StatusInternalServerError)
+			return
+		}
+		resp = append(resp, job)
+	}
+
+	common.NewAPIResponse("", resp).WriteResponse(w, http.StatusOK)
+}
+
+// GetJobHandler returns a job and its run history, newest first. The number
+// of runs can be set with the limit query parameter.
+func (j *Jobs) GetJobHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	info := j.findJob(p.ByName("name"))
+	if info == nil {
+		common.NewAPIResponse(tasks.ErrUnknownJob.Error(), nil).WriteResponse(w, http.StatusNotFound)
+		return
+	}
+
+	limit := defaultJobHistoryLimit
+	if l := r.FormValue("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 {
+			common.NewAPIResponse("Invalid limit", nil).WriteResponse(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	job, err := j.jobResponse(info)
+	if err != nil {
+		j.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:jobs",
+			"job":     info.Name,
+		}).Error("Error getting job status")
+		common.NewAPIResponse("Error getting job", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	runs, err := j.stores.JobRuns.GetJobRuns(info.Name, limit)
+	if err != nil {
+		j.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:jobs",
+			"job":     info.Name,
+		}).Error("Error getting job runs")
+		common.NewAPIResponse("Error getting job", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+	if runs == nil {
+		runs = []*models.JobRun{}
+	}
+
+	common.NewAPIResponse("", &jobHistoryResp{jobResp: job, Runs: runs}).WriteResponse(w, http.StatusOK)
+}
+
+// RunJobHandler starts a job in the background. The run shows in the job
+// history once it finishes.
+func (j *Jobs) RunJobHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	name := p.ByName("name")
+
+	switch err := tasks.RunJob(j.e, j.stores, name, sessionUser.Username); err {
+	case nil:
+	case tasks.ErrUnknownJob:
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusNotFound)
+		return
+	case tasks.ErrJobRunning:
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusConflict)
+		return
+	default:
+		common.NewAPIResponse("Error starting job", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	j.e.Log.WithFields(verbose.Fields{
+		"package":    "controllers:api:jobs",
+		"action":     "run_job",
+		"job":        name,
+		"changed-by": sessionUser.Username,
+	}).Info("Job started manually")
+	common.NewAPIResponse("Job started", nil).WriteResponse(w, http.StatusAccepted)
+}
+
+func (j *Jobs) findJob(name string) *tasks.JobInfo {
+	for _, info := range tasks.RegisteredJobs(j.e.Config) {
+		if info.Name == name {
+			return info
+		}
+	}
+	return nil
+}
+
+func (j *Jobs) jobResponse(info *tasks.JobInfo) (*jobResp, error) {
+	status, err := j.stores.JobRuns.GetJobStatus(info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &jobResp{
+		Name:     info.Name,
+		Schedule: info.Schedule,
+		Disabled: info.Disabled,
+		Running:  info.Running,
+		Status:   status,
+	}
+	if !info.NextRun.IsZero() {
+		next := info.NextRun.UTC()
+		resp.NextRun = &next
+	}
+	return resp, nil
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+func jobsTestSetup() (*Jobs, *http.Request) {
+	e := common.NewTestEnvironment()
+	start := time.Now().Add(-72 * time.Hour)
+
+	runStore := &stores.TestJobRunStore{}
+	for i, errStr := range []string{"", "database gone", "database gone"} {
+		run := models.NewJobRun(runStore, "purge-devices")
+		run.Started = start.Add(time.Duration(i) * 24 * time.Hour)
+		run.Finished = run.Started.Add(time.Second)
+		run.Error = errStr
+		run.Save()
+	}
+
+	admin := models.NewUser(e, &stores.TestUserStore{}, &stores.TestBlacklistItem{}, "admin")
+	admin.Rights = models.ManageJobs
+
+	req, _ := http.NewRequest("", "", nil)
+	req = common.SetEnvironmentToContext(req, e)
+	req = common.SetSessionToContext(req, common.NewTestSession())
+	req = models.SetUserToContext(req, admin)
+
+	return NewJobsController(e, stores.StoreCollection{JobRuns: runStore}), req
+}
+
+func TestGetJobs(t *testing.T) {
+	controller, req := jobsTestSetup()
+
+	w := httptest.NewRecorder()
+	controller.GetJobHandler(w, req, httprouter.Params{{Key: "name", Value: "purge-devices"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var resp struct {
+		Data struct {
+			Name   string `json:"name"`
+			Status struct {
+				FailingSince *time.Time `json:"failing_since"`
+			} `json:"status"`
+			Runs []*struct {
+				Failed bool `json:"failed"`
+			} `json:"runs"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Data.Runs) != 3 || !resp.Data.Runs[0].Failed || resp.Data.Runs[2].Failed {
+		t.Errorf("Expected 3 runs newest first, got %#v", resp.Data.Runs)
+	}
+	if resp.Data.Status.FailingSince == nil || time.Since(*resp.Data.Status.FailingSince) < 47*time.Hour {
+		t.Errorf("Expected job to be failing for 2 days, got %v", resp.Data.Status.FailingSince)
+	}
+}
+
+func TestUnknownJob(t *testing.T) {
+	controller, req := jobsTestSetup()
+	params := httprouter.Params{{Key: "name", Value: "make-coffee"}}
+
+	w := httptest.NewRecorder()
+	controller.GetJobHandler(w, req, params)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected unknown job to return not found, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	controller.RunJobHandler(w, req, params)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected running unknown job to return not found, got %d", w.Code)
+	}
+}
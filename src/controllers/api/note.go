@@ -0,0 +1,155 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+// Note handles the notes logs of devices and users.
+type Note struct {
+	e       *common.Environment
+	devices stores.DeviceStore
+	notes   stores.NoteStore
+}
+
+func NewNoteController(e *common.Environment, ds stores.DeviceStore, ns stores.NoteStore) *Note {
+	return &Note{
+		e:       e,
+		devices: ds,
+		notes:   ns,
+	}
+}
+
+// GetNotesHandler returns the notes log of a device or user, oldest first.
+func (n *Note) GetNotesHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	entity, key, httpCode, err := n.checkNotePermissions(r, p, false)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, httpCode)
+		return
+	}
+
+	notes, err := n.notes.GetNotes(entity, key)
+	if err != nil {
+		n.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:note",
+			"entity":  entity,
+			"key":     key,
+		}).Error("Error getting notes")
+		common.NewAPIResponse("Error getting notes", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+	if notes == nil {
+		notes = []*models.Note{}
+	}
+
+	common.NewAPIResponse("", notes).WriteResponse(w, http.StatusOK)
+}
+
+// AddNoteHandler appends a note to the log of a device or user.
+func (n *Note) AddNoteHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+
+	entity, key, httpCode, err := n.checkNotePermissions(r, p, true)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, httpCode)
+		return
+	}
+
+	text := strings.TrimSpace(r.FormValue("text"))
+	if text == "" {
+		common.NewAPIResponse("Note text required", nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	note, err := addNote(n.e, n.notes, entity, key, sessionUser.Username, text)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+	common.NewAPIResponse("Note added", note).WriteResponse(w, http.StatusOK)
+}
+
+// checkNotePermissions returns the entity and key of the notes log in the
+// request. Viewing requires ViewDevices or ViewUsers, adding notes requires
+// EditDevice or EditUser.
+func (n *Note) checkNotePermissions(r *http.Request, p httprouter.Params, edit bool) (string, string, int, error) {
+	sessionUser := models.GetUserFromContext(r)
+	entity := p.ByName("entity")
+
+	switch entity {
+	case models.NoteEntityDevice:
+		if !sessionUser.Can(models.ViewDevices) || (edit && !sessionUser.Can(models.EditDevice)) {
+			return "", "", http.StatusForbidden, errors.New("Permission denied")
+		}
+
+		mac, err := net.ParseMAC(p.ByName("key"))
+		if err != nil {
+			return "", "", http.StatusBadRequest, errors.New("Invalid MAC address")
+		}
+
+		device, err := n.devices.GetDeviceByMAC(mac)
+		if err != nil {
+			n.e.Log.WithFields(verbose.Fields{
+				"error":   err,
+				"package": "controllers:api:note",
+				"mac":     mac.String(),
+			}).Error("Error getting device")
+			return "", "", http.StatusInternalServerError, errors.New("Server error")
+		}
+		if device.ID == 0 {
+			return "", "", http.StatusNotFound, errors.New("Device not found")
+		}
+		return entity, mac.String(), 0, nil
+
+	case models.NoteEntityUser:
+		if !sessionUser.Can(models.ViewUsers) || (edit && !sessionUser.Can(models.EditUser)) {
+			return "", "", http.StatusForbidden, errors.New("Permission denied")
+		}
+
+		username := strings.ToLower(p.ByName("key"))
+		if username == "" {
+			return "", "", http.StatusBadRequest, errors.New("Username required")
+		}
+		return entity, username, 0, nil
+	}
+	return "", "", http.StatusNotFound, errors.New("Unknown notes type")
+}
+
+// addNote appends text to the notes log of a device or user.
+func addNote(e *common.Environment, notes stores.NoteStore, entity, key, author, text string) (*models.Note, error) {
+	note := models.NewNote(notes, entity, key)
+	note.Author = author
+	note.Text = text
+
+	if err := note.Save(); err != nil {
+		e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:note",
+			"entity":  entity,
+			"key":     key,
+		}).Error("Error saving note")
+		return nil, errors.New("Error saving note")
+	}
+
+	e.Log.WithFields(verbose.Fields{
+		"package":    "controllers:api:note",
+		"entity":     entity,
+		"key":        key,
+		"changed-by": author,
+		"action":     "add_note",
+	}).Info("Note added")
+	return note, nil
+}
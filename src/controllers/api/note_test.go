@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+const (
+	noteViewRights = models.ViewDevices | models.ViewUsers
+	noteEditRights = noteViewRights | models.EditDevice | models.EditUser
+)
+
+func noteTestSetup(perms models.Permission, form map[string][]string) (*Note, *stores.TestNoteStore, *http.Request) {
+	e := common.NewTestEnvironment()
+
+	testMac, _ := net.ParseMAC("12:34:56:12:34:56")
+	testDeviceStore := &stores.TestDeviceStore{}
+
+	testDevice := models.NewDevice(testDeviceStore, nil, &stores.TestBlacklistItem{Val: false})
+	testDevice.ID = 1
+	testDevice.MAC = testMac
+	testDevice.Username = "owner"
+
+	testDeviceStore.Devices = []*models.Device{testDevice}
+
+	testuser := models.NewUser(
+		e,
+		&stores.TestUserStore{},
+		&stores.TestBlacklistItem{Val: false},
+		"admin",
+	)
+	testuser.Rights = perms
+
+	req, _ := http.NewRequest("", "", nil)
+	req = common.SetEnvironmentToContext(req, e)
+	req = common.SetSessionToContext(req, common.NewTestSession())
+	req = models.SetUserToContext(req, testuser)
+	req.PostForm = form
+
+	testNoteStore := &stores.TestNoteStore{}
+	return NewNoteController(e, testDeviceStore, testNoteStore), testNoteStore, req
+}
+
+var addNoteTests = []struct {
+	name    string
+	perms   models.Permission
+	entity  string
+	key     string
+	text    string
+	code    int
+	noteKey string
+}{
+	{"View only", noteViewRights, models.NoteEntityDevice, "12:34:56:12:34:56", "Called owner", http.StatusForbidden, ""},
+	{"Empty note", noteEditRights, models.NoteEntityDevice, "12:34:56:12:34:56", "  ", http.StatusBadRequest, ""},
+	{"Unknown device", noteEditRights, models.NoteEntityDevice, "ab:cd:ef:ab:cd:ef", "Called owner", http.StatusNotFound, ""},
+	{"Unknown entity", noteEditRights, "lease", "12:34:56:12:34:56", "Called owner", http.StatusNotFound, ""},
+	{"Device note", noteEditRights, models.NoteEntityDevice, "12-34-56-12-34-56", "Called owner", http.StatusOK, "12:34:56:12:34:56"},
+	{"User note", noteEditRights, models.NoteEntityUser, "Owner", "Called owner", http.StatusOK, "owner"},
+}
+
+func TestAddNote(t *testing.T) {
+	for _, test := range addNoteTests {
+		t.Run(test.name, func(t *testing.T) {
+			testHandler, noteStore, req := noteTestSetup(test.perms, map[string][]string{
+				"text": {test.text},
+			})
+			params := httprouter.Params{{Key: "entity", Value: test.entity}, {Key: "key", Value: test.key}}
+
+			w := httptest.NewRecorder()
+			testHandler.AddNoteHandler(w, req, params)
+
+			if w.Code != test.code {
+				t.Fatalf("Expected status %d, got %d", test.code, w.Code)
+			}
+			if test.code != http.StatusOK {
+				if len(noteStore.Notes) != 0 {
+					t.Errorf("Expected no notes, got %d", len(noteStore.Notes))
+				}
+				return
+			}
+
+			if len(noteStore.Notes) != 1 {
+				t.Fatalf("Expected 1 note, got %d", len(noteStore.Notes))
+			}
+			note := noteStore.Notes[0]
+			if note.Key != test.noteKey || note.Author != "admin" || note.Text != test.text {
+				t.Errorf("Unexpected note %#v", note)
+			}
+		})
+	}
+}
+
+func TestGetNotes(t *testing.T) {
+	testHandler, noteStore, req := noteTestSetup(noteViewRights, nil)
+	for _, text := range []string{"First", "Second"} {
+		note := models.NewNote(noteStore, models.NoteEntityDevice, "12:34:56:12:34:56")
+		note.Author = "admin"
+		note.Text = text
+		note.Save()
+	}
+
+	w := httptest.NewRecorder()
+	params := httprouter.Params{{Key: "entity", Value: models.NoteEntityDevice}, {Key: "key", Value: "12:34:56:12:34:56"}}
+	testHandler.GetNotesHandler(w, req, params)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var resp struct {
+		Data []struct {
+			Author string `json:"author"`
+			Text   string `json:"text"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 2 || resp.Data[0].Text != "First" || resp.Data[1].Text != "Second" {
+		t.Errorf("Unexpected notes %#v", resp.Data)
+	}
+}
@@ -0,0 +1,100 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+// Policy handles users accepting the registration policy.
+type Policy struct {
+	e        *common.Environment
+	policies stores.PolicyStore
+}
+
+func NewPolicyController(e *common.Environment, ps stores.PolicyStore) *Policy {
+	return &Policy{
+		e:        e,
+		policies: ps,
+	}
+}
+
+// AcceptHandler records the session user accepting the current policy. The
+// version shown to the user must be given so an outdated page can't accept
+// a newer policy.
+func (p *Policy) AcceptHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+
+	policy, err := p.policies.GetCurrentPolicy()
+	if err != nil {
+		p.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:policy",
+		}).Error("Error getting policy")
+		common.NewAPIResponse("Server error", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	if !policy.Versioned() || r.FormValue("version") != strconv.Itoa(policy.ID) {
+		common.NewAPIResponse("The policy has changed, please reload the page", nil).WriteResponse(w, http.StatusConflict)
+		return
+	}
+
+	acceptance, err := acceptPolicy(p.e, p.policies, r, sessionUser, policy)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	common.NewAPIResponse("Policy accepted", acceptance).WriteResponse(w, http.StatusOK)
+}
+
+// acceptPolicy records user accepting policy if they haven't already. The
+// returned acceptance is the user's first acceptance of the version.
+func acceptPolicy(e *common.Environment, policies stores.PolicyStore, r *http.Request, user *models.User, policy *models.Policy) (*models.PolicyAcceptance, error) {
+	acceptance, err := policies.GetAcceptance(user.Username, policy.ID)
+	if err != nil {
+		e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:api:policy",
+			"username": user.Username,
+		}).Error("Error getting policy acceptance")
+		return nil, errors.New("Error accepting policy")
+	}
+	if acceptance.ID != 0 {
+		return acceptance, nil
+	}
+
+	acceptance.Accepted = time.Now()
+	if ip := common.GetIPFromContext(r); ip != nil {
+		acceptance.IP = ip.String()
+	}
+	if err := policies.SaveAcceptance(acceptance); err != nil {
+		e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:api:policy",
+			"username": user.Username,
+		}).Error("Error saving policy acceptance")
+		return nil, errors.New("Error accepting policy")
+	}
+
+	e.Log.WithFields(verbose.Fields{
+		"package":  "controllers:api:policy",
+		"username": user.Username,
+		"version":  policy.ID,
+		"ip":       acceptance.IP,
+		"action":   "accept_policy",
+	}).Info("Registration policy accepted")
+	return acceptance, nil
+}
@@ -6,12 +6,18 @@ import (
 	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/lfkeitel/verbose/v4"
 	"github.com/packet-guardian/packet-guardian/src/common"
 	"github.com/packet-guardian/packet-guardian/src/db"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+	"github.com/packet-guardian/packet-guardian/src/tasks"
 )
 
 type Status struct {
-	e *common.Environment
+	e         *common.Environment
+	jobRuns   stores.JobRunStore
+	taskLocks stores.TaskLockStore
 }
 
 type StatusResp struct {
@@ -19,6 +25,8 @@ type StatusResp struct {
 	Database    *DatabaseStatusResp    `json:"database"`
 	GoRoutines  *GoRoutineStatusResp   `json:"go_routines"`
 	Memory      *MemoryStatusResp      `json:"memory"`
+	Jobs        []*models.JobStatus    `json:"jobs"`
+	Scheduler   *SchedulerStatusResp   `json:"scheduler"`
 }
 
 type ApplicationStatusResp struct {
@@ -31,6 +39,12 @@ type DatabaseStatusResp struct {
 	Type    string `json:"type"`
 }
 
+type SchedulerStatusResp struct {
+	Instance string `json:"instance"`
+	Leader   string `json:"leader"`
+	IsLeader bool   `json:"is_leader"`
+}
+
 type GoRoutineStatusResp struct {
 	RoutineNum int `json:"routine_num"`
 }
@@ -47,8 +61,12 @@ type MemoryStatusResp struct {
 	LastGC       string `json:"last_gc"`
 }
 
-func NewStatusController(e *common.Environment) *Status {
-	return &Status{e: e}
+func NewStatusController(e *common.Environment, jobRuns stores.JobRunStore, taskLocks stores.TaskLockStore) *Status {
+	return &Status{
+		e:         e,
+		jobRuns:   jobRuns,
+		taskLocks: taskLocks,
+	}
 }
 
 func (s *Status) GetStatus(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
@@ -57,6 +75,8 @@ func (s *Status) GetStatus(w http.ResponseWriter, r *http.Request, _ httprouter.
 		Database:    s.databaseStatus(),
 		GoRoutines:  s.goRoutineStatus(),
 		Memory:      s.memoryStatus(),
+		Jobs:        s.jobStatus(),
+		Scheduler:   s.schedulerStatus(),
 	}
 
 	common.NewAPIResponse("", data).WriteResponse(w, http.StatusOK)
@@ -82,6 +102,44 @@ func (s *Status) databaseStatus() *DatabaseStatusResp {
 	}
 }
 
+// jobStatus returns the run summary of each registered job. Monitoring can
+// alert on failing_since to catch jobs that keep failing.
+func (s *Status) jobStatus() []*models.JobStatus {
+	infos := tasks.RegisteredJobs(s.e.Config)
+	statuses := make([]*models.JobStatus, 0, len(infos))
+	for _, info := range infos {
+		status, err := s.jobRuns.GetJobStatus(info.Name)
+		if err != nil {
+			s.e.Log.WithFields(verbose.Fields{
+				"error":   err,
+				"package": "controllers:api:status",
+				"job":     info.Name,
+			}).Error("Error getting job status")
+			status = &models.JobStatus{Job: info.Name}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// schedulerStatus returns which instance runs scheduled jobs. Leader is
+// empty if no instance holds the scheduler lock.
+func (s *Status) schedulerStatus() *SchedulerStatusResp {
+	holder, _, err := s.taskLocks.GetHolder(tasks.SchedulerLock)
+	if err != nil {
+		s.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:status",
+		}).Error("Error getting scheduler lock")
+	}
+
+	return &SchedulerStatusResp{
+		Instance: tasks.InstanceID(s.e.Config),
+		Leader:   holder,
+		IsLeader: tasks.IsLeader(),
+	}
+}
+
 func (s *Status) goRoutineStatus() *GoRoutineStatusResp {
 	return &GoRoutineStatusResp{
 		RoutineNum: runtime.NumGoroutine(),
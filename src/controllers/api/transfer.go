@@ -0,0 +1,439 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+	"github.com/packet-guardian/packet-guardian/src/webhooks"
+)
+
+// transferActions are the audit log actions for each final transfer state
+var transferActions = map[string]string{
+	models.TransferAccepted:  "accept_transfer_device",
+	models.TransferDeclined:  "decline_transfer_device",
+	models.TransferCancelled: "cancel_transfer_device",
+}
+
+// Transfer handles device transfers between users. An owner offers a device
+// to another user who then accepts or declines it.
+type Transfer struct {
+	e         *common.Environment
+	users     stores.UserStore
+	devices   stores.DeviceStore
+	transfers stores.TransferStore
+	webhooks  stores.WebhookStore
+	device    *Device
+}
+
+func NewTransferController(e *common.Environment, us stores.UserStore, ds stores.DeviceStore, ts stores.TransferStore, ws stores.WebhookStore) *Transfer {
+	return &Transfer{
+		e:         e,
+		users:     us,
+		devices:   ds,
+		transfers: ts,
+		webhooks:  ws,
+		device:    NewDeviceController(e, us, ds, nil, nil, nil, ws),
+	}
+}
+
+// OfferHandler creates a pending transfer of a device to another user.
+func (t *Transfer) OfferHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	mac, err := net.ParseMAC(p.ByName("mac"))
+	if err != nil {
+		common.NewAPIResponse("Invalid MAC address", nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	username := strings.TrimSpace(r.FormValue("username"))
+	if username == "" {
+		common.NewAPIResponse("Username required", nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	device, err := t.devices.GetDeviceByMAC(mac)
+	if err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:transfer",
+			"mac":     mac.String(),
+		}).Error("Error getting device")
+		common.NewAPIResponse("Server error", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	if device.ID == 0 {
+		common.NewAPIResponse("Device not found", nil).WriteResponse(w, http.StatusNotFound)
+		return
+	}
+
+	httpCode, err := t.device.editDevicePermissionCheck(sessionUser, device)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, httpCode)
+		return
+	}
+
+	if sessionUser.IsBlacklisted() {
+		common.NewAPIResponse("Username blocked", nil).WriteResponse(w, http.StatusForbidden)
+		return
+	}
+
+	// Protect blacklisted devices
+	if device.IsBlacklisted() {
+		t.e.Log.WithFields(verbose.Fields{
+			"package":    "controllers:api:transfer",
+			"changed-by": sessionUser.Username,
+			"mac":        device.MAC.String(),
+		}).Error("Attempted transferring a blocked device")
+		common.NewAPIResponse("Blocked devices can't be transferred", nil).WriteResponse(w, http.StatusForbidden)
+		return
+	}
+
+	if username == device.Username {
+		common.NewAPIResponse("Device is already owned by "+username, nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	pending, err := t.transfers.GetPendingTransferForDevice(device.MAC)
+	if err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:transfer",
+			"mac":     mac.String(),
+		}).Error("Error getting transfer")
+		common.NewAPIResponse("Server error", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+	if pending.ID != 0 {
+		common.NewAPIResponse("Device already has a pending transfer to "+pending.ToUser, nil).WriteResponse(w, http.StatusConflict)
+		return
+	}
+
+	recipient, err := t.users.GetUserByUsername(username)
+	if err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:api:transfer",
+			"username": username,
+		}).Error("Error getting user")
+		common.NewAPIResponse("Server error", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	httpCode, err = t.checkRecipient(recipient, device)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, httpCode)
+		return
+	}
+
+	transfer := models.NewDeviceTransfer(t.transfers)
+	transfer.MAC = device.MAC
+	transfer.FromUser = device.Username
+	transfer.ToUser = recipient.Username
+	transfer.Created = time.Now()
+
+	if err := transfer.Save(); err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:transfer",
+		}).Error("Error saving transfer")
+		common.NewAPIResponse("Error saving transfer", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	t.e.Log.WithFields(verbose.Fields{
+		"package":      "controllers:api:transfer",
+		"action":       "offer_transfer_device",
+		"transfer-id":  transfer.ID,
+		"mac":          device.MAC.String(),
+		"old-username": transfer.FromUser,
+		"new-username": transfer.ToUser,
+		"changed-by":   sessionUser.Username,
+	}).Info("Device transfer offered")
+	common.NewAPIResponse("Device transfer offered to "+transfer.ToUser, transfer).WriteResponse(w, http.StatusOK)
+}
+
+// AcceptHandler moves the device of a pending transfer to the recipient.
+func (t *Transfer) AcceptHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	transfer, httpCode, err := t.getPendingTransfer(p)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, httpCode)
+		return
+	}
+
+	recipient, err := t.users.GetUserByUsername(transfer.ToUser)
+	if err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:api:transfer",
+			"username": transfer.ToUser,
+		}).Error("Error getting user")
+		common.NewAPIResponse("Server error", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	if !t.canRespond(sessionUser, recipient) {
+		common.NewAPIResponse("Permission denied", nil).WriteResponse(w, http.StatusForbidden)
+		return
+	}
+
+	device, err := t.devices.GetDeviceByMAC(transfer.MAC)
+	if err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:transfer",
+			"mac":     transfer.MAC.String(),
+		}).Error("Error getting device")
+		common.NewAPIResponse("Server error", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	// The device was deleted or reassigned since the offer was made
+	if device.ID == 0 || device.Username != transfer.FromUser {
+		t.resolve(transfer, models.TransferCancelled, sessionUser, "Device transfer cancelled, device changed owner")
+		common.NewAPIResponse("Device is no longer owned by "+transfer.FromUser, nil).WriteResponse(w, http.StatusConflict)
+		return
+	}
+
+	if device.IsBlacklisted() {
+		common.NewAPIResponse("Blocked devices can't be transferred", nil).WriteResponse(w, http.StatusForbidden)
+		return
+	}
+
+	httpCode, err = t.checkRecipient(recipient, device)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, httpCode)
+		return
+	}
+
+	device.Username = recipient.Username
+	device.ChangedBy = sessionUser.Username
+	// Change expiration to reflect new owner
+	device.Expires = recipient.DeviceExpiration.NextExpiration(t.e, time.Now())
+	if err := device.Save(); err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:transfer",
+		}).Error("Error saving device")
+		common.NewAPIResponse("Error saving device", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	if !t.resolve(transfer, models.TransferAccepted, sessionUser, "Device transfer accepted") {
+		common.NewAPIResponse("Error saving transfer", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+	webhooks.Fire(t.e, t.webhooks, common.WebhookDeviceReassigned, sessionUser.Username, &webhooks.DeviceData{
+		Device:           device,
+		PreviousUsername: transfer.FromUser,
+	})
+	common.NewAPIResponse("Device transferred successfully", transfer).WriteResponse(w, http.StatusOK)
+}
+
+// DeclineHandler rejects a pending transfer, the device stays with its owner.
+func (t *Transfer) DeclineHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	transfer, httpCode, err := t.getPendingTransfer(p)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, httpCode)
+		return
+	}
+
+	recipient, err := t.users.GetUserByUsername(transfer.ToUser)
+	if err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:api:transfer",
+			"username": transfer.ToUser,
+		}).Error("Error getting user")
+		common.NewAPIResponse("Server error", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	if !t.canRespond(sessionUser, recipient) {
+		common.NewAPIResponse("Permission denied", nil).WriteResponse(w, http.StatusForbidden)
+		return
+	}
+
+	if !t.resolve(transfer, models.TransferDeclined, sessionUser, "Device transfer declined") {
+		common.NewAPIResponse("Error saving transfer", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+	common.NewAPIResponse("Device transfer declined", transfer).WriteResponse(w, http.StatusOK)
+}
+
+// CancelHandler withdraws a pending transfer. It can be used by anyone who
+// could have offered the device.
+func (t *Transfer) CancelHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	transfer, httpCode, err := t.getPendingTransfer(p)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, httpCode)
+		return
+	}
+
+	device, err := t.devices.GetDeviceByMAC(transfer.MAC)
+	if err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:transfer",
+			"mac":     transfer.MAC.String(),
+		}).Error("Error getting device")
+		common.NewAPIResponse("Server error", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	if device.ID != 0 {
+		httpCode, err := t.device.editDevicePermissionCheck(sessionUser, device)
+		if err != nil {
+			common.NewAPIResponse(err.Error(), nil).WriteResponse(w, httpCode)
+			return
+		}
+	} else if transfer.FromUser != sessionUser.Username && !sessionUser.Can(models.EditDevice) {
+		common.NewAPIResponse("Permission denied", nil).WriteResponse(w, http.StatusForbidden)
+		return
+	}
+
+	if !t.resolve(transfer, models.TransferCancelled, sessionUser, "Device transfer cancelled") {
+		common.NewAPIResponse("Error saving transfer", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+	common.NewAPIResponse("Device transfer cancelled", transfer).WriteResponse(w, http.StatusOK)
+}
+
+// GetTransfersHandler returns the pending transfers to and from a user.
+func (t *Transfer) GetTransfersHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	username := p.ByName("username")
+
+	user, err := t.users.GetUserByUsername(username)
+	if err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:api:transfer",
+			"username": username,
+		}).Error("Error getting user")
+		common.NewAPIResponse("Server error", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	if !sessionUser.Can(models.ViewDevices) &&
+		sessionUser.Username != user.Username &&
+		!user.DelegateCan(sessionUser.Username, models.ViewDevices) {
+		common.NewAPIResponse("Permission denied", nil).WriteResponse(w, http.StatusForbidden)
+		return
+	}
+
+	incoming, err := t.transfers.GetPendingTransfersToUser(user.Username)
+	if err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:api:transfer",
+			"username": username,
+		}).Error("Error getting transfers")
+		common.NewAPIResponse("Server error", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	outgoing, err := t.transfers.GetPendingTransfersFromUser(user.Username)
+	if err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:api:transfer",
+			"username": username,
+		}).Error("Error getting transfers")
+		common.NewAPIResponse("Server error", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	common.NewAPIResponse("", map[string][]*models.DeviceTransfer{
+		"incoming": incoming,
+		"outgoing": outgoing,
+	}).WriteResponse(w, http.StatusOK)
+}
+
+func (t *Transfer) getPendingTransfer(p httprouter.Params) (*models.DeviceTransfer, int, error) {
+	id, err := strconv.Atoi(p.ByName("id"))
+	if err != nil || id < 1 {
+		return nil, http.StatusBadRequest, errors.New("Invalid transfer ID")
+	}
+
+	transfer, err := t.transfers.GetTransferByID(id)
+	if err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":       err,
+			"package":     "controllers:api:transfer",
+			"transfer-id": id,
+		}).Error("Error getting transfer")
+		return nil, http.StatusInternalServerError, errors.New("Server error")
+	}
+
+	if transfer.ID == 0 {
+		return nil, http.StatusNotFound, errors.New("Transfer not found")
+	}
+	if !transfer.IsPending() {
+		return nil, http.StatusConflict, errors.New("Transfer was already " + transfer.Status)
+	}
+	return transfer, 0, nil
+}
+
+// checkRecipient makes sure the recipient is allowed to take ownership of device.
+func (t *Transfer) checkRecipient(recipient *models.User, device *models.Device) (int, error) {
+	if recipient.IsBlacklisted() {
+		return http.StatusForbidden, errors.New("User " + recipient.Username + " is blocked")
+	}
+	if recipient.IsExpired() {
+		return http.StatusForbidden, errors.New("User " + recipient.Username + " is expired")
+	}
+	if httpCode, err := t.device.checkDeviceLimitRegister(recipient); err != nil {
+		return httpCode, err
+	}
+	return t.device.checkCategoryLimitRegister(recipient, device.Platform)
+}
+
+// canRespond returns if sessionUser can accept or decline transfers to recipient.
+func (t *Transfer) canRespond(sessionUser, recipient *models.User) bool {
+	if sessionUser.Username == recipient.Username {
+		return true
+	}
+	return recipient.DelegateCan(sessionUser.Username, models.CreateDevice)
+}
+
+// resolve finalizes the transfer and records who did it. It returns false
+// if the transfer couldn't be saved.
+func (t *Transfer) resolve(transfer *models.DeviceTransfer, status string, sessionUser *models.User, msg string) bool {
+	transfer.Resolve(status, sessionUser.Username)
+	if err := transfer.Save(); err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":       err,
+			"package":     "controllers:api:transfer",
+			"transfer-id": transfer.ID,
+		}).Error("Error saving transfer")
+		return false
+	}
+
+	t.e.Log.WithFields(verbose.Fields{
+		"package":      "controllers:api:transfer",
+		"action":       transferActions[status],
+		"transfer-id":  transfer.ID,
+		"mac":          transfer.MAC.String(),
+		"old-username": transfer.FromUser,
+		"new-username": transfer.ToUser,
+		"changed-by":   sessionUser.Username,
+	}).Info(msg)
+	return true
+}
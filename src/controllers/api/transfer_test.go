@@ -0,0 +1,157 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+// transferTestSetup creates an owner with one device, a recipient with
+// recipientDevices devices, and a request from sessionUser. The global device
+// limit is 2. When offered is set the owner's device has a pending transfer to
+// the recipient.
+func transferTestSetup(sessionUser string, recipientDevices int, recipientBlacklisted, offered bool) (*Transfer, *stores.TestTransferStore, *http.Request) {
+	e := common.NewTestEnvironment()
+	e.Config.Registration.DefaultDeviceLimit = 2
+
+	testDeviceStore := &stores.TestDeviceStore{}
+	testTransferStore := &stores.TestTransferStore{}
+	testUserStore := &stores.TestUserStore{}
+
+	var sessionuser *models.User
+	for _, username := range []string{"owner", "recipient", "other"} {
+		blacklisted := username == "recipient" && recipientBlacklisted
+		user := models.NewUser(e, testUserStore, &stores.TestBlacklistItem{Val: blacklisted}, username)
+		user.Rights = models.ViewOwn | models.ManageOwnRights
+		testUserStore.Users = append(testUserStore.Users, user)
+		if username == sessionUser {
+			sessionuser = user
+		}
+	}
+
+	testDevice := models.NewDevice(testDeviceStore, nil, &stores.TestBlacklistItem{})
+	testDevice.ID = 1
+	testDevice.MAC, _ = net.ParseMAC("12:34:56:12:34:56")
+	testDevice.Username = "owner"
+	testDeviceStore.Devices = append(testDeviceStore.Devices, testDevice)
+
+	for i := 0; i < recipientDevices; i++ {
+		d := models.NewDevice(testDeviceStore, nil, &stores.TestBlacklistItem{})
+		d.ID = i + 2
+		d.MAC = net.HardwareAddr{0x12, 0x34, 0x56, 0, 0, byte(i)}
+		d.Username = "recipient"
+		testDeviceStore.Devices = append(testDeviceStore.Devices, d)
+	}
+
+	if offered {
+		transfer := models.NewDeviceTransfer(testTransferStore)
+		transfer.MAC = testDevice.MAC
+		transfer.FromUser = "owner"
+		transfer.ToUser = "recipient"
+		transfer.Save()
+	}
+
+	req, _ := http.NewRequest("", "", nil)
+	req = common.SetEnvironmentToContext(req, e)
+	req = common.SetSessionToContext(req, common.NewTestSession())
+	req = models.SetUserToContext(req, sessionuser)
+
+	return NewTransferController(e, testUserStore, testDeviceStore, testTransferStore, nil), testTransferStore, req
+}
+
+var transferOfferTests = []struct {
+	name                 string
+	sessionUser          string
+	recipientDevices     int
+	recipientBlacklisted bool
+	offered              bool
+	code                 int
+	transfers            int
+}{
+	{"Owner", "owner", 0, false, false, http.StatusOK, 1},
+	{"Not owner", "other", 0, false, false, http.StatusUnauthorized, 0},
+	{"Blocked recipient", "owner", 0, true, false, http.StatusForbidden, 0},
+	{"Recipient at limit", "owner", 2, false, false, http.StatusConflict, 0},
+	{"Already offered", "owner", 0, false, true, http.StatusConflict, 1},
+}
+
+func TestTransferOffer(t *testing.T) {
+	for _, test := range transferOfferTests {
+		t.Run(test.name, func(t *testing.T) {
+			testHandler, transferStore, req := transferTestSetup(test.sessionUser, test.recipientDevices, test.recipientBlacklisted, test.offered)
+			req.PostForm = map[string][]string{
+				"username": {"recipient"},
+			}
+			params := httprouter.Params{{Key: "mac", Value: "12:34:56:12:34:56"}}
+
+			w := httptest.NewRecorder()
+			testHandler.OfferHandler(w, req, params)
+
+			if w.Code != test.code {
+				t.Errorf("Wrong HTTP code. Expected %d, got %d", test.code, w.Code)
+			}
+			if len(transferStore.Transfers) != test.transfers {
+				t.Errorf("Expected %d transfers, got %d", test.transfers, len(transferStore.Transfers))
+			}
+		})
+	}
+}
+
+var transferResponseTests = []struct {
+	name             string
+	handler          func(*Transfer) httprouter.Handle
+	sessionUser      string
+	recipientDevices int
+	status           string
+	code             int
+	newStatus        string
+	owner            string
+}{
+	{"Accept by other user", acceptHandler, "other", 1, models.TransferPending, http.StatusForbidden, models.TransferPending, "owner"},
+	{"Accept by recipient", acceptHandler, "recipient", 1, models.TransferPending, http.StatusOK, models.TransferAccepted, "recipient"},
+	{"Accept resolved transfer", acceptHandler, "recipient", 1, models.TransferAccepted, http.StatusConflict, models.TransferAccepted, "owner"},
+	{"Accept over device limit", acceptHandler, "recipient", 2, models.TransferPending, http.StatusConflict, models.TransferPending, "owner"},
+	{"Decline by recipient", declineHandler, "recipient", 0, models.TransferPending, http.StatusOK, models.TransferDeclined, "owner"},
+	{"Cancel by other user", cancelHandler, "other", 0, models.TransferPending, http.StatusUnauthorized, models.TransferPending, "owner"},
+	{"Cancel by owner", cancelHandler, "owner", 0, models.TransferPending, http.StatusOK, models.TransferCancelled, "owner"},
+}
+
+func acceptHandler(t *Transfer) httprouter.Handle  { return t.AcceptHandler }
+func declineHandler(t *Transfer) httprouter.Handle { return t.DeclineHandler }
+func cancelHandler(t *Transfer) httprouter.Handle  { return t.CancelHandler }
+
+func TestTransferResponse(t *testing.T) {
+	for _, test := range transferResponseTests {
+		t.Run(test.name, func(t *testing.T) {
+			testHandler, transferStore, req := transferTestSetup(test.sessionUser, test.recipientDevices, false, true)
+			transfer := transferStore.Transfers[0]
+			transfer.Status = test.status
+			params := httprouter.Params{{Key: "id", Value: "1"}}
+
+			w := httptest.NewRecorder()
+			test.handler(testHandler)(w, req, params)
+
+			if w.Code != test.code {
+				t.Errorf("Wrong HTTP code. Expected %d, got %d", test.code, w.Code)
+			}
+			if transfer.Status != test.newStatus {
+				t.Errorf("Expected transfer status %s, got %s", test.newStatus, transfer.Status)
+			}
+			if test.code == http.StatusOK && transfer.ResolvedBy != test.sessionUser {
+				t.Errorf("Expected transfer resolved by %s, got %q", test.sessionUser, transfer.ResolvedBy)
+			}
+
+			device := testHandler.devices.(*stores.TestDeviceStore).Devices[0]
+			if device.Username != test.owner {
+				t.Errorf("Expected device owned by %s, got %s", test.owner, device.Username)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+// Trash handles deleted devices and users.
+type Trash struct {
+	e     *common.Environment
+	trash stores.TrashStore
+}
+
+func NewTrashController(e *common.Environment, ts stores.TrashStore) *Trash {
+	return &Trash{
+		e:     e,
+		trash: ts,
+	}
+}
+
+// GetTrashHandler returns the trashed devices and users the session user can
+// restore, most recently deleted first.
+func (t *Trash) GetTrashHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+
+	items, err := t.trash.GetTrash()
+	if err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:trash",
+		}).Error("Error getting trash")
+		common.NewAPIResponse("Error getting trash", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	visible := make([]*models.TrashItem, 0, len(items))
+	for _, item := range items {
+		if sessionUser.Can(models.TrashPermission(item.Entity)) {
+			visible = append(visible, item)
+		}
+	}
+
+	common.NewAPIResponse("", visible).WriteResponse(w, http.StatusOK)
+}
+
+// RestoreHandler moves a device or user out of the trash.
+func (t *Trash) RestoreHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+	entity := p.ByName("entity")
+
+	if entity != models.TrashEntityDevice && entity != models.TrashEntityUser {
+		common.NewAPIResponse("Entity must be device or user", nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+	if !sessionUser.Can(models.TrashPermission(entity)) {
+		common.NewAPIResponse("Permission denied", nil).WriteResponse(w, http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.Atoi(p.ByName("id"))
+	if err != nil {
+		common.NewAPIResponse("Invalid ID", nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	item, err := t.trash.GetTrashItem(entity, id)
+	if err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:trash",
+		}).Error("Error getting trash item")
+		common.NewAPIResponse("Error restoring from trash", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+	if item == nil {
+		common.NewAPIResponse(stores.ErrTrashItemNotFound.Error(), nil).WriteResponse(w, http.StatusNotFound)
+		return
+	}
+
+	switch err := t.trash.Restore(item, sessionUser.Username); err {
+	case nil:
+	case stores.ErrRestoreConflict, stores.ErrTrashItemNotFound:
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusConflict)
+		return
+	default:
+		t.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:api:trash",
+			"entity":  item.Entity,
+			"key":     item.Key,
+		}).Error("Error restoring from trash")
+		common.NewAPIResponse("Error restoring from trash", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+
+	t.e.Log.WithFields(verbose.Fields{
+		"package":    "controllers:api:trash",
+		"action":     "restore_" + item.Entity,
+		"key":        item.Key,
+		"changed-by": sessionUser.Username,
+	}).Info("Restored from trash")
+	common.NewAPIResponse("Restored "+item.Key, item).WriteResponse(w, http.StatusOK)
+}
+
+// GetArchivedDevicesHandler returns the devices of a user that were purged
+// from the trash while archiving was enabled, most recently deleted first.
+func (t *Trash) GetArchivedDevicesHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	devices, err := t.trash.GetArchivedDevices(p.ByName("username"))
+	if err != nil {
+		t.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:api:trash",
+			"username": p.ByName("username"),
+		}).Error("Error getting archived devices")
+		common.NewAPIResponse("Error getting archived devices", nil).WriteResponse(w, http.StatusInternalServerError)
+		return
+	}
+	if devices == nil {
+		devices = []*models.ArchivedDevice{}
+	}
+
+	common.NewAPIResponse("", devices).WriteResponse(w, http.StatusOK)
+}
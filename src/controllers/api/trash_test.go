@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+// trashTestSetup creates a trash with a deleted device and user, and a
+// request from a user with perms.
+func trashTestSetup(perms models.Permission) (*Trash, *stores.TestTrashStore, *http.Request) {
+	e := common.NewTestEnvironment()
+
+	testTrashStore := &stores.TestTrashStore{
+		Items: []*models.TrashItem{
+			{ID: 1, Entity: models.TrashEntityDevice, Key: "12:34:56:12:34:56", Username: "owner", Deleted: time.Now()},
+			{ID: 2, Entity: models.TrashEntityUser, Key: "owner", Username: "owner", Deleted: time.Now()},
+		},
+	}
+
+	testuser := models.NewUser(
+		e,
+		&stores.TestUserStore{},
+		&stores.TestBlacklistItem{Val: false},
+		"admin",
+	)
+	testuser.Rights = perms
+
+	req, _ := http.NewRequest("", "", nil)
+	req = common.SetEnvironmentToContext(req, e)
+	req = common.SetSessionToContext(req, common.NewTestSession())
+	req = models.SetUserToContext(req, testuser)
+
+	return NewTrashController(e, testTrashStore), testTrashStore, req
+}
+
+func TestGetTrash(t *testing.T) {
+	for perms, expected := range map[models.Permission]int{
+		models.DeleteDevice:                     1,
+		models.DeleteDevice | models.DeleteUser: 2,
+	} {
+		testHandler, _, req := trashTestSetup(perms)
+
+		w := httptest.NewRecorder()
+		testHandler.GetTrashHandler(w, req, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+
+		var resp struct {
+			Data []*models.TrashItem `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Data) != expected {
+			t.Errorf("Expected %s to see %d items, got %d", perms, expected, len(resp.Data))
+		}
+	}
+}
+
+var restoreTrashTests = []struct {
+	name      string
+	perms     models.Permission
+	entity    string
+	id        int
+	code      int
+	remaining int
+}{
+	{"User without permission", models.DeleteDevice, models.TrashEntityUser, 2, http.StatusForbidden, 2},
+	{"Unknown entity", models.DeleteDevice | models.DeleteUser, "lease", 1, http.StatusBadRequest, 2},
+	{"Unknown device", models.DeleteDevice | models.DeleteUser, models.TrashEntityDevice, 2, http.StatusNotFound, 2},
+	{"Device", models.DeleteDevice, models.TrashEntityDevice, 1, http.StatusOK, 1},
+	{"User", models.DeleteDevice | models.DeleteUser, models.TrashEntityUser, 2, http.StatusOK, 1},
+}
+
+func TestRestoreTrash(t *testing.T) {
+	for _, test := range restoreTrashTests {
+		t.Run(test.name, func(t *testing.T) {
+			testHandler, trashStore, req := trashTestSetup(test.perms)
+			params := httprouter.Params{{Key: "entity", Value: test.entity}, {Key: "id", Value: strconv.Itoa(test.id)}}
+
+			w := httptest.NewRecorder()
+			testHandler.RestoreHandler(w, req, params)
+
+			if w.Code != test.code {
+				t.Fatalf("Expected status %d, got %d", test.code, w.Code)
+			}
+			if len(trashStore.Items) != test.remaining {
+				t.Fatalf("Expected %d items left in the trash, got %d", test.remaining, len(trashStore.Items))
+			}
+			for _, item := range trashStore.Items {
+				if test.code == http.StatusOK && item.Entity == test.entity && item.ID == test.id {
+					t.Errorf("Expected %s %d to be restored", test.entity, test.id)
+				}
+			}
+		})
+	}
+}
@@ -6,13 +6,12 @@ package api
 
 import (
 	"net/http"
-	"strconv"
 	"strings"
-	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/lfkeitel/verbose/v4"
 	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/importer"
 	"github.com/packet-guardian/packet-guardian/src/models"
 	"github.com/packet-guardian/packet-guardian/src/models/stores"
 )
@@ -21,13 +20,15 @@ type UserController struct {
 	e       *common.Environment
 	users   stores.UserStore
 	devices stores.DeviceStore
+	notes   stores.NoteStore
 }
 
-func NewUserController(e *common.Environment, us stores.UserStore, ds stores.DeviceStore) *UserController {
+func NewUserController(e *common.Environment, us stores.UserStore, ds stores.DeviceStore, ns stores.NoteStore) *UserController {
 	return &UserController{
 		e:       e,
 		users:   us,
 		devices: ds,
+		notes:   ns,
 	}
 }
 
@@ -57,151 +58,15 @@ func (u *UserController) SaveUserHandler(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	// Permission groups
-	uiGroup := r.FormValue("ui_group")
-	apiGroup := r.FormValue("api_group")
-	allowStatusAPI := r.FormValue("allow_status_api") == "1"
-	if (user.UIGroup != uiGroup || user.APIGroup != apiGroup || user.AllowStatusAPI != allowStatusAPI) && !sessionUser.Can(models.EditUserPermissions) {
+	oldNotes := user.Notes
+	updateDeviceExpirations, err := user.ApplyValues(sessionUser, userFormGetter(r))
+	if err == models.ErrPermissionDenied {
 		common.NewAPIResponse("Permission denied", nil).WriteResponse(w, http.StatusForbidden)
 		return
-	}
-
-	if !common.StringInSlice(uiGroup, []string{"default", "admin", "helpdesk", "readonly"}) {
-		common.NewAPIResponse("Unknown ui group", nil).WriteResponse(w, http.StatusBadRequest)
-		return
-	}
-	user.UIGroup = uiGroup
-
-	if !common.StringInSlice(apiGroup, []string{"disable", "readonly-api", "readwrite-api"}) {
-		common.NewAPIResponse("Unknown api group", nil).WriteResponse(w, http.StatusBadRequest)
+	} else if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusBadRequest)
 		return
 	}
-	user.APIGroup = apiGroup
-	user.AllowStatusAPI = allowStatusAPI
-
-	// Password
-	password := r.FormValue("password")
-	if password != "" {
-		if password == "-1" {
-			user.RemovePassword()
-		} else {
-			user.NewPassword(password)
-		}
-	}
-
-	// Device limit
-	limitStr := r.FormValue("device_limit")
-	if limitStr != "" {
-		limit, err := strconv.Atoi(limitStr)
-		if err != nil {
-			common.NewAPIResponse("device_limit must be a number", nil).WriteResponse(w, http.StatusBadRequest)
-			return
-		}
-		user.DeviceLimit = models.UserDeviceLimit(limit)
-	}
-
-	// Default device expiration
-	expTypeStr := r.FormValue("expiration_type")
-	devExpiration := r.FormValue("device_expiration")
-	updateDeviceExpirations := false
-	if expTypeStr != "" || devExpiration != "" {
-		if expTypeStr == "" && devExpiration != "" {
-			common.NewAPIResponse("Error saving user: Expiration type not given", nil).WriteResponse(w, http.StatusBadRequest)
-			return
-		}
-
-		expType, err := strconv.Atoi(expTypeStr)
-		if err != nil {
-			common.NewAPIResponse("Expiration type must be an integer", nil).WriteResponse(w, http.StatusBadRequest)
-			return
-		}
-		if user.DeviceExpiration.Mode != models.UserExpiration(expType) {
-			user.DeviceExpiration.Mode = models.UserExpiration(expType)
-			updateDeviceExpirations = true
-		}
-		if user.DeviceExpiration.Mode == models.UserDeviceExpirationGlobal ||
-			user.DeviceExpiration.Mode == models.UserDeviceExpirationNever ||
-			user.DeviceExpiration.Mode == models.UserDeviceExpirationRolling {
-			user.DeviceExpiration.Value = 0
-		} else if user.DeviceExpiration.Mode == models.UserDeviceExpirationSpecific {
-			t, err := time.ParseInLocation(common.TimeFormat, devExpiration, time.Local)
-			if err != nil {
-				common.NewAPIResponse("Invalid time format", nil).WriteResponse(w, http.StatusBadRequest)
-				return
-			}
-			if user.DeviceExpiration.Value != t.Unix() {
-				user.DeviceExpiration.Value = t.Unix()
-				updateDeviceExpirations = true
-			}
-		} else if user.DeviceExpiration.Mode == models.UserDeviceExpirationDaily {
-			secs, err := common.ParseTime(devExpiration)
-			if err != nil {
-				common.NewAPIResponse("Invalid time format", nil).WriteResponse(w, http.StatusBadRequest)
-				return
-			}
-			if user.DeviceExpiration.Value != secs {
-				user.DeviceExpiration.Value = secs
-				updateDeviceExpirations = true
-			}
-		} else if user.DeviceExpiration.Mode == models.UserDeviceExpirationDuration {
-			d, err := time.ParseDuration(devExpiration)
-			if err != nil {
-				common.NewAPIResponse("Invalid duration", nil).WriteResponse(w, http.StatusBadRequest)
-				return
-			}
-			// time.Duration's Second() returns a float that contains the nanoseconds as well
-			// For sanity we don't care and don't want the nanoseconds
-			dur := int64(d / time.Second)
-			if user.DeviceExpiration.Value != dur {
-				user.DeviceExpiration.Value = dur
-				updateDeviceExpirations = true
-			}
-		} else {
-			common.NewAPIResponse("Invalid device expiration type", nil).WriteResponse(w, http.StatusBadRequest)
-			return
-		}
-	}
-
-	// Valid dates
-	validStart := r.FormValue("valid_start")
-	validEnd := r.FormValue("valid_end")
-	if validStart == "0" && validEnd == "0" {
-		user.ValidForever = true
-		user.ValidStart = time.Unix(0, 0)
-		user.ValidEnd = user.ValidStart
-	} else {
-		user.ValidForever = false
-		if validStart != "" {
-			t, err := time.ParseInLocation(common.TimeFormat, validStart, time.Local)
-			if err != nil {
-				common.NewAPIResponse("Invalid time format: valid_start", nil).WriteResponse(w, http.StatusBadRequest)
-				return
-			}
-			user.ValidStart = t
-		}
-		if validEnd != "" {
-			t, err := time.ParseInLocation(common.TimeFormat, validEnd, time.Local)
-			if err != nil {
-				common.NewAPIResponse("Invalid time format: valid_end", nil).WriteResponse(w, http.StatusBadRequest)
-				return
-			}
-			user.ValidEnd = t
-		}
-		if user.ValidEnd.Before(user.ValidStart) {
-			common.NewAPIResponse("valid_start must be before valid_end", nil).WriteResponse(w, http.StatusBadRequest)
-			return
-		}
-	}
-
-	canManage := r.FormValue("can_manage")
-	if canManage != "" {
-		user.CanManage = (canManage == "1")
-	}
-
-	canAutoreg := r.FormValue("can_autoreg")
-	if canAutoreg != "" {
-		user.CanAutoreg = (canAutoreg == "1")
-	}
 
 	// Delegates
 	oldDelegates := make([]string, 0, len(user.Delegates))
@@ -236,7 +101,12 @@ func (u *UserController) SaveUserHandler(w http.ResponseWriter, r *http.Request,
 
 	isNewUser := user.IsNew() // This will always be false after a call to Save()
 
-	user.Notes = r.FormValue("notes")
+	// Custom fields
+	userFields := u.e.Config.CustomFieldsFor(common.CustomFieldUser)
+	if err := user.Attributes.ApplyCustomFields(userFields, formAttributeGetter(r), true); err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
 
 	if err := user.Save(); err != nil {
 		u.e.Log.WithFields(verbose.Fields{
@@ -267,6 +137,14 @@ func (u *UserController) SaveUserHandler(w http.ResponseWriter, r *http.Request,
 		}).Info("User edited")
 	}
 
+	// Record the new text in the notes log
+	if user.Notes != oldNotes && user.Notes != "" {
+		if _, err := addNote(u.e, u.notes, models.NoteEntityUser, user.Username, sessionUser.Username, user.Notes); err != nil {
+			common.NewAPIResponse("User saved, but notes log not updated", nil).WriteResponse(w, http.StatusInternalServerError)
+			return
+		}
+	}
+
 	if updateDeviceExpirations {
 		devices, err := u.devices.GetDevicesForUser(user)
 		if err != nil {
@@ -280,6 +158,7 @@ func (u *UserController) SaveUserHandler(w http.ResponseWriter, r *http.Request,
 		errOccured := false
 		for _, d := range devices {
 			d.Expires = user.DeviceExpiration.NextExpiration(u.e, d.DateRegistered)
+			d.ChangedBy = sessionUser.Username
 			if err := d.Save(); err != nil {
 				u.e.Log.WithFields(verbose.Fields{
 					"error":   err,
@@ -302,6 +181,68 @@ func (u *UserController) SaveUserHandler(w http.ResponseWriter, r *http.Request,
 	common.NewAPIResponse("User saved successfully", nil).WriteResponse(w, http.StatusNoContent)
 }
 
+// ImportHandler creates or updates users in bulk. Data is given as an uploaded
+// file, form value, or JSON body. Values are validated the same as SaveUserHandler
+// and errors for individual rows are reported in the result. The result is
+// returned as a CSV report if report=1.
+func (u *UserController) ImportHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sessionUser := models.GetUserFromContext(r)
+
+	opts := importer.Options{
+		Mode:      r.FormValue("mode"),
+		DryRun:    r.FormValue("dry-run") == "1",
+		ChangedBy: sessionUser.Username,
+		IP:        common.GetIPFromContext(r),
+		Editor:    sessionUser,
+	}
+
+	if opts.Mode == importer.ModeUpsert && !sessionUser.Can(models.EditUser) {
+		common.NewAPIResponse("Permission denied", nil).WriteResponse(w, http.StatusForbidden)
+		return
+	}
+
+	records, err := importer.ParseRequest(r)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	result, err := importer.New(u.e, u.users, u.devices, nil).ImportUsers(records, opts)
+	if err != nil {
+		common.NewAPIResponse(err.Error(), nil).WriteResponse(w, http.StatusBadRequest)
+		return
+	}
+
+	if r.FormValue("report") == "1" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="user-import-report.csv"`)
+		result.WriteCSV(w)
+		return
+	}
+
+	common.NewAPIResponse("Import finished", result).WriteResponse(w, http.StatusOK)
+}
+
+// userFormGetter returns user values from the request for User.ApplyValues.
+// Fields are always given so empty values are applied as the API always has,
+// except email and category_limits which are only changed when submitted.
+func userFormGetter(r *http.Request) func(string) (string, bool) {
+	if r.Form == nil {
+		r.ParseMultipartForm(32 << 20)
+	}
+	return func(name string) (string, bool) {
+		switch name {
+		case "email", "category_limits":
+			v, ok := r.Form[name]
+			if !ok || len(v) == 0 {
+				return "", false
+			}
+			return v[0], true
+		}
+		return r.FormValue(name), true
+	}
+}
+
 func (u *UserController) DeleteUserHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	sessionUser := models.GetUserFromContext(r)
 	username := r.FormValue("username")
@@ -321,6 +262,7 @@ func (u *UserController) DeleteUserHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	user.ChangedBy = sessionUser.Username
 	if err := user.Delete(); err != nil {
 		u.e.Log.WithFields(verbose.Fields{
 			"error":   err,
@@ -12,6 +12,7 @@ import (
 
 	"github.com/packet-guardian/packet-guardian/src/auth"
 	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/metrics"
 	"github.com/packet-guardian/packet-guardian/src/models"
 	"github.com/packet-guardian/packet-guardian/src/models/stores"
 
@@ -47,6 +48,7 @@ func (a *CAS) CASHandler(w http.ResponseWriter, r *http.Request) {
 	validationResp, err := a.validateServiceTicket(casServiceTicket)
 	if err != nil {
 		a.e.Log.Error(err.Error())
+		metrics.Logins.Inc("cas", metrics.ResultFailure)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
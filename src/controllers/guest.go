@@ -19,18 +19,22 @@ import (
 )
 
 type Guest struct {
-	e       *common.Environment
-	users   stores.UserStore
-	devices stores.DeviceStore
-	leases  stores.LeaseStore
+	e        *common.Environment
+	users    stores.UserStore
+	devices  stores.DeviceStore
+	leases   stores.LeaseStore
+	policies stores.PolicyStore
+	webhooks stores.WebhookStore
 }
 
-func NewGuestController(e *common.Environment, us stores.UserStore, ds stores.DeviceStore, ls stores.LeaseStore) *Guest {
+func NewGuestController(e *common.Environment, us stores.UserStore, ds stores.DeviceStore, ls stores.LeaseStore, ps stores.PolicyStore, ws stores.WebhookStore) *Guest {
 	return &Guest{
-		e:       e,
-		users:   us,
-		devices: ds,
-		leases:  ls,
+		e:        e,
+		users:    us,
+		devices:  ds,
+		leases:   ls,
+		policies: ps,
+		webhooks: ws,
 	}
 }
 
@@ -67,8 +71,18 @@ func (g *Guest) showGuestRegPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	policy, err := g.policies.GetCurrentPolicy()
+	if err != nil {
+		g.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:guest",
+		}).Error("Error getting policy")
+		g.e.Views.RenderError(w, r, nil)
+		return
+	}
+
 	data := map[string]interface{}{
-		"policy":         common.LoadPolicyText(g.e.Config.Registration.RegistrationPolicyFile),
+		"policy":         policy.Paragraphs(),
 		"guestCredLabel": label,
 		"guestCredText":  guest.GetInputText(g.e),
 		"captchaID":      captcha.New(),
@@ -201,6 +215,8 @@ func (g *Guest) verifyGuestRegistration(w http.ResponseWriter, r *http.Request)
 		g.users,
 		g.devices,
 		g.leases,
+		g.policies,
+		g.webhooks,
 	); err != nil {
 		g.renderErrorMessage(err.Error(), w, r)
 		return
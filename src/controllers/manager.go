@@ -26,18 +26,22 @@ const (
 )
 
 type Manager struct {
-	e       *common.Environment
-	users   stores.UserStore
-	devices stores.DeviceStore
-	leases  stores.LeaseStore
+	e         *common.Environment
+	users     stores.UserStore
+	devices   stores.DeviceStore
+	leases    stores.LeaseStore
+	transfers stores.TransferStore
+	policies  stores.PolicyStore
 }
 
-func NewManagerController(e *common.Environment, ds stores.DeviceStore, ls stores.LeaseStore, us stores.UserStore) *Manager {
+func NewManagerController(e *common.Environment, ds stores.DeviceStore, ls stores.LeaseStore, us stores.UserStore, ts stores.TransferStore, ps stores.PolicyStore) *Manager {
 	return &Manager{
-		e:       e,
-		devices: ds,
-		leases:  ls,
-		users:   us,
+		e:         e,
+		devices:   ds,
+		leases:    ls,
+		users:     us,
+		transfers: ts,
+		policies:  ps,
 	}
 }
 
@@ -83,15 +87,73 @@ func (m *Manager) RegistrationHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	userAttributes := models.Attributes{}
+	if username != "" {
+		if user, err := m.users.GetUserByUsername(username); err == nil {
+			userAttributes = user.Attributes
+		}
+	}
+
+	policy, err := m.policies.GetCurrentPolicy()
+	if err != nil {
+		m.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "controllers:manager",
+		}).Error("Error getting policy")
+		m.e.Views.RenderError(w, r, nil)
+		return
+	}
+
+	regForm := registrationFormName(formType)
 	data := map[string]interface{}{
-		"policy":   common.LoadPolicyText(m.e.Config.Registration.RegistrationPolicyFile),
-		"type":     formType,
-		"username": strings.ToLower(username),
+		"policy":           policy.Paragraphs(),
+		"policyVersion":    policy.ID,
+		"type":             formType,
+		"username":         strings.ToLower(username),
+		"deviceFields":     m.e.Config.CustomFieldsOnForm(common.CustomFieldDevice, regForm),
+		"deviceAttributes": models.Attributes{},
+		"userFields":       m.e.Config.CustomFieldsOnForm(common.CustomFieldUser, regForm),
+		"userAttributes":   userAttributes,
 	}
 
 	m.e.Views.NewView("user-register", r).Render(w, data)
 }
 
+// policyUpdate returns the current registration policy if user hasn't
+// accepted it. Users must accept a new policy before registering devices.
+func (m *Manager) policyUpdate(user *models.User) *models.Policy {
+	policy, err := m.policies.GetCurrentPolicy()
+	if err != nil || !policy.Versioned() {
+		return nil
+	}
+
+	acceptance, err := m.policies.GetAcceptance(user.Username, policy.ID)
+	if err != nil {
+		m.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:manager",
+			"username": user.Username,
+		}).Error("Error getting policy acceptance")
+		return nil
+	}
+	if acceptance.ID != 0 {
+		return nil
+	}
+	return policy
+}
+
+// registrationFormName maps a registration page type to the form name used
+// by custom field definitions.
+func registrationFormName(formType string) string {
+	switch formType {
+	case nonAdminAutoReg:
+		return common.RegFormAuto
+	case adminReg:
+		return common.RegFormAdmin
+	}
+	return common.RegFormManual
+}
+
 func (m *Manager) DelegateManageHandler(w http.ResponseWriter, r *http.Request) {
 	sessionUser := models.GetUserFromContext(r)
 
@@ -143,6 +205,7 @@ func (m *Manager) DelegateManageHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	showAddBtn := (m.e.Config.Registration.AllowManualRegistrations && !user.IsBlacklisted())
+	incoming, outgoing := m.getPendingTransfers(user.Username)
 
 	data := map[string]interface{}{
 		"user":            sessionUser,
@@ -159,6 +222,12 @@ func (m *Manager) DelegateManageHandler(w http.ResponseWriter, r *http.Request)
 		"showAddBtn":      showAddBtn && user.DelegateCan(sessionUser.Username, models.CreateDevice) && !user.IsBlacklisted(),
 		"canEditDevice":   user.DelegateCan(sessionUser.Username, models.EditDevice) && !sessionUser.IsBlacklisted(),
 		"canDeleteDevice": user.DelegateCan(sessionUser.Username, models.DeleteDevice) && !sessionUser.IsBlacklisted(),
+		"renewalsEnabled": m.e.Config.Registration.Renewal.Enabled,
+		"policyUpdate":    m.policyUpdate(sessionUser),
+
+		"incomingTransfers":  incoming,
+		"outgoingTransfers":  outgoing,
+		"canRespondTransfer": user.DelegateCan(sessionUser.Username, models.CreateDevice) && !sessionUser.IsBlacklisted(),
 	}
 
 	m.e.Views.NewView("user-manage", r).Render(w, data)
@@ -206,6 +275,7 @@ func (m *Manager) ManageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	showAddBtn := (m.e.Config.Registration.AllowManualRegistrations && !sessionUser.IsBlacklisted())
+	incoming, outgoing := m.getPendingTransfers(sessionUser.Username)
 
 	data := map[string]interface{}{
 		"user":            sessionUser,
@@ -222,7 +292,35 @@ func (m *Manager) ManageHandler(w http.ResponseWriter, r *http.Request) {
 		"showAddBtn":      showAddBtn && sessionUser.Can(models.CreateOwn) && !sessionUser.IsBlacklisted(),
 		"canEditDevice":   sessionUser.Can(models.EditOwn) && !sessionUser.IsBlacklisted(),
 		"canDeleteDevice": sessionUser.Can(models.DeleteOwn) && !sessionUser.IsBlacklisted(),
+		"renewalsEnabled": m.e.Config.Registration.Renewal.Enabled,
+		"policyUpdate":    m.policyUpdate(sessionUser),
+
+		"incomingTransfers":  incoming,
+		"outgoingTransfers":  outgoing,
+		"canRespondTransfer": !sessionUser.IsBlacklisted(),
 	}
 
 	m.e.Views.NewView("user-manage", r).Render(w, data)
 }
+
+// getPendingTransfers returns the device transfers offered to and by username.
+func (m *Manager) getPendingTransfers(username string) ([]*models.DeviceTransfer, []*models.DeviceTransfer) {
+	incoming, err := m.transfers.GetPendingTransfersToUser(username)
+	if err != nil {
+		m.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:manager",
+			"username": username,
+		}).Error("Error getting device transfers")
+	}
+
+	outgoing, err := m.transfers.GetPendingTransfersFromUser(username)
+	if err != nil {
+		m.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "controllers:manager",
+			"username": username,
+		}).Error("Error getting device transfers")
+	}
+	return incoming, outgoing
+}
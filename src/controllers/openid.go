@@ -14,6 +14,7 @@ import (
 
 	"github.com/packet-guardian/packet-guardian/src/auth"
 	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/metrics"
 	"github.com/packet-guardian/packet-guardian/src/models"
 	"github.com/packet-guardian/packet-guardian/src/models/stores"
 
@@ -71,6 +72,7 @@ func (a *OpenID) OpenIDHandler(w http.ResponseWriter, r *http.Request) {
 	clientStateCookie, _ := r.Cookie(openIDStateCookie)
 	if clientStateCookie == nil || clientStateCookie.Value != openIDState {
 		a.e.Log.Error("OpenID state mismatch")
+		metrics.Logins.Inc("openid", metrics.ResultFailure)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
@@ -78,6 +80,7 @@ func (a *OpenID) OpenIDHandler(w http.ResponseWriter, r *http.Request) {
 	tokenResp, err := a.getOpenIDTokens(openIDCode)
 	if err != nil {
 		a.e.Log.Error(err.Error())
+		metrics.Logins.Inc("openid", metrics.ResultFailure)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
@@ -85,6 +88,7 @@ func (a *OpenID) OpenIDHandler(w http.ResponseWriter, r *http.Request) {
 	userInfoResp, err := a.getOpenIDUserInfo(tokenResp.AccessToken)
 	if err != nil {
 		a.e.Log.Error(err.Error())
+		metrics.Logins.Inc("openid", metrics.ResultFailure)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
@@ -98,6 +102,7 @@ func (a *OpenID) OpenIDHandler(w http.ResponseWriter, r *http.Request) {
 			username = userInfoResp.Email
 		} else {
 			a.e.Log.Info("No email returned from OpenID server, failing login")
+			metrics.Logins.Inc("openid", metrics.ResultFailure)
 			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 			return
 		}
@@ -0,0 +1,75 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"@every 10s",
+		"@every tomorrow",
+		"@yearly",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Expected error parsing '%s'", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	at := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.Local)
+	}
+
+	// 2026-03-04 is a Wednesday
+	start := time.Date(2026, time.March, 4, 10, 30, 15, 0, time.Local)
+
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"0 3 * * *", at(time.March, 5, 3, 0)},
+		{"*/15 * * * *", at(time.March, 4, 10, 45)},
+		{"30 10 * * *", at(time.March, 5, 10, 30)},
+		{"0 9-17/4 * * *", at(time.March, 4, 13, 0)},
+		{"0 0 1 * *", at(time.April, 1, 0, 0)},
+		{"0 8 * * 1,5", at(time.March, 6, 8, 0)},
+		{"0 8 * * 7", at(time.March, 8, 8, 0)},
+		{"0 8 10 * 1", at(time.March, 9, 8, 0)},
+		{"0 0 31 * *", at(time.March, 31, 0, 0)},
+		{"@hourly", at(time.March, 4, 11, 0)},
+		{"@every 90m", start.Add(90 * time.Minute)},
+	}
+
+	for _, test := range tests {
+		s, err := Parse(test.spec)
+		if err != nil {
+			t.Fatalf("Failed to parse '%s': %s", test.spec, err)
+		}
+		if next := s.Next(start); !next.Equal(test.expected) {
+			t.Errorf("%s: expected %s, got %s", test.spec, test.expected, next)
+		}
+	}
+}
+
+func TestNextNeverMatches(t *testing.T) {
+	s, err := Parse("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := s.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Expected no next run for February 31st, got %s", next)
+	}
+}
@@ -12,7 +12,7 @@ import (
 	"github.com/packet-guardian/packet-guardian/src/common"
 )
 
-const DBVersion = 6
+const DBVersion = 16
 
 type dbInit interface {
 	init(*common.DatabaseAccessor, *common.Config) error
@@ -12,6 +12,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/packet-guardian/packet-guardian/src/models/stores"
 
@@ -33,20 +34,46 @@ func newmySQLDBInit() *mySQLDB {
 	m := &mySQLDB{}
 
 	m.createFuncs = map[string]func(*common.DatabaseAccessor) error{
-		"blacklist":        m.createBlacklistTable,
-		"device":           m.createDeviceTable,
-		"lease":            m.createLeaseTable,
-		"settings":         m.createSettingTable,
-		"user":             m.createUserTable,
-		"account_delegate": m.createDelegateTable,
+		"blacklist":         m.createBlacklistTable,
+		"device":            m.createDeviceTable,
+		"lease":             m.createLeaseTable,
+		"settings":          m.createSettingTable,
+		"user":              m.createUserTable,
+		"account_delegate":  m.createDelegateTable,
+		"device_transfer":   m.createDeviceTransferTable,
+		"device_notice":     m.createDeviceNoticeTable,
+		"term":              m.createTermTable,
+		"policy":            m.createPolicyTable,
+		"policy_acceptance": m.createPolicyAcceptanceTable,
+		"note":              m.createNoteTable,
+		"device_event":      m.createDeviceEventTable,
+		"lease_log":         m.createLeaseLogTable,
+		"device_trash":      m.createDeviceTrashTable,
+		"user_trash":        m.createUserTrashTable,
+		"device_archive":    m.createDeviceArchiveTable,
+		"user_archive":      m.createUserArchiveTable,
+		"job_run":           m.createJobRunTable,
+		"task_lock":         m.createTaskLockTable,
+		"flagged_alert":     m.createFlaggedAlertTable,
+		"webhook_delivery":  m.createWebhookDeliveryTable,
 	}
 
 	m.migrateFuncs = []migrateFunc{
-		1: m.migrateFrom1,
-		2: m.migrateFrom2,
-		3: m.migrateFrom3,
-		4: m.migrateFrom4,
-		5: m.migrateFrom5,
+		1:  m.migrateFrom1,
+		2:  m.migrateFrom2,
+		3:  m.migrateFrom3,
+		4:  m.migrateFrom4,
+		5:  m.migrateFrom5,
+		6:  m.migrateFrom6,
+		7:  m.migrateFrom7,
+		8:  m.migrateFrom8,
+		9:  m.migrateFrom9,
+		10: m.migrateFrom10,
+		11: m.migrateFrom11,
+		12: m.migrateFrom12,
+		13: m.migrateFrom13,
+		14: m.migrateFrom14,
+		15: m.migrateFrom15,
 	}
 
 	return m
@@ -199,7 +226,17 @@ func (m *mySQLDB) createDeviceTable(d *common.DatabaseAccessor) error {
 		"description" TEXT,
 		"last_seen" INTEGER NOT NULL,
 		"flagged" TINYINT DEFAULT 0,
-		"notes" TEXT
+		"notes" TEXT,
+		"attributes" TEXT,
+		"renewals" INTEGER NOT NULL DEFAULT 0,
+		"policy_version" INTEGER NOT NULL DEFAULT 0,
+		"policy_accepted" INTEGER NOT NULL DEFAULT 0,
+		"tags" TEXT,
+		"flag_category" VARCHAR(64) NOT NULL DEFAULT '',
+		"flag_reason" TEXT,
+		"flagged_by" VARCHAR(255) NOT NULL DEFAULT '',
+		"flagged_at" INTEGER NOT NULL DEFAULT 0,
+		"flag_clears" INTEGER NOT NULL DEFAULT 0
 	) ENGINE=InnoDB DEFAULT CHARSET=utf8 AUTO_INCREMENT=1`
 
 	_, err := d.DB.Exec(sql)
@@ -253,7 +290,10 @@ func (m *mySQLDB) createUserTable(d *common.DatabaseAccessor) error {
 		"ui_group" VARCHAR(20) NOT NULL DEFAULT 'default',
 		"api_group" VARCHAR(20) NOT NULL DEFAULT 'disable',
 		"allow_status_api" TINYINT DEFAULT 0,
-		"notes" TEXT
+		"notes" TEXT,
+		"attributes" TEXT,
+		"category_limits" TEXT,
+		"email" VARCHAR(255) NOT NULL DEFAULT ''
 	) ENGINE=InnoDB DEFAULT CHARSET=utf8 AUTO_INCREMENT=4;`
 
 	if _, err := d.DB.Exec(sql); err != nil {
@@ -281,6 +321,320 @@ func (m *mySQLDB) createDelegateTable(d *common.DatabaseAccessor) error {
 	return err
 }
 
+func (m *mySQLDB) createDeviceTransferTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "device_transfer" (
+		"id" INTEGER PRIMARY KEY AUTO_INCREMENT NOT NULL,
+		"mac" VARCHAR(17) NOT NULL,
+		"from_user" VARCHAR(255) NOT NULL,
+		"to_user" VARCHAR(255) NOT NULL,
+		"status" VARCHAR(10) NOT NULL DEFAULT 'pending',
+		"created" INTEGER NOT NULL,
+		"resolved" INTEGER DEFAULT 0,
+		"resolved_by" VARCHAR(255) NOT NULL DEFAULT '',
+		INDEX "device_transfer_mac" ("mac"),
+		INDEX "device_transfer_to_user" ("to_user")
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8 AUTO_INCREMENT=1`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) createDeviceNoticeTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "device_notice" (
+		"id" INTEGER PRIMARY KEY AUTO_INCREMENT NOT NULL,
+		"mac" VARCHAR(17) NOT NULL,
+		"expires" INTEGER NOT NULL,
+		"days" INTEGER NOT NULL,
+		"sent" INTEGER NOT NULL,
+		INDEX "device_notice_mac" ("mac")
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8 AUTO_INCREMENT=1`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) createTermTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "term" (
+		"id" INTEGER PRIMARY KEY AUTO_INCREMENT NOT NULL,
+		"name" VARCHAR(255) NOT NULL,
+		"cutoff" INTEGER NOT NULL DEFAULT 0,
+		"end" INTEGER NOT NULL
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8 AUTO_INCREMENT=1`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) createPolicyTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "policy" (
+		"id" INTEGER PRIMARY KEY AUTO_INCREMENT NOT NULL,
+		"text" TEXT NOT NULL,
+		"published" INTEGER NOT NULL,
+		"published_by" VARCHAR(255) NOT NULL
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8 AUTO_INCREMENT=1`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) createPolicyAcceptanceTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "policy_acceptance" (
+		"id" INTEGER PRIMARY KEY AUTO_INCREMENT NOT NULL,
+		"username" VARCHAR(255) NOT NULL,
+		"version" INTEGER NOT NULL,
+		"accepted" INTEGER NOT NULL,
+		"ip" VARCHAR(39) NOT NULL DEFAULT '',
+		UNIQUE KEY "policy_acceptance_user_version" ("username", "version")
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8 AUTO_INCREMENT=1`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) createNoteTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "note" (
+		"id" INTEGER PRIMARY KEY AUTO_INCREMENT NOT NULL,
+		"entity" VARCHAR(16) NOT NULL,
+		"entity_key" VARCHAR(255) NOT NULL,
+		"author" VARCHAR(255) NOT NULL DEFAULT '',
+		"created" INTEGER NOT NULL,
+		"text" TEXT NOT NULL,
+		KEY "note_entity_key" ("entity", "entity_key")
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8 AUTO_INCREMENT=1`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) createDeviceEventTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "device_event" (
+		"id" INTEGER PRIMARY KEY AUTO_INCREMENT NOT NULL,
+		"mac" VARCHAR(17) NOT NULL,
+		"type" VARCHAR(16) NOT NULL,
+		"username" VARCHAR(255) NOT NULL DEFAULT '',
+		"changed_by" VARCHAR(255) NOT NULL DEFAULT '',
+		"auth_method" VARCHAR(32) NOT NULL DEFAULT '',
+		"created" INTEGER NOT NULL,
+		"details" TEXT,
+		KEY "device_event_mac" ("mac")
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8 AUTO_INCREMENT=1`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) createLeaseLogTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "lease_log" (
+		"id" INTEGER PRIMARY KEY AUTO_INCREMENT NOT NULL,
+		"ip" VARCHAR(15) NOT NULL,
+		"mac" VARCHAR(17) NOT NULL,
+		"network" VARCHAR(255) NOT NULL,
+		"start" INTEGER NOT NULL,
+		"end" INTEGER NOT NULL,
+		"hostname" TEXT NOT NULL,
+		UNIQUE KEY "lease_log_grant" ("ip", "mac", "start"),
+		KEY "lease_log_mac" ("mac")
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8 AUTO_INCREMENT=1`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+// The trash tables hold deleted rows with the columns of their source table.
+// The ID is the ID the row had before it was deleted.
+func (m *mySQLDB) createDeviceTrashTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "device_trash" (
+		"id" INTEGER PRIMARY KEY NOT NULL,
+		"mac" VARCHAR(17) NOT NULL,
+		"username" VARCHAR(255) NOT NULL,
+		"registered_from" VARCHAR(15),
+		"platform" TEXT,
+		"expires" INTEGER DEFAULT 0,
+		"date_registered" INTEGER NOT NULL,
+		"user_agent" TEXT,
+		"description" TEXT,
+		"last_seen" INTEGER NOT NULL,
+		"flagged" TINYINT DEFAULT 0,
+		"notes" TEXT,
+		"attributes" TEXT,
+		"renewals" INTEGER NOT NULL DEFAULT 0,
+		"policy_version" INTEGER NOT NULL DEFAULT 0,
+		"policy_accepted" INTEGER NOT NULL DEFAULT 0,
+		"tags" TEXT,
+		"flag_category" VARCHAR(64) NOT NULL DEFAULT '',
+		"flag_reason" TEXT,
+		"flagged_by" VARCHAR(255) NOT NULL DEFAULT '',
+		"flagged_at" INTEGER NOT NULL DEFAULT 0,
+		"flag_clears" INTEGER NOT NULL DEFAULT 0,
+		"deleted" INTEGER NOT NULL,
+		"deleted_by" VARCHAR(255) NOT NULL DEFAULT '',
+		KEY "device_trash_mac" ("mac"),
+		KEY "device_trash_deleted" ("deleted")
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) createUserTrashTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "user_trash" (
+		"id" INTEGER PRIMARY KEY NOT NULL,
+		"username" VARCHAR(255) NOT NULL,
+		"password" TEXT,
+		"device_limit" INTEGER DEFAULT -1,
+		"default_expiration" INTEGER DEFAULT 0,
+		"expiration_type" TINYINT DEFAULT 1,
+		"can_manage" TINYINT DEFAULT 1,
+		"can_autoreg" TINYINT DEFAULT 1,
+		"valid_start" INTEGER DEFAULT 0,
+		"valid_end" INTEGER DEFAULT 0,
+		"valid_forever" TINYINT DEFAULT 1,
+		"ui_group" VARCHAR(20) NOT NULL DEFAULT 'default',
+		"api_group" VARCHAR(20) NOT NULL DEFAULT 'disable',
+		"allow_status_api" TINYINT DEFAULT 0,
+		"notes" TEXT,
+		"attributes" TEXT,
+		"category_limits" TEXT,
+		"email" VARCHAR(255) NOT NULL DEFAULT '',
+		"deleted" INTEGER NOT NULL,
+		"deleted_by" VARCHAR(255) NOT NULL DEFAULT '',
+		KEY "user_trash_username" ("username"),
+		KEY "user_trash_deleted" ("deleted")
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) createDeviceArchiveTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "device_archive" (
+		"archive_id" INTEGER PRIMARY KEY AUTO_INCREMENT NOT NULL,
+		"id" INTEGER NOT NULL,
+		"mac" VARCHAR(17) NOT NULL,
+		"username" VARCHAR(255) NOT NULL,
+		"registered_from" VARCHAR(15),
+		"platform" TEXT,
+		"expires" INTEGER DEFAULT 0,
+		"date_registered" INTEGER NOT NULL,
+		"user_agent" TEXT,
+		"description" TEXT,
+		"last_seen" INTEGER NOT NULL,
+		"flagged" TINYINT DEFAULT 0,
+		"notes" TEXT,
+		"attributes" TEXT,
+		"renewals" INTEGER NOT NULL DEFAULT 0,
+		"policy_version" INTEGER NOT NULL DEFAULT 0,
+		"policy_accepted" INTEGER NOT NULL DEFAULT 0,
+		"tags" TEXT,
+		"flag_category" VARCHAR(64) NOT NULL DEFAULT '',
+		"flag_reason" TEXT,
+		"flagged_by" VARCHAR(255) NOT NULL DEFAULT '',
+		"flagged_at" INTEGER NOT NULL DEFAULT 0,
+		"flag_clears" INTEGER NOT NULL DEFAULT 0,
+		"deleted" INTEGER NOT NULL,
+		"deleted_by" VARCHAR(255) NOT NULL DEFAULT '',
+		"archived" INTEGER NOT NULL,
+		UNIQUE KEY "device_archive_id_deleted" ("id", "deleted"),
+		KEY "device_archive_mac" ("mac"),
+		KEY "device_archive_username" ("username")
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8 AUTO_INCREMENT=1`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) createUserArchiveTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "user_archive" (
+		"archive_id" INTEGER PRIMARY KEY AUTO_INCREMENT NOT NULL,
+		"id" INTEGER NOT NULL,
+		"username" VARCHAR(255) NOT NULL,
+		"device_limit" INTEGER DEFAULT -1,
+		"default_expiration" INTEGER DEFAULT 0,
+		"expiration_type" TINYINT DEFAULT 1,
+		"can_manage" TINYINT DEFAULT 1,
+		"can_autoreg" TINYINT DEFAULT 1,
+		"valid_start" INTEGER DEFAULT 0,
+		"valid_end" INTEGER DEFAULT 0,
+		"valid_forever" TINYINT DEFAULT 1,
+		"ui_group" VARCHAR(20) NOT NULL DEFAULT 'default',
+		"api_group" VARCHAR(20) NOT NULL DEFAULT 'disable',
+		"allow_status_api" TINYINT DEFAULT 0,
+		"notes" TEXT,
+		"attributes" TEXT,
+		"category_limits" TEXT,
+		"email" VARCHAR(255) NOT NULL DEFAULT '',
+		"deleted" INTEGER NOT NULL,
+		"deleted_by" VARCHAR(255) NOT NULL DEFAULT '',
+		"archived" INTEGER NOT NULL,
+		UNIQUE KEY "user_archive_id_deleted" ("id", "deleted"),
+		KEY "user_archive_username" ("username")
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8 AUTO_INCREMENT=1`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) createJobRunTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "job_run" (
+		"id" INTEGER PRIMARY KEY AUTO_INCREMENT NOT NULL,
+		"job" VARCHAR(64) NOT NULL,
+		"started" INTEGER NOT NULL,
+		"finished" INTEGER NOT NULL,
+		"result" TEXT NOT NULL,
+		"error" TEXT NOT NULL,
+		"affected" INTEGER NOT NULL DEFAULT 0,
+		"triggered_by" VARCHAR(255) NOT NULL DEFAULT '',
+		KEY "job_run_job_started" ("job", "started")
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8 AUTO_INCREMENT=1`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) createTaskLockTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "task_lock" (
+		"name" VARCHAR(64) PRIMARY KEY NOT NULL,
+		"holder" VARCHAR(255) NOT NULL,
+		"expires" INTEGER NOT NULL
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) createFlaggedAlertTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "flagged_alert" (
+		"mac" VARCHAR(17) NOT NULL,
+		"notifier" VARCHAR(64) NOT NULL,
+		"last_seen" INTEGER NOT NULL,
+		"sent" INTEGER NOT NULL,
+		PRIMARY KEY ("mac", "notifier")
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) createWebhookDeliveryTable(d *common.DatabaseAccessor) error {
+	sql := `CREATE TABLE "webhook_delivery" (
+		"id" INTEGER PRIMARY KEY AUTO_INCREMENT NOT NULL,
+		"endpoint" VARCHAR(64) NOT NULL,
+		"event" VARCHAR(64) NOT NULL,
+		"payload" MEDIUMTEXT NOT NULL,
+		"status" VARCHAR(16) NOT NULL,
+		"attempts" INTEGER NOT NULL DEFAULT 0,
+		"next_attempt" INTEGER NOT NULL,
+		"response_code" INTEGER NOT NULL DEFAULT 0,
+		"last_error" TEXT NOT NULL,
+		"created" INTEGER NOT NULL,
+		"delivered" INTEGER NOT NULL DEFAULT 0,
+		KEY "webhook_delivery_status_next" ("status", "next_attempt")
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8 AUTO_INCREMENT=1`
+
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
 func (m *mySQLDB) migrateFrom1(d *common.DatabaseAccessor, c *common.Config) error {
 	// Move device blacklist to blacklist table
 	bd, err := d.DB.Query(`SELECT "mac" FROM "device" WHERE "blacklisted" = 1`)
@@ -404,3 +758,132 @@ func (m *mySQLDB) migrateFrom5(d *common.DatabaseAccessor, c *common.Config) err
 	_, err := d.DB.Exec(sql)
 	return err
 }
+
+func (m *mySQLDB) migrateFrom6(d *common.DatabaseAccessor, c *common.Config) error {
+	sql := `ALTER TABLE "user" ADD COLUMN (
+		"attributes" TEXT
+	);`
+	if _, err := d.DB.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `ALTER TABLE "device" ADD COLUMN (
+		"attributes" TEXT
+	);`
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) migrateFrom7(d *common.DatabaseAccessor, c *common.Config) error {
+	sql := `ALTER TABLE "user" ADD COLUMN (
+		"category_limits" TEXT
+	);`
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) migrateFrom8(d *common.DatabaseAccessor, c *common.Config) error {
+	sql := `ALTER TABLE "user" ADD COLUMN (
+		"email" VARCHAR(255) NOT NULL DEFAULT ''
+	);`
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) migrateFrom9(d *common.DatabaseAccessor, c *common.Config) error {
+	sql := `ALTER TABLE "device" ADD COLUMN (
+		"renewals" INTEGER NOT NULL DEFAULT 0
+	);`
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) migrateFrom10(d *common.DatabaseAccessor, c *common.Config) error {
+	sql := `ALTER TABLE "device" ADD COLUMN (
+		"policy_version" INTEGER NOT NULL DEFAULT 0,
+		"policy_accepted" INTEGER NOT NULL DEFAULT 0
+	);`
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) migrateFrom11(d *common.DatabaseAccessor, c *common.Config) error {
+	sql := `ALTER TABLE "device" ADD COLUMN (
+		"tags" TEXT
+	);`
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) migrateFrom12(d *common.DatabaseAccessor, c *common.Config) error {
+	// Existing notes become the first entry of the notes log
+	now := time.Now().Unix()
+
+	sql := `INSERT INTO "note" ("entity", "entity_key", "author", "created", "text")
+		SELECT 'device', "mac", '', ?, "notes" FROM "device" WHERE "notes" IS NOT NULL AND "notes" != ''`
+	if _, err := d.DB.Exec(sql, now); err != nil {
+		return err
+	}
+
+	sql = `INSERT INTO "note" ("entity", "entity_key", "author", "created", "text")
+		SELECT 'user', "username", '', ?, "notes" FROM "user" WHERE "notes" IS NOT NULL AND "notes" != ''`
+	_, err := d.DB.Exec(sql, now)
+	return err
+}
+
+func (m *mySQLDB) migrateFrom13(d *common.DatabaseAccessor, c *common.Config) error {
+	// Start the history of existing devices with their registration
+	sql := `INSERT INTO "device_event" ("mac", "type", "username", "changed_by", "created", "details")
+		SELECT "mac", 'registered', "username", '', "date_registered", 'Registered before device history was kept' FROM "device"`
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) migrateFrom14(d *common.DatabaseAccessor, c *common.Config) error {
+	// The device_event table may have been created with the column already
+	row := d.DB.QueryRow(`SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE "TABLE_SCHEMA" = DATABASE() AND "TABLE_NAME" = 'device_event' AND "COLUMN_NAME" = 'auth_method'`)
+
+	var exists int
+	if err := row.Scan(&exists); err != nil {
+		return err
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	sql := `ALTER TABLE "device_event" ADD COLUMN (
+		"auth_method" VARCHAR(32) NOT NULL DEFAULT ''
+	);`
+	_, err := d.DB.Exec(sql)
+	return err
+}
+
+func (m *mySQLDB) migrateFrom15(d *common.DatabaseAccessor, c *common.Config) error {
+	// The trash and archive tables may have been created with the columns
+	// already
+	for _, table := range []string{"device", "device_trash", "device_archive"} {
+		row := d.DB.QueryRow(`SELECT COUNT(*) FROM information_schema.COLUMNS
+			WHERE "TABLE_SCHEMA" = DATABASE() AND "TABLE_NAME" = ? AND "COLUMN_NAME" = 'flag_category'`, table)
+
+		var exists int
+		if err := row.Scan(&exists); err != nil {
+			return err
+		}
+		if exists > 0 {
+			continue
+		}
+
+		sql := `ALTER TABLE "` + table + `" ADD COLUMN (
+			"flag_category" VARCHAR(64) NOT NULL DEFAULT '',
+			"flag_reason" TEXT,
+			"flagged_by" VARCHAR(255) NOT NULL DEFAULT '',
+			"flagged_at" INTEGER NOT NULL DEFAULT 0,
+			"flag_clears" INTEGER NOT NULL DEFAULT 0
+		);`
+		if _, err := d.DB.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package exporter writes devices and users as CSV or JSON. Records are
+// streamed from the database so large exports aren't held in memory. Exports
+// use the importer's columns so they can be imported again.
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/importer"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+// Output formats
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Exportable resources
+const (
+	ResourceDevices = "devices"
+	ResourceUsers   = "users"
+)
+
+// ParseFormat validates an output format. An empty format is CSV.
+func ParseFormat(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "", FormatCSV:
+		return FormatCSV, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("Unknown export format '%s'", s)
+}
+
+// RequiredPermission returns the permission needed to export resource. False
+// is returned if the resource can't be exported.
+func RequiredPermission(resource string) (models.Permission, bool) {
+	switch resource {
+	case ResourceDevices:
+		return models.ViewDevices, true
+	case ResourceUsers:
+		return models.ViewUsers, true
+	}
+	return 0, false
+}
+
+type Exporter struct {
+	e       *common.Environment
+	users   stores.UserStore
+	devices stores.DeviceStore
+}
+
+func New(e *common.Environment, us stores.UserStore, ds stores.DeviceStore) *Exporter {
+	return &Exporter{
+		e:       e,
+		users:   us,
+		devices: ds,
+	}
+}
+
+// WriteResponse sends resource as a file download. Once the headers are sent
+// errors can't be reported to the client so the caller should only log them.
+// The number of exported records is returned.
+func (x *Exporter) WriteResponse(w http.ResponseWriter, resource, format string, f Filter) (int, error) {
+	contentType := "text/csv"
+	if format == FormatJSON {
+		contentType = "application/json"
+	}
+	filename := fmt.Sprintf("%s-%s.%s", resource, time.Now().Format("20060102"), format)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	switch resource {
+	case ResourceDevices:
+		return x.Devices(w, format, f)
+	case ResourceUsers:
+		return x.Users(w, format, f)
+	}
+	return 0, fmt.Errorf("Unknown export resource '%s'", resource)
+}
+
+// Devices writes the devices matching f in the importer's format.
+func (x *Exporter) Devices(w io.Writer, format string, f Filter) (int, error) {
+	fields := x.e.Config.CustomFieldsFor(common.CustomFieldDevice)
+	columns := append(append([]string{}, importer.Columns...), fieldNames(fields)...)
+
+	rw, err := newRowWriter(w, format, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	where, values := f.deviceWhere()
+	err = x.devices.Each(where, func(d *models.Device) error {
+		count++
+		return rw.writeRow(deviceRow(d, fields))
+	}, values...)
+	if err != nil {
+		return count, err
+	}
+	return count, rw.close()
+}
+
+// Users writes the users matching f in the importer's format.
+func (x *Exporter) Users(w io.Writer, format string, f Filter) (int, error) {
+	fields := x.e.Config.CustomFieldsFor(common.CustomFieldUser)
+	columns := append(append([]string{}, importer.UserColumns...), fieldNames(fields)...)
+
+	rw, err := newRowWriter(w, format, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	where, values := f.userWhere()
+	err = x.users.Each(where, func(u *models.User) error {
+		count++
+		return rw.writeRow(userRow(u, fields))
+	}, values...)
+	if err != nil {
+		return count, err
+	}
+	return count, rw.close()
+}
+
+func fieldNames(fields []common.CustomField) []string {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.Name
+	}
+	return names
+}
+
+func deviceRow(d *models.Device, fields []common.CustomField) []interface{} {
+	tags := []string(d.Tags)
+	if tags == nil {
+		tags = []string{}
+	}
+
+	row := []interface{}{
+		d.Username,
+		d.MAC.String(),
+		d.Description,
+		d.Platform,
+		formatExpires(d.Expires),
+		d.Notes,
+		d.Flagged,
+		tags,
+	}
+	for _, f := range fields {
+		row = append(row, d.Attributes.Get(f.Name))
+	}
+	return row
+}
+
+// formatExpires formats an expiration the way the importer parses it.
+func formatExpires(t time.Time) string {
+	switch t.Unix() {
+	case 0:
+		return "never"
+	case 1:
+		return "rolling"
+	}
+	return t.Format(common.TimeFormat)
+}
+
+func userRow(u *models.User, fields []common.CustomField) []interface{} {
+	validStart, validEnd := "0", "0"
+	if !u.ValidForever {
+		validStart = u.ValidStart.Format(common.TimeFormat)
+		validEnd = u.ValidEnd.Format(common.TimeFormat)
+	}
+
+	expType, expValue := 0, ""
+	if u.DeviceExpiration != nil {
+		expType = int(u.DeviceExpiration.Mode)
+		expValue = formatUserExpiration(u.DeviceExpiration)
+	}
+
+	row := []interface{}{
+		u.Username,
+		u.Email,
+		int(u.DeviceLimit),
+		expType,
+		expValue,
+		validStart,
+		validEnd,
+		u.UIGroup,
+		u.APIGroup,
+		boolInt(u.AllowStatusAPI),
+		boolInt(u.CanManage),
+		boolInt(u.CanAutoreg),
+		u.Notes,
+		u.CategoryLimits.List(),
+	}
+	for _, f := range fields {
+		row = append(row, u.Attributes.Get(f.Name))
+	}
+	return row
+}
+
+// formatUserExpiration formats the expiration value the way the user API
+// parses the device_expiration field.
+func formatUserExpiration(e *models.UserDeviceExpiration) string {
+	switch e.Mode {
+	case models.UserDeviceExpirationSpecific:
+		return time.Unix(e.Value, 0).Format(common.TimeFormat)
+	case models.UserDeviceExpirationDuration:
+		return (time.Duration(e.Value) * time.Second).String()
+	case models.UserDeviceExpirationDaily:
+		return fmt.Sprintf("%02d:%02d", e.Value/3600, e.Value%3600/60)
+	}
+	return ""
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,166 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/importer"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+func exportTestSetup() *Exporter {
+	e := common.NewTestEnvironment()
+	deviceStore := &stores.TestDeviceStore{}
+
+	device := models.NewDevice(deviceStore, nil, &stores.TestBlacklistItem{})
+	device.ID = 1
+	device.MAC, _ = net.ParseMAC("12:34:56:00:00:01")
+	device.Username = "alice"
+	device.Description = "Laptop, work"
+	device.Expires = time.Unix(0, 0)
+	device.Flagged = true
+	device.Tags = models.ParseTags("lab,printer")
+	deviceStore.Devices = append(deviceStore.Devices, device)
+
+	user := models.NewUser(e, &stores.TestUserStore{}, &stores.TestBlacklistItem{}, "alice")
+	user.ValidForever = true
+	user.CanManage = true
+	user.DeviceExpiration = &models.UserDeviceExpiration{
+		Mode:  models.UserDeviceExpirationDaily,
+		Value: 13*3600 + 30*60,
+	}
+	userStore := &stores.TestUserStore{Users: []*models.User{user}}
+
+	return New(e, userStore, deviceStore)
+}
+
+func TestExportDevicesCSV(t *testing.T) {
+	x := exportTestSetup()
+
+	var buf bytes.Buffer
+	count, err := x.Devices(&buf, FormatCSV, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("Expected 1 device, got %d", count)
+	}
+
+	// The export must be readable by the importer
+	records, err := importer.ParseCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"username":    "alice",
+		"mac":         "12:34:56:00:00:01",
+		"description": "Laptop, work",
+		"platform":    "",
+		"expires":     "never",
+		"notes":       "",
+		"flagged":     "true",
+		"tags":        "lab,printer",
+	}
+	if len(records) != 1 || !reflect.DeepEqual(records[0].Values, expected) {
+		t.Errorf("Wrong device export: %v", records[0].Values)
+	}
+}
+
+func TestExportDevicesJSON(t *testing.T) {
+	x := exportTestSetup()
+
+	var buf bytes.Buffer
+	if _, err := x.Devices(&buf, FormatJSON, Filter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var devices []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &devices); err != nil {
+		t.Fatalf("Invalid JSON %q: %s", buf.String(), err)
+	}
+	if len(devices) != 1 || devices[0]["flagged"] != true || devices[0]["mac"] != "12:34:56:00:00:01" {
+		t.Errorf("Wrong device export: %v", devices)
+	}
+
+	records, err := importer.ParseJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records[0].Values["tags"] != "lab,printer" {
+		t.Errorf("Wrong tags after import: %v", records[0].Values)
+	}
+}
+
+func TestExportUsers(t *testing.T) {
+	x := exportTestSetup()
+
+	var buf bytes.Buffer
+	if _, err := x.Users(&buf, FormatJSON, Filter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var users []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &users); err != nil {
+		t.Fatalf("Invalid JSON %q: %s", buf.String(), err)
+	}
+	user := users[0]
+	if user["username"] != "alice" || user["valid_start"] != "0" || user["can_manage"] != float64(1) ||
+		user["expiration_type"] != float64(models.UserDeviceExpirationDaily) || user["device_expiration"] != "13:30" {
+		t.Errorf("Wrong user export: %v", user)
+	}
+}
+
+func TestExportEmpty(t *testing.T) {
+	x := New(common.NewTestEnvironment(), &stores.TestUserStore{}, &stores.TestDeviceStore{})
+
+	var buf bytes.Buffer
+	if _, err := x.Devices(&buf, FormatJSON, Filter{}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[]\n" {
+		t.Errorf("Expected empty array, got %q", buf.String())
+	}
+}
+
+func TestFilter(t *testing.T) {
+	r := httptest.NewRequest("GET", "/admin/export/devices?username=Alice&network=Lab&seen-to=2030-01-02&flagged=1&blacklisted=0", nil)
+	f, err := ParseFilter(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Username != "alice" || f.Network != "Lab" || f.Flagged == nil || !*f.Flagged {
+		t.Errorf("Wrong filter: %+v", f)
+	}
+	if f.SeenTo.Format(common.TimeFormat) != "2030-01-03 00:00" {
+		t.Errorf("seen-to date should include the whole day, got %s", f.SeenTo)
+	}
+
+	where, values := f.deviceWhere()
+	expected := `"username" = ? AND "mac" NOT IN (SELECT "value" FROM "blacklist") AND ` +
+		`"mac" IN (SELECT "mac" FROM "lease" WHERE "network" = ?) AND "last_seen" < ? AND "flagged" = ?`
+	if where != expected || len(values) != 4 {
+		t.Errorf("Wrong device where clause: %s %v", where, values)
+	}
+
+	where, values = Filter{Network: "Lab"}.userWhere()
+	expected = `u."username" IN (SELECT "username" FROM "device" WHERE "mac" IN (SELECT "mac" FROM "lease" WHERE "network" = ?))`
+	if where != expected || len(values) != 1 {
+		t.Errorf("Wrong user where clause: %s %v", where, values)
+	}
+
+	r = httptest.NewRequest("GET", "/admin/export/devices?flagged=maybe", nil)
+	if _, err := ParseFilter(r); err == nil {
+		t.Error("Expected error for invalid flagged value")
+	}
+}
@@ -0,0 +1,149 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exporter
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+// Filter limits the exported devices or users. Zero values match everything.
+// For user exports the device filters match users with at least one matching
+// device.
+type Filter struct {
+	Username    string
+	Network     string
+	SeenFrom    time.Time // Inclusive
+	SeenTo      time.Time // Exclusive
+	Flagged     *bool
+	Blacklisted *bool
+}
+
+// ParseFilter reads a filter from the username, network, seen-from, seen-to,
+// flagged, and blacklisted request values. Dates may be given as YYYY-MM-DD
+// or a date and time. A seen-to date without a time includes the whole day.
+func ParseFilter(r *http.Request) (Filter, error) {
+	f := Filter{
+		Username: strings.ToLower(strings.TrimSpace(r.FormValue("username"))),
+		Network:  strings.TrimSpace(r.FormValue("network")),
+	}
+
+	var err error
+	if f.SeenFrom, _, err = parseDate(r.FormValue("seen-from")); err != nil {
+		return f, fmt.Errorf("Invalid seen-from date: %s", err)
+	}
+
+	var dateOnly bool
+	if f.SeenTo, dateOnly, err = parseDate(r.FormValue("seen-to")); err != nil {
+		return f, fmt.Errorf("Invalid seen-to date: %s", err)
+	}
+	if dateOnly {
+		f.SeenTo = f.SeenTo.AddDate(0, 0, 1)
+	}
+
+	if f.Flagged, err = parseOptionalBool(r.FormValue("flagged")); err != nil {
+		return f, fmt.Errorf("Invalid flagged value: %s", err)
+	}
+	if f.Blacklisted, err = parseOptionalBool(r.FormValue("blacklisted")); err != nil {
+		return f, fmt.Errorf("Invalid blacklisted value: %s", err)
+	}
+	return f, nil
+}
+
+func parseDate(s string) (time.Time, bool, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false, nil
+	}
+	if t, err := time.ParseInLocation(common.TimeFormat, s, time.Local); err == nil {
+		return t, false, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	return t, err == nil, err
+}
+
+func parseOptionalBool(s string) (*bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// deviceWhere returns the where clause and values selecting matching devices.
+func (f Filter) deviceWhere() (string, []interface{}) {
+	var clauses []string
+	var values []interface{}
+
+	if f.Username != "" {
+		clauses = append(clauses, `"username" = ?`)
+		values = append(values, f.Username)
+	}
+	if f.Blacklisted != nil {
+		clauses = append(clauses, `"mac" `+notIn(*f.Blacklisted)+` (SELECT "value" FROM "blacklist")`)
+	}
+
+	dc, dv := f.deviceOnlyWhere()
+	return strings.Join(append(clauses, dc...), " AND "), append(values, dv...)
+}
+
+// userWhere returns the where clause and values selecting matching users.
+func (f Filter) userWhere() (string, []interface{}) {
+	var clauses []string
+	var values []interface{}
+
+	if f.Username != "" {
+		clauses = append(clauses, `u."username" = ?`)
+		values = append(values, f.Username)
+	}
+	if f.Blacklisted != nil {
+		clauses = append(clauses, `u."username" `+notIn(*f.Blacklisted)+` (SELECT "value" FROM "blacklist")`)
+	}
+
+	if dc, dv := f.deviceOnlyWhere(); len(dc) > 0 {
+		clauses = append(clauses, `u."username" IN (SELECT "username" FROM "device" WHERE `+strings.Join(dc, " AND ")+`)`)
+		values = append(values, dv...)
+	}
+	return strings.Join(clauses, " AND "), values
+}
+
+// deviceOnlyWhere returns the clauses for filters on device columns.
+func (f Filter) deviceOnlyWhere() ([]string, []interface{}) {
+	var clauses []string
+	var values []interface{}
+
+	if f.Network != "" {
+		clauses = append(clauses, `"mac" IN (SELECT "mac" FROM "lease" WHERE "network" = ?)`)
+		values = append(values, f.Network)
+	}
+	if !f.SeenFrom.IsZero() {
+		clauses = append(clauses, `"last_seen" >= ?`)
+		values = append(values, f.SeenFrom.Unix())
+	}
+	if !f.SeenTo.IsZero() {
+		clauses = append(clauses, `"last_seen" < ?`)
+		values = append(values, f.SeenTo.Unix())
+	}
+	if f.Flagged != nil {
+		clauses = append(clauses, `"flagged" = ?`)
+		values = append(values, *f.Flagged)
+	}
+	return clauses, values
+}
+
+func notIn(in bool) string {
+	if in {
+		return "IN"
+	}
+	return "NOT IN"
+}
@@ -0,0 +1,114 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// rowWriter writes one record at a time. Values are strings, ints, bools,
+// or string slices in column order.
+type rowWriter interface {
+	writeRow(values []interface{}) error
+	close() error
+}
+
+func newRowWriter(w io.Writer, format string, columns []string) (rowWriter, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns)
+	case FormatJSON:
+		return newJSONWriter(w, columns)
+	}
+	return nil, fmt.Errorf("Unknown export format '%s'", format)
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, columns []string) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	if err := cw.w.Write(columns); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (c *csvWriter) writeRow(values []interface{}) error {
+	fields := make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case string:
+			fields[i] = v
+		case int:
+			fields[i] = strconv.Itoa(v)
+		case bool:
+			fields[i] = strconv.FormatBool(v)
+		case []string:
+			fields[i] = strings.Join(v, ",")
+		default:
+			fields[i] = fmt.Sprint(v)
+		}
+	}
+	return c.w.Write(fields)
+}
+
+func (c *csvWriter) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonWriter writes an array of objects keyed by column. The array is
+// written as records arrive instead of being marshalled at once.
+type jsonWriter struct {
+	w       io.Writer
+	columns []string
+	started bool
+}
+
+func newJSONWriter(w io.Writer, columns []string) (*jsonWriter, error) {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return nil, err
+	}
+	return &jsonWriter{w: w, columns: columns}, nil
+}
+
+func (j *jsonWriter) writeRow(values []interface{}) error {
+	obj := make(map[string]interface{}, len(j.columns))
+	for i, column := range j.columns {
+		obj[column] = values[i]
+	}
+
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	sep := ",\n"
+	if !j.started {
+		sep = "\n"
+		j.started = true
+	}
+	if _, err := io.WriteString(j.w, sep); err != nil {
+		return err
+	}
+	_, err = j.w.Write(b)
+	return err
+}
+
+func (j *jsonWriter) close() error {
+	end := "]\n"
+	if j.started {
+		end = "\n]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
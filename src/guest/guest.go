@@ -14,8 +14,10 @@ import (
 
 	"github.com/lfkeitel/verbose/v4"
 	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/metrics"
 	"github.com/packet-guardian/packet-guardian/src/models"
 	"github.com/packet-guardian/packet-guardian/src/models/stores"
+	"github.com/packet-guardian/packet-guardian/src/webhooks"
 	"github.com/packet-guardian/useragent"
 )
 
@@ -40,7 +42,8 @@ func GenerateGuestCode() string {
 
 // RegisterDevice will register the device for a guest. It is a simplified form of the
 // full registration function found in controllers.api.Device.RegistrationHandler().
-func RegisterDevice(e *common.Environment, name, credential string, r *http.Request, users stores.UserStore, devices stores.DeviceStore, leases stores.LeaseStore) error {
+// Guests accept the current registration policy by completing the registration.
+func RegisterDevice(e *common.Environment, name, credential string, r *http.Request, users stores.UserStore, devices stores.DeviceStore, leases stores.LeaseStore, policies stores.PolicyStore, hooks stores.WebhookStore) error {
 	// Build guest user model
 	guest, err := users.GetUserByUsername(credential)
 	if err != nil {
@@ -121,8 +124,22 @@ func RegisterDevice(e *common.Environment, name, credential string, r *http.Requ
 	// Validate platform, we don't want someone to submit an inappropriate value
 	platform := useragent.ParseUserAgent(r.UserAgent()).String()
 
+	if common.IsLocallyAdministered(mac) &&
+		e.Config.RandomizedMACPolicy(platform, lease.Network) == common.RandomizedMACReject {
+		e.Log.WithFields(verbose.Fields{
+			"package":  "guest",
+			"mac":      mac.String(),
+			"platform": platform,
+			"network":  lease.Network,
+			"username": credential,
+		}).Notice("Rejected registration of randomized MAC address")
+		return errors.New(e.Config.Registration.RandomizedMAC.Guidance)
+	}
+
 	// Fill in device information
 	device.Username = credential
+	device.ChangedBy = credential
+	device.AuthMethod = "guest"
 	device.Description = "Guest - " + name
 	device.RegisteredFrom = ip
 	device.Platform = platform
@@ -130,6 +147,18 @@ func RegisterDevice(e *common.Environment, name, credential string, r *http.Requ
 	device.DateRegistered = time.Now()
 	device.LastSeen = time.Now()
 	device.UserAgent = r.UserAgent()
+	device.LimitRandomizedExpiration(e, time.Now())
+
+	if policies != nil {
+		acceptance, err := acceptPolicy(e, credential, ip, policies)
+		if err != nil {
+			return errors.New("Error registering device")
+		}
+		if acceptance != nil {
+			device.PolicyVersion = acceptance.Version
+			device.PolicyAccepted = acceptance.Accepted
+		}
+	}
 
 	// Save new device
 	if err := device.Save(); err != nil {
@@ -146,9 +175,40 @@ func RegisterDevice(e *common.Environment, name, credential string, r *http.Requ
 		"username": credential,
 		"action":   "register_guest_device",
 	}).Info("Device registered")
+	metrics.Registrations.Inc("guest")
+	webhooks.FireDevice(e, hooks, common.WebhookDeviceRegistered, credential, device)
 	return nil
 }
 
+// acceptPolicy records a guest accepting the current registration policy. Nil
+// is returned if no policy version has been published.
+func acceptPolicy(e *common.Environment, credential string, ip net.IP, policies stores.PolicyStore) (*models.PolicyAcceptance, error) {
+	policy, err := policies.GetCurrentPolicy()
+	if err == nil && !policy.Versioned() {
+		return nil, nil
+	}
+
+	var acceptance *models.PolicyAcceptance
+	if err == nil {
+		acceptance, err = policies.GetAcceptance(credential, policy.ID)
+	}
+	if err == nil && acceptance.ID == 0 {
+		acceptance.Accepted = time.Now()
+		acceptance.IP = ip.String()
+		err = policies.SaveAcceptance(acceptance)
+	}
+
+	if err != nil {
+		e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "guest",
+			"username": credential,
+		}).Error("Error saving policy acceptance")
+		return nil, err
+	}
+	return acceptance, nil
+}
+
 // TODO: Create tests for this
 func calcDeviceExpirationModeValue(expType, expTimeStr string) (models.UserExpiration, int64, error) {
 	switch expType {
@@ -163,6 +223,8 @@ func calcDeviceExpirationModeValue(expType, expTimeStr string) (models.UserExpir
 	case "daily":
 		expTime, err := common.ParseTime(expTimeStr)
 		return models.UserDeviceExpirationDaily, expTime, err
+	case "term":
+		return models.UserDeviceExpirationTerm, 0, nil
 	default:
 		return 0, 0, errors.New(expType + " is not a valid device expiration type")
 	}
@@ -40,7 +40,7 @@ func TestGuestRegister(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := RegisterDevice(e, "John Doe", "johndoe@example.com", r, testUserStore, testDeviceStore, testLeaseStore); err != nil {
+	if err := RegisterDevice(e, "John Doe", "johndoe@example.com", r, testUserStore, testDeviceStore, testLeaseStore, nil, nil); err != nil {
 		t.Fatal(err)
 	}
 }
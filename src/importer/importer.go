@@ -0,0 +1,418 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package importer creates and updates devices and users in bulk from CSV or
+// JSON data.
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+	"github.com/packet-guardian/packet-guardian/src/webhooks"
+)
+
+// Import modes
+const (
+	// ModeCreate registers new devices, existing devices are an error
+	ModeCreate = "create"
+	// ModeUpsert registers new devices and updates existing devices
+	ModeUpsert = "upsert"
+)
+
+// Row outcomes
+const (
+	OutcomeCreated = "created"
+	OutcomeUpdated = "updated"
+	OutcomeError   = "error"
+)
+
+// Columns are the device properties that can be imported. Device custom
+// fields may also be given using the field name.
+var Columns = []string{"username", "mac", "description", "platform", "expires", "notes", "flagged", "tags"}
+
+// UserColumns are the user properties that can be imported. Values use the
+// same format as the user API. User custom fields may also be given using the
+// field name.
+var UserColumns = []string{
+	"username", "email", "device_limit", "expiration_type", "device_expiration",
+	"valid_start", "valid_end", "ui_group", "api_group", "allow_status_api",
+	"can_manage", "can_autoreg", "notes", "category_limits",
+}
+
+// Options controls how records are imported.
+type Options struct {
+	Mode      string
+	DryRun    bool
+	ChangedBy string
+	IP        net.IP
+	Editor    *models.User // Permissions are checked against the editor when importing users or reassigning devices
+}
+
+// checkMode validates the mode, defaulting to ModeCreate.
+func (o *Options) checkMode() error {
+	if o.Mode == "" {
+		o.Mode = ModeCreate
+	}
+	if o.Mode != ModeCreate && o.Mode != ModeUpsert {
+		return fmt.Errorf("Unknown import mode '%s'", o.Mode)
+	}
+	return nil
+}
+
+// RowResult is the outcome of importing one record.
+type RowResult struct {
+	Row      int    `json:"row"`
+	MAC      string `json:"mac"`
+	Username string `json:"username"`
+	Outcome  string `json:"outcome"`
+	Message  string `json:"message,omitempty"`
+}
+
+// Result is the outcome of an import. In a dry run the outcomes are what
+// would happen but nothing is saved.
+type Result struct {
+	Mode    string       `json:"mode"`
+	DryRun  bool         `json:"dry_run"`
+	Created int          `json:"created"`
+	Updated int          `json:"updated"`
+	Failed  int          `json:"failed"`
+	Rows    []*RowResult `json:"rows"`
+}
+
+func (r *Result) add(row *RowResult) {
+	switch row.Outcome {
+	case OutcomeCreated:
+		r.Created++
+	case OutcomeUpdated:
+		r.Updated++
+	case OutcomeError:
+		r.Failed++
+	}
+	r.Rows = append(r.Rows, row)
+}
+
+// WriteCSV writes the per row outcomes as a CSV report.
+func (r *Result) WriteCSV(w io.Writer) error {
+	csvw := csv.NewWriter(w)
+	csvw.Write([]string{"row", "mac", "username", "outcome", "message"})
+	for _, row := range r.Rows {
+		csvw.Write([]string{strconv.Itoa(row.Row), row.MAC, row.Username, row.Outcome, row.Message})
+	}
+	csvw.Flush()
+	return csvw.Error()
+}
+
+type Importer struct {
+	e        *common.Environment
+	users    stores.UserStore
+	devices  stores.DeviceStore
+	webhooks stores.WebhookStore
+
+	userCache map[string]*models.User
+}
+
+func New(e *common.Environment, us stores.UserStore, ds stores.DeviceStore, ws stores.WebhookStore) *Importer {
+	return &Importer{
+		e:        e,
+		users:    us,
+		devices:  ds,
+		webhooks: ws,
+	}
+}
+
+// Import registers or updates a device for each record. When updating, only
+// columns with a value change the device. An error is returned if the records
+// have an unknown column, otherwise errors are reported per row.
+func (i *Importer) Import(records []*Record, opts Options) (*Result, error) {
+	if err := opts.checkMode(); err != nil {
+		return nil, err
+	}
+
+	attrFields, err := i.attributeFields(records, common.CustomFieldDevice, Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	i.userCache = make(map[string]*models.User)
+	seen := make(map[string]bool)
+	result := &Result{Mode: opts.Mode, DryRun: opts.DryRun}
+
+	for _, record := range records {
+		row := &RowResult{Row: record.Row}
+		row.Username, _ = record.get("username")
+		row.MAC, _ = record.get("mac")
+
+		if err := i.importRecord(record, row, attrFields, seen, opts); err != nil {
+			row.Outcome = OutcomeError
+			row.Message = err.Error()
+		}
+		result.add(row)
+	}
+	return result, nil
+}
+
+// attributeFields returns the entity custom fields given as columns in records.
+// Columns that aren't in columns or a custom field are an error.
+func (i *Importer) attributeFields(records []*Record, entity string, columns []string) ([]common.CustomField, error) {
+	var fields []common.CustomField
+	seen := make(map[string]bool)
+
+	for _, record := range records {
+		for column := range record.Values {
+			if seen[column] || common.StringInSlice(column, columns) {
+				continue
+			}
+			seen[column] = true
+
+			field, ok := i.e.Config.GetCustomField(entity, column)
+			if !ok {
+				return nil, fmt.Errorf("Unknown column '%s'", column)
+			}
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+func (i *Importer) importRecord(record *Record, row *RowResult, attrFields []common.CustomField, seen map[string]bool, opts Options) error {
+	if record.Err != nil {
+		return record.Err
+	}
+
+	macStr, _ := record.get("mac")
+	if macStr == "" {
+		return errors.New("MAC address is required")
+	}
+	mac, err := common.FormatMacAddress(macStr)
+	if err != nil {
+		return fmt.Errorf("Invalid MAC address '%s'", macStr)
+	}
+	row.MAC = mac.String()
+
+	if seen[row.MAC] {
+		return errors.New("Duplicate MAC address in import")
+	}
+	seen[row.MAC] = true
+
+	device, err := i.devices.GetDeviceByMAC(mac)
+	if err != nil {
+		i.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "importer",
+			"mac":     row.MAC,
+		}).Error("Error getting device")
+		return errors.New("Error getting device")
+	}
+
+	create := device.ID == 0
+	if !create && opts.Mode == ModeCreate {
+		return errors.New("Device already registered")
+	}
+
+	username := strings.ToLower(row.Username)
+	if username == "" {
+		if create {
+			return errors.New("Username is required")
+		}
+		username = device.Username
+	}
+	row.Username = username
+
+	user, err := i.getUser(username)
+	if err != nil {
+		return err
+	}
+
+	previousUsername := device.Username
+	reassign := !create && username != previousUsername
+	if reassign {
+		if err := i.checkReassign(device, user, opts); err != nil {
+			return err
+		}
+	}
+
+	// Values are applied to new devices, existing devices only change
+	// when the column has a value.
+	get := func(column string) (string, bool) {
+		v, ok := record.get(column)
+		return v, ok && (create || v != "")
+	}
+
+	if v, ok := get("expires"); ok && v != "" {
+		device.Expires, err = parseExpires(v)
+		if err != nil {
+			return err
+		}
+	} else if create || reassign {
+		// Change expiration to reflect new owner
+		device.Expires = user.DeviceExpiration.NextExpiration(i.e, time.Now())
+	}
+
+	if v, ok := get("flagged"); ok && v != "" {
+		flagged, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("Invalid flagged value '%s'", v)
+		}
+		// Imported flags have no category, existing flags are kept as is
+		if flagged && !device.Flagged {
+			device.Flag("", "", opts.ChangedBy, time.Time{})
+		} else if !flagged {
+			device.Unflag()
+		}
+	}
+
+	if v, ok := get("tags"); ok {
+		device.Tags = models.ParseTags(v)
+	}
+	if v, ok := get("description"); ok {
+		device.Description = v
+	}
+	if v, ok := get("platform"); ok {
+		device.Platform = v
+	}
+	if v, ok := get("notes"); ok {
+		device.Notes = v
+	}
+
+	if err := device.Attributes.ApplyCustomFields(attrFields, get, true); err != nil {
+		return err
+	}
+
+	device.Username = username
+	device.ChangedBy = opts.ChangedBy
+	device.AuthMethod = "import"
+	if create {
+		row.Outcome = OutcomeCreated
+		device.RegisteredFrom = opts.IP
+		device.DateRegistered = time.Now()
+		device.LastSeen = time.Now()
+		device.UserAgent = "Manual"
+	} else {
+		row.Outcome = OutcomeUpdated
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+
+	if err := device.Save(); err != nil {
+		i.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "importer",
+			"mac":     row.MAC,
+		}).Error("Error saving device")
+		return errors.New("Error saving device")
+	}
+
+	action := "register_device"
+	if reassign {
+		action = "reassign_device"
+	} else if !create {
+		action = "edit_device"
+	}
+	i.e.Log.WithFields(verbose.Fields{
+		"package":    "importer",
+		"mac":        row.MAC,
+		"changed-by": opts.ChangedBy,
+		"username":   username,
+		"action":     action,
+		"manual":     true,
+	}).Info("Device imported")
+
+	actor := opts.ChangedBy
+	if opts.Editor != nil {
+		actor = opts.Editor.Username
+	}
+	if create {
+		webhooks.FireDevice(i.e, i.webhooks, common.WebhookDeviceRegistered, actor, device)
+	} else if reassign {
+		webhooks.Fire(i.e, i.webhooks, common.WebhookDeviceReassigned, actor, &webhooks.DeviceData{
+			Device:           device,
+			PreviousUsername: previousUsername,
+		})
+	}
+	return nil
+}
+
+// checkReassign makes sure the editor can move device to user and user has
+// room for another device.
+func (i *Importer) checkReassign(device *models.Device, user *models.User, opts Options) error {
+	if opts.Editor == nil || !opts.Editor.Can(models.ReassignDevice) {
+		return errors.New("Permission denied to reassign device")
+	}
+	// Protect blacklisted devices
+	if device.IsBlacklisted() && !opts.Editor.Can(models.ManageBlacklist) {
+		return errors.New("Device is blocked")
+	}
+
+	limit := models.UserDeviceLimit(i.e.Config.Registration.DefaultDeviceLimit)
+	if user.DeviceLimit != models.UserDeviceLimitGlobal {
+		limit = user.DeviceLimit
+	}
+	if limit == models.UserDeviceLimitUnlimited {
+		return nil
+	}
+
+	count, err := i.devices.GetDeviceCountForUser(user)
+	if err != nil {
+		i.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "importer",
+			"username": user.Username,
+		}).Error("Error getting device count")
+		return errors.New("Error getting device count")
+	}
+	if count >= int(limit) {
+		return fmt.Errorf("Device limit reached for '%s'", user.Username)
+	}
+	return nil
+}
+
+func (i *Importer) getUser(username string) (*models.User, error) {
+	if user, ok := i.userCache[username]; ok {
+		return user, nil
+	}
+
+	user, err := i.users.GetUserByUsername(username)
+	if err != nil {
+		i.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "importer",
+			"username": username,
+		}).Error("Error getting user")
+		return nil, fmt.Errorf("Error getting user '%s'", username)
+	}
+	i.userCache[username] = user
+	return user, nil
+}
+
+// parseExpires parses an expiration as "never", "rolling", a date, or a
+// date and time.
+func parseExpires(s string) (time.Time, error) {
+	switch strings.ToLower(s) {
+	case "never":
+		return time.Unix(0, 0), nil
+	case "rolling":
+		return time.Unix(1, 0), nil
+	}
+
+	if t, err := time.ParseInLocation(common.TimeFormat, s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("Invalid expiration '%s'", s)
+}
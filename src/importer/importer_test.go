@@ -0,0 +1,296 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package importer
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+func importTestSetup() (*Importer, *stores.TestDeviceStore) {
+	e := common.NewTestEnvironment()
+	deviceStore := &stores.TestDeviceStore{}
+
+	existing := models.NewDevice(deviceStore, nil, &stores.TestBlacklistItem{})
+	existing.ID = 1
+	existing.MAC, _ = net.ParseMAC("12:34:56:00:00:01")
+	existing.Username = "alice"
+	existing.Description = "Laptop"
+	deviceStore.Devices = append(deviceStore.Devices, existing)
+
+	return New(e, &stores.TestUserStore{}, deviceStore, nil), deviceStore
+}
+
+func TestParse(t *testing.T) {
+	csvData := `username,MAC,tags
+# Comment
+bob,12:34:56:00:00:02,"Lab, printer"
+bob,12:34:56:00:00:03
+`
+	records, err := Parse(FormatAuto, strings.NewReader(csvData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if records[0].Values["mac"] != "12:34:56:00:00:02" || records[0].Values["tags"] != "Lab, printer" {
+		t.Errorf("Wrong CSV values: %v", records[0].Values)
+	}
+	if records[1].Err == nil {
+		t.Error("Expected error for short CSV row")
+	}
+
+	jsonData := ` [{"username": "bob", "mac": "12:34:56:00:00:02", "flagged": true, "tags": ["lab", "printer"]}]`
+	records, err = Parse(FormatAuto, strings.NewReader(jsonData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Values["flagged"] != "true" || records[0].Values["tags"] != "lab,printer" {
+		t.Errorf("Wrong JSON values: %v", records[0].Values)
+	}
+}
+
+func TestImport(t *testing.T) {
+	data := `username,mac,description,expires,flagged,tags
+bob,12:34:56:00:00:02,Printer,2030-01-02,true,"lab,printer"
+,12:34:56:00:00:01,,never,,
+bob,12:34:56:00:00:02,Duplicate,,,
+bob,nope,,,,
+`
+
+	cases := []struct {
+		mode     string
+		dryRun   bool
+		outcomes []string
+		devices  int
+	}{
+		{ModeCreate, false, []string{OutcomeCreated, OutcomeError, OutcomeError, OutcomeError}, 2},
+		{ModeUpsert, false, []string{OutcomeCreated, OutcomeUpdated, OutcomeError, OutcomeError}, 2},
+		{ModeUpsert, true, []string{OutcomeCreated, OutcomeUpdated, OutcomeError, OutcomeError}, 1},
+	}
+
+	for _, c := range cases {
+		imp, deviceStore := importTestSetup()
+		records, _ := ParseCSV(strings.NewReader(data))
+
+		result, err := imp.Import(records, Options{Mode: c.mode, DryRun: c.dryRun})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, row := range result.Rows {
+			if row.Outcome != c.outcomes[i] {
+				t.Errorf("%s dry run %t: row %d expected %s, got %s (%s)",
+					c.mode, c.dryRun, row.Row, c.outcomes[i], row.Outcome, row.Message)
+			}
+		}
+		if len(deviceStore.Devices) != c.devices {
+			t.Errorf("%s dry run %t: expected %d devices, got %d", c.mode, c.dryRun, c.devices, len(deviceStore.Devices))
+		}
+		if c.dryRun {
+			continue
+		}
+
+		created := deviceStore.Devices[1]
+		if created.Description != "Printer" || !created.Flagged || created.Tags.String() != "lab,printer" ||
+			created.Expires.Format("2006-01-02") != "2030-01-02" {
+			t.Errorf("%s: created device has wrong values: %+v", c.mode, created)
+		}
+
+		existing := deviceStore.Devices[0]
+		if c.mode == ModeUpsert && (existing.Username != "alice" || existing.Description != "Laptop" || existing.Expires.Unix() != 0) {
+			t.Errorf("Updated device has wrong values: %+v", existing)
+		}
+	}
+}
+
+func TestImportReassign(t *testing.T) {
+	data := "username,mac\nbob,12:34:56:00:00:01\n"
+
+	cases := []struct {
+		rights      models.Permission
+		deviceLimit models.UserDeviceLimit
+		outcome     string
+	}{
+		{models.EditDevice, models.UserDeviceLimitUnlimited, OutcomeError},
+		{models.EditDevice | models.ReassignDevice, 1, OutcomeError},
+		{models.EditDevice | models.ReassignDevice, models.UserDeviceLimitUnlimited, OutcomeUpdated},
+	}
+
+	for _, c := range cases {
+		imp, deviceStore := importTestSetup()
+		bob := models.NewUser(imp.e, nil, &stores.TestBlacklistItem{}, "bob")
+		bob.ID = 2
+		bob.DeviceLimit = c.deviceLimit
+		bob.DeviceExpiration.Mode = models.UserDeviceExpirationDuration
+		bob.DeviceExpiration.Value = 3600
+		imp.users = &stores.TestUserStore{Users: []*models.User{bob}}
+
+		bobDevice := models.NewDevice(deviceStore, nil, &stores.TestBlacklistItem{})
+		bobDevice.ID = 2
+		bobDevice.Username = "bob"
+		deviceStore.Devices = append(deviceStore.Devices, bobDevice)
+
+		editor := models.NewUser(imp.e, nil, &stores.TestBlacklistItem{}, "admin")
+		editor.Rights = c.rights
+
+		records, _ := ParseCSV(strings.NewReader(data))
+		result, err := imp.Import(records, Options{Mode: ModeUpsert, Editor: editor})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		row := result.Rows[0]
+		if row.Outcome != c.outcome {
+			t.Errorf("%s limit %d: expected %s, got %s (%s)", c.rights, c.deviceLimit, c.outcome, row.Outcome, row.Message)
+		}
+
+		device := deviceStore.Devices[0]
+		if c.outcome == OutcomeError {
+			if device.Username != "alice" {
+				t.Errorf("%s limit %d: device was reassigned to %s", c.rights, c.deviceLimit, device.Username)
+			}
+			continue
+		}
+		if device.Username != "bob" || time.Until(device.Expires) <= 0 || time.Until(device.Expires) > time.Hour {
+			t.Errorf("Reassigned device has wrong values: %+v", device)
+		}
+	}
+}
+
+func TestImportWebhooks(t *testing.T) {
+	data := "username,mac\nbob,12:34:56:00:00:01\nbob,12:34:56:00:00:02\n"
+
+	for _, dryRun := range []bool{true, false} {
+		imp, _ := importTestSetup()
+		imp.e.Config.Webhooks.Endpoints = []common.WebhookEndpoint{{Name: "siem", URL: "http://example.com"}}
+		queue := &stores.TestWebhookStore{}
+		imp.webhooks = queue
+
+		bob := models.NewUser(imp.e, nil, &stores.TestBlacklistItem{}, "bob")
+		bob.DeviceLimit = models.UserDeviceLimitUnlimited
+		imp.users = &stores.TestUserStore{Users: []*models.User{bob}}
+
+		editor := models.NewUser(imp.e, nil, &stores.TestBlacklistItem{}, "admin")
+		editor.Rights = models.CreateDevice | models.EditDevice | models.ReassignDevice
+
+		records, _ := ParseCSV(strings.NewReader(data))
+		if _, err := imp.Import(records, Options{Mode: ModeUpsert, Editor: editor, ChangedBy: "admin", DryRun: dryRun}); err != nil {
+			t.Fatal(err)
+		}
+
+		if dryRun {
+			if len(queue.Deliveries) != 0 {
+				t.Errorf("Expected no webhook deliveries for a dry run, got %d", len(queue.Deliveries))
+			}
+			continue
+		}
+
+		expected := []string{common.WebhookDeviceReassigned, common.WebhookDeviceRegistered}
+		if len(queue.Deliveries) != len(expected) {
+			t.Fatalf("Expected %d webhook deliveries, got %d", len(expected), len(queue.Deliveries))
+		}
+		for i, event := range expected {
+			if queue.Deliveries[i].Event != event {
+				t.Errorf("Delivery %d: expected %s, got %s", i, event, queue.Deliveries[i].Event)
+			}
+		}
+		if payload := queue.Deliveries[0].Payload; !strings.Contains(payload, `"previous_username":"alice"`) || !strings.Contains(payload, `"actor":"admin"`) {
+			t.Errorf("Unexpected reassign payload %s", payload)
+		}
+	}
+}
+
+func TestImportUnknownColumn(t *testing.T) {
+	imp, _ := importTestSetup()
+	records, _ := ParseCSV(strings.NewReader("username,mac,color\nbob,12:34:56:00:00:02,red\n"))
+	if _, err := imp.Import(records, Options{}); err == nil {
+		t.Error("Expected error for unknown column")
+	}
+}
+
+func TestResultWriteCSV(t *testing.T) {
+	r := &Result{}
+	r.add(&RowResult{Row: 1, MAC: "12:34:56:00:00:02", Username: "bob", Outcome: OutcomeError, Message: "Device already registered"})
+
+	var buf bytes.Buffer
+	if err := r.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "row,mac,username,outcome,message\n1,12:34:56:00:00:02,bob,error,Device already registered\n"
+	if buf.String() != expected || r.Failed != 1 {
+		t.Errorf("Wrong report: %q", buf.String())
+	}
+}
+
+func TestImportUsers(t *testing.T) {
+	data := `username,ui_group,api_group,device_limit,expiration_type,device_expiration,valid_start,valid_end,notes
+Alice,,,5,4,13:30,,,Staff
+bob,helpdesk,disable,,,,2030-01-01 00:00,2031-01-01 00:00,
+carol,,,,3,forever,,,
+dave,,,,,,2031-01-01 00:00,2030-01-01 00:00,
+alice,,,,,,,,
+`
+
+	cases := []struct {
+		mode     string
+		rights   models.Permission
+		outcomes []string
+	}{
+		{ModeCreate, models.AdminRights, []string{OutcomeError, OutcomeCreated, OutcomeError, OutcomeError, OutcomeError}},
+		{ModeUpsert, models.AdminRights, []string{OutcomeUpdated, OutcomeCreated, OutcomeError, OutcomeError, OutcomeError}},
+		{ModeUpsert, models.CreateUser | models.EditUser, []string{OutcomeUpdated, OutcomeError, OutcomeError, OutcomeError, OutcomeError}},
+	}
+
+	for _, c := range cases {
+		e := common.NewTestEnvironment()
+		existing := models.NewUser(e, nil, &stores.TestBlacklistItem{}, "alice")
+		existing.ID = 1
+		userStore := &stores.TestUserStore{Users: []*models.User{existing}}
+
+		editor := models.NewUser(e, userStore, &stores.TestBlacklistItem{}, "admin")
+		editor.Rights = c.rights
+
+		records, _ := ParseCSV(strings.NewReader(data))
+		result, err := New(e, userStore, &stores.TestDeviceStore{}, nil).ImportUsers(records, Options{Mode: c.mode, Editor: editor, DryRun: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, row := range result.Rows {
+			if row.Outcome != c.outcomes[i] {
+				t.Errorf("%s %s: row %d expected %s, got %s (%s)",
+					c.mode, c.rights, row.Row, c.outcomes[i], row.Outcome, row.Message)
+			}
+		}
+	}
+
+	// Values are validated and applied the same as the user API
+	e := common.NewTestEnvironment()
+	existing := models.NewUser(e, nil, &stores.TestBlacklistItem{}, "alice")
+	existing.ID = 1
+	existing.Notes = "Old notes"
+	userStore := &stores.TestUserStore{Users: []*models.User{existing}}
+	editor := models.NewUser(e, userStore, &stores.TestBlacklistItem{}, "admin")
+	editor.Rights = models.AdminRights
+
+	records, _ := ParseCSV(strings.NewReader("username,device_limit,expiration_type,device_expiration,notes\nalice,5,4,13:30,\n"))
+	if _, err := New(e, userStore, &stores.TestDeviceStore{}, nil).ImportUsers(records, Options{Mode: ModeUpsert, Editor: editor, DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	if existing.DeviceLimit != 5 || existing.DeviceExpiration.Mode != models.UserDeviceExpirationDaily ||
+		existing.DeviceExpiration.Value != 13*3600+30*60 || existing.Notes != "Old notes" {
+		t.Errorf("Wrong values for updated user: %+v", existing)
+	}
+}
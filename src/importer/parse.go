@@ -0,0 +1,166 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Input formats
+const (
+	FormatAuto = ""
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Record is one device to import keyed by column name. Err is set if the
+// record couldn't be parsed.
+type Record struct {
+	Row    int
+	Values map[string]string
+	Err    error
+}
+
+func (r *Record) get(column string) (string, bool) {
+	v, ok := r.Values[column]
+	return v, ok
+}
+
+// Parse reads records in format. FormatAuto detects JSON by a leading '['.
+func Parse(format string, r io.Reader) ([]*Record, error) {
+	br := bufio.NewReader(r)
+	if format == FormatAuto {
+		format = FormatCSV
+		if start, _ := br.Peek(512); bytes.HasPrefix(bytes.TrimSpace(start), []byte("[")) {
+			format = FormatJSON
+		}
+	}
+
+	switch format {
+	case FormatCSV:
+		return ParseCSV(br)
+	case FormatJSON:
+		return ParseJSON(br)
+	}
+	return nil, fmt.Errorf("Unknown import format '%s'", format)
+}
+
+// ParseCSV reads records from CSV data. The first line names the columns.
+// Lines starting with # are ignored.
+func ParseCSV(r io.Reader) ([]*Record, error) {
+	csvr := csv.NewReader(r)
+	csvr.Comment = '#'
+	csvr.TrimLeadingSpace = true
+	csvr.FieldsPerRecord = 0 // All records must match the header
+
+	header, err := csvr.Read()
+	if err == io.EOF {
+		return nil, errors.New("Import data is empty")
+	} else if err != nil {
+		return nil, err
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	var records []*Record
+	for row := 1; ; row++ {
+		fields, err := csvr.Read()
+		if err == io.EOF {
+			break
+		}
+
+		record := &Record{Row: row, Values: make(map[string]string, len(header))}
+		records = append(records, record)
+		if err != nil {
+			record.Err = err
+			continue
+		}
+
+		for i, column := range header {
+			record.Values[column] = strings.TrimSpace(fields[i])
+		}
+	}
+	return records, nil
+}
+
+// ParseJSON reads records from a JSON array of objects. Values may be strings,
+// numbers, or booleans. Tags may also be given as an array of strings.
+func ParseJSON(r io.Reader) ([]*Record, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var objects []map[string]interface{}
+	if err := dec.Decode(&objects); err != nil {
+		return nil, fmt.Errorf("Invalid JSON: %s", err)
+	}
+
+	records := make([]*Record, len(objects))
+	for i, obj := range objects {
+		record := &Record{Row: i + 1, Values: make(map[string]string, len(obj))}
+		records[i] = record
+
+		for key, val := range obj {
+			s, err := jsonString(val)
+			if err != nil {
+				record.Err = fmt.Errorf("Invalid value for '%s': %s", key, err)
+				break
+			}
+			record.Values[strings.ToLower(key)] = s
+		}
+	}
+	return records, nil
+}
+
+func jsonString(val interface{}) (string, error) {
+	switch v := val.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return strings.TrimSpace(v), nil
+	case bool, json.Number:
+		return fmt.Sprint(v), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return "", errors.New("lists may only contain strings")
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", errors.New("unsupported type")
+}
+
+// ParseRequest reads records from an import request. Data is read from an
+// uploaded "import-file", the "import-data" form value, or a JSON request body
+// in that order. The "format" form value selects the input format.
+func ParseRequest(r *http.Request) ([]*Record, error) {
+	format := strings.ToLower(r.FormValue("format"))
+
+	if file, _, err := r.FormFile("import-file"); err == nil {
+		defer file.Close()
+		return Parse(format, file)
+	}
+
+	if data := r.FormValue("import-data"); data != "" {
+		return Parse(format, strings.NewReader(data))
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return ParseJSON(r.Body)
+	}
+	return nil, errors.New("No import data given")
+}
@@ -0,0 +1,161 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package importer
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+)
+
+// ImportUsers creates or updates a user for each record. Values are validated
+// the same as the user API and empty values are ignored. Options.Editor must
+// be set, the editor's permissions are checked for each row. An error is
+// returned if the records have an unknown column, otherwise errors are
+// reported per row.
+func (i *Importer) ImportUsers(records []*Record, opts Options) (*Result, error) {
+	if err := opts.checkMode(); err != nil {
+		return nil, err
+	}
+	if opts.Editor == nil {
+		return nil, errors.New("Importing users requires an editor")
+	}
+
+	attrFields, err := i.attributeFields(records, common.CustomFieldUser, UserColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	result := &Result{Mode: opts.Mode, DryRun: opts.DryRun}
+
+	for _, record := range records {
+		row := &RowResult{Row: record.Row}
+		row.Username, _ = record.get("username")
+
+		if err := i.importUser(record, row, attrFields, seen, opts); err != nil {
+			row.Outcome = OutcomeError
+			row.Message = err.Error()
+		}
+		result.add(row)
+	}
+	return result, nil
+}
+
+func (i *Importer) importUser(record *Record, row *RowResult, attrFields []common.CustomField, seen map[string]bool, opts Options) error {
+	if record.Err != nil {
+		return record.Err
+	}
+
+	username := strings.ToLower(row.Username)
+	if username == "" {
+		return errors.New("Username is required")
+	}
+	row.Username = username
+
+	if seen[username] {
+		return errors.New("Duplicate username in import")
+	}
+	seen[username] = true
+
+	user, err := i.users.GetUserByUsername(username)
+	if err != nil {
+		i.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "importer",
+			"username": username,
+		}).Error("Error getting user")
+		return errors.New("Error getting user")
+	}
+
+	create := user.IsNew()
+	if !create && opts.Mode == ModeCreate {
+		return errors.New("User already exists")
+	}
+	if (create && !opts.Editor.Can(models.CreateUser)) || (!create && !opts.Editor.Can(models.EditUser)) {
+		return models.ErrPermissionDenied
+	}
+
+	get := func(column string) (string, bool) {
+		v, ok := record.get(column)
+		return v, ok && v != ""
+	}
+
+	updateDeviceExpirations, err := user.ApplyValues(opts.Editor, get)
+	if err != nil {
+		return err
+	}
+	if err := user.Attributes.ApplyCustomFields(attrFields, get, true); err != nil {
+		return err
+	}
+
+	if create {
+		row.Outcome = OutcomeCreated
+	} else {
+		row.Outcome = OutcomeUpdated
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+
+	if err := user.Save(); err != nil {
+		i.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "importer",
+			"username": username,
+		}).Error("Error saving user")
+		return errors.New("Error saving user")
+	}
+
+	action := "create_user"
+	if !create {
+		action = "edit_user"
+	}
+	i.e.Log.WithFields(verbose.Fields{
+		"package":    "importer",
+		"action":     action,
+		"username":   username,
+		"changed-by": opts.ChangedBy,
+	}).Info("User imported")
+
+	if updateDeviceExpirations && !i.updateDeviceExpirations(user, opts.ChangedBy) {
+		row.Message = "User saved, but some devices not updated"
+	}
+	return nil
+}
+
+// updateDeviceExpirations recalculates the expiration of the user's devices
+// after their default expiration changed. False is returned if any device
+// couldn't be updated.
+func (i *Importer) updateDeviceExpirations(user *models.User, changedBy string) bool {
+	devices, err := i.devices.GetDevicesForUser(user)
+	if err != nil {
+		i.e.Log.WithFields(verbose.Fields{
+			"error":    err,
+			"package":  "importer",
+			"username": user.Username,
+		}).Error("Error getting devices")
+		return false
+	}
+
+	ok := true
+	for _, d := range devices {
+		d.Expires = user.DeviceExpiration.NextExpiration(i.e, d.DateRegistered)
+		d.ChangedBy = changedBy
+		if err := d.Save(); err != nil {
+			i.e.Log.WithFields(verbose.Fields{
+				"error":   err,
+				"package": "importer",
+				"mac":     d.MAC.String(),
+			}).Error("Error saving device")
+			ok = false
+		}
+	}
+	return ok
+}
@@ -0,0 +1,72 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"crypto/subtle"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/stats"
+)
+
+// Handler serves the metrics to scrapers sending the configured bearer token
+// or connecting from an allowed IP.
+func Handler(e *common.Environment) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(e.Config, r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+		writeTotals(e, w)
+	})
+}
+
+func authorized(c *common.Config, r *http.Request) bool {
+	if c.Metrics.Token != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(c.Metrics.Token)) == 1 {
+			return true
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return c.MetricsAllowed(net.ParseIP(host))
+}
+
+// writeTotals writes the gauges read from the database on each scrape.
+func writeTotals(e *common.Environment, w io.Writer) {
+	devices, users, blacklisted := stats.GetTotals(e)
+	WriteGauge(w, "pg_devices", "Registered devices.", Sample{Value: float64(devices)})
+	WriteGauge(w, "pg_users", "Users with a stored account.", Sample{Value: float64(users)})
+	WriteGauge(w, "pg_blacklist_entries", "Blocked users and devices.", Sample{Value: float64(blacklisted)})
+
+	leaseStats := stats.GetLeaseStats(e)
+	networks := make([]string, 0, len(leaseStats))
+	for network := range leaseStats {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+
+	samples := make([]Sample, 0, len(networks)*2)
+	for _, network := range networks {
+		s := leaseStats[network]
+		samples = append(samples,
+			Sample{Labels: []string{"network", network, "state", "registered"}, Value: float64(s.Registered)},
+			Sample{Labels: []string{"network", network, "state", "unregistered"}, Value: float64(s.Unregistered)},
+		)
+	}
+	WriteGauge(w, "pg_active_leases", "Active DHCP leases by network and registration state.", samples...)
+}
@@ -0,0 +1,277 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package metrics collects application metrics and writes them in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Application metrics
+var (
+	HTTPRequests = NewCounterVec(
+		"pg_http_requests_total",
+		"HTTP requests by route, method, and status code.",
+		"route", "method", "code",
+	)
+	HTTPDuration = NewHistogramVec(
+		"pg_http_request_duration_seconds",
+		"HTTP request latency by route and method.",
+		[]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		"route", "method",
+	)
+	Logins = NewCounterVec(
+		"pg_logins_total",
+		"Login attempts by authentication method and result.",
+		"method", "result",
+	)
+	Registrations = NewCounterVec(
+		"pg_registrations_total",
+		"Device registrations by type.",
+		"type",
+	)
+	JobRuns = NewCounterVec(
+		"pg_job_runs_total",
+		"Scheduled job runs by job and result.",
+		"job", "result",
+	)
+	JobDuration = NewHistogramVec(
+		"pg_job_duration_seconds",
+		"Scheduled job run time.",
+		[]float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600},
+		"job",
+	)
+)
+
+// Label values of Logins and JobRuns results
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+type collector interface {
+	write(w io.Writer)
+}
+
+var registry struct {
+	sync.Mutex
+	collectors []collector
+}
+
+func register(c collector) {
+	registry.Lock()
+	registry.collectors = append(registry.collectors, c)
+	registry.Unlock()
+}
+
+// Write writes all registered metrics to w.
+func Write(w io.Writer) {
+	registry.Lock()
+	collectors := registry.collectors
+	registry.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec creates and registers a counter.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]float64),
+	}
+	register(c)
+	return c
+}
+
+// Inc increments the counter with the label values by one.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter with the label values by v.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := labelString(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Value returns the counter with the label values.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	key := labelString(c.labels, labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, braces(key), formatFloat(c.values[key]))
+	}
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec creates and registers a histogram with the given bucket
+// upper bounds in ascending order.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		values:  make(map[string]*histogram),
+	}
+	register(h)
+	return h
+}
+
+// Observe adds an observation to the histogram with the label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := labelString(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hist, exists := h.values[key]
+	if !exists {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hist
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hist.counts[i]++
+	}
+	hist.count++
+	hist.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, key := range keys {
+		hist := h.values[key]
+		sep := ""
+		if key != "" {
+			sep = ","
+		}
+
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", h.name, key, sep, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", h.name, key, sep, hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, braces(key), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, braces(key), hist.count)
+	}
+}
+
+// Sample is a single value of a gauge.
+type Sample struct {
+	Labels []string // Alternating label names and values
+	Value  float64
+}
+
+// WriteGauge writes a gauge computed at scrape time.
+func WriteGauge(w io.Writer, name, help string, samples ...Sample) {
+	writeHeader(w, name, help, "gauge")
+	for _, s := range samples {
+		var names, values []string
+		for i := 0; i+1 < len(s.Labels); i += 2 {
+			names = append(names, s.Labels[i])
+			values = append(values, s.Labels[i+1])
+		}
+		fmt.Fprintf(w, "%s%s %s\n", name, braces(labelString(names, values)), formatFloat(s.Value))
+	}
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelString formats label pairs as name="value",... Missing values are
+// empty.
+func labelString(names, values []string) string {
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		labelEscaper.WriteString(&b, value)
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,111 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+func TestWriteCounterAndHistogram(t *testing.T) {
+	c := &CounterVec{name: "test_total", help: "Test counter.", labels: []string{"path"}, values: make(map[string]float64)}
+	c.Inc(`/a"b`)
+	c.Add(2, "/c")
+
+	h := &HistogramVec{name: "test_seconds", help: "Test histogram.", labels: []string{"job"}, buckets: []float64{1, 5}, values: make(map[string]*histogram)}
+	h.Observe(0.5, "purge")
+	h.Observe(3, "purge")
+	h.Observe(10, "purge")
+
+	buf := &bytes.Buffer{}
+	c.write(buf)
+	h.write(buf)
+
+	expected := `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{path="/a\"b"} 1
+test_total{path="/c"} 2
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{job="purge",le="1"} 1
+test_seconds_bucket{job="purge",le="5"} 2
+test_seconds_bucket{job="purge",le="+Inf"} 3
+test_seconds_sum{job="purge"} 13.5
+test_seconds_count{job="purge"} 3
+`
+	if buf.String() != expected {
+		t.Errorf("Wrong output:\n%s\nExpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	AddRoute("GET", "/api/*a")
+	AddRoute("GET", "/api/device/:mac")
+	AddRoute("GET", "/api/device/:mac/history")
+	AddRoute("GET", "/api/device/user/:username")
+	AddRoute("POST", "/api/device/import")
+	AddRoute("GET", "/manage/*user")
+
+	cases := []struct {
+		method, path, route string
+	}{
+		{"GET", "/api/device/12:34:56:12:34:56", "/api/device/:mac"},
+		{"GET", "/api/device/12:34:56:12:34:56/history", "/api/device/:mac/history"},
+		{"GET", "/api/device/user/alice", "/api/device/user/:username"},
+		{"GET", "/api/unknown/path", "/api/*a"},
+		{"GET", "/manage/", "/manage/*user"},
+		{"POST", "/api/device/import", "/api/device/import"},
+		{"POST", "/api/device/12:34:56:12:34:56", UnknownRoute},
+		{"GET", "/nothing", UnknownRoute},
+	}
+	for _, c := range cases {
+		if route := Route(c.method, c.path); route != c.route {
+			t.Errorf("%s %s: expected route %s, got %s", c.method, c.path, c.route, route)
+		}
+	}
+}
+
+func TestHandlerAccess(t *testing.T) {
+	e := common.NewTestEnvironment()
+	e.Config.Metrics.Enabled = true
+	e.Config.Metrics.Token = "s3cret"
+	e.Config.Metrics.AllowedIPs = []string{"10.0.0.0/8"}
+
+	cases := []struct {
+		remote, token string
+		allowed       bool
+	}{
+		{"192.168.1.5:4000", "", false},
+		{"192.168.1.5:4000", "wrong", false},
+		{"192.168.1.5:4000", "s3cret", true},
+		{"10.1.2.3:4000", "", true},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.RemoteAddr = c.remote
+		if c.token != "" {
+			r.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		if allowed := authorized(e.Config, r); allowed != c.allowed {
+			t.Errorf("%s with token %q: expected %t, got %t", c.remote, c.token, c.allowed, allowed)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.RemoteAddr = "192.168.1.5:4000"
+	Handler(e).ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "pg_http_requests_total") {
+		t.Error("Expected metrics to be hidden")
+	}
+}
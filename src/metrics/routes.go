@@ -0,0 +1,96 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+// UnknownRoute is the route label of requests not matching a registered route.
+const UnknownRoute = "other"
+
+type route struct {
+	pattern  string
+	segments []string
+	static   int
+	catchAll bool
+}
+
+var routes struct {
+	sync.RWMutex
+	byMethod map[string][]*route
+}
+
+// AddRoute registers a router pattern so requests are counted by pattern
+// instead of by path. Patterns use the httprouter syntax.
+func AddRoute(method, pattern string) {
+	rt := &route{
+		pattern:  pattern,
+		segments: strings.Split(strings.TrimPrefix(pattern, "/"), "/"),
+	}
+	for _, seg := range rt.segments {
+		if strings.HasPrefix(seg, "*") {
+			rt.catchAll = true
+		} else if !strings.HasPrefix(seg, ":") {
+			rt.static++
+		}
+	}
+
+	routes.Lock()
+	defer routes.Unlock()
+	if routes.byMethod == nil {
+		routes.byMethod = make(map[string][]*route)
+	}
+	for _, existing := range routes.byMethod[method] {
+		if existing.pattern == pattern {
+			return
+		}
+	}
+	routes.byMethod[method] = append(routes.byMethod[method], rt)
+}
+
+// Route returns the registered pattern best matching a request path. The
+// pattern with the most static segments wins so a route on a sub-router is
+// preferred over the catch-all route leading to it.
+func Route(method, path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	routes.RLock()
+	defer routes.RUnlock()
+
+	var best *route
+	for _, rt := range routes.byMethod[method] {
+		if !rt.matches(segments) {
+			continue
+		}
+		if best == nil || rt.static > best.static || (rt.static == best.static && best.catchAll && !rt.catchAll) {
+			best = rt
+		}
+	}
+	if best == nil {
+		return UnknownRoute
+	}
+	return best.pattern
+}
+
+func (rt *route) matches(segments []string) bool {
+	for i, seg := range rt.segments {
+		if strings.HasPrefix(seg, "*") {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if strings.HasPrefix(seg, ":") {
+			if segments[i] == "" {
+				return false
+			}
+		} else if seg != segments[i] {
+			return false
+		}
+	}
+	return len(segments) == len(rt.segments)
+}
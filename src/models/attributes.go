@@ -0,0 +1,79 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+// Attributes holds the values of admin defined custom fields keyed by field name.
+type Attributes map[string]string
+
+// ParseAttributes decodes attributes as stored in the database.
+func ParseAttributes(s string) Attributes {
+	a := make(Attributes)
+	if s == "" {
+		return a
+	}
+	json.Unmarshal([]byte(s), &a)
+	return a
+}
+
+// String encodes the attributes for storage in the database.
+func (a Attributes) String() string {
+	if len(a) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(a)
+	return string(b)
+}
+
+// Get returns the value of attribute name or an empty string.
+func (a Attributes) Get(name string) string {
+	return a[name]
+}
+
+// ApplyCustomFields sets the values of fields on a using the get function to
+// retrieve the submitted value for a field name. Only fields present in the
+// submission are changed when partial is true. Required fields must have a value
+// either submitted or already set.
+func (a Attributes) ApplyCustomFields(fields []common.CustomField, get func(string) (string, bool), partial bool) error {
+	for _, f := range fields {
+		raw, submitted := get(f.Name)
+		if !submitted && partial {
+			if f.Required && a[f.Name] == "" {
+				return fmt.Errorf("%s is required", f.Label)
+			}
+			continue
+		}
+
+		value, err := f.Normalize(raw)
+		if err != nil {
+			return err
+		}
+
+		if value == "" {
+			if f.Required {
+				return fmt.Errorf("%s is required", f.Label)
+			}
+			delete(a, f.Name)
+			continue
+		}
+		a[f.Name] = value
+	}
+	return nil
+}
+
+// AttributeSearchPattern returns a LIKE pattern that matches the stored
+// attributes containing field name with a value starting with value.
+func AttributeSearchPattern(name, value string) string {
+	key, _ := json.Marshal(name)
+	val, _ := json.Marshal(value)
+	// Remove the closing quote so the value is a prefix match
+	return "%" + string(key) + ":" + string(val[:len(val)-1]) + "%"
+}
@@ -0,0 +1,77 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+// CategoryLimits holds a user's device limit overrides keyed by device category.
+// A limit of 0 is unlimited.
+type CategoryLimits map[string]int
+
+// ParseCategoryLimits decodes category limits as stored in the database.
+func ParseCategoryLimits(s string) CategoryLimits {
+	c := make(CategoryLimits)
+	if s == "" {
+		return c
+	}
+	json.Unmarshal([]byte(s), &c)
+	return c
+}
+
+// ParseCategoryLimitsList parses a comma separated list of category:limit pairs.
+// Each category must be defined in the configuration.
+func ParseCategoryLimitsList(e *common.Environment, s string) (CategoryLimits, error) {
+	c := make(CategoryLimits)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		psplit := strings.SplitN(pair, ":", 2)
+		if len(psplit) != 2 {
+			return nil, fmt.Errorf("Invalid category limit '%s'", pair)
+		}
+
+		name := strings.TrimSpace(psplit[0])
+		if _, exists := e.Config.DeviceCategory(name); !exists {
+			return nil, fmt.Errorf("Unknown device category '%s'", name)
+		}
+
+		limit, err := strconv.Atoi(strings.TrimSpace(psplit[1]))
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("Invalid limit for device category '%s'", name)
+		}
+		c[name] = limit
+	}
+	return c, nil
+}
+
+// String encodes the limits for storage in the database.
+func (c CategoryLimits) String() string {
+	if len(c) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+// List returns the limits as a comma separated list of category:limit pairs.
+func (c CategoryLimits) List() string {
+	pairs := make([]string, 0, len(c))
+	for name, limit := range c {
+		pairs = append(pairs, fmt.Sprintf("%s:%d", name, limit))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -6,13 +6,18 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
 	"time"
 
 	"github.com/packet-guardian/dhcp-lib"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/oui"
 )
 
 type DeviceStore interface {
+	DeviceEventStore
 	Save(*Device) error
 	Delete(*Device) error
 	DeleteAllDeviceForUser(u *User) error
@@ -30,6 +35,7 @@ type LeaseHistory interface {
 	GetNetworkName() string
 	GetStartTime() time.Time
 	GetEndTime() time.Time
+	GetHostname() string
 }
 
 type BlacklistItem interface {
@@ -56,7 +62,35 @@ type Device struct {
 	LastSeen       time.Time      `json:"-"`
 	Leases         []LeaseHistory `json:"-"`
 	Flagged        bool           `json:"flagged"`
+	FlagCategory   string         `json:"flag_category"`
+	FlagReason     string         `json:"flag_reason"`
+	FlaggedBy      string         `json:"flagged_by"`
+	FlaggedAt      time.Time      `json:"-"`
+	FlagClears     time.Time      `json:"-"`
 	Notes          string         `json:"notes"`
+	Attributes     Attributes     `json:"attributes"`
+	Renewals       int            `json:"renewals"`
+	PolicyVersion  int            `json:"policy_version"`
+	PolicyAccepted time.Time      `json:"-"`
+	Tags           Tags           `json:"tags"`
+
+	// ChangedBy and AuthMethod are recorded in the device history for the
+	// next save.
+	ChangedBy      string `json:"-"`
+	AuthMethod     string `json:"-"`
+	blacklistEvent string
+	saved          *DeviceSnapshot
+}
+
+// DeviceSnapshot holds the values of a device compared on save to record
+// history events.
+type DeviceSnapshot struct {
+	Username     string
+	Expires      time.Time
+	Flagged      bool
+	FlagCategory string
+	FlagReason   string
+	FlagClears   time.Time
 }
 
 func NewDevice(s DeviceStore, l LeaseStore, b BlacklistItem) *Device {
@@ -64,6 +98,8 @@ func NewDevice(s DeviceStore, l LeaseStore, b BlacklistItem) *Device {
 		deviceStore: s,
 		leaseStore:  l,
 		blacklist:   b,
+		Attributes:  make(Attributes),
+		Tags:        make(Tags, 0),
 	}
 }
 
@@ -76,6 +112,10 @@ func (d *Device) MarshalJSON() ([]byte, error) {
 		LastSeen       time.Time `json:"last_seen"`
 		Blacklisted    bool      `json:"blacklisted"`
 		MAC            string    `json:"mac"`
+		Vendor         string    `json:"vendor"`
+		PolicyAccepted time.Time `json:"policy_accepted"`
+		FlaggedAt      time.Time `json:"flagged_at"`
+		FlagClears     time.Time `json:"flag_clears"`
 	}{
 		Alias:          (*Alias)(d),
 		Expires:        d.Expires.UTC(),
@@ -83,6 +123,10 @@ func (d *Device) MarshalJSON() ([]byte, error) {
 		LastSeen:       d.LastSeen.UTC(),
 		Blacklisted:    d.IsBlacklisted(),
 		MAC:            d.MAC.String(),
+		Vendor:         d.Vendor(),
+		PolicyAccepted: d.PolicyAccepted.UTC(),
+		FlaggedAt:      d.FlaggedAt.UTC(),
+		FlagClears:     d.FlagClears.UTC(),
 	})
 }
 
@@ -103,6 +147,13 @@ func (d *Device) IsBlacklisted() bool {
 }
 
 func (d *Device) SetBlacklist(b bool) {
+	if d.IsBlacklisted() != b {
+		d.blacklistEvent = DeviceEventUnblacklisted
+		if b {
+			d.blacklistEvent = DeviceEventBlacklisted
+		}
+	}
+
 	if b {
 		d.blacklist.Blacklist()
 		return
@@ -110,6 +161,32 @@ func (d *Device) SetBlacklist(b bool) {
 	d.blacklist.Unblacklist()
 }
 
+// Flag flags the device in category. A zero clears time keeps the flag until
+// it's removed.
+func (d *Device) Flag(category, reason, flaggedBy string, clears time.Time) {
+	d.Flagged = true
+	d.FlagCategory = category
+	d.FlagReason = reason
+	d.FlaggedBy = flaggedBy
+	d.FlaggedAt = time.Now()
+	d.FlagClears = clears
+}
+
+// Unflag removes the flag and its details.
+func (d *Device) Unflag() {
+	d.Flagged = false
+	d.FlagCategory = ""
+	d.FlagReason = ""
+	d.FlaggedBy = ""
+	d.FlaggedAt = time.Time{}
+	d.FlagClears = time.Time{}
+}
+
+// FlagCleared returns if the flag has a clear time that has passed.
+func (d *Device) FlagCleared(now time.Time) bool {
+	return d.Flagged && !d.FlagClears.IsZero() && !now.Before(d.FlagClears)
+}
+
 func (d *Device) IsRegistered() bool {
 	return (d.ID != 0 && !d.IsBlacklisted() && !d.IsExpired())
 }
@@ -150,8 +227,100 @@ func (d *Device) IsExpired() bool {
 	return d.Expires.Unix() > 10 && time.Now().After(d.Expires)
 }
 
+// IsRandomized returns if the device is using a randomized MAC address.
+func (d *Device) IsRandomized() bool {
+	return common.IsLocallyAdministered(d.MAC)
+}
+
+// Vendor returns the manufacturer the device's MAC address is assigned to.
+func (d *Device) Vendor() string {
+	return oui.Lookup(d.MAC)
+}
+
+// LimitRandomizedExpiration shortens the expiration of a device using a randomized
+// MAC address to the configured maximum, if any, measured from now.
+func (d *Device) LimitRandomizedExpiration(e *common.Environment, now time.Time) {
+	if !d.IsRandomized() || e.Config.Registration.RandomizedMAC.Expiration == "" {
+		return
+	}
+
+	dur, _ := time.ParseDuration(e.Config.Registration.RandomizedMAC.Expiration)
+	limit := now.Add(dur)
+	// Expires values of 0 and 1 mean never and rolling
+	if d.Expires.Unix() <= 1 || d.Expires.After(limit) {
+		d.Expires = limit
+	}
+}
+
+// Renew recomputes the expiration of the device from exp, its owner's device
+// expiration, as allowed by the renewal policy. The returned error explains
+// why the device can't be renewed.
+func (d *Device) Renew(e *common.Environment, exp *UserDeviceExpiration, now time.Time) error {
+	policy := e.Config.Registration.Renewal
+
+	if exp.Mode == UserDeviceExpirationGlobal {
+		exp = GetGlobalDefaultExpiration(e)
+	}
+	if !common.StringInSlice(exp.Mode.configName(), policy.Modes) {
+		return errors.New("Devices with this expiration type can't be renewed")
+	}
+
+	// Expires values of 0 and 1 mean never and rolling
+	if d.Expires.Unix() <= 1 {
+		return errors.New("Device doesn't expire")
+	}
+	if window := e.Config.RenewalWindow(); window > 0 && d.Expires.After(now.Add(window)) {
+		return fmt.Errorf("Device can't be renewed until %s", d.Expires.Add(-window).Format(common.TimeFormat))
+	}
+	if policy.MaxRenewals > 0 && d.Renewals >= policy.MaxRenewals {
+		return errors.New("Device has been renewed the maximum number of times")
+	}
+
+	expires := exp.NextExpiration(e, now)
+	if !expires.After(d.Expires) {
+		return errors.New("Renewing wouldn't extend the expiration")
+	}
+
+	d.Expires = expires
+	d.LimitRandomizedExpiration(e, now)
+	d.Renewals++
+	return nil
+}
+
 func (d *Device) SaveToBlacklist() error {
-	return d.blacklist.Save(d.MAC.String())
+	if err := d.blacklist.Save(d.MAC.String()); err != nil {
+		return err
+	}
+	if d.blacklistEvent == "" {
+		return nil
+	}
+
+	event := NewDeviceEvent(d.deviceStore, d.MAC, d.blacklistEvent)
+	event.Username = d.Username
+	event.ChangedBy = d.ChangedBy
+	event.AuthMethod = d.AuthMethod
+	d.blacklistEvent = ""
+	return event.Save()
+}
+
+// MarkSaved records the device as matching the database. Stores call it after
+// loading or saving a device so the next save can tell what changed without
+// reading the device again.
+func (d *Device) MarkSaved() {
+	d.saved = &DeviceSnapshot{
+		Username:     d.Username,
+		Expires:      d.Expires,
+		Flagged:      d.Flagged,
+		FlagCategory: d.FlagCategory,
+		FlagReason:   d.FlagReason,
+		FlagClears:   d.FlagClears,
+	}
+}
+
+// Saved returns the device as it was last loaded or saved, or nil if it
+// didn't come from a store.
+func (d *Device) Saved() *DeviceSnapshot {
+	return d.saved
 }
 
 func (d *Device) Save() error {
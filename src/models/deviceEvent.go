@@ -0,0 +1,169 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+// Device event types
+const (
+	DeviceEventRegistered    = "registered"
+	DeviceEventReassigned    = "reassigned"
+	DeviceEventExpiration    = "expiration"
+	DeviceEventFlagged       = "flagged"
+	DeviceEventUnflagged     = "unflagged"
+	DeviceEventBlacklisted   = "blacklisted"
+	DeviceEventUnblacklisted = "unblacklisted"
+	DeviceEventDeleted       = "deleted"
+	DeviceEventRestored      = "restored"
+
+	// DeviceEventLease is only used for lease entries in a timeline,
+	// leases aren't stored as events.
+	DeviceEventLease = "lease"
+)
+
+type DeviceEventStore interface {
+	SaveEvent(*DeviceEvent) error
+}
+
+// DeviceEvent is a change in the state of a device. Events are keyed by MAC
+// address and are kept after the device is deleted. Username is the owner of
+// the device after the event. AuthMethod is how the registering user logged
+// in, or manual, guest, or import.
+type DeviceEvent struct {
+	store      DeviceEventStore
+	ID         int              `json:"id"`
+	MAC        net.HardwareAddr `json:"-"`
+	Type       string           `json:"type"`
+	Username   string           `json:"username"`
+	ChangedBy  string           `json:"changed_by"`
+	AuthMethod string           `json:"auth_method"`
+	Created    time.Time        `json:"-"`
+	Details    string           `json:"details"`
+}
+
+func NewDeviceEvent(s DeviceEventStore, mac net.HardwareAddr, eventType string) *DeviceEvent {
+	return &DeviceEvent{
+		store: s,
+		MAC:   mac,
+		Type:  eventType,
+	}
+}
+
+func (e *DeviceEvent) MarshalJSON() ([]byte, error) {
+	type Alias DeviceEvent
+	return json.Marshal(&struct {
+		*Alias
+		MAC     string    `json:"mac"`
+		Created time.Time `json:"created"`
+	}{
+		Alias:   (*Alias)(e),
+		MAC:     e.MAC.String(),
+		Created: e.Created.UTC(),
+	})
+}
+
+func (e *DeviceEvent) Save() error {
+	return e.store.SaveEvent(e)
+}
+
+// TimelineEntry is an event or lease in the history of a device.
+type TimelineEntry struct {
+	Time      time.Time `json:"-"`
+	Type      string    `json:"type"`
+	Username  string    `json:"username"`
+	ChangedBy string    `json:"changed_by"`
+	Details   string    `json:"details"`
+}
+
+func (t *TimelineEntry) MarshalJSON() ([]byte, error) {
+	type Alias TimelineEntry
+	return json.Marshal(&struct {
+		*Alias
+		Time time.Time `json:"time"`
+	}{
+		Alias: (*Alias)(t),
+		Time:  t.Time.UTC(),
+	})
+}
+
+// DeviceTimeline merges device events and leases into a single history,
+// newest first. Leases are attributed to the owner of the device when the
+// lease started.
+func DeviceTimeline(events []*DeviceEvent, leases []LeaseHistory) []*TimelineEntry {
+	timeline := make([]*TimelineEntry, 0, len(events)+len(leases))
+	for _, e := range events {
+		timeline = append(timeline, &TimelineEntry{
+			Time:      e.Created,
+			Type:      e.Type,
+			Username:  e.Username,
+			ChangedBy: e.ChangedBy,
+			Details:   e.Details,
+		})
+	}
+
+	for _, l := range leases {
+		timeline = append(timeline, &TimelineEntry{
+			Time:     l.GetStartTime(),
+			Type:     DeviceEventLease,
+			Username: DeviceOwnerAt(events, l.GetStartTime()),
+			Details: fmt.Sprintf("%s on %s until %s",
+				l.GetIP(), l.GetNetworkName(), l.GetEndTime().Format(common.TimeFormat)),
+		})
+	}
+
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].Time.After(timeline[j].Time)
+	})
+	return timeline
+}
+
+// DeviceOwnerAt returns the owner of a device at time t from its events, or
+// an empty string if the device wasn't registered then. Events must be oldest
+// first.
+func DeviceOwnerAt(events []*DeviceEvent, t time.Time) string {
+	owner := ""
+	for _, e := range events {
+		if e.Created.After(t) {
+			break
+		}
+		if e.Type == DeviceEventDeleted {
+			owner = ""
+		} else {
+			owner = e.Username
+		}
+	}
+	return owner
+}
+
+// DeviceAuthMethodAt returns the authentication method used to register a
+// device that was registered at time t. Events must be oldest first.
+func DeviceAuthMethodAt(events []*DeviceEvent, t time.Time) string {
+	method := ""
+	registeredWith := ""
+	for _, e := range events {
+		if e.Created.After(t) {
+			break
+		}
+		switch e.Type {
+		case DeviceEventRegistered:
+			method = e.AuthMethod
+			registeredWith = e.AuthMethod
+		case DeviceEventDeleted:
+			method = ""
+		case DeviceEventRestored:
+			// A restored device keeps its original registration
+			method = registeredWith
+		}
+	}
+	return method
+}
@@ -0,0 +1,96 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+type testLease struct {
+	ip         net.IP
+	start, end time.Time
+}
+
+func (l *testLease) GetIP() net.IP            { return l.ip }
+func (l *testLease) GetMAC() net.HardwareAddr { return nil }
+func (l *testLease) GetNetworkName() string   { return "main" }
+func (l *testLease) GetStartTime() time.Time  { return l.start }
+func (l *testLease) GetEndTime() time.Time    { return l.end }
+func (l *testLease) GetHostname() string      { return "" }
+
+func TestDeviceTimeline(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2026, time.March, d, 12, 0, 0, 0, time.Local)
+	}
+
+	events := []*DeviceEvent{
+		{Type: DeviceEventRegistered, Username: "alice", Created: day(1)},
+		{Type: DeviceEventReassigned, Username: "bob", ChangedBy: "admin", Created: day(10)},
+		{Type: DeviceEventDeleted, Username: "bob", Created: day(20)},
+	}
+	leases := []LeaseHistory{
+		&testLease{ip: net.ParseIP("10.0.0.2"), start: day(12), end: day(13)},
+		&testLease{ip: net.ParseIP("10.0.0.1"), start: day(5), end: day(6)},
+		&testLease{ip: net.ParseIP("10.0.0.3"), start: day(25), end: day(26)},
+	}
+
+	timeline := DeviceTimeline(events, leases)
+	expected := []struct {
+		eventType string
+		username  string
+		time      time.Time
+	}{
+		{DeviceEventLease, "", day(25)},
+		{DeviceEventDeleted, "bob", day(20)},
+		{DeviceEventLease, "bob", day(12)},
+		{DeviceEventReassigned, "bob", day(10)},
+		{DeviceEventLease, "alice", day(5)},
+		{DeviceEventRegistered, "alice", day(1)},
+	}
+
+	if len(timeline) != len(expected) {
+		t.Fatalf("Expected %d timeline entries, got %d", len(expected), len(timeline))
+	}
+	for i, test := range expected {
+		entry := timeline[i]
+		if entry.Type != test.eventType || entry.Username != test.username || !entry.Time.Equal(test.time) {
+			t.Errorf("Entry %d: expected %s by %q at %s, got %s by %q at %s",
+				i, test.eventType, test.username, test.time, entry.Type, entry.Username, entry.Time)
+		}
+	}
+}
+
+func TestDeviceOwnerAfterRestore(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2026, time.March, d, 12, 0, 0, 0, time.Local)
+	}
+
+	events := []*DeviceEvent{
+		{Type: DeviceEventRegistered, Username: "alice", AuthMethod: "ldap", Created: day(1)},
+		{Type: DeviceEventDeleted, Username: "alice", Created: day(10)},
+		{Type: DeviceEventRestored, Username: "alice", ChangedBy: "admin", Created: day(12)},
+	}
+
+	tests := []struct {
+		time       time.Time
+		owner      string
+		authMethod string
+	}{
+		{day(5), "alice", "ldap"},
+		{day(11), "", ""},
+		{day(15), "alice", "ldap"},
+	}
+
+	for _, test := range tests {
+		if owner := DeviceOwnerAt(events, test.time); owner != test.owner {
+			t.Errorf("At %s: expected owner %q, got %q", test.time, test.owner, owner)
+		}
+		if method := DeviceAuthMethodAt(events, test.time); method != test.authMethod {
+			t.Errorf("At %s: expected auth method %q, got %q", test.time, test.authMethod, method)
+		}
+	}
+}
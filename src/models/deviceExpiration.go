@@ -21,6 +21,7 @@ const (
 	UserDeviceExpirationDuration UserExpiration = 3
 	UserDeviceExpirationDaily    UserExpiration = 4
 	UserDeviceExpirationRolling  UserExpiration = 5
+	UserDeviceExpirationTerm     UserExpiration = 6
 
 	UserDeviceLimitGlobal    UserDeviceLimit = -1
 	UserDeviceLimitUnlimited UserDeviceLimit = 0
@@ -40,6 +41,28 @@ func (ue UserExpiration) string() string {
 		return "daily-time"
 	case UserDeviceExpirationRolling:
 		return "rolling-duration"
+	case UserDeviceExpirationTerm:
+		return "term"
+	}
+	return ""
+}
+
+// configName returns the name of the mode as used for the default device
+// expiration type in the configuration.
+func (ue UserExpiration) configName() string {
+	switch ue {
+	case UserDeviceExpirationNever:
+		return "never"
+	case UserDeviceExpirationSpecific:
+		return "date"
+	case UserDeviceExpirationDuration:
+		return "duration"
+	case UserDeviceExpirationDaily:
+		return "daily"
+	case UserDeviceExpirationRolling:
+		return "rolling"
+	case UserDeviceExpirationTerm:
+		return "term"
 	}
 	return ""
 }
@@ -91,10 +114,49 @@ func GetGlobalDefaultExpiration(e *common.Environment) *UserDeviceExpiration {
 	case "rolling":
 		g.Value = 0
 		g.Mode = UserDeviceExpirationRolling
+	case "term":
+		// The duration used when no term covers the registration
+		d, err := time.ParseDuration(e.Config.Registration.DefaultDeviceExpiration)
+		if err != nil {
+			e.Log.Error("Incorrect default device expiration duration format")
+			break
+		}
+		g.Value = int64(d / time.Second)
+		g.Mode = UserDeviceExpirationTerm
 	}
 	return g
 }
 
+// getGlobalDeviceExpiration returns the cached global default expiration.
+func getGlobalDeviceExpiration(env *common.Environment) *UserDeviceExpiration {
+	if globalDeviceExpiration == nil {
+		// Build the global default, typically it's the most used mode
+		globalDeviceExpiration = GetGlobalDefaultExpiration(env)
+	}
+	return globalDeviceExpiration
+}
+
+// termFallback returns the expiration for a term mode registration no term
+// covers. The global term default carries the fallback duration. Users and
+// guests with the term mode use the global default instead.
+func (e *UserDeviceExpiration) termFallback(env *common.Environment, base time.Time) time.Time {
+	env.Log.WithField("base", base.Format(common.TimeFormat)).
+		Warning("No academic term found for device expiration, using default expiration")
+
+	if e.Value > 0 {
+		return base.Add(time.Duration(e.Value) * time.Second)
+	}
+
+	g := getGlobalDeviceExpiration(env)
+	if g.Mode != UserDeviceExpirationTerm {
+		return g.NextExpiration(env, base)
+	}
+	if g.Value > 0 {
+		return base.Add(time.Duration(g.Value) * time.Second)
+	}
+	return time.Unix(0, 0)
+}
+
 func (e *UserDeviceExpiration) String() string {
 	switch e.Mode {
 	case UserDeviceExpirationNever:
@@ -103,6 +165,8 @@ func (e *UserDeviceExpiration) String() string {
 		return "Global"
 	case UserDeviceExpirationRolling:
 		return "Rolling"
+	case UserDeviceExpirationTerm:
+		return "Term"
 	case UserDeviceExpirationSpecific:
 		return time.Unix(e.Value, 0).Format(common.TimeFormat)
 	case UserDeviceExpirationDuration:
@@ -119,14 +183,18 @@ func (e *UserDeviceExpiration) String() string {
 func (e *UserDeviceExpiration) NextExpiration(env *common.Environment, base time.Time) time.Time {
 	switch e.Mode {
 	case UserDeviceExpirationGlobal:
-		if globalDeviceExpiration != nil {
-			return globalDeviceExpiration.NextExpiration(env, base)
-		}
-		// Build the global default, typically it's the most used mode
-		globalDeviceExpiration = GetGlobalDefaultExpiration(env)
-		return globalDeviceExpiration.NextExpiration(env, base)
+		return getGlobalDeviceExpiration(env).NextExpiration(env, base)
 	case UserDeviceExpirationRolling:
 		return time.Unix(1, 0)
+	case UserDeviceExpirationTerm:
+		t, err := TermFor(base)
+		if err != nil {
+			env.Log.WithField("error", err).Error("Failed loading academic term calendar")
+		}
+		if t != nil {
+			return t.End
+		}
+		return e.termFallback(env, base)
 	case UserDeviceExpirationSpecific:
 		return time.Unix(e.Value, 0)
 	case UserDeviceExpirationDuration:
@@ -0,0 +1,97 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type JobRunStore interface {
+	SaveRun(*JobRun) error
+}
+
+// JobRun is a finished run of a scheduled job. Affected is the number of
+// records the job changed or messages it sent. TriggeredBy is the user who
+// started a manual run and is empty for scheduled runs.
+type JobRun struct {
+	store       JobRunStore
+	ID          int       `json:"id"`
+	Job         string    `json:"job"`
+	Started     time.Time `json:"-"`
+	Finished    time.Time `json:"-"`
+	Result      string    `json:"result"`
+	Error       string    `json:"error"`
+	Affected    int64     `json:"affected"`
+	TriggeredBy string    `json:"triggered_by"`
+}
+
+func NewJobRun(s JobRunStore, job string) *JobRun {
+	return &JobRun{
+		store: s,
+		Job:   job,
+	}
+}
+
+func (r *JobRun) MarshalJSON() ([]byte, error) {
+	type Alias JobRun
+	return json.Marshal(&struct {
+		*Alias
+		Started  time.Time `json:"started"`
+		Finished time.Time `json:"finished"`
+		Failed   bool      `json:"failed"`
+	}{
+		Alias:    (*Alias)(r),
+		Started:  r.Started.UTC(),
+		Finished: r.Finished.UTC(),
+		Failed:   r.Failed(),
+	})
+}
+
+// Failed returns if the run ended with an error.
+func (r *JobRun) Failed() bool {
+	return r.Error != ""
+}
+
+// Duration returns how long the run took.
+func (r *JobRun) Duration() time.Duration {
+	return r.Finished.Sub(r.Started)
+}
+
+func (r *JobRun) Save() error {
+	return r.store.SaveRun(r)
+}
+
+// JobStatus summarizes the run history of a job. FailingSince is the start of
+// the first failed run after the last successful run, it's zero when the
+// last run succeeded. LastRun is nil if the job has never run.
+type JobStatus struct {
+	Job          string
+	LastRun      *JobRun
+	LastSuccess  time.Time
+	FailingSince time.Time
+}
+
+func (s *JobStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Job          string     `json:"job"`
+		LastRun      *JobRun    `json:"last_run"`
+		LastSuccess  *time.Time `json:"last_success"`
+		FailingSince *time.Time `json:"failing_since"`
+	}{
+		Job:          s.Job,
+		LastRun:      s.LastRun,
+		LastSuccess:  timeOrNil(s.LastSuccess),
+		FailingSince: timeOrNil(s.FailingSince),
+	})
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
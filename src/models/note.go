@@ -0,0 +1,57 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Entities notes can be attached to
+const (
+	NoteEntityDevice = "device"
+	NoteEntityUser   = "user"
+)
+
+type NoteStore interface {
+	Save(*Note) error
+}
+
+// Note is an entry in the append-only notes log of a device or user. Key is
+// the device MAC address or the username. Notes migrated from the old notes
+// field have no author.
+type Note struct {
+	store   NoteStore
+	ID      int       `json:"id"`
+	Entity  string    `json:"entity"`
+	Key     string    `json:"key"`
+	Author  string    `json:"author"`
+	Created time.Time `json:"-"`
+	Text    string    `json:"text"`
+}
+
+func NewNote(s NoteStore, entity, key string) *Note {
+	return &Note{
+		store:  s,
+		Entity: entity,
+		Key:    key,
+	}
+}
+
+func (n *Note) MarshalJSON() ([]byte, error) {
+	type Alias Note
+	return json.Marshal(&struct {
+		*Alias
+		Created time.Time `json:"created"`
+	}{
+		Alias:   (*Alias)(n),
+		Created: n.Created.UTC(),
+	})
+}
+
+// Save adds the note to the log. Saved notes can't be changed.
+func (n *Note) Save() error {
+	return n.store.Save(n)
+}
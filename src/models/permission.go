@@ -51,6 +51,15 @@ const (
 
 	ViewDHCP
 	AdminDHCP
+
+	// Manage the academic term calendar used for device expirations
+	ManageTerms
+	// Publish new versions of the registration policy
+	ManagePolicy
+	// View scheduled job history and run jobs on demand
+	ManageJobs
+	// View the webhook delivery log and retry deliveries
+	ManageWebhooks
 )
 
 const (
@@ -104,6 +113,10 @@ var permLookupMap = map[string]Permission{
 	"APIWrite":            APIWrite,
 	"ViewDHCP":            ViewDHCP,
 	"AdminDHCP":           AdminDHCP,
+	"ManageTerms":         ManageTerms,
+	"ManagePolicy":        ManagePolicy,
+	"ManageJobs":          ManageJobs,
+	"ManageWebhooks":      ManageWebhooks,
 }
 
 func StrToPermission(p string) Permission {
@@ -235,6 +248,18 @@ func (p Permission) String() string {
 	if p.Can(AdminDHCP) {
 		buf.WriteString("models.AdminDHCP\n")
 	}
+	if p.Can(ManageTerms) {
+		buf.WriteString("models.ManageTerms\n")
+	}
+	if p.Can(ManagePolicy) {
+		buf.WriteString("models.ManagePolicy\n")
+	}
+	if p.Can(ManageJobs) {
+		buf.WriteString("models.ManageJobs\n")
+	}
+	if p.Can(ManageWebhooks) {
+		buf.WriteString("models.ManageWebhooks\n")
+	}
 
 	return buf.String()
 }
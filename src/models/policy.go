@@ -0,0 +1,56 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+type PolicyStore interface {
+	Save(*Policy) error
+}
+
+// Policy is a published version of the registration policy. Policies are
+// never changed once published, a new version is published instead. A
+// policy with ID 0 is the legacy policy file which isn't versioned.
+type Policy struct {
+	store       PolicyStore
+	ID          int       `json:"version"`
+	Text        string    `json:"text"`
+	Published   time.Time `json:"published"`
+	PublishedBy string    `json:"published_by"`
+}
+
+func NewPolicy(s PolicyStore) *Policy {
+	return &Policy{store: s}
+}
+
+// Versioned returns if the policy was published from the database and
+// acceptance should be recorded.
+func (p *Policy) Versioned() bool {
+	return p.ID > 0
+}
+
+// Paragraphs returns the policy text split into paragraphs for display.
+func (p *Policy) Paragraphs() []template.HTML {
+	return common.ParsePolicyText(strings.NewReader(p.Text))
+}
+
+func (p *Policy) Save() error {
+	return p.store.Save(p)
+}
+
+// PolicyAcceptance records a user agreeing to a version of the registration policy.
+type PolicyAcceptance struct {
+	ID       int       `json:"id"`
+	Username string    `json:"username"`
+	Version  int       `json:"version"`
+	Accepted time.Time `json:"accepted"`
+	IP       string    `json:"ip"`
+}
@@ -0,0 +1,120 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stores
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+)
+
+var appDeviceEventStore DeviceEventStore
+
+type DeviceEventStore interface {
+	GetDeviceEvents(mac net.HardwareAddr) ([]*models.DeviceEvent, error)
+	SaveEvent(e *models.DeviceEvent) error
+}
+
+type deviceEventStore struct {
+	e *common.Environment
+}
+
+func newDeviceEventStore(e *common.Environment) *deviceEventStore {
+	return &deviceEventStore{
+		e: e,
+	}
+}
+
+func GetDeviceEventStore(e *common.Environment) DeviceEventStore {
+	if appDeviceEventStore == nil {
+		appDeviceEventStore = newDeviceEventStore(e)
+	}
+	return appDeviceEventStore
+}
+
+// GetDeviceEvents returns the history of a MAC address, oldest first.
+func (s *deviceEventStore) GetDeviceEvents(mac net.HardwareAddr) ([]*models.DeviceEvent, error) {
+	sql := `SELECT "id", "type", "username", "changed_by", "auth_method", "created", "details" FROM "device_event" WHERE "mac" = ? ORDER BY "created" ASC, "id" ASC`
+
+	rows, err := s.e.DB.Query(sql, mac.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.DeviceEvent
+	for rows.Next() {
+		var id int
+		var eventType string
+		var username string
+		var changedBy string
+		var authMethod string
+		var created int64
+		var details []byte
+
+		if err := rows.Scan(&id, &eventType, &username, &changedBy, &authMethod, &created, &details); err != nil {
+			continue
+		}
+
+		results = append(results, &models.DeviceEvent{
+			ID:         id,
+			MAC:        mac,
+			Type:       eventType,
+			Username:   username,
+			ChangedBy:  changedBy,
+			AuthMethod: authMethod,
+			Created:    time.Unix(created, 0),
+			Details:    string(details),
+		})
+	}
+	return results, rows.Err()
+}
+
+// SaveEvent appends an event to the history of a device. Events are never
+// updated or deleted.
+func (s *deviceEventStore) SaveEvent(e *models.DeviceEvent) error {
+	if e.Created.IsZero() {
+		e.Created = time.Now()
+	}
+
+	sql := `INSERT INTO "device_event" ("mac", "type", "username", "changed_by", "auth_method", "created", "details") VALUES (?,?,?,?,?,?,?)`
+	result, err := s.e.DB.Exec(sql, e.MAC.String(), e.Type, e.Username, e.ChangedBy, e.AuthMethod, e.Created.Unix(), e.Details)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	e.ID = int(id)
+	return nil
+}
+
+// expirationDetails describes a device expiration for the device history.
+func expirationDetails(expires time.Time) string {
+	// Expires values of 0 and 1 mean never and rolling
+	switch expires.Unix() {
+	case 0:
+		return "Never"
+	case 1:
+		return "Rolling"
+	}
+	return expires.Format(common.TimeFormat)
+}
+
+// flagDetails describes the flag of a device for its history.
+func flagDetails(d *models.Device) string {
+	var details []string
+	if d.FlagCategory != "" {
+		details = append(details, "Category "+d.FlagCategory)
+	}
+	if d.FlagReason != "" {
+		details = append(details, "Reason: "+d.FlagReason)
+	}
+	if !d.FlagClears.IsZero() {
+		details = append(details, "Clears "+d.FlagClears.Format(common.TimeFormat))
+	}
+	return strings.Join(details, ", ")
+}
@@ -10,6 +10,7 @@ import (
 	"net"
 	"time"
 
+	"github.com/lfkeitel/verbose/v4"
 	"github.com/packet-guardian/packet-guardian/src/common"
 	"github.com/packet-guardian/packet-guardian/src/models"
 )
@@ -26,18 +27,22 @@ type DeviceStore interface {
 	GetAllDevices(e *common.Environment) ([]*models.Device, error)
 	SearchDevicesByField(field, pattern string) ([]*models.Device, error)
 	Search(where string, vals ...interface{}) ([]*models.Device, error)
+	Each(where string, fn func(*models.Device) error, vals ...interface{}) error
 	Save(d *models.Device) error
 	Delete(d *models.Device) error
 	DeleteAllDeviceForUser(u *models.User) error
+	SaveEvent(e *models.DeviceEvent) error
 }
 
 type deviceStore struct {
-	e *common.Environment
+	e      *common.Environment
+	events DeviceEventStore
 }
 
 func newDeviceStore(e *common.Environment) *deviceStore {
 	return &deviceStore{
-		e: e,
+		e:      e,
+		events: GetDeviceEventStore(e),
 	}
 }
 
@@ -106,16 +111,38 @@ func (s *deviceStore) SearchDevicesByField(field, pattern string) ([]*models.Dev
 	return s.getDevicesFromDatabase(sql, pattern)
 }
 
+// Each calls fn for every device matching where, ordered by MAC address.
+// Devices are read one at a time so large result sets aren't held in memory.
+// An empty where matches all devices. Iteration stops at the first error
+// returned by fn.
+func (s *deviceStore) Each(where string, fn func(*models.Device) error, vals ...interface{}) error {
+	if where != "" {
+		where = "WHERE " + where
+	}
+	return s.eachDeviceFromDatabase(where+` ORDER BY "mac" ASC`, fn, vals...)
+}
+
 func (s *deviceStore) getDevicesFromDatabase(where string, values ...interface{}) ([]*models.Device, error) {
-	sqlstmt := `SELECT "id", "mac", "username", "registered_from", "platform", "expires", "date_registered", "user_agent", "description", "last_seen", "flagged", "notes" FROM "device" ` + where
+	var results []*models.Device
+	err := s.eachDeviceFromDatabase(where, func(d *models.Device) error {
+		results = append(results, d)
+		return nil
+	}, values...)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *deviceStore) eachDeviceFromDatabase(where string, fn func(*models.Device) error, values ...interface{}) error {
+	sqlstmt := `SELECT "id", "mac", "username", "registered_from", "platform", "expires", "date_registered", "user_agent", "description", "last_seen", "flagged", "notes", "attributes", "renewals", "policy_version", "policy_accepted", "tags", "flag_category", "flag_reason", "flagged_by", "flagged_at", "flag_clears" FROM "device" ` + where
 
 	rows, err := s.e.DB.Query(sqlstmt, values...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var results []*models.Device
 	for rows.Next() {
 		var id int
 		var macStr string
@@ -129,6 +156,16 @@ func (s *deviceStore) getDevicesFromDatabase(where string, values ...interface{}
 		var lastSeen int64
 		var flagged bool
 		var notes sql.NullString
+		var attributes sql.NullString
+		var renewals int
+		var policyVersion int
+		var policyAccepted int64
+		var tags sql.NullString
+		var flagCategory string
+		var flagReason sql.NullString
+		var flaggedBy string
+		var flaggedAt int64
+		var flagClears int64
 
 		err := rows.Scan(
 			&id,
@@ -143,6 +180,16 @@ func (s *deviceStore) getDevicesFromDatabase(where string, values ...interface{}
 			&lastSeen,
 			&flagged,
 			&notes,
+			&attributes,
+			&renewals,
+			&policyVersion,
+			&policyAccepted,
+			&tags,
+			&flagCategory,
+			&flagReason,
+			&flaggedBy,
+			&flaggedAt,
+			&flagClears,
 		)
 		if err != nil {
 			continue
@@ -162,13 +209,38 @@ func (s *deviceStore) getDevicesFromDatabase(where string, values ...interface{}
 		device.UserAgent = ua
 		device.LastSeen = time.Unix(lastSeen, 0)
 		device.Flagged = flagged
+		device.FlagCategory = flagCategory
+		device.FlaggedBy = flaggedBy
+		if flagReason.Valid {
+			device.FlagReason = flagReason.String
+		}
+		if flaggedAt > 0 {
+			device.FlaggedAt = time.Unix(flaggedAt, 0)
+		}
+		if flagClears > 0 {
+			device.FlagClears = time.Unix(flagClears, 0)
+		}
+		device.Renewals = renewals
+		device.PolicyVersion = policyVersion
+		if policyAccepted > 0 {
+			device.PolicyAccepted = time.Unix(policyAccepted, 0)
+		}
+		if tags.Valid {
+			device.Tags = models.ParseTags(tags.String)
+		}
 		if notes.Valid {
 			device.Notes = notes.String
 		}
+		if attributes.Valid {
+			device.Attributes = models.ParseAttributes(attributes.String)
+		}
+		device.MarkSaved()
 
-		results = append(results, device)
+		if err := fn(device); err != nil {
+			return err
+		}
 	}
-	return results, nil
+	return rows.Err()
 }
 
 func (s *deviceStore) Save(d *models.Device) error {
@@ -179,7 +251,7 @@ func (s *deviceStore) Save(d *models.Device) error {
 }
 
 func (s *deviceStore) updateExisting(d *models.Device) error {
-	sql := `UPDATE "device" SET "mac" = ?, "username" = ?, "registered_from" = ?, "platform" = ?, "expires" = ?, "date_registered" = ?, "user_agent" = ?, "description" = ?, "last_seen" = ?, "flagged" = ?, "notes" = ? WHERE "id" = ?`
+	sql := `UPDATE "device" SET "mac" = ?, "username" = ?, "registered_from" = ?, "platform" = ?, "expires" = ?, "date_registered" = ?, "user_agent" = ?, "description" = ?, "last_seen" = ?, "flagged" = ?, "notes" = ?, "attributes" = ?, "renewals" = ?, "policy_version" = ?, "policy_accepted" = ?, "tags" = ?, "flag_category" = ?, "flag_reason" = ?, "flagged_by" = ?, "flagged_at" = ?, "flag_clears" = ? WHERE "id" = ?`
 
 	_, err := s.e.DB.Exec(
 		sql,
@@ -194,20 +266,59 @@ func (s *deviceStore) updateExisting(d *models.Device) error {
 		d.LastSeen.Unix(),
 		d.Flagged,
 		d.Notes,
+		d.Attributes.String(),
+		d.Renewals,
+		d.PolicyVersion,
+		unixOrZero(d.PolicyAccepted),
+		d.Tags.String(),
+		d.FlagCategory,
+		d.FlagReason,
+		d.FlaggedBy,
+		unixOrZero(d.FlaggedAt),
+		unixOrZero(d.FlagClears),
 		d.ID,
 	)
 	if err != nil {
 		return err
 	}
+
+	// Changes are compared to the device as loaded, devices that didn't come
+	// from the store have nothing to compare to.
+	if old := d.Saved(); old != nil {
+		s.recordChanges(d, old)
+	}
+	d.MarkSaved()
 	return d.SaveToBlacklist()
 }
 
+// recordChanges records history events for the differences between d and
+// its saved values.
+func (s *deviceStore) recordChanges(d *models.Device, old *models.DeviceSnapshot) {
+	if d.Username != old.Username {
+		s.recordEvent(d, models.DeviceEventReassigned, "From "+old.Username)
+	}
+	if d.Expires.Unix() != old.Expires.Unix() {
+		s.recordEvent(d, models.DeviceEventExpiration, expirationDetails(d.Expires))
+	}
+	if d.Flagged {
+		if !old.Flagged || d.FlagCategory != old.FlagCategory || d.FlagReason != old.FlagReason || unixOrZero(d.FlagClears) != unixOrZero(old.FlagClears) {
+			s.recordEvent(d, models.DeviceEventFlagged, flagDetails(d))
+		}
+	} else if old.Flagged {
+		details := ""
+		if !old.FlagClears.IsZero() && !old.FlagClears.After(time.Now()) {
+			details = "Flag cleared on schedule"
+		}
+		s.recordEvent(d, models.DeviceEventUnflagged, details)
+	}
+}
+
 func (s *deviceStore) saveNew(d *models.Device) error {
 	if d.Username == "" {
 		return errors.New("Username cannot be empty")
 	}
 
-	sql := `INSERT INTO "device" ("mac", "username", "registered_from", "platform", "expires", "date_registered", "user_agent", "description", "last_seen", "flagged", "notes") VALUES (?,?,?,?,?,?,?,?,?,?,?)`
+	sql := `INSERT INTO "device" ("mac", "username", "registered_from", "platform", "expires", "date_registered", "user_agent", "description", "last_seen", "flagged", "notes", "attributes", "renewals", "policy_version", "policy_accepted", "tags", "flag_category", "flag_reason", "flagged_by", "flagged_at", "flag_clears") VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
 
 	result, err := s.e.DB.Exec(
 		sql,
@@ -222,23 +333,78 @@ func (s *deviceStore) saveNew(d *models.Device) error {
 		d.LastSeen.Unix(),
 		d.Flagged,
 		d.Notes,
+		d.Attributes.String(),
+		d.Renewals,
+		d.PolicyVersion,
+		unixOrZero(d.PolicyAccepted),
+		d.Tags.String(),
+		d.FlagCategory,
+		d.FlagReason,
+		d.FlaggedBy,
+		unixOrZero(d.FlaggedAt),
+		unixOrZero(d.FlagClears),
 	)
 	if err != nil {
 		return err
 	}
 	id, _ := result.LastInsertId()
 	d.ID = int(id)
+	s.recordEvent(d, models.DeviceEventRegistered, "Expires "+expirationDetails(d.Expires))
+	if d.Flagged {
+		s.recordEvent(d, models.DeviceEventFlagged, flagDetails(d))
+	}
+	d.MarkSaved()
 	return d.SaveToBlacklist()
 }
 
+// Delete moves a device to the trash. It can be restored until the trash is
+// purged.
 func (s *deviceStore) Delete(d *models.Device) error {
-	sql := `DELETE FROM "device" WHERE "id" = ?`
-	_, err := s.e.DB.Exec(sql, d.ID)
-	return err
+	if _, err := moveToTrash(s.e, "device", deviceTrashColumns, `"id" = ?`, d.ChangedBy, d.ID); err != nil {
+		return err
+	}
+	s.recordEvent(d, models.DeviceEventDeleted, "")
+	return nil
 }
 
+// DeleteAllDeviceForUser moves all devices of a user to the trash.
 func (s *deviceStore) DeleteAllDeviceForUser(u *models.User) error {
-	sql := `DELETE FROM "device" WHERE "username" = ?`
-	_, err := s.e.DB.Exec(sql, u.Username)
-	return err
+	devices, err := s.GetDevicesForUser(u)
+	if err != nil {
+		return err
+	}
+
+	if _, err := moveToTrash(s.e, "device", deviceTrashColumns, `"username" = ?`, u.ChangedBy, u.Username); err != nil {
+		return err
+	}
+	for _, d := range devices {
+		d.ChangedBy = u.ChangedBy
+		s.recordEvent(d, models.DeviceEventDeleted, "")
+	}
+	return nil
+}
+
+// SaveEvent records an event in the device history.
+func (s *deviceStore) SaveEvent(e *models.DeviceEvent) error {
+	return s.events.SaveEvent(e)
+}
+
+// recordEvent saves an event for a device change that has already been
+// written. Failures are logged rather than returned so the change itself
+// isn't reported as failed.
+func (s *deviceStore) recordEvent(d *models.Device, eventType, details string) {
+	event := models.NewDeviceEvent(s.events, d.MAC, eventType)
+	event.Username = d.Username
+	event.ChangedBy = d.ChangedBy
+	event.AuthMethod = d.AuthMethod
+	event.Details = details
+
+	if err := event.Save(); err != nil {
+		s.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "stores:device",
+			"mac":     d.MAC.String(),
+			"type":    eventType,
+		}).Error("Error saving device event")
+	}
 }
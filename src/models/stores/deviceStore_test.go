@@ -0,0 +1,139 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stores
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+)
+
+func TestDeviceSaveRecordsEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	e := common.NewTestEnvironment()
+	e.DB = &common.DatabaseAccessor{DB: db}
+	store := &deviceStore{e: e, events: newDeviceEventStore(e)}
+
+	device := models.NewDevice(store, nil, &TestBlacklistItem{})
+	device.ID = 1
+	device.MAC, _ = net.ParseMAC("ab:cd:ef:12:34:56")
+	device.Username = "alice"
+	device.Expires = time.Unix(1, 0)
+	device.MarkSaved()
+
+	device.Username = "bob"
+	device.ChangedBy = "admin"
+	mock.ExpectExec(`UPDATE "device"`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "device_event"`).
+		WithArgs("ab:cd:ef:12:34:56", models.DeviceEventReassigned, "bob", "admin", "", sqlmock.AnyArg(), "From alice").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := device.Save(); err != nil {
+		t.Fatalf("Failed to save device: %s", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`REPLACE INTO "device_trash" (.+) SELECT (.+) FROM "device" WHERE "id" = ?`).
+		WithArgs(sqlmock.AnyArg(), "admin", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "device"`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO "device_event"`).
+		WithArgs("ab:cd:ef:12:34:56", models.DeviceEventDeleted, "bob", "admin", "", sqlmock.AnyArg(), "").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	if err := device.Delete(); err != nil {
+		t.Fatalf("Failed to delete device: %s", err)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeviceSaveRecordsFlagEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	e := common.NewTestEnvironment()
+	e.DB = &common.DatabaseAccessor{DB: db}
+	store := &deviceStore{e: e, events: newDeviceEventStore(e)}
+
+	device := models.NewDevice(store, nil, &TestBlacklistItem{})
+	device.ID = 1
+	device.MAC, _ = net.ParseMAC("ab:cd:ef:12:34:56")
+	device.Username = "bob"
+	device.Expires = time.Unix(1, 0)
+	device.MarkSaved()
+
+	device.ChangedBy = "admin"
+	device.Flag("stolen", "Reported by owner", "admin", time.Time{})
+	mock.ExpectExec(`UPDATE "device"`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "device_event"`).
+		WithArgs("ab:cd:ef:12:34:56", models.DeviceEventFlagged, "bob", "admin", "", sqlmock.AnyArg(), "Category stolen, Reason: Reported by owner").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := device.Save(); err != nil {
+		t.Fatalf("Failed to save device: %s", err)
+	}
+
+	// Saving an unchanged flag doesn't add to the history
+	mock.ExpectExec(`UPDATE "device"`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := device.Save(); err != nil {
+		t.Fatalf("Failed to save device: %s", err)
+	}
+
+	// The flag was loaded with a clear date that has passed
+	device.FlagClears = time.Now().Add(-time.Minute)
+	device.MarkSaved()
+	device.Unflag()
+	device.ChangedBy = ""
+	mock.ExpectExec(`UPDATE "device"`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "device_event"`).
+		WithArgs("ab:cd:ef:12:34:56", models.DeviceEventUnflagged, "bob", "", "", sqlmock.AnyArg(), "Flag cleared on schedule").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	if err := device.Save(); err != nil {
+		t.Fatalf("Failed to save device: %s", err)
+	}
+
+	// A device that wasn't loaded has nothing to compare to and a device
+	// that no longer exists is updated as a no-op
+	unloaded := models.NewDevice(store, nil, &TestBlacklistItem{})
+	unloaded.ID = 2
+	unloaded.MAC, _ = net.ParseMAC("ab:cd:ef:12:34:57")
+	unloaded.Username = "carol"
+	unloaded.Flag("stolen", "", "admin", time.Time{})
+	mock.ExpectExec(`UPDATE "device"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := unloaded.Save(); err != nil {
+		t.Fatalf("Failed to save device: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
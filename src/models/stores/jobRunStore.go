@@ -0,0 +1,126 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stores
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+)
+
+var appJobRunStore JobRunStore
+
+type JobRunStore interface {
+	GetJobRuns(job string, limit int) ([]*models.JobRun, error)
+	GetJobStatus(job string) (*models.JobStatus, error)
+	SaveRun(r *models.JobRun) error
+}
+
+type jobRunStore struct {
+	e *common.Environment
+}
+
+func newJobRunStore(e *common.Environment) *jobRunStore {
+	return &jobRunStore{
+		e: e,
+	}
+}
+
+func GetJobRunStore(e *common.Environment) JobRunStore {
+	if appJobRunStore == nil {
+		appJobRunStore = newJobRunStore(e)
+	}
+	return appJobRunStore
+}
+
+// GetJobRuns returns the most recent runs of a job, newest first.
+func (s *jobRunStore) GetJobRuns(job string, limit int) ([]*models.JobRun, error) {
+	return s.getRunsFromDatabase(`WHERE "job" = ? ORDER BY "started" DESC, "id" DESC LIMIT ?`, job, limit)
+}
+
+// GetJobStatus summarizes the run history of a job.
+func (s *jobRunStore) GetJobStatus(job string) (*models.JobStatus, error) {
+	status := &models.JobStatus{Job: job}
+
+	runs, err := s.GetJobRuns(job, 1)
+	if err != nil || len(runs) == 0 {
+		return status, err
+	}
+	status.LastRun = runs[0]
+
+	var lastSuccess sql.NullInt64
+	row := s.e.DB.QueryRow(`SELECT MAX("started") FROM "job_run" WHERE "job" = ? AND "error" = ''`, job)
+	if err := row.Scan(&lastSuccess); err != nil {
+		return nil, err
+	}
+	if lastSuccess.Valid {
+		status.LastSuccess = time.Unix(lastSuccess.Int64, 0)
+	}
+
+	if !status.LastRun.Failed() {
+		return status, nil
+	}
+
+	var failingSince sql.NullInt64
+	row = s.e.DB.QueryRow(`SELECT MIN("started") FROM "job_run" WHERE "job" = ? AND "error" != '' AND "started" > ?`, job, lastSuccess.Int64)
+	if err := row.Scan(&failingSince); err != nil {
+		return nil, err
+	}
+	if failingSince.Valid {
+		status.FailingSince = time.Unix(failingSince.Int64, 0)
+	}
+	return status, nil
+}
+
+func (s *jobRunStore) getRunsFromDatabase(where string, values ...interface{}) ([]*models.JobRun, error) {
+	sql := `SELECT "id", "job", "started", "finished", "result", "error", "affected", "triggered_by" FROM "job_run" ` + where
+
+	rows, err := s.e.DB.Query(sql, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.JobRun
+	for rows.Next() {
+		var id int
+		var job string
+		var started int64
+		var finished int64
+		var result string
+		var errStr string
+		var affected int64
+		var triggeredBy string
+
+		if err := rows.Scan(&id, &job, &started, &finished, &result, &errStr, &affected, &triggeredBy); err != nil {
+			continue
+		}
+
+		run := models.NewJobRun(s, job)
+		run.ID = id
+		run.Started = time.Unix(started, 0)
+		run.Finished = time.Unix(finished, 0)
+		run.Result = result
+		run.Error = errStr
+		run.Affected = affected
+		run.TriggeredBy = triggeredBy
+		results = append(results, run)
+	}
+	return results, rows.Err()
+}
+
+// SaveRun records a finished job run.
+func (s *jobRunStore) SaveRun(r *models.JobRun) error {
+	sql := `INSERT INTO "job_run" ("job", "started", "finished", "result", "error", "affected", "triggered_by") VALUES (?,?,?,?,?,?,?)`
+	result, err := s.e.DB.Exec(sql, r.Job, r.Started.Unix(), r.Finished.Unix(), r.Result, r.Error, r.Affected, r.TriggeredBy)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	r.ID = int(id)
+	return nil
+}
@@ -5,7 +5,9 @@
 package stores
 
 import (
+	"fmt"
 	"net"
+	"sort"
 	"time"
 
 	"github.com/lfkeitel/verbose/v4"
@@ -15,11 +17,12 @@ import (
 )
 
 type LeaseHistory struct {
-	IP      net.IP
-	MAC     net.HardwareAddr
-	Network string
-	Start   time.Time
-	End     time.Time
+	IP       net.IP
+	MAC      net.HardwareAddr
+	Network  string
+	Start    time.Time
+	End      time.Time
+	Hostname string
 }
 
 func (l *LeaseHistory) GetIP() net.IP {
@@ -37,6 +40,9 @@ func (l *LeaseHistory) GetStartTime() time.Time {
 func (l *LeaseHistory) GetEndTime() time.Time {
 	return l.End
 }
+func (l *LeaseHistory) GetHostname() string {
+	return l.Hostname
+}
 
 type LeaseStore interface {
 	GetAllLeases() ([]*dhcp.Lease, error)
@@ -49,6 +55,10 @@ type LeaseStore interface {
 	DeleteLease(lease *dhcp.Lease) error
 	SearchLeases(where string, vals ...interface{}) ([]*dhcp.Lease, error)
 	GetLatestLease(mac net.HardwareAddr) models.LeaseHistory
+	GetLeaseAt(ip net.IP, t time.Time) (models.LeaseHistory, error)
+	GetLeaseAtByMAC(mac net.HardwareAddr, t time.Time) (models.LeaseHistory, error)
+	SnapshotLeaseHistory() (int64, error)
+	PurgeLeaseHistory(before time.Time) (int64, error)
 }
 
 type leaseStore struct {
@@ -128,25 +138,180 @@ func (l *leaseStore) CreateLease(lease *dhcp.Lease) error {
 	}
 	id, _ := result.LastInsertId()
 	lease.ID = int(id)
+	l.recordLeaseHistory(lease)
 	return nil
 }
 
+// GetLeaseHistory returns the leases given to a MAC address, newest first.
+// Leases from the retained history are merged with the lease table which may
+// have changed since the last snapshot.
 func (l *leaseStore) GetLeaseHistory(mac net.HardwareAddr) ([]models.LeaseHistory, error) {
-	leases, err := l.SearchLeases(`"mac" = ? ORDER BY "start" DESC`, mac.String())
+	history, err := l.searchLeaseLog(`"mac" = ?`, mac.String())
+	if err != nil {
+		return nil, err
+	}
+	leases, err := l.SearchLeases(`"mac" = ?`, mac.String())
+	if err != nil {
+		return nil, err
+	}
+	return mergeLeaseHistory(history, leases), nil
+}
+
+// GetLeaseAt returns the lease of an IP address at time t, or nil if the
+// address wasn't leased.
+func (l *leaseStore) GetLeaseAt(ip net.IP, t time.Time) (models.LeaseHistory, error) {
+	return l.getLeaseAt(`"ip" = ?`, ip.String(), t)
+}
+
+// GetLeaseAtByMAC returns the lease of a MAC address at time t, or nil if the
+// device didn't have a lease.
+func (l *leaseStore) GetLeaseAtByMAC(mac net.HardwareAddr, t time.Time) (models.LeaseHistory, error) {
+	return l.getLeaseAt(`"mac" = ?`, mac.String(), t)
+}
+
+func (l *leaseStore) getLeaseAt(where, value string, t time.Time) (models.LeaseHistory, error) {
+	where += ` AND "start" <= ? AND "end" >= ?`
+
+	history, err := l.searchLeaseLog(where, value, t.Unix(), t.Unix())
+	if err != nil {
+		return nil, err
+	}
+	leases, err := l.SearchLeases(where, value, t.Unix(), t.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	merged := mergeLeaseHistory(history, leases)
+	if len(merged) == 0 {
+		return nil, nil
+	}
+	return merged[0], nil
+}
+
+// recordLeaseHistory adds the grant of a saved lease to the lease history, or
+// updates its end time and hostname if it's already there. Recording on save
+// keeps grants that are overwritten before the next snapshot. Failures are
+// logged and left for the snapshot to catch up.
+func (l *leaseStore) recordLeaseHistory(lease *dhcp.Lease) {
+	if len(lease.MAC) == 0 || lease.IsAbandoned {
+		return
+	}
+
+	sql := `INSERT INTO "lease_log" ("ip", "mac", "network", "start", "end", "hostname") VALUES (?,?,?,?,?,?)
+		ON DUPLICATE KEY UPDATE "end" = VALUES("end"), "hostname" = VALUES("hostname")`
+
+	_, err := l.e.DB.Exec(
+		sql,
+		lease.IP.String(),
+		lease.MAC.String(),
+		lease.Network,
+		lease.Start.Unix(),
+		lease.End.Unix(),
+		lease.Hostname,
+	)
+	if err != nil {
+		l.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "models:leasestore",
+			"ip":      lease.IP.String(),
+		}).Error("Failed to record lease history")
+	}
+}
+
+// SnapshotLeaseHistory copies the lease table into the lease history. Leases
+// already in the history have their end time and hostname updated. The number
+// of changed rows is returned. Leases are recorded when saved, the snapshot
+// catches leases whose history couldn't be written.
+func (l *leaseStore) SnapshotLeaseHistory() (int64, error) {
+	sql := `INSERT INTO "lease_log" ("ip", "mac", "network", "start", "end", "hostname")
+		SELECT "ip", "mac", "network", "start", "end", "hostname" FROM "lease" WHERE "mac" != '' AND "abandoned" = 0
+		ON DUPLICATE KEY UPDATE "end" = VALUES("end"), "hostname" = VALUES("hostname")`
+
+	result, err := l.e.DB.Exec(sql)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// PurgeLeaseHistory deletes history of leases that ended before the given time.
+func (l *leaseStore) PurgeLeaseHistory(before time.Time) (int64, error) {
+	result, err := l.e.DB.Exec(`DELETE FROM "lease_log" WHERE "end" < ?`, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (l *leaseStore) searchLeaseLog(where string, values ...interface{}) ([]*LeaseHistory, error) {
+	sql := `SELECT "ip", "mac", "network", "start", "end", "hostname" FROM "lease_log" WHERE ` + where
+
+	rows, err := l.e.DB.Query(sql, values...)
 	if err != nil {
 		return nil, err
 	}
-	history := make([]models.LeaseHistory, len(leases))
-	for i, lease := range leases {
-		history[i] = &LeaseHistory{
-			IP:      lease.IP,
-			MAC:     lease.MAC,
-			Network: lease.Network,
-			Start:   lease.Start,
-			End:     lease.End,
+	defer rows.Close()
+
+	var results []*LeaseHistory
+	for rows.Next() {
+		var ip string
+		var macStr string
+		var network string
+		var start int64
+		var end int64
+		var hostname string
+
+		if err := rows.Scan(&ip, &macStr, &network, &start, &end, &hostname); err != nil {
+			l.e.Log.WithFields(verbose.Fields{
+				"error":   err,
+				"package": "models:leasestore",
+			}).Error("Failed to scan lease history into struct")
+			continue
+		}
+
+		mac, _ := net.ParseMAC(macStr)
+		results = append(results, &LeaseHistory{
+			IP:       net.ParseIP(ip),
+			MAC:      mac,
+			Network:  network,
+			Start:    time.Unix(start, 0),
+			End:      time.Unix(end, 0),
+			Hostname: hostname,
+		})
+	}
+	return results, rows.Err()
+}
+
+// mergeLeaseHistory combines lease history with current leases, newest first.
+// Current leases replace history entries of the same grant.
+func mergeLeaseHistory(history []*LeaseHistory, leases []*dhcp.Lease) []models.LeaseHistory {
+	grants := make(map[string]*LeaseHistory, len(history)+len(leases))
+	key := func(ip net.IP, mac net.HardwareAddr, start time.Time) string {
+		return fmt.Sprintf("%s|%s|%d", ip, mac, start.Unix())
+	}
+
+	for _, h := range history {
+		grants[key(h.IP, h.MAC, h.Start)] = h
+	}
+	for _, lease := range leases {
+		grants[key(lease.IP, lease.MAC, lease.Start)] = &LeaseHistory{
+			IP:       lease.IP,
+			MAC:      lease.MAC,
+			Network:  lease.Network,
+			Start:    lease.Start,
+			End:      lease.End,
+			Hostname: lease.Hostname,
 		}
 	}
-	return history, nil
+
+	merged := make([]models.LeaseHistory, 0, len(grants))
+	for _, g := range grants {
+		merged = append(merged, g)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].GetStartTime().After(merged[j].GetStartTime())
+	})
+	return merged
 }
 
 func (l *leaseStore) UpdateLease(lease *dhcp.Lease) error {
@@ -164,6 +329,7 @@ func (l *leaseStore) UpdateLease(lease *dhcp.Lease) error {
 	if err != nil {
 		return err
 	}
+	l.recordLeaseHistory(lease)
 	return nil
 }
 
@@ -14,7 +14,7 @@ import (
 	"github.com/packet-guardian/packet-guardian/src/common"
 )
 
-func TestLeaseSaveNoHistory(t *testing.T) {
+func TestLeaseSaveRecordsHistory(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
@@ -36,6 +36,9 @@ func TestLeaseSaveNoHistory(t *testing.T) {
 	mock.ExpectExec(`INSERT INTO "lease"`).
 		WithArgs("192.168.1.1", "ab:cd:ef:12:34:56", "main", lease.Start.Unix(), lease.End.Unix(), "something", false, false).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO "lease_log" (.+) ON DUPLICATE KEY UPDATE`).
+		WithArgs("192.168.1.1", "ab:cd:ef:12:34:56", "main", lease.Start.Unix(), lease.End.Unix(), "something").
+		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	if err := lease.Save(); err != nil {
 		t.Fatalf("Failed to save lease: %s", err)
@@ -46,11 +49,87 @@ func TestLeaseSaveNoHistory(t *testing.T) {
 	mock.ExpectExec(`UPDATE "lease"`).
 		WithArgs("ab:cd:ef:12:34:56", lease.Start.Unix(), lease.End.Unix(), "something", false, 1).
 		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "lease_log" (.+) ON DUPLICATE KEY UPDATE`).
+		WithArgs("192.168.1.1", "ab:cd:ef:12:34:56", "main", lease.Start.Unix(), lease.End.Unix(), "something").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	if err := lease.Save(); err != nil {
+		t.Fatalf("Failed to save lease: %s", err)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// A lease given to another device before the next snapshot must still be in
+// the history.
+func TestLeaseOverwrittenBetweenSnapshots(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	now := time.Now()
+
+	e := common.NewTestEnvironment()
+	e.DB = &common.DatabaseAccessor{DB: db}
+	store := newLeaseStore(e)
+
+	lease := dhcp.NewLease(store)
+	lease.ID = 1
+	lease.IP = net.ParseIP("192.168.1.1")
+	lease.MAC = net.HardwareAddr([]byte{0xab, 0xcd, 0xef, 0x12, 0x34, 0x56})
+	lease.Network = "main"
+	lease.Start = now.Add(-10 * time.Minute)
+	lease.End = now.Add(-2 * time.Minute)
+
+	firstStart, firstEnd := lease.Start.Unix(), lease.End.Unix()
+	mock.ExpectExec(`UPDATE "lease"`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "lease_log"`).
+		WithArgs("192.168.1.1", "ab:cd:ef:12:34:56", "main", firstStart, firstEnd, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	if err := lease.Save(); err != nil {
 		t.Fatalf("Failed to save lease: %s", err)
 	}
 
+	// The address is reused by another device
+	lease.MAC = net.HardwareAddr([]byte{0x12, 0x34, 0x56, 0xab, 0xcd, 0xef})
+	lease.Start = now.Add(-time.Minute)
+	lease.End = now.Add(time.Hour)
+
+	mock.ExpectExec(`UPDATE "lease"`).
+		WithArgs("12:34:56:ab:cd:ef", lease.Start.Unix(), lease.End.Unix(), "", false, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "lease_log"`).
+		WithArgs("192.168.1.1", "12:34:56:ab:cd:ef", "main", lease.Start.Unix(), lease.End.Unix(), "").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	if err := lease.Save(); err != nil {
+		t.Fatalf("Failed to save lease: %s", err)
+	}
+
+	// The first device is found from the history
+	at := now.Add(-5 * time.Minute)
+	mock.ExpectQuery(`SELECT (.+) FROM "lease_log" WHERE "ip" = \? AND "start" <= \? AND "end" >= \?`).
+		WithArgs("192.168.1.1", at.Unix(), at.Unix()).
+		WillReturnRows(sqlmock.NewRows([]string{"ip", "mac", "network", "start", "end", "hostname"}).
+			AddRow("192.168.1.1", "ab:cd:ef:12:34:56", "main", firstStart, firstEnd, ""))
+	mock.ExpectQuery(`SELECT (.+) FROM "lease" WHERE "ip" = \? AND "start" <= \? AND "end" >= \?`).
+		WithArgs("192.168.1.1", at.Unix(), at.Unix()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "ip", "mac", "network", "start", "end", "hostname", "abandoned", "registered"}))
+
+	owner, err := store.GetLeaseAt(net.ParseIP("192.168.1.1"), at)
+	if err != nil {
+		t.Fatalf("Failed to get lease: %s", err)
+	}
+	if owner == nil || owner.GetMAC().String() != "ab:cd:ef:12:34:56" {
+		t.Errorf("Expected the first device to own the address, got %v", owner)
+	}
+
 	// we make sure that all expectations were met
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -0,0 +1,91 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stores
+
+import (
+	"errors"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+)
+
+var appNoteStore NoteStore
+
+type NoteStore interface {
+	GetNotes(entity, key string) ([]*models.Note, error)
+	Save(n *models.Note) error
+}
+
+type noteStore struct {
+	e *common.Environment
+}
+
+func newNoteStore(e *common.Environment) *noteStore {
+	return &noteStore{
+		e: e,
+	}
+}
+
+func GetNoteStore(e *common.Environment) NoteStore {
+	if appNoteStore == nil {
+		appNoteStore = newNoteStore(e)
+	}
+	return appNoteStore
+}
+
+// GetNotes returns the notes log of a device or user, oldest first.
+func (s *noteStore) GetNotes(entity, key string) ([]*models.Note, error) {
+	sql := `SELECT "id", "author", "created", "text" FROM "note" WHERE "entity" = ? AND "entity_key" = ? ORDER BY "created" ASC, "id" ASC`
+
+	rows, err := s.e.DB.Query(sql, entity, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.Note
+	for rows.Next() {
+		var id int
+		var author string
+		var created int64
+		var text string
+
+		if err := rows.Scan(&id, &author, &created, &text); err != nil {
+			continue
+		}
+
+		n := models.NewNote(s, entity, key)
+		n.ID = id
+		n.Author = author
+		n.Created = time.Unix(created, 0)
+		n.Text = text
+
+		results = append(results, n)
+	}
+	return results, nil
+}
+
+// Save appends a note to the log. Notes are never updated or deleted.
+func (s *noteStore) Save(n *models.Note) error {
+	if n.ID != 0 {
+		return errors.New("Notes can't be changed")
+	}
+	if n.Text == "" {
+		return errors.New("Note text cannot be empty")
+	}
+	if n.Created.IsZero() {
+		n.Created = time.Now()
+	}
+
+	sql := `INSERT INTO "note" ("entity", "entity_key", "author", "created", "text") VALUES (?,?,?,?,?)`
+	result, err := s.e.DB.Exec(sql, n.Entity, n.Key, n.Author, n.Created.Unix(), n.Text)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	n.ID = int(id)
+	return nil
+}
@@ -0,0 +1,188 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stores
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+)
+
+var appPolicyStore PolicyStore
+
+type PolicyStore interface {
+	GetCurrentPolicy() (*models.Policy, error)
+	GetPolicies() ([]*models.Policy, error)
+	Save(p *models.Policy) error
+	GetAcceptance(username string, version int) (*models.PolicyAcceptance, error)
+	SaveAcceptance(a *models.PolicyAcceptance) error
+	GetAcceptanceCounts() (map[int]int, error)
+}
+
+type policyStore struct {
+	e *common.Environment
+}
+
+func newPolicyStore(e *common.Environment) *policyStore {
+	return &policyStore{
+		e: e,
+	}
+}
+
+func GetPolicyStore(e *common.Environment) PolicyStore {
+	if appPolicyStore == nil {
+		appPolicyStore = newPolicyStore(e)
+	}
+	return appPolicyStore
+}
+
+// GetCurrentPolicy returns the latest published policy. If no policy has been
+// published, the registration policy file is returned as version 0. The policy
+// isn't cached so versions published by other instances are seen right away.
+func (s *policyStore) GetCurrentPolicy() (*models.Policy, error) {
+	policies, err := s.getPoliciesFromDatabase(`ORDER BY "id" DESC LIMIT 1`)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(policies) > 0 {
+		return policies[0], nil
+	}
+
+	p := models.NewPolicy(s)
+	if text, err := os.ReadFile(s.e.Config.Registration.RegistrationPolicyFile); err == nil {
+		p.Text = string(text)
+	}
+	return p, nil
+}
+
+func (s *policyStore) GetPolicies() ([]*models.Policy, error) {
+	return s.getPoliciesFromDatabase(`ORDER BY "id" DESC`)
+}
+
+func (s *policyStore) getPoliciesFromDatabase(where string, values ...interface{}) ([]*models.Policy, error) {
+	sqlstmt := `SELECT "id", "text", "published", "published_by" FROM "policy" ` + where
+
+	rows, err := s.e.DB.Query(sqlstmt, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.Policy
+	for rows.Next() {
+		var id int
+		var text string
+		var published int64
+		var publishedBy string
+
+		if err := rows.Scan(&id, &text, &published, &publishedBy); err != nil {
+			continue
+		}
+
+		p := models.NewPolicy(s)
+		p.ID = id
+		p.Text = text
+		p.Published = time.Unix(published, 0)
+		p.PublishedBy = publishedBy
+
+		results = append(results, p)
+	}
+	return results, nil
+}
+
+// Save publishes a new policy version. Published versions can't be changed.
+func (s *policyStore) Save(p *models.Policy) error {
+	if p.ID != 0 {
+		return errors.New("Published policies can't be changed")
+	}
+	if p.Text == "" {
+		return errors.New("Policy text cannot be empty")
+	}
+	if p.Published.IsZero() {
+		p.Published = time.Now()
+	}
+
+	sql := `INSERT INTO "policy" ("text", "published", "published_by") VALUES (?,?,?)`
+	result, err := s.e.DB.Exec(sql, p.Text, p.Published.Unix(), p.PublishedBy)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	p.ID = int(id)
+	return nil
+}
+
+// GetAcceptance returns the user's acceptance of a policy version. The returned
+// acceptance has an ID of 0 if the user hasn't accepted the version.
+func (s *policyStore) GetAcceptance(username string, version int) (*models.PolicyAcceptance, error) {
+	sql := `SELECT "id", "accepted", "ip" FROM "policy_acceptance" WHERE "username" = ? AND "version" = ?`
+
+	a := &models.PolicyAcceptance{
+		Username: username,
+		Version:  version,
+	}
+
+	rows, err := s.e.DB.Query(sql, username, version)
+	if err != nil {
+		return a, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return a, nil
+	}
+
+	var accepted int64
+	if err := rows.Scan(&a.ID, &accepted, &a.IP); err != nil {
+		return a, err
+	}
+	a.Accepted = time.Unix(accepted, 0)
+	return a, nil
+}
+
+// SaveAcceptance records a new acceptance. Acceptances are never updated so
+// the first acceptance of a version is kept.
+func (s *policyStore) SaveAcceptance(a *models.PolicyAcceptance) error {
+	if a.ID != 0 {
+		return nil
+	}
+	if a.Username == "" {
+		return errors.New("Username cannot be empty")
+	}
+
+	sql := `INSERT INTO "policy_acceptance" ("username", "version", "accepted", "ip") VALUES (?,?,?,?)`
+	result, err := s.e.DB.Exec(sql, a.Username, a.Version, a.Accepted.Unix(), a.IP)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	a.ID = int(id)
+	return nil
+}
+
+// GetAcceptanceCounts returns the number of users who accepted each policy version.
+func (s *policyStore) GetAcceptanceCounts() (map[int]int, error) {
+	sql := `SELECT "version", COUNT(*) FROM "policy_acceptance" GROUP BY "version"`
+
+	rows, err := s.e.DB.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var version, count int
+		if err := rows.Scan(&version, &count); err != nil {
+			continue
+		}
+		counts[version] = count
+	}
+	return counts, nil
+}
@@ -0,0 +1,45 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stores
+
+import (
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+func TestGetCurrentPolicySeesOtherInstances(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	e := common.NewTestEnvironment()
+	e.DB = &common.DatabaseAccessor{DB: db}
+	store := newPolicyStore(e)
+
+	columns := []string{"id", "text", "published", "published_by"}
+	mock.ExpectQuery(`SELECT (.+) FROM "policy" ORDER BY "id" DESC LIMIT 1`).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "First", 1, "admin"))
+	// Version 2 is published by another instance
+	mock.ExpectQuery(`SELECT (.+) FROM "policy" ORDER BY "id" DESC LIMIT 1`).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(2, "Second", 2, "admin"))
+
+	for _, expected := range []int{1, 2} {
+		p, err := store.GetCurrentPolicy()
+		if err != nil {
+			t.Fatalf("Failed to get policy: %s", err)
+		}
+		if p.ID != expected {
+			t.Errorf("Expected policy version %d, got %d", expected, p.ID)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
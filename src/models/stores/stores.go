@@ -1,8 +1,17 @@
 package stores
 
 type StoreCollection struct {
-	Blacklist BlacklistStore
-	Devices   DeviceStore
-	Leases    LeaseStore
-	Users     UserStore
+	Blacklist    BlacklistStore
+	DeviceEvents DeviceEventStore
+	Devices      DeviceStore
+	JobRuns      JobRunStore
+	Leases       LeaseStore
+	Notes        NoteStore
+	Policies     PolicyStore
+	TaskLocks    TaskLockStore
+	Terms        TermStore
+	Transfers    TransferStore
+	Trash        TrashStore
+	Users        UserStore
+	Webhooks     WebhookStore
 }
@@ -0,0 +1,88 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stores
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+var appTaskLockStore TaskLockStore
+
+// TaskLockStore holds named locks shared by every instance using the
+// database. A lock expires unless its holder renews it so another instance
+// can take over when the holder dies.
+type TaskLockStore interface {
+	// Acquire takes the lock or renews it for ttl if it's already held by
+	// holder. It returns false if another holder has the lock.
+	Acquire(name, holder string, ttl time.Duration) (bool, error)
+	// Release gives up the lock if it's held by holder.
+	Release(name, holder string) error
+	// GetHolder returns the current holder of a lock and when it expires.
+	// The holder is empty if the lock isn't held.
+	GetHolder(name string) (string, time.Time, error)
+}
+
+type taskLockStore struct {
+	e *common.Environment
+}
+
+func newTaskLockStore(e *common.Environment) *taskLockStore {
+	return &taskLockStore{
+		e: e,
+	}
+}
+
+func GetTaskLockStore(e *common.Environment) TaskLockStore {
+	if appTaskLockStore == nil {
+		appTaskLockStore = newTaskLockStore(e)
+	}
+	return appTaskLockStore
+}
+
+func (s *taskLockStore) Acquire(name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	// MySQL assigns columns left to right so expires is only extended if
+	// holder has the lock after the first assignment.
+	sql := `INSERT INTO "task_lock" ("name", "holder", "expires") VALUES (?,?,?)
+		ON DUPLICATE KEY UPDATE
+		"holder" = IF("holder" = VALUES("holder") OR "expires" < ?, VALUES("holder"), "holder"),
+		"expires" = IF("holder" = VALUES("holder"), VALUES("expires"), "expires")`
+	if _, err := s.e.DB.Exec(sql, name, holder, now.Add(ttl).Unix(), now.Unix()); err != nil {
+		return false, err
+	}
+
+	current, _, err := s.GetHolder(name)
+	if err != nil {
+		return false, err
+	}
+	return current == holder, nil
+}
+
+func (s *taskLockStore) Release(name, holder string) error {
+	_, err := s.e.DB.Exec(`DELETE FROM "task_lock" WHERE "name" = ? AND "holder" = ?`, name, holder)
+	return err
+}
+
+func (s *taskLockStore) GetHolder(name string) (string, time.Time, error) {
+	var holder string
+	var expires int64
+
+	row := s.e.DB.QueryRow(`SELECT "holder", "expires" FROM "task_lock" WHERE "name" = ?`, name)
+	if err := row.Scan(&holder, &expires); err != nil {
+		if err == sql.ErrNoRows {
+			return "", time.Time{}, nil
+		}
+		return "", time.Time{}, err
+	}
+
+	if time.Now().Unix() > expires {
+		return "", time.Time{}, nil
+	}
+	return holder, time.Unix(expires, 0), nil
+}
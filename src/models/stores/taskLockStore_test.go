@@ -0,0 +1,47 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stores
+
+import (
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+func TestTaskLockAcquire(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	e := common.NewTestEnvironment()
+	e.DB = &common.DatabaseAccessor{DB: db}
+	store := newTaskLockStore(e)
+	expires := time.Now().Add(time.Minute).Unix()
+
+	for holder, expected := range map[string]bool{"web1:10": true, "web2:20": false} {
+		mock.ExpectExec(`INSERT INTO "task_lock" (.+) ON DUPLICATE KEY UPDATE`).
+			WithArgs("scheduler", holder, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`SELECT "holder", "expires" FROM "task_lock"`).
+			WithArgs("scheduler").
+			WillReturnRows(sqlmock.NewRows([]string{"holder", "expires"}).AddRow("web1:10", expires))
+
+		held, err := store.Acquire("scheduler", holder, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if held != expected {
+			t.Errorf("Expected %s to hold lock %t, got %t", holder, expected, held)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
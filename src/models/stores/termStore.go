@@ -0,0 +1,118 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stores
+
+import (
+	"errors"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+)
+
+var appTermStore TermStore
+
+type TermStore interface {
+	GetTerms() ([]*models.Term, error)
+	GetTermByID(id int) (*models.Term, error)
+	Save(t *models.Term) error
+	Delete(t *models.Term) error
+}
+
+type termStore struct {
+	e *common.Environment
+}
+
+func newTermStore(e *common.Environment) *termStore {
+	return &termStore{
+		e: e,
+	}
+}
+
+func GetTermStore(e *common.Environment) TermStore {
+	if appTermStore == nil {
+		appTermStore = newTermStore(e)
+	}
+	return appTermStore
+}
+
+func (s *termStore) GetTerms() ([]*models.Term, error) {
+	return s.getTermsFromDatabase(`ORDER BY "end" ASC`)
+}
+
+func (s *termStore) GetTermByID(id int) (*models.Term, error) {
+	terms, err := s.getTermsFromDatabase(`WHERE "id" = ?`, id)
+	if len(terms) == 0 {
+		return models.NewTerm(s), err
+	}
+	return terms[0], nil
+}
+
+func (s *termStore) getTermsFromDatabase(where string, values ...interface{}) ([]*models.Term, error) {
+	sqlstmt := `SELECT "id", "name", "cutoff", "end" FROM "term" ` + where
+
+	rows, err := s.e.DB.Query(sqlstmt, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.Term
+	for rows.Next() {
+		var id int
+		var name string
+		var cutoff int64
+		var end int64
+
+		if err := rows.Scan(&id, &name, &cutoff, &end); err != nil {
+			continue
+		}
+
+		t := models.NewTerm(s)
+		t.ID = id
+		t.Name = name
+		if cutoff > 0 {
+			t.Cutoff = time.Unix(cutoff, 0)
+		}
+		t.End = time.Unix(end, 0)
+
+		results = append(results, t)
+	}
+	return results, nil
+}
+
+func (s *termStore) Save(t *models.Term) error {
+	if t.Name == "" {
+		return errors.New("Term name cannot be empty")
+	}
+
+	var err error
+	if t.ID == 0 {
+		err = s.saveNew(t)
+	} else {
+		sql := `UPDATE "term" SET "name" = ?, "cutoff" = ?, "end" = ? WHERE "id" = ?`
+		_, err = s.e.DB.Exec(sql, t.Name, unixOrZero(t.Cutoff), t.End.Unix(), t.ID)
+	}
+	return err
+}
+
+func (s *termStore) saveNew(t *models.Term) error {
+	sql := `INSERT INTO "term" ("name", "cutoff", "end") VALUES (?,?,?)`
+	result, err := s.e.DB.Exec(sql, t.Name, unixOrZero(t.Cutoff), t.End.Unix())
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	t.ID = int(id)
+	return nil
+}
+
+func (s *termStore) Delete(t *models.Term) error {
+	if t.ID == 0 {
+		return nil
+	}
+	_, err := s.e.DB.Exec(`DELETE FROM "term" WHERE "id" = ?`, t.ID)
+	return err
+}
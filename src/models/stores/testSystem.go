@@ -3,6 +3,8 @@ package stores
 import (
 	"bytes"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/packet-guardian/dhcp-lib"
 	"github.com/packet-guardian/packet-guardian/src/common"
@@ -53,10 +55,40 @@ func (s *TestLeaseStore) DeleteLease(lease *dhcp.Lease) error { return nil }
 func (s *TestLeaseStore) SearchLeases(where string, vals ...interface{}) ([]*dhcp.Lease, error) {
 	return nil, nil
 }
-func (s *TestLeaseStore) GetLatestLease(mac net.HardwareAddr) models.LeaseHistory { return nil }
+func (s *TestLeaseStore) GetLatestLease(mac net.HardwareAddr) models.LeaseHistory {
+	var latest *dhcp.Lease
+	for _, l := range s.Leases {
+		if bytes.Equal(l.MAC, mac) && (latest == nil || l.End.After(latest.End)) {
+			latest = l
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+	return &LeaseHistory{IP: latest.IP, MAC: latest.MAC, Network: latest.Network, Start: latest.Start, End: latest.End, Hostname: latest.Hostname}
+}
+func (s *TestLeaseStore) GetLeaseAt(ip net.IP, t time.Time) (models.LeaseHistory, error) {
+	for _, l := range s.Leases {
+		if l.IP.Equal(ip) && !l.Start.After(t) && !l.End.Before(t) {
+			return &LeaseHistory{IP: l.IP, MAC: l.MAC, Network: l.Network, Start: l.Start, End: l.End, Hostname: l.Hostname}, nil
+		}
+	}
+	return nil, nil
+}
+func (s *TestLeaseStore) GetLeaseAtByMAC(mac net.HardwareAddr, t time.Time) (models.LeaseHistory, error) {
+	for _, l := range s.Leases {
+		if bytes.Equal(l.MAC, mac) && !l.Start.After(t) && !l.End.Before(t) {
+			return &LeaseHistory{IP: l.IP, MAC: l.MAC, Network: l.Network, Start: l.Start, End: l.End, Hostname: l.Hostname}, nil
+		}
+	}
+	return nil, nil
+}
+func (s *TestLeaseStore) SnapshotLeaseHistory() (int64, error)              { return 0, nil }
+func (s *TestLeaseStore) PurgeLeaseHistory(before time.Time) (int64, error) { return 0, nil }
 
 type TestUserStore struct {
 	Users []*models.User
+	Saved []*models.User
 }
 
 func (s *TestUserStore) GetUserByUsername(username string) (*models.User, error) {
@@ -76,6 +108,16 @@ func (s *TestUserStore) SearchUsersByField(field, pattern string) ([]*models.Use
 	return nil, nil
 }
 
+// Each ignores where and calls fn for every user.
+func (s *TestUserStore) Each(where string, fn func(*models.User) error, vals ...interface{}) error {
+	for _, u := range s.Users {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *TestUserStore) GetPassword(username string) (string, error) {
 	for _, u := range s.Users {
 		if u.Username == username {
@@ -84,7 +126,10 @@ func (s *TestUserStore) GetPassword(username string) (string, error) {
 	}
 	return "", nil
 }
-func (s *TestUserStore) Save(u *models.User) error                            { return nil }
+func (s *TestUserStore) Save(u *models.User) error {
+	s.Saved = append(s.Saved, u)
+	return nil
+}
 func (s *TestUserStore) Delete(u *models.User) error                          { return nil }
 func (s *TestUserStore) DeleteDelegate(u *models.User, delegate string) error { return nil }
 func (s *TestUserStore) GetDelegatedUsers(u *models.User) (map[string]models.Permission, error) {
@@ -93,6 +138,8 @@ func (s *TestUserStore) GetDelegatedUsers(u *models.User) (map[string]models.Per
 
 type TestDeviceStore struct {
 	Devices []*models.Device
+	Events  []*models.DeviceEvent
+	SaveErr error
 }
 
 func (s *TestDeviceStore) GetDeviceByMAC(mac net.HardwareAddr) (*models.Device, error) {
@@ -161,10 +208,26 @@ func (s *TestDeviceStore) GetAllDevices(e *common.Environment) ([]*models.Device
 func (s *TestDeviceStore) SearchDevicesByField(field, pattern string) ([]*models.Device, error) {
 	return nil, nil
 }
+
+// Search ignores where and returns every device.
 func (s *TestDeviceStore) Search(where string, vals ...interface{}) ([]*models.Device, error) {
-	return nil, nil
+	return s.Devices, nil
+}
+
+// Each ignores where and calls fn for every device.
+func (s *TestDeviceStore) Each(where string, fn func(*models.Device) error, vals ...interface{}) error {
+	for _, d := range s.Devices {
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 func (s *TestDeviceStore) Save(d *models.Device) error {
+	if s.SaveErr != nil {
+		return s.SaveErr
+	}
+
 	var dev *models.Device
 	for _, device := range s.Devices {
 		if bytes.Equal(device.MAC, d.MAC) {
@@ -191,6 +254,10 @@ func (s *TestDeviceStore) Delete(d *models.Device) error {
 	s.Devices = devs
 	return nil
 }
+func (s *TestDeviceStore) SaveEvent(e *models.DeviceEvent) error {
+	s.Events = append(s.Events, e)
+	return nil
+}
 func (s *TestDeviceStore) DeleteAllDeviceForUser(u *models.User) error {
 	devs := make([]*models.Device, 0, len(s.Devices)-1)
 	for _, device := range s.Devices {
@@ -222,3 +289,331 @@ func (b *TestBlacklistItem) Blacklist()                { b.Val = true }
 func (b *TestBlacklistItem) Unblacklist()              { b.Val = false }
 func (b *TestBlacklistItem) IsBlacklisted(string) bool { return b.Val }
 func (b *TestBlacklistItem) Save(string) error         { return nil }
+
+type TestTransferStore struct {
+	Transfers []*models.DeviceTransfer
+}
+
+func (s *TestTransferStore) GetTransferByID(id int) (*models.DeviceTransfer, error) {
+	for _, t := range s.Transfers {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return models.NewDeviceTransfer(s), nil
+}
+func (s *TestTransferStore) GetPendingTransferForDevice(mac net.HardwareAddr) (*models.DeviceTransfer, error) {
+	for _, t := range s.Transfers {
+		if bytes.Equal(t.MAC, mac) && t.IsPending() {
+			return t, nil
+		}
+	}
+	t := models.NewDeviceTransfer(s)
+	t.MAC = mac
+	return t, nil
+}
+func (s *TestTransferStore) GetPendingTransfersToUser(username string) ([]*models.DeviceTransfer, error) {
+	var transfers []*models.DeviceTransfer
+	for _, t := range s.Transfers {
+		if t.ToUser == username && t.IsPending() {
+			transfers = append(transfers, t)
+		}
+	}
+	return transfers, nil
+}
+func (s *TestTransferStore) GetPendingTransfersFromUser(username string) ([]*models.DeviceTransfer, error) {
+	var transfers []*models.DeviceTransfer
+	for _, t := range s.Transfers {
+		if t.FromUser == username && t.IsPending() {
+			transfers = append(transfers, t)
+		}
+	}
+	return transfers, nil
+}
+func (s *TestTransferStore) GetTransfersForDevice(mac net.HardwareAddr) ([]*models.DeviceTransfer, error) {
+	var transfers []*models.DeviceTransfer
+	for _, t := range s.Transfers {
+		if bytes.Equal(t.MAC, mac) {
+			transfers = append(transfers, t)
+		}
+	}
+	return transfers, nil
+}
+func (s *TestTransferStore) Save(t *models.DeviceTransfer) error {
+	if t.ID == 0 {
+		t.ID = len(s.Transfers) + 1
+		s.Transfers = append(s.Transfers, t)
+	}
+	return nil
+}
+
+type TestPolicyStore struct {
+	Policies    []*models.Policy
+	Acceptances []*models.PolicyAcceptance
+}
+
+func (s *TestPolicyStore) GetCurrentPolicy() (*models.Policy, error) {
+	if len(s.Policies) == 0 {
+		return models.NewPolicy(s), nil
+	}
+	return s.Policies[len(s.Policies)-1], nil
+}
+func (s *TestPolicyStore) GetPolicies() ([]*models.Policy, error) {
+	return s.Policies, nil
+}
+func (s *TestPolicyStore) Save(p *models.Policy) error {
+	if p.ID == 0 {
+		p.ID = len(s.Policies) + 1
+		s.Policies = append(s.Policies, p)
+	}
+	return nil
+}
+func (s *TestPolicyStore) GetAcceptance(username string, version int) (*models.PolicyAcceptance, error) {
+	for _, a := range s.Acceptances {
+		if a.Username == username && a.Version == version {
+			return a, nil
+		}
+	}
+	return &models.PolicyAcceptance{Username: username, Version: version}, nil
+}
+func (s *TestPolicyStore) SaveAcceptance(a *models.PolicyAcceptance) error {
+	if a.ID == 0 {
+		a.ID = len(s.Acceptances) + 1
+		s.Acceptances = append(s.Acceptances, a)
+	}
+	return nil
+}
+func (s *TestPolicyStore) GetAcceptanceCounts() (map[int]int, error) {
+	counts := make(map[int]int)
+	for _, a := range s.Acceptances {
+		counts[a.Version]++
+	}
+	return counts, nil
+}
+
+type TestNoteStore struct {
+	Notes []*models.Note
+}
+
+func (s *TestNoteStore) GetNotes(entity, key string) ([]*models.Note, error) {
+	var notes []*models.Note
+	for _, n := range s.Notes {
+		if n.Entity == entity && n.Key == key {
+			notes = append(notes, n)
+		}
+	}
+	return notes, nil
+}
+func (s *TestNoteStore) Save(n *models.Note) error {
+	if n.ID == 0 {
+		n.ID = len(s.Notes) + 1
+		s.Notes = append(s.Notes, n)
+	}
+	return nil
+}
+
+type TestDeviceEventStore struct {
+	Events []*models.DeviceEvent
+}
+
+func (s *TestDeviceEventStore) GetDeviceEvents(mac net.HardwareAddr) ([]*models.DeviceEvent, error) {
+	var events []*models.DeviceEvent
+	for _, e := range s.Events {
+		if bytes.Equal(e.MAC, mac) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+func (s *TestDeviceEventStore) SaveEvent(e *models.DeviceEvent) error {
+	if e.ID == 0 {
+		e.ID = len(s.Events) + 1
+		s.Events = append(s.Events, e)
+	}
+	return nil
+}
+
+type TestTrashStore struct {
+	Items []*models.TrashItem
+}
+
+func (s *TestTrashStore) GetTrash() ([]*models.TrashItem, error) {
+	return s.Items, nil
+}
+func (s *TestTrashStore) GetTrashItem(entity string, id int) (*models.TrashItem, error) {
+	for _, item := range s.Items {
+		if item.Entity == entity && item.ID == id {
+			return item, nil
+		}
+	}
+	return nil, nil
+}
+func (s *TestTrashStore) TrashDevices(where, deletedBy string, vals ...interface{}) (int64, error) {
+	return 0, nil
+}
+func (s *TestTrashStore) TrashUsers(where, deletedBy string, vals ...interface{}) (int64, error) {
+	return 0, nil
+}
+func (s *TestTrashStore) Restore(item *models.TrashItem, restoredBy string) error {
+	for i, t := range s.Items {
+		if t == item {
+			s.Items = append(s.Items[:i], s.Items[i+1:]...)
+			return nil
+		}
+	}
+	return ErrTrashItemNotFound
+}
+func (s *TestTrashStore) Purge(before time.Time, archive bool) (int64, error) {
+	return 0, nil
+}
+func (s *TestTrashStore) GetArchivedDevices(username string) ([]*models.ArchivedDevice, error) {
+	return nil, nil
+}
+
+type TestJobRunStore struct {
+	Runs []*models.JobRun
+}
+
+func (s *TestJobRunStore) GetJobRuns(job string, limit int) ([]*models.JobRun, error) {
+	var runs []*models.JobRun
+	for i := len(s.Runs) - 1; i >= 0 && len(runs) < limit; i-- {
+		if s.Runs[i].Job == job {
+			runs = append(runs, s.Runs[i])
+		}
+	}
+	return runs, nil
+}
+func (s *TestJobRunStore) GetJobStatus(job string) (*models.JobStatus, error) {
+	status := &models.JobStatus{Job: job}
+	for _, r := range s.Runs {
+		if r.Job != job {
+			continue
+		}
+		status.LastRun = r
+		if r.Failed() {
+			if status.FailingSince.IsZero() {
+				status.FailingSince = r.Started
+			}
+		} else {
+			status.LastSuccess = r.Started
+			status.FailingSince = time.Time{}
+		}
+	}
+	return status, nil
+}
+func (s *TestJobRunStore) SaveRun(r *models.JobRun) error {
+	if r.ID == 0 {
+		r.ID = len(s.Runs) + 1
+		s.Runs = append(s.Runs, r)
+	}
+	return nil
+}
+
+type testTaskLock struct {
+	holder  string
+	expires time.Time
+}
+
+type TestTaskLockStore struct {
+	mu    sync.Mutex
+	locks map[string]*testTaskLock
+}
+
+func (s *TestTaskLockStore) Acquire(name, holder string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locks == nil {
+		s.locks = make(map[string]*testTaskLock)
+	}
+	if l, ok := s.locks[name]; ok && l.holder != holder && time.Now().Before(l.expires) {
+		return false, nil
+	}
+	s.locks[name] = &testTaskLock{holder: holder, expires: time.Now().Add(ttl)}
+	return true, nil
+}
+func (s *TestTaskLockStore) Release(name, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.locks[name]; ok && l.holder == holder {
+		delete(s.locks, name)
+	}
+	return nil
+}
+func (s *TestTaskLockStore) GetHolder(name string) (string, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.locks[name]; ok && time.Now().Before(l.expires) {
+		return l.holder, l.expires, nil
+	}
+	return "", time.Time{}, nil
+}
+
+type TestWebhookStore struct {
+	mu         sync.Mutex
+	Deliveries []*models.WebhookDelivery
+}
+
+func (s *TestWebhookStore) Enqueue(d *models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d.ID = len(s.Deliveries) + 1
+	s.Deliveries = append(s.Deliveries, d)
+	return nil
+}
+func (s *TestWebhookStore) GetDue(now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*models.WebhookDelivery
+	for _, d := range s.Deliveries {
+		if len(due) < limit && d.Status == models.WebhookPending && !d.NextAttempt.After(now) {
+			due = append(due, d)
+		}
+	}
+	return due, nil
+}
+func (s *TestWebhookStore) GetDeliveries(status string, limit int) ([]*models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deliveries []*models.WebhookDelivery
+	for i := len(s.Deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if status == "" || s.Deliveries[i].Status == status {
+			deliveries = append(deliveries, s.Deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+func (s *TestWebhookStore) GetDelivery(id int) (*models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.Deliveries {
+		if d.ID == id {
+			return d, nil
+		}
+	}
+	return nil, nil
+}
+func (s *TestWebhookStore) SaveAttempt(d *models.WebhookDelivery) error { return nil }
+func (s *TestWebhookStore) Retry(id int) error {
+	d, _ := s.GetDelivery(id)
+	if d != nil {
+		s.mu.Lock()
+		d.Status = models.WebhookPending
+		d.Attempts = 0
+		d.NextAttempt = time.Now()
+		s.mu.Unlock()
+	}
+	return nil
+}
+func (s *TestWebhookStore) PurgeDeliveries(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var kept []*models.WebhookDelivery
+	for _, d := range s.Deliveries {
+		if d.Status == models.WebhookPending || !d.Created.Before(before) {
+			kept = append(kept, d)
+		}
+	}
+	purged := int64(len(s.Deliveries) - len(kept))
+	s.Deliveries = kept
+	return purged, nil
+}
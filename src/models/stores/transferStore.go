@@ -0,0 +1,180 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stores
+
+import (
+	"net"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+)
+
+var appTransferStore TransferStore
+
+type TransferStore interface {
+	GetTransferByID(id int) (*models.DeviceTransfer, error)
+	GetPendingTransferForDevice(mac net.HardwareAddr) (*models.DeviceTransfer, error)
+	GetPendingTransfersToUser(username string) ([]*models.DeviceTransfer, error)
+	GetPendingTransfersFromUser(username string) ([]*models.DeviceTransfer, error)
+	GetTransfersForDevice(mac net.HardwareAddr) ([]*models.DeviceTransfer, error)
+	Save(t *models.DeviceTransfer) error
+}
+
+type transferStore struct {
+	e *common.Environment
+}
+
+func newTransferStore(e *common.Environment) *transferStore {
+	return &transferStore{
+		e: e,
+	}
+}
+
+func GetTransferStore(e *common.Environment) TransferStore {
+	if appTransferStore == nil {
+		appTransferStore = newTransferStore(e)
+	}
+	return appTransferStore
+}
+
+func (s *transferStore) GetTransferByID(id int) (*models.DeviceTransfer, error) {
+	transfers, err := s.getTransfersFromDatabase(`WHERE "id" = ?`, id)
+	if len(transfers) == 0 {
+		return models.NewDeviceTransfer(s), err
+	}
+	return transfers[0], nil
+}
+
+func (s *transferStore) GetPendingTransferForDevice(mac net.HardwareAddr) (*models.DeviceTransfer, error) {
+	transfers, err := s.getTransfersFromDatabase(`WHERE "mac" = ? AND "status" = ?`, mac.String(), models.TransferPending)
+	if len(transfers) == 0 {
+		t := models.NewDeviceTransfer(s)
+		t.MAC = mac
+		return t, err
+	}
+	return transfers[0], nil
+}
+
+func (s *transferStore) GetPendingTransfersToUser(username string) ([]*models.DeviceTransfer, error) {
+	sql := `WHERE "to_user" = ? AND "status" = ? ORDER BY "created" ASC`
+	return s.getTransfersFromDatabase(sql, username, models.TransferPending)
+}
+
+func (s *transferStore) GetPendingTransfersFromUser(username string) ([]*models.DeviceTransfer, error) {
+	sql := `WHERE "from_user" = ? AND "status" = ? ORDER BY "created" ASC`
+	return s.getTransfersFromDatabase(sql, username, models.TransferPending)
+}
+
+func (s *transferStore) GetTransfersForDevice(mac net.HardwareAddr) ([]*models.DeviceTransfer, error) {
+	sql := `WHERE "mac" = ? ORDER BY "created" DESC`
+	return s.getTransfersFromDatabase(sql, mac.String())
+}
+
+func (s *transferStore) getTransfersFromDatabase(where string, values ...interface{}) ([]*models.DeviceTransfer, error) {
+	sqlstmt := `SELECT "id", "mac", "from_user", "to_user", "status", "created", "resolved", "resolved_by" FROM "device_transfer" ` + where
+
+	rows, err := s.e.DB.Query(sqlstmt, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.DeviceTransfer
+	for rows.Next() {
+		var id int
+		var macStr string
+		var fromUser string
+		var toUser string
+		var status string
+		var created int64
+		var resolved int64
+		var resolvedBy string
+
+		err := rows.Scan(
+			&id,
+			&macStr,
+			&fromUser,
+			&toUser,
+			&status,
+			&created,
+			&resolved,
+			&resolvedBy,
+		)
+		if err != nil {
+			continue
+		}
+
+		mac, _ := net.ParseMAC(macStr)
+
+		t := models.NewDeviceTransfer(s)
+		t.ID = id
+		t.MAC = mac
+		t.FromUser = fromUser
+		t.ToUser = toUser
+		t.Status = status
+		t.Created = time.Unix(created, 0)
+		if resolved > 0 {
+			t.Resolved = time.Unix(resolved, 0)
+		}
+		t.ResolvedBy = resolvedBy
+
+		results = append(results, t)
+	}
+	return results, nil
+}
+
+func (s *transferStore) Save(t *models.DeviceTransfer) error {
+	if t.ID == 0 {
+		return s.saveNew(t)
+	}
+	return s.updateExisting(t)
+}
+
+func (s *transferStore) updateExisting(t *models.DeviceTransfer) error {
+	sql := `UPDATE "device_transfer" SET "status" = ?, "resolved" = ?, "resolved_by" = ? WHERE "id" = ?`
+
+	_, err := s.e.DB.Exec(
+		sql,
+		t.Status,
+		unixOrZero(t.Resolved),
+		t.ResolvedBy,
+		t.ID,
+	)
+	return err
+}
+
+func (s *transferStore) saveNew(t *models.DeviceTransfer) error {
+	if t.Created.IsZero() {
+		t.Created = time.Now()
+	}
+
+	sql := `INSERT INTO "device_transfer" ("mac", "from_user", "to_user", "status", "created", "resolved", "resolved_by") VALUES (?,?,?,?,?,?,?)`
+
+	result, err := s.e.DB.Exec(
+		sql,
+		t.MAC.String(),
+		t.FromUser,
+		t.ToUser,
+		t.Status,
+		t.Created.Unix(),
+		unixOrZero(t.Resolved),
+		t.ResolvedBy,
+	)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	t.ID = int(id)
+	return nil
+}
+
+// unixOrZero returns the unix timestamp of t or 0 if t isn't set.
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
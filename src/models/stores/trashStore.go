@@ -0,0 +1,366 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stores
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+)
+
+// Columns copied between the device and user tables and their trash tables
+const (
+	deviceTrashColumns = `"id", "mac", "username", "registered_from", "platform", "expires", "date_registered", "user_agent", "description", "last_seen", "flagged", "notes", "attributes", "renewals", "policy_version", "policy_accepted", "tags", "flag_category", "flag_reason", "flagged_by", "flagged_at", "flag_clears"`
+	userTrashColumns   = `"id", "username", "password", "device_limit", "default_expiration", "expiration_type", "can_manage", "can_autoreg", "valid_start", "valid_end", "valid_forever", "ui_group", "api_group", "allow_status_api", "notes", "attributes", "category_limits", "email"`
+)
+
+// Columns copied from the trash tables to the archive tables. Passwords
+// aren't archived.
+const (
+	deviceArchiveColumns = deviceTrashColumns + `, "deleted", "deleted_by"`
+	userArchiveColumns   = `"id", "username", "device_limit", "default_expiration", "expiration_type", "can_manage", "can_autoreg", "valid_start", "valid_end", "valid_forever", "ui_group", "api_group", "allow_status_api", "notes", "attributes", "category_limits", "email", "deleted", "deleted_by"`
+)
+
+var (
+	// ErrTrashItemNotFound is returned when restoring an item that isn't in the trash.
+	ErrTrashItemNotFound = errors.New("Item not found in trash")
+	// ErrRestoreConflict is returned when the MAC address or username of a
+	// trashed item is in use again.
+	ErrRestoreConflict = errors.New("A device or user with the same MAC address or username already exists")
+)
+
+var appTrashStore TrashStore
+
+type TrashStore interface {
+	GetTrash() ([]*models.TrashItem, error)
+	GetTrashItem(entity string, id int) (*models.TrashItem, error)
+	TrashDevices(where, deletedBy string, vals ...interface{}) (int64, error)
+	TrashUsers(where, deletedBy string, vals ...interface{}) (int64, error)
+	Restore(item *models.TrashItem, restoredBy string) error
+	Purge(before time.Time, archive bool) (int64, error)
+	GetArchivedDevices(username string) ([]*models.ArchivedDevice, error)
+}
+
+type trashStore struct {
+	e      *common.Environment
+	events DeviceEventStore
+}
+
+func newTrashStore(e *common.Environment) *trashStore {
+	return &trashStore{
+		e:      e,
+		events: GetDeviceEventStore(e),
+	}
+}
+
+func GetTrashStore(e *common.Environment) TrashStore {
+	if appTrashStore == nil {
+		appTrashStore = newTrashStore(e)
+	}
+	return appTrashStore
+}
+
+// GetTrash returns all trashed devices and users, most recently deleted first.
+func (s *trashStore) GetTrash() ([]*models.TrashItem, error) {
+	devices, err := s.getTrashedDevices("")
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.getTrashedUsers("")
+	if err != nil {
+		return nil, err
+	}
+
+	items := append(devices, users...)
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Deleted.After(items[j].Deleted)
+	})
+	return items, nil
+}
+
+// GetTrashItem returns a trashed device or user by the ID it had before it
+// was deleted. A nil item is returned if it isn't in the trash.
+func (s *trashStore) GetTrashItem(entity string, id int) (*models.TrashItem, error) {
+	var items []*models.TrashItem
+	var err error
+
+	switch entity {
+	case models.TrashEntityDevice:
+		items, err = s.getTrashedDevices(`WHERE "id" = ?`, id)
+	case models.TrashEntityUser:
+		items, err = s.getTrashedUsers(`WHERE "id" = ?`, id)
+	}
+
+	if len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+func (s *trashStore) getTrashedDevices(where string, vals ...interface{}) ([]*models.TrashItem, error) {
+	sql := `SELECT "id", "mac", "username", "description", "deleted", "deleted_by" FROM "device_trash" ` + where
+
+	rows, err := s.e.DB.Query(sql, vals...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.TrashItem
+	for rows.Next() {
+		var id int
+		var mac string
+		var username string
+		var description string
+		var deleted int64
+		var deletedBy string
+
+		if err := rows.Scan(&id, &mac, &username, &description, &deleted, &deletedBy); err != nil {
+			continue
+		}
+
+		results = append(results, &models.TrashItem{
+			ID:          id,
+			Entity:      models.TrashEntityDevice,
+			Key:         mac,
+			Username:    username,
+			Description: description,
+			Deleted:     time.Unix(deleted, 0),
+			DeletedBy:   deletedBy,
+		})
+	}
+	return results, rows.Err()
+}
+
+func (s *trashStore) getTrashedUsers(where string, vals ...interface{}) ([]*models.TrashItem, error) {
+	sql := `SELECT "id", "username", "deleted", "deleted_by" FROM "user_trash" ` + where
+
+	rows, err := s.e.DB.Query(sql, vals...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.TrashItem
+	for rows.Next() {
+		var id int
+		var username string
+		var deleted int64
+		var deletedBy string
+
+		if err := rows.Scan(&id, &username, &deleted, &deletedBy); err != nil {
+			continue
+		}
+
+		results = append(results, &models.TrashItem{
+			ID:        id,
+			Entity:    models.TrashEntityUser,
+			Key:       username,
+			Username:  username,
+			Deleted:   time.Unix(deleted, 0),
+			DeletedBy: deletedBy,
+		})
+	}
+	return results, rows.Err()
+}
+
+// TrashDevices moves devices matching where to the trash and returns the
+// number of devices moved. Device events aren't recorded.
+func (s *trashStore) TrashDevices(where, deletedBy string, vals ...interface{}) (int64, error) {
+	return moveToTrash(s.e, "device", deviceTrashColumns, where, deletedBy, vals...)
+}
+
+// TrashUsers moves users matching where to the trash and returns the number
+// of users moved. Delegates are kept until the user is purged.
+func (s *trashStore) TrashUsers(where, deletedBy string, vals ...interface{}) (int64, error) {
+	return moveToTrash(s.e, "user", userTrashColumns, where, deletedBy, vals...)
+}
+
+// moveToTrash copies the rows of table matching where to its trash table
+// then deletes them in one transaction. A row already in the trash with the
+// same ID is replaced.
+func moveToTrash(e *common.Environment, table, columns, where, deletedBy string, vals ...interface{}) (int64, error) {
+	args := append([]interface{}{time.Now().Unix(), deletedBy}, vals...)
+
+	tx, err := e.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	sql := `REPLACE INTO "` + table + `_trash" (` + columns + `, "deleted", "deleted_by") SELECT ` + columns + `, ?, ? FROM "` + table + `" WHERE ` + where
+	if _, err := tx.Exec(sql, args...); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`DELETE FROM "`+table+`" WHERE `+where, vals...)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Restore moves a device or user out of the trash. ErrRestoreConflict is
+// returned if the MAC address or username has been used since it was deleted.
+func (s *trashStore) Restore(item *models.TrashItem, restoredBy string) error {
+	var table, columns, keyColumn string
+	switch item.Entity {
+	case models.TrashEntityDevice:
+		table, columns, keyColumn = "device", deviceTrashColumns, "mac"
+	case models.TrashEntityUser:
+		table, columns, keyColumn = "user", userTrashColumns, "username"
+	default:
+		return ErrTrashItemNotFound
+	}
+
+	tx, err := s.e.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inUse int
+	row := tx.QueryRow(`SELECT COUNT(*) FROM "`+table+`" WHERE "`+keyColumn+`" = ? OR "id" = ?`, item.Key, item.ID)
+	if err := row.Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse > 0 {
+		return ErrRestoreConflict
+	}
+
+	sql := `INSERT INTO "` + table + `" (` + columns + `) SELECT ` + columns + ` FROM "` + table + `_trash" WHERE "id" = ?`
+	result, err := tx.Exec(sql, item.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTrashItemNotFound
+	}
+
+	if _, err := tx.Exec(`DELETE FROM "`+table+`_trash" WHERE "id" = ?`, item.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if item.Entity == models.TrashEntityDevice {
+		s.recordRestored(item, restoredBy)
+	}
+	return nil
+}
+
+func (s *trashStore) recordRestored(item *models.TrashItem, restoredBy string) {
+	mac, err := net.ParseMAC(item.Key)
+	if err != nil {
+		return
+	}
+
+	event := models.NewDeviceEvent(s.events, mac, models.DeviceEventRestored)
+	event.Username = item.Username
+	event.ChangedBy = restoredBy
+	if err := event.Save(); err != nil {
+		s.e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "stores:trash",
+			"mac":     item.Key,
+		}).Error("Error saving device event")
+	}
+}
+
+// Purge permanently deletes devices and users trashed before a time and
+// returns the number of records deleted. If archive is true the records are
+// copied to the archive tables first.
+func (s *trashStore) Purge(before time.Time, archive bool) (int64, error) {
+	if archive {
+		if err := archiveTrash(s.e, "device", deviceArchiveColumns, before); err != nil {
+			return 0, err
+		}
+		if err := archiveTrash(s.e, "user", userArchiveColumns, before); err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := s.e.DB.Exec(`DELETE FROM "device_trash" WHERE "deleted" < ?`, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	devices, _ := result.RowsAffected()
+
+	sql := `DELETE FROM "account_delegate" WHERE "user_id" IN (SELECT "id" FROM "user_trash" WHERE "deleted" < ?)`
+	if _, err := s.e.DB.Exec(sql, before.Unix()); err != nil {
+		return devices, err
+	}
+
+	result, err = s.e.DB.Exec(`DELETE FROM "user_trash" WHERE "deleted" < ?`, before.Unix())
+	if err != nil {
+		return devices, err
+	}
+	users, _ := result.RowsAffected()
+	return devices + users, nil
+}
+
+// archiveTrash copies the rows of a trash table deleted before a time to its
+// archive table. Rows archived by an earlier run that failed to purge are
+// replaced.
+func archiveTrash(e *common.Environment, table, columns string, before time.Time) error {
+	sql := `REPLACE INTO "` + table + `_archive" (` + columns + `, "archived") SELECT ` + columns + `, ? FROM "` + table + `_trash" WHERE "deleted" < ?`
+	_, err := e.DB.Exec(sql, time.Now().Unix(), before.Unix())
+	return err
+}
+
+// GetArchivedDevices returns the archived devices registered to a user, most
+// recently deleted first.
+func (s *trashStore) GetArchivedDevices(username string) ([]*models.ArchivedDevice, error) {
+	sqlstmt := `SELECT "id", "mac", "username", "platform", "description", "date_registered", "last_seen", "deleted", "deleted_by", "archived"
+		FROM "device_archive" WHERE "username" = ? ORDER BY "deleted" DESC`
+
+	rows, err := s.e.DB.Query(sqlstmt, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.ArchivedDevice
+	for rows.Next() {
+		var id int
+		var mac string
+		var owner string
+		var platform sql.NullString
+		var description sql.NullString
+		var registered int64
+		var lastSeen int64
+		var deleted int64
+		var deletedBy string
+		var archived int64
+
+		if err := rows.Scan(&id, &mac, &owner, &platform, &description, &registered, &lastSeen, &deleted, &deletedBy, &archived); err != nil {
+			continue
+		}
+
+		results = append(results, &models.ArchivedDevice{
+			ID:          id,
+			MAC:         mac,
+			Username:    owner,
+			Platform:    platform.String,
+			Description: description.String,
+			Registered:  time.Unix(registered, 0),
+			LastSeen:    time.Unix(lastSeen, 0),
+			Deleted:     time.Unix(deleted, 0),
+			DeletedBy:   deletedBy,
+			Archived:    time.Unix(archived, 0),
+		})
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,141 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stores
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+)
+
+func TestTrashRestore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	e := common.NewTestEnvironment()
+	e.DB = &common.DatabaseAccessor{DB: db}
+	store := &trashStore{e: e, events: newDeviceEventStore(e)}
+
+	item := &models.TrashItem{
+		ID:       5,
+		Entity:   models.TrashEntityDevice,
+		Key:      "ab:cd:ef:12:34:56",
+		Username: "bob",
+	}
+
+	// The MAC address was registered again after the device was deleted
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM "device" WHERE "mac" = \? OR "id" = \?`).
+		WithArgs("ab:cd:ef:12:34:56", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	if err := store.Restore(item, "admin"); err != ErrRestoreConflict {
+		t.Fatalf("Expected restore conflict, got %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM "device"`).
+		WithArgs("ab:cd:ef:12:34:56", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(`INSERT INTO "device" (.+) SELECT (.+) FROM "device_trash" WHERE "id" = ?`).
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectExec(`DELETE FROM "device_trash" WHERE "id" = ?`).
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO "device_event"`).
+		WithArgs("ab:cd:ef:12:34:56", models.DeviceEventRestored, "bob", "admin", "", sqlmock.AnyArg(), "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := store.Restore(item, "admin"); err != nil {
+		t.Fatalf("Failed to restore device: %s", err)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestTrashDevicesRollsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	e := common.NewTestEnvironment()
+	e.DB = &common.DatabaseAccessor{DB: db}
+	store := &trashStore{e: e, events: newDeviceEventStore(e)}
+
+	// A failed delete must not leave the copy in the trash
+	mock.ExpectBegin()
+	mock.ExpectExec(`REPLACE INTO "device_trash" (.+) SELECT (.+) FROM "device" WHERE "username" = ?`).
+		WithArgs(sqlmock.AnyArg(), "admin", "bob").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM "device" WHERE "username" = ?`).
+		WithArgs("bob").
+		WillReturnError(errors.New("lock wait timeout"))
+	mock.ExpectRollback()
+
+	if _, err := store.TrashDevices(`"username" = ?`, "admin", "bob"); err == nil {
+		t.Fatal("Expected error from failed delete")
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestTrashPurgeArchives(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	e := common.NewTestEnvironment()
+	e.DB = &common.DatabaseAccessor{DB: db}
+	store := &trashStore{e: e, events: newDeviceEventStore(e)}
+	before := time.Unix(1000, 0)
+
+	mock.ExpectExec(`REPLACE INTO "device_archive" (.+) SELECT (.+) FROM "device_trash" WHERE "deleted" < ?`).
+		WithArgs(sqlmock.AnyArg(), 1000).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`REPLACE INTO "user_archive" \("id", "username", "device_limit"`).
+		WithArgs(sqlmock.AnyArg(), 1000).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "device_trash" WHERE "deleted" < ?`).
+		WithArgs(1000).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM "account_delegate"`).
+		WithArgs(1000).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM "user_trash" WHERE "deleted" < ?`).
+		WithArgs(1000).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	n, err := store.Purge(before, true)
+	if err != nil {
+		t.Fatalf("Failed to purge trash: %s", err)
+	}
+	if n != 3 {
+		t.Errorf("Expected 3 records purged, got %d", n)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -21,6 +21,7 @@ type UserStore interface {
 	GetUserByUsername(username string) (*models.User, error)
 	GetAllUsers() ([]*models.User, error)
 	SearchUsersByField(field, pattern string) ([]*models.User, error)
+	Each(where string, fn func(*models.User) error, vals ...interface{}) error
 	GetPassword(username string) (string, error)
 	Save(u *models.User) error
 	Delete(u *models.User) error
@@ -75,10 +76,33 @@ func (s *userStore) SearchUsersByField(field, pattern string) ([]*models.User, e
 	return s.getUsersFromDatabase(sql, "", pattern)
 }
 
+// Each calls fn for every user matching where, ordered by username. Users
+// are read one at a time so large result sets aren't held in memory. An empty
+// where matches all users. Iteration stops at the first error returned by fn.
+func (s *userStore) Each(where string, fn func(*models.User) error, vals ...interface{}) error {
+	if where != "" {
+		where = "WHERE " + where
+	}
+	return s.eachUserFromDatabase(where, `ORDER BY u."username" ASC`, fn, vals...)
+}
+
 func (s *userStore) getUsersFromDatabase(where string, order string, values ...interface{}) ([]*models.User, error) {
+	var results []*models.User
+	err := s.eachUserFromDatabase(where, order, func(u *models.User) error {
+		results = append(results, u)
+		return nil
+	}, values...)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *userStore) eachUserFromDatabase(where string, order string, fn func(*models.User) error, values ...interface{}) error {
 	sqlstmt := `SELECT u."id", u."username", u."password", u."device_limit", u."default_expiration",
 				u."expiration_type", u."can_manage", u."can_autoreg", u."valid_forever", u."valid_start",
-				u."valid_end", u."ui_group", u."api_group", u."allow_status_api", u."notes",
+				u."valid_end", u."ui_group", u."api_group", u."allow_status_api", u."notes", u."attributes",
+				u."category_limits", u."email",
 				GROUP_CONCAT(d."delegate") AS delegate_names,
 				GROUP_CONCAT(d."permissions") AS delegate_permissions,
 				(SELECT COUNT(*) FROM "device" WHERE "username" = u."username") as device_count
@@ -88,11 +112,10 @@ func (s *userStore) getUsersFromDatabase(where string, order string, values ...i
 
 	rows, err := s.e.DB.Query(sqlstmt, values...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var results []*models.User
 	for rows.Next() {
 		var id int
 		var username string
@@ -109,6 +132,9 @@ func (s *userStore) getUsersFromDatabase(where string, order string, values ...i
 		var apiGroup string
 		var allowStatusAPI bool
 		var notes sql.NullString
+		var attributes sql.NullString
+		var categoryLimits sql.NullString
+		var email string
 		var delegateNames sql.NullString
 		var delegatePermissions sql.NullString
 		var deviceCnt int
@@ -129,6 +155,9 @@ func (s *userStore) getUsersFromDatabase(where string, order string, values ...i
 			&apiGroup,
 			&allowStatusAPI,
 			&notes,
+			&attributes,
+			&categoryLimits,
+			&email,
 			&delegateNames,
 			&delegatePermissions,
 			&deviceCnt,
@@ -151,9 +180,16 @@ func (s *userStore) getUsersFromDatabase(where string, order string, values ...i
 		user.APIGroup = apiGroup
 		user.AllowStatusAPI = allowStatusAPI
 		user.DeviceCnt = deviceCnt
+		user.Email = email
 		if notes.Valid {
 			user.Notes = notes.String
 		}
+		if attributes.Valid {
+			user.Attributes = models.ParseAttributes(attributes.String)
+		}
+		if categoryLimits.Valid {
+			user.CategoryLimits = models.ParseCategoryLimits(categoryLimits.String)
+		}
 
 		if canManage {
 			user.Rights = user.Rights.With(models.ManageOwnRights)
@@ -182,9 +218,11 @@ func (s *userStore) getUsersFromDatabase(where string, order string, values ...i
 			}
 		}
 
-		results = append(results, user)
+		if err := fn(user); err != nil {
+			return err
+		}
 	}
-	return results, nil
+	return rows.Err()
 }
 
 func (s *userStore) GetPassword(username string) (string, error) {
@@ -202,7 +240,7 @@ func (s *userStore) Save(u *models.User) error {
 }
 
 func (s *userStore) updateExisting(u *models.User) error {
-	sql := `UPDATE "user" SET "device_limit"=?, "default_expiration"=?, "expiration_type"=?, "can_manage"=?, "can_autoreg"=?, "valid_forever"=?, "valid_start"=?, "valid_end"=?, "ui_group"=?, "api_group"=?, "allow_status_api"=?, "notes"=?`
+	sql := `UPDATE "user" SET "device_limit"=?, "default_expiration"=?, "expiration_type"=?, "can_manage"=?, "can_autoreg"=?, "valid_forever"=?, "valid_start"=?, "valid_end"=?, "ui_group"=?, "api_group"=?, "allow_status_api"=?, "notes"=?, "attributes"=?, "category_limits"=?, "email"=?`
 
 	if u.NeedToSavePassword() {
 		sql += ", \"password\" = ?"
@@ -226,6 +264,9 @@ func (s *userStore) updateExisting(u *models.User) error {
 			u.APIGroup,
 			u.AllowStatusAPI,
 			u.Notes,
+			u.Attributes.String(),
+			u.CategoryLimits.String(),
+			u.Email,
 			u.Password,
 			u.ID,
 		)
@@ -244,6 +285,9 @@ func (s *userStore) updateExisting(u *models.User) error {
 			u.APIGroup,
 			u.AllowStatusAPI,
 			u.Notes,
+			u.Attributes.String(),
+			u.CategoryLimits.String(),
+			u.Email,
 			u.ID,
 		)
 	}
@@ -259,7 +303,7 @@ func (s *userStore) saveNew(u *models.User) error {
 		return errors.New("Username cannot be empty")
 	}
 
-	sql := `INSERT INTO "user" ("username", "password", "device_limit", "default_expiration", "expiration_type", "can_manage", "can_autoreg", "valid_forever", "valid_start", "valid_end", "ui_group", "api_group", "allow_status_api", "notes") VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+	sql := `INSERT INTO "user" ("username", "password", "device_limit", "default_expiration", "expiration_type", "can_manage", "can_autoreg", "valid_forever", "valid_start", "valid_end", "ui_group", "api_group", "allow_status_api", "notes", "attributes", "category_limits", "email") VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
 
 	result, err := s.e.DB.Exec(
 		sql,
@@ -277,6 +321,9 @@ func (s *userStore) saveNew(u *models.User) error {
 		u.APIGroup,
 		u.AllowStatusAPI,
 		u.Notes,
+		u.Attributes.String(),
+		u.CategoryLimits.String(),
+		u.Email,
 	)
 	if err != nil {
 		return err
@@ -286,13 +333,14 @@ func (s *userStore) saveNew(u *models.User) error {
 	return s.saveDelegates(u)
 }
 
+// Delete moves a user to the trash. It can be restored until the trash is
+// purged.
 func (s *userStore) Delete(u *models.User) error {
 	if u.ID == 0 {
 		return nil
 	}
 
-	sql := `DELETE FROM "user" WHERE "id" = ?`
-	_, err := s.e.DB.Exec(sql, u.ID)
+	_, err := moveToTrash(s.e, "user", userTrashColumns, `"id" = ?`, u.ChangedBy, u.ID)
 	return err
 }
 
@@ -334,7 +382,7 @@ func (s *userStore) DeleteDelegate(u *models.User, delegate string) error {
 func (s *userStore) GetDelegatedUsers(u *models.User) (map[string]models.Permission, error) {
 	sqlstmt := `SELECT username, permissions
 				FROM account_delegate
-				LEFT JOIN user ON user_id = user.id
+				JOIN user ON user_id = user.id
 				WHERE delegate = ?`
 
 	rows, err := s.e.DB.Query(sqlstmt, u.Username)
@@ -0,0 +1,178 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stores
+
+import (
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+)
+
+var appWebhookStore WebhookStore
+
+type WebhookStore interface {
+	Enqueue(d *models.WebhookDelivery) error
+	GetDue(now time.Time, limit int) ([]*models.WebhookDelivery, error)
+	GetDeliveries(status string, limit int) ([]*models.WebhookDelivery, error)
+	GetDelivery(id int) (*models.WebhookDelivery, error)
+	SaveAttempt(d *models.WebhookDelivery) error
+	Retry(id int) error
+	PurgeDeliveries(before time.Time) (int64, error)
+}
+
+type webhookStore struct {
+	e *common.Environment
+}
+
+func newWebhookStore(e *common.Environment) *webhookStore {
+	return &webhookStore{
+		e: e,
+	}
+}
+
+func GetWebhookStore(e *common.Environment) WebhookStore {
+	if appWebhookStore == nil {
+		appWebhookStore = newWebhookStore(e)
+	}
+	return appWebhookStore
+}
+
+// Enqueue adds a delivery to the queue.
+func (s *webhookStore) Enqueue(d *models.WebhookDelivery) error {
+	sql := `INSERT INTO "webhook_delivery" ("endpoint", "event", "payload", "status", "attempts", "next_attempt", "response_code", "last_error", "created", "delivered") VALUES (?,?,?,?,?,?,?,?,?,?)`
+	result, err := s.e.DB.Exec(sql,
+		d.Endpoint,
+		d.Event,
+		d.Payload,
+		d.Status,
+		d.Attempts,
+		d.NextAttempt.Unix(),
+		d.ResponseCode,
+		d.LastError,
+		d.Created.Unix(),
+		unixOrZero(d.Delivered),
+	)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	d.ID = int(id)
+	return nil
+}
+
+// GetDue returns pending deliveries whose next attempt is at or before now,
+// oldest first.
+func (s *webhookStore) GetDue(now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	return s.getDeliveriesFromDatabase(`WHERE "status" = ? AND "next_attempt" <= ? ORDER BY "next_attempt", "id" LIMIT ?`,
+		models.WebhookPending, now.Unix(), limit)
+}
+
+// GetDeliveries returns the most recent deliveries, newest first. An empty
+// status returns deliveries of any status.
+func (s *webhookStore) GetDeliveries(status string, limit int) ([]*models.WebhookDelivery, error) {
+	if status == "" {
+		return s.getDeliveriesFromDatabase(`ORDER BY "id" DESC LIMIT ?`, limit)
+	}
+	return s.getDeliveriesFromDatabase(`WHERE "status" = ? ORDER BY "id" DESC LIMIT ?`, status, limit)
+}
+
+// GetDelivery returns a single delivery. If it doesn't exist, nil is returned.
+func (s *webhookStore) GetDelivery(id int) (*models.WebhookDelivery, error) {
+	deliveries, err := s.getDeliveriesFromDatabase(`WHERE "id" = ?`, id)
+	if err != nil || len(deliveries) == 0 {
+		return nil, err
+	}
+	return deliveries[0], nil
+}
+
+func (s *webhookStore) getDeliveriesFromDatabase(where string, values ...interface{}) ([]*models.WebhookDelivery, error) {
+	sql := `SELECT "id", "endpoint", "event", "payload", "status", "attempts", "next_attempt", "response_code", "last_error", "created", "delivered" FROM "webhook_delivery" ` + where
+
+	rows, err := s.e.DB.Query(sql, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.WebhookDelivery
+	for rows.Next() {
+		var id int
+		var endpoint string
+		var event string
+		var payload string
+		var status string
+		var attempts int
+		var nextAttempt int64
+		var responseCode int
+		var lastError string
+		var created int64
+		var delivered int64
+
+		if err := rows.Scan(
+			&id,
+			&endpoint,
+			&event,
+			&payload,
+			&status,
+			&attempts,
+			&nextAttempt,
+			&responseCode,
+			&lastError,
+			&created,
+			&delivered,
+		); err != nil {
+			continue
+		}
+
+		d := models.NewWebhookDelivery(endpoint, event, payload)
+		d.ID = id
+		d.Status = status
+		d.Attempts = attempts
+		d.NextAttempt = time.Unix(nextAttempt, 0)
+		d.ResponseCode = responseCode
+		d.LastError = lastError
+		d.Created = time.Unix(created, 0)
+		if delivered > 0 {
+			d.Delivered = time.Unix(delivered, 0)
+		}
+		results = append(results, d)
+	}
+	return results, rows.Err()
+}
+
+// SaveAttempt records the outcome of a delivery attempt.
+func (s *webhookStore) SaveAttempt(d *models.WebhookDelivery) error {
+	sql := `UPDATE "webhook_delivery" SET "status" = ?, "attempts" = ?, "next_attempt" = ?, "response_code" = ?, "last_error" = ?, "delivered" = ? WHERE "id" = ?`
+	_, err := s.e.DB.Exec(sql,
+		d.Status,
+		d.Attempts,
+		d.NextAttempt.Unix(),
+		d.ResponseCode,
+		d.LastError,
+		unixOrZero(d.Delivered),
+		d.ID,
+	)
+	return err
+}
+
+// Retry requeues a delivery to be sent on the next delivery run with a
+// fresh set of attempts.
+func (s *webhookStore) Retry(id int) error {
+	sql := `UPDATE "webhook_delivery" SET "status" = ?, "attempts" = 0, "next_attempt" = ? WHERE "id" = ?`
+	_, err := s.e.DB.Exec(sql, models.WebhookPending, time.Now().Unix(), id)
+	return err
+}
+
+// PurgeDeliveries deletes finished deliveries created before the given time.
+// Pending deliveries are kept.
+func (s *webhookStore) PurgeDeliveries(before time.Time) (int64, error) {
+	sql := `DELETE FROM "webhook_delivery" WHERE "status" != ? AND "created" < ?`
+	result, err := s.e.DB.Exec(sql, models.WebhookPending, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,94 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stores
+
+import (
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+)
+
+var webhookDeliveryCols = []string{
+	"id", "endpoint", "event", "payload", "status", "attempts",
+	"next_attempt", "response_code", "last_error", "created", "delivered",
+}
+
+func TestWebhookEnqueueAndGetDue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	e := common.NewTestEnvironment()
+	e.DB = &common.DatabaseAccessor{DB: db}
+	store := newWebhookStore(e)
+
+	d := models.NewWebhookDelivery("siem", common.WebhookDeviceFlagged, `{"event":"device.flagged"}`)
+	mock.ExpectExec(`INSERT INTO "webhook_delivery"`).
+		WithArgs("siem", common.WebhookDeviceFlagged, `{"event":"device.flagged"}`, models.WebhookPending, 0,
+			d.NextAttempt.Unix(), 0, "", d.Created.Unix(), 0).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+
+	if err := store.Enqueue(d); err != nil {
+		t.Fatal(err)
+	}
+	if d.ID != 7 {
+		t.Errorf("Expected ID 7, got %d", d.ID)
+	}
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT (.+) FROM "webhook_delivery" WHERE "status" = \? AND "next_attempt" <= \?`).
+		WithArgs(models.WebhookPending, now.Unix(), 10).
+		WillReturnRows(sqlmock.NewRows(webhookDeliveryCols).
+			AddRow(7, "siem", common.WebhookDeviceFlagged, `{}`, models.WebhookPending, 2, now.Unix(), 500, "bad gateway", now.Unix(), 0))
+
+	due, err := store.GetDue(now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 {
+		t.Fatalf("Expected 1 due delivery, got %d", len(due))
+	}
+	if due[0].Attempts != 2 || due[0].ResponseCode != 500 || !due[0].Delivered.IsZero() {
+		t.Errorf("Delivery not loaded correctly: %#v", due[0])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWebhookPurgeKeepsPending(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	e := common.NewTestEnvironment()
+	e.DB = &common.DatabaseAccessor{DB: db}
+	store := newWebhookStore(e)
+
+	before := time.Now().Add(-time.Hour)
+	mock.ExpectExec(`DELETE FROM "webhook_delivery" WHERE "status" != \? AND "created" < \?`).
+		WithArgs(models.WebhookPending, before.Unix()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	purged, err := store.PurgeDeliveries(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 3 {
+		t.Errorf("Expected 3 purged, got %d", purged)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
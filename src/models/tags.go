@@ -0,0 +1,36 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// Tags are free form labels admins attach to devices. Tags are lowercase
+// and can't contain commas.
+type Tags []string
+
+// ParseTags parses a comma separated list of tags. Duplicates and empty tags
+// are removed.
+func ParseTags(s string) Tags {
+	seen := make(map[string]bool)
+	t := make(Tags, 0)
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		t = append(t, tag)
+	}
+	sort.Strings(t)
+	return t
+}
+
+// String encodes the tags as a comma separated list for storage in the database.
+func (t Tags) String() string {
+	return strings.Join(t, ",")
+}
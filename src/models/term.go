@@ -0,0 +1,92 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type TermStore interface {
+	Save(*Term) error
+	Delete(*Term) error
+}
+
+// Term is an academic term in the calendar used by the term expiration mode.
+// Devices registered before the cutoff expire at the end of the term,
+// later registrations roll over to the next term.
+type Term struct {
+	store  TermStore
+	ID     int       `json:"id"`
+	Name   string    `json:"name"`
+	Cutoff time.Time `json:"cutoff"`
+	End    time.Time `json:"end"`
+}
+
+func NewTerm(s TermStore) *Term {
+	return &Term{store: s}
+}
+
+// CutoffTime returns the time after which registrations roll to the next term.
+// Terms without a cutoff use the end of the term.
+func (t *Term) CutoffTime() time.Time {
+	if t.Cutoff.IsZero() {
+		return t.End
+	}
+	return t.Cutoff
+}
+
+func (t *Term) Save() error {
+	return t.store.Save(t)
+}
+
+func (t *Term) Delete() error {
+	return t.store.Delete(t)
+}
+
+// TermCalendar loads the academic terms.
+type TermCalendar interface {
+	GetTerms() ([]*Term, error)
+}
+
+var termCalendar struct {
+	sync.RWMutex
+	calendar TermCalendar
+}
+
+// SetTermCalendar sets where terms are loaded from to calculate term
+// expirations. Terms are loaded for each expiration so changes made by
+// other instances are used right away.
+func SetTermCalendar(c TermCalendar) {
+	termCalendar.Lock()
+	termCalendar.calendar = c
+	termCalendar.Unlock()
+}
+
+// TermFor returns the term a device registered at base belongs to. Nil is
+// returned if the calendar has no term with a cutoff after base.
+func TermFor(base time.Time) (*Term, error) {
+	termCalendar.RLock()
+	calendar := termCalendar.calendar
+	termCalendar.RUnlock()
+
+	if calendar == nil {
+		return nil, nil
+	}
+
+	terms, err := calendar.GetTerms()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(terms, func(i, j int) bool { return terms[i].End.Before(terms[j].End) })
+
+	for _, t := range terms {
+		if base.Before(t.CutoffTime()) {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,98 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+// testTermCalendar is a term calendar kept in memory.
+type testTermCalendar struct {
+	terms []*Term
+}
+
+func (c *testTermCalendar) GetTerms() ([]*Term, error) {
+	terms := make([]*Term, len(c.terms))
+	copy(terms, c.terms)
+	return terms, nil
+}
+
+func TestTermExpiration(t *testing.T) {
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(2026, month, day, 0, 0, 0, 0, time.Local)
+	}
+
+	fall := &Term{Name: "Fall", Cutoff: date(time.November, 1), End: date(time.December, 18)}
+	spring := &Term{Name: "Spring", Cutoff: date(time.April, 1), End: date(time.May, 8)}
+	winter := &Term{Name: "Winter", End: date(time.January, 10)}
+	calendar := &testTermCalendar{terms: []*Term{fall, spring}}
+	SetTermCalendar(calendar)
+	defer SetTermCalendar(nil)
+
+	// A term added after the calendar was set, such as by another instance
+	calendar.terms = append(calendar.terms, winter)
+
+	exp := &UserDeviceExpiration{Mode: UserDeviceExpirationTerm}
+	e := common.NewTestEnvironment()
+
+	tests := []struct {
+		base     time.Time
+		expected time.Time
+	}{
+		{date(time.January, 2), winter.End},
+		{date(time.January, 10), spring.End},
+		{date(time.March, 31), spring.End},
+		{date(time.April, 1), fall.End},
+		{date(time.October, 31), fall.End},
+		{date(time.November, 1), time.Unix(0, 0)},
+	}
+
+	for _, test := range tests {
+		if next := exp.NextExpiration(e, test.base); !next.Equal(test.expected) {
+			t.Errorf("Base %s: expected %s, got %s", test.base, test.expected, next)
+		}
+	}
+}
+
+func TestTermExpirationFallback(t *testing.T) {
+	spring := &Term{Name: "Spring", Cutoff: time.Date(2026, time.April, 1, 0, 0, 0, 0, time.Local), End: time.Date(2026, time.May, 8, 0, 0, 0, 0, time.Local)}
+	SetTermCalendar(&testTermCalendar{terms: []*Term{spring}})
+	defer SetTermCalendar(nil)
+	defer func() { globalDeviceExpiration = nil }()
+
+	base := time.Date(2026, time.April, 2, 0, 0, 0, 0, time.Local)
+	e := common.NewTestEnvironment()
+
+	tests := []struct {
+		expType  string
+		exp      string
+		expected time.Time
+	}{
+		{"term", "720h", base.Add(720 * time.Hour)},
+		{"duration", "24h", base.Add(24 * time.Hour)},
+		{"never", "", time.Unix(0, 0)},
+	}
+
+	for _, test := range tests {
+		globalDeviceExpiration = nil
+		e.Config.Registration.DefaultDeviceExpirationType = test.expType
+		e.Config.Registration.DefaultDeviceExpiration = test.exp
+
+		global := &UserDeviceExpiration{Mode: UserDeviceExpirationGlobal}
+		user := &UserDeviceExpiration{Mode: UserDeviceExpirationTerm}
+		if next := user.NextExpiration(e, base); !next.Equal(test.expected) {
+			t.Errorf("Global %s: expected %s for a user, got %s", test.expType, test.expected, next)
+		}
+		if test.expType != "term" {
+			continue
+		}
+		if next := global.NextExpiration(e, base); !next.Equal(test.expected) {
+			t.Errorf("Global %s: expected %s, got %s", test.expType, test.expected, next)
+		}
+	}
+}
@@ -13,6 +13,7 @@ type TestDeviceStore struct{}
 func (s *TestDeviceStore) Save(d *Device) error                 { return nil }
 func (s *TestDeviceStore) Delete(d *Device) error               { return nil }
 func (s *TestDeviceStore) DeleteAllDeviceForUser(u *User) error { return nil }
+func (s *TestDeviceStore) SaveEvent(e *DeviceEvent) error       { return nil }
 
 type TestLeaseStore struct{}
 
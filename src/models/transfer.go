@@ -0,0 +1,74 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"encoding/json"
+	"net"
+	"time"
+)
+
+// Device transfer states
+const (
+	TransferPending   = "pending"
+	TransferAccepted  = "accepted"
+	TransferDeclined  = "declined"
+	TransferCancelled = "cancelled"
+)
+
+type DeviceTransferStore interface {
+	Save(*DeviceTransfer) error
+}
+
+// DeviceTransfer is an offer from a device owner to give a device to another user.
+// Resolved transfers are kept as a record of the exchange.
+type DeviceTransfer struct {
+	store      DeviceTransferStore
+	ID         int              `json:"id"`
+	MAC        net.HardwareAddr `json:"-"`
+	FromUser   string           `json:"from_user"`
+	ToUser     string           `json:"to_user"`
+	Status     string           `json:"status"`
+	Created    time.Time        `json:"-"`
+	Resolved   time.Time        `json:"-"`
+	ResolvedBy string           `json:"resolved_by"`
+}
+
+func NewDeviceTransfer(s DeviceTransferStore) *DeviceTransfer {
+	return &DeviceTransfer{
+		store:  s,
+		Status: TransferPending,
+	}
+}
+
+func (t *DeviceTransfer) MarshalJSON() ([]byte, error) {
+	type Alias DeviceTransfer
+	return json.Marshal(&struct {
+		*Alias
+		MAC      string    `json:"mac"`
+		Created  time.Time `json:"created"`
+		Resolved time.Time `json:"resolved"`
+	}{
+		Alias:    (*Alias)(t),
+		MAC:      t.MAC.String(),
+		Created:  t.Created.UTC(),
+		Resolved: t.Resolved.UTC(),
+	})
+}
+
+func (t *DeviceTransfer) IsPending() bool {
+	return t.Status == TransferPending
+}
+
+// Resolve sets the final status of the transfer.
+func (t *DeviceTransfer) Resolve(status, by string) {
+	t.Status = status
+	t.ResolvedBy = by
+	t.Resolved = time.Now()
+}
+
+func (t *DeviceTransfer) Save() error {
+	return t.store.Save(t)
+}
@@ -0,0 +1,84 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Entities that can be in the trash
+const (
+	TrashEntityDevice = "device"
+	TrashEntityUser   = "user"
+)
+
+// TrashItem is a deleted device or user that can be restored until it's
+// purged. Key is the device MAC address or the username. ID is the ID the
+// record had before it was deleted and is kept when it's restored.
+type TrashItem struct {
+	ID          int       `json:"id"`
+	Entity      string    `json:"entity"`
+	Key         string    `json:"key"`
+	Username    string    `json:"username"`
+	Description string    `json:"description"`
+	Deleted     time.Time `json:"-"`
+	DeletedBy   string    `json:"deleted_by"`
+}
+
+func (t *TrashItem) MarshalJSON() ([]byte, error) {
+	type Alias TrashItem
+	return json.Marshal(&struct {
+		*Alias
+		Deleted time.Time `json:"deleted"`
+	}{
+		Alias:   (*Alias)(t),
+		Deleted: t.Deleted.UTC(),
+	})
+}
+
+// ArchivedDevice is a device purged from the trash while archiving was
+// enabled. Archived devices are kept as a record and can't be restored.
+type ArchivedDevice struct {
+	ID          int       `json:"id"`
+	MAC         string    `json:"mac"`
+	Username    string    `json:"username"`
+	Platform    string    `json:"platform"`
+	Description string    `json:"description"`
+	Registered  time.Time `json:"-"`
+	LastSeen    time.Time `json:"-"`
+	Deleted     time.Time `json:"-"`
+	DeletedBy   string    `json:"deleted_by"`
+	Archived    time.Time `json:"-"`
+}
+
+func (d *ArchivedDevice) MarshalJSON() ([]byte, error) {
+	type Alias ArchivedDevice
+	return json.Marshal(&struct {
+		*Alias
+		Registered time.Time `json:"registered"`
+		LastSeen   time.Time `json:"last_seen"`
+		Deleted    time.Time `json:"deleted"`
+		Archived   time.Time `json:"archived"`
+	}{
+		Alias:      (*Alias)(d),
+		Registered: d.Registered.UTC(),
+		LastSeen:   d.LastSeen.UTC(),
+		Deleted:    d.Deleted.UTC(),
+		Archived:   d.Archived.UTC(),
+	})
+}
+
+// TrashPermission returns the permission needed to see and restore trashed
+// items of an entity. It's the same permission needed to delete them.
+func TrashPermission(entity string) Permission {
+	switch entity {
+	case TrashEntityDevice:
+		return DeleteDevice
+	case TrashEntityUser:
+		return DeleteUser
+	}
+	return AdminRights
+}
@@ -6,6 +6,7 @@ package models
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -31,6 +32,7 @@ type User struct {
 	savePassword     bool
 	ClearPassword    bool                  `json:"-"`
 	DeviceLimit      UserDeviceLimit       `json:"device_limit"`
+	CategoryLimits   CategoryLimits        `json:"category_limits"`
 	DeviceExpiration *UserDeviceExpiration `json:"device_expiration"`
 	ValidStart       time.Time             `json:"-"`
 	ValidEnd         time.Time             `json:"-"`
@@ -45,7 +47,12 @@ type User struct {
 	AllowStatusAPI bool                  `json:"-"`
 	Delegates      map[string]Permission `json:"delegates"`
 	Notes          string                `json:"notes"`
+	Email          string                `json:"email"`
+	Attributes     Attributes            `json:"attributes"`
 	DeviceCnt      int                   `json:"-"`
+
+	// ChangedBy is recorded as the user who deleted the account
+	ChangedBy string `json:"-"`
 }
 
 // NewUser creates a new base user
@@ -61,6 +68,7 @@ func NewUser(e *common.Environment, us UserStore, b BlacklistItem, username stri
 		store:            us,
 		Username:         username,
 		DeviceLimit:      UserDeviceLimitGlobal,
+		CategoryLimits:   make(CategoryLimits),
 		DeviceExpiration: &UserDeviceExpiration{Mode: UserDeviceExpirationGlobal},
 		ValidStart:       time.Unix(0, 0),
 		ValidEnd:         time.Unix(0, 0),
@@ -71,6 +79,7 @@ func NewUser(e *common.Environment, us UserStore, b BlacklistItem, username stri
 		UIGroup:          "default",
 		APIGroup:         "disabled",
 		Delegates:        make(map[string]Permission),
+		Attributes:       make(Attributes),
 	}
 	// Load extra rights as set in the configuration
 	u.LoadRights()
@@ -104,6 +113,31 @@ func (u *User) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// EmailAddress returns the address used to contact the user. Users without
+// an address are emailed at the configured user domain.
+func (u *User) EmailAddress() string {
+	if u.Email != "" {
+		return u.Email
+	}
+	if strings.Contains(u.Username, "@") {
+		return u.Username
+	}
+	if u.e != nil && u.e.Config.Email.UserDomain != "" {
+		return u.Username + "@" + u.e.Config.Email.UserDomain
+	}
+	return ""
+}
+
+// DeviceCategoryLimit returns the user's device limit for category. A user
+// override takes precedence over the limit for the user's UI group.
+// A limit of 0 is unlimited.
+func (u *User) DeviceCategoryLimit(category common.DeviceCategory) int {
+	if limit, ok := u.CategoryLimits[category.Name]; ok {
+		return limit
+	}
+	return category.LimitFor(u.UIGroup)
+}
+
 func (u *User) IsNew() bool {
 	return (u.ID == 0 || u.Username == "")
 }
@@ -0,0 +1,214 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"errors"
+	"net/mail"
+	"strconv"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+// ErrPermissionDenied is returned when the editor isn't allowed to make a change.
+var ErrPermissionDenied = errors.New("Permission denied")
+
+// UIGroups and APIGroups are the valid permission groups.
+var (
+	UIGroups  = []string{"default", "admin", "helpdesk", "readonly"}
+	APIGroups = []string{"disable", "readonly-api", "readwrite-api"}
+)
+
+// ApplyValues validates and applies user settings as submitted to the user
+// API. get returns a value by its API field name and false if the field wasn't
+// given, fields not given are left unchanged. Changing permission groups
+// requires the editor to have EditUserPermissions. The returned bool is true
+// if the default device expiration changed and existing devices should be
+// updated. Delegates and custom fields aren't handled.
+func (u *User) ApplyValues(editor *User, get func(string) (string, bool)) (bool, error) {
+	value := func(name string) string {
+		v, _ := get(name)
+		return v
+	}
+
+	// Permission groups
+	uiGroup, apiGroup, allowStatusAPI := u.UIGroup, u.APIGroup, u.AllowStatusAPI
+	if v, ok := get("ui_group"); ok {
+		uiGroup = v
+	}
+	if v, ok := get("api_group"); ok {
+		apiGroup = v
+	}
+	if v, ok := get("allow_status_api"); ok {
+		allowStatusAPI = v == "1"
+	}
+	if (u.UIGroup != uiGroup || u.APIGroup != apiGroup || u.AllowStatusAPI != allowStatusAPI) && !editor.Can(EditUserPermissions) {
+		return false, ErrPermissionDenied
+	}
+
+	if _, ok := get("ui_group"); ok {
+		if !common.StringInSlice(uiGroup, UIGroups) {
+			return false, errors.New("Unknown ui group")
+		}
+		u.UIGroup = uiGroup
+	}
+	if _, ok := get("api_group"); ok {
+		if !common.StringInSlice(apiGroup, APIGroups) {
+			return false, errors.New("Unknown api group")
+		}
+		u.APIGroup = apiGroup
+	}
+	u.AllowStatusAPI = allowStatusAPI
+
+	// Password
+	if password := value("password"); password != "" {
+		if password == "-1" {
+			u.RemovePassword()
+		} else {
+			u.NewPassword(password)
+		}
+	}
+
+	// Device limit
+	if limitStr := value("device_limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil {
+			return false, errors.New("device_limit must be a number")
+		}
+		u.DeviceLimit = UserDeviceLimit(limit)
+	}
+
+	// Contact email
+	if email, ok := get("email"); ok {
+		u.Email = ""
+		if email != "" {
+			addr, err := mail.ParseAddress(email)
+			if err != nil {
+				return false, errors.New("Invalid email address")
+			}
+			u.Email = addr.Address
+		}
+	}
+
+	// Device category limits
+	if v, ok := get("category_limits"); ok {
+		limits, err := ParseCategoryLimitsList(u.e, v)
+		if err != nil {
+			return false, err
+		}
+		u.CategoryLimits = limits
+	}
+
+	updateDeviceExpirations, err := u.applyExpiration(value("expiration_type"), value("device_expiration"))
+	if err != nil {
+		return false, err
+	}
+
+	// Valid dates
+	_, startOK := get("valid_start")
+	_, endOK := get("valid_end")
+	if startOK || endOK {
+		if err := u.applyValidDates(value("valid_start"), value("valid_end")); err != nil {
+			return false, err
+		}
+	}
+
+	if canManage := value("can_manage"); canManage != "" {
+		u.CanManage = (canManage == "1")
+	}
+	if canAutoreg := value("can_autoreg"); canAutoreg != "" {
+		u.CanAutoreg = (canAutoreg == "1")
+	}
+
+	if notes, ok := get("notes"); ok {
+		u.Notes = notes
+	}
+	return updateDeviceExpirations, nil
+}
+
+func (u *User) applyExpiration(expTypeStr, devExpiration string) (bool, error) {
+	if expTypeStr == "" && devExpiration == "" {
+		return false, nil
+	}
+	if expTypeStr == "" {
+		return false, errors.New("Error saving user: Expiration type not given")
+	}
+
+	expType, err := strconv.Atoi(expTypeStr)
+	if err != nil {
+		return false, errors.New("Expiration type must be an integer")
+	}
+
+	changed := false
+	if u.DeviceExpiration.Mode != UserExpiration(expType) {
+		u.DeviceExpiration.Mode = UserExpiration(expType)
+		changed = true
+	}
+
+	var value int64
+	switch u.DeviceExpiration.Mode {
+	case UserDeviceExpirationGlobal, UserDeviceExpirationNever, UserDeviceExpirationRolling, UserDeviceExpirationTerm:
+		u.DeviceExpiration.Value = 0
+		return changed, nil
+	case UserDeviceExpirationSpecific:
+		t, err := time.ParseInLocation(common.TimeFormat, devExpiration, time.Local)
+		if err != nil {
+			return false, errors.New("Invalid time format")
+		}
+		value = t.Unix()
+	case UserDeviceExpirationDaily:
+		secs, err := common.ParseTime(devExpiration)
+		if err != nil {
+			return false, errors.New("Invalid time format")
+		}
+		value = secs
+	case UserDeviceExpirationDuration:
+		d, err := time.ParseDuration(devExpiration)
+		if err != nil {
+			return false, errors.New("Invalid duration")
+		}
+		// time.Duration's Second() returns a float that contains the nanoseconds as well
+		// For sanity we don't care and don't want the nanoseconds
+		value = int64(d / time.Second)
+	default:
+		return false, errors.New("Invalid device expiration type")
+	}
+
+	if u.DeviceExpiration.Value != value {
+		u.DeviceExpiration.Value = value
+		changed = true
+	}
+	return changed, nil
+}
+
+func (u *User) applyValidDates(validStart, validEnd string) error {
+	if validStart == "0" && validEnd == "0" {
+		u.ValidForever = true
+		u.ValidStart = time.Unix(0, 0)
+		u.ValidEnd = u.ValidStart
+		return nil
+	}
+
+	u.ValidForever = false
+	if validStart != "" {
+		t, err := time.ParseInLocation(common.TimeFormat, validStart, time.Local)
+		if err != nil {
+			return errors.New("Invalid time format: valid_start")
+		}
+		u.ValidStart = t
+	}
+	if validEnd != "" {
+		t, err := time.ParseInLocation(common.TimeFormat, validEnd, time.Local)
+		if err != nil {
+			return errors.New("Invalid time format: valid_end")
+		}
+		u.ValidEnd = t
+	}
+	if u.ValidEnd.Before(u.ValidStart) {
+		return errors.New("valid_start must be before valid_end")
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import "time"
+
+// Webhook delivery statuses
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// WebhookDelivery is an event queued for a webhook endpoint. Pending
+// deliveries are retried until they're delivered or run out of attempts.
+// Payload is the JSON body sent to the endpoint. ResponseCode and LastError
+// are from the latest attempt.
+type WebhookDelivery struct {
+	ID           int
+	Endpoint     string
+	Event        string
+	Payload      string
+	Status       string
+	Attempts     int
+	NextAttempt  time.Time
+	ResponseCode int
+	LastError    string
+	Created      time.Time
+	Delivered    time.Time
+}
+
+func NewWebhookDelivery(endpoint, event, payload string) *WebhookDelivery {
+	now := time.Now()
+	return &WebhookDelivery{
+		Endpoint:    endpoint,
+		Event:       event,
+		Payload:     payload,
+		Status:      WebhookPending,
+		NextAttempt: now,
+		Created:     now,
+	}
+}
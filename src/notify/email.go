@@ -0,0 +1,40 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package notify
+
+import (
+	"github.com/packet-guardian/packet-guardian/src/common"
+
+	"gopkg.in/mail.v2"
+)
+
+// emailNotifier sends alerts through the SMTP server in [email].
+type emailNotifier struct {
+	dialer *mail.Dialer
+	from   string
+	to     []string
+}
+
+func newEmailNotifier(c *common.Config, nc common.NotifierConfig) *emailNotifier {
+	return &emailNotifier{
+		dialer: mail.NewDialer(
+			c.Email.Address,
+			c.Email.Port,
+			c.Email.Username,
+			c.Email.Password,
+		),
+		from: c.Email.FromAddress,
+		to:   nc.To,
+	}
+}
+
+func (n *emailNotifier) Notify(a *Alert) error {
+	m := mail.NewMessage()
+	m.SetHeader("From", n.from)
+	m.SetHeader("To", n.to...)
+	m.SetHeader("Subject", a.Subject)
+	m.SetBody("text/plain", a.Body)
+	return n.dialer.DialAndSend(m)
+}
@@ -0,0 +1,198 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package notify sends alerts about flagged devices to email, webhook, and
+// syslog notifiers.
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/bindata"
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+// TemplateAsset is the path of the alert templates in the custom data
+// directory. It can redefine the subject, body, and line templates.
+const TemplateAsset = "templates/alerts/flagged-devices.tmpl"
+
+const defaultTemplates = `
+{{define "subject"}}A flagged device has been detected{{end}}
+
+{{define "body"}}The following flagged devices were detected on the network:
+{{range .Devices}}
+==================================
+MAC:        {{.MAC}}
+Username:   {{.Username}}
+Category:   {{with .Category}}{{.}}{{else}}None{{end}}
+Reason:     {{with .Reason}}{{.}}{{else}}None given{{end}}
+Flagged By: {{with .FlaggedBy}}{{.}}{{else}}Unknown{{end}}{{if not .FlaggedAt.IsZero}} on {{.FlaggedAt.Format "2006-01-02 15:04"}}{{end}}
+{{- if not .Clears.IsZero}}
+Clears:     {{.Clears.Format "2006-01-02 15:04"}}
+{{- end}}
+Last Seen:  {{.LastSeen.Format "2006-01-02 15:04"}}
+Network:    {{.Network}}
+IP Address: {{.Address}}
+==================================
+{{end}}{{end}}
+
+{{define "line"}}Flagged device {{.MAC}} owned by {{.Username}} seen on {{.Network}} with address {{.Address}}{{with .Category}} category {{.}}{{end}}{{with .Reason}} reason "{{.}}"{{end}}{{end}}
+`
+
+// Device is a flagged device seen on the network. Category, Reason,
+// FlaggedBy, FlaggedAt, and Clears describe the flag.
+type Device struct {
+	MAC       string    `json:"mac"`
+	Username  string    `json:"username"`
+	LastSeen  time.Time `json:"last_seen"`
+	Network   string    `json:"network"`
+	Address   string    `json:"address"`
+	Tags      []string  `json:"tags"`
+	Category  string    `json:"category"`
+	Reason    string    `json:"reason"`
+	FlaggedBy string    `json:"flagged_by"`
+	FlaggedAt time.Time `json:"flagged_at"`
+	Clears    time.Time `json:"clears"`
+}
+
+// Alert is a rendered alert about one or more devices. Email and webhooks
+// use the subject and body, syslog writes one line per device.
+type Alert struct {
+	Subject string
+	Body    string
+	Lines   []string
+	Devices []*Device
+}
+
+// Notifier sends alerts to a destination.
+type Notifier interface {
+	Notify(a *Alert) error
+}
+
+// New creates the notifier described by nc.
+func New(c *common.Config, nc common.NotifierConfig) (Notifier, error) {
+	switch nc.Type {
+	case common.NotifierEmail:
+		return newEmailNotifier(c, nc), nil
+	case common.NotifierWebhook:
+		return newWebhookNotifier(nc), nil
+	case common.NotifierSyslog:
+		return newSyslogNotifier(nc), nil
+	}
+	return nil, fmt.Errorf("Unknown notifier type '%s'", nc.Type)
+}
+
+// LoadTemplates returns the alert templates. Templates defined in
+// TemplateAsset in the custom data directory replace the defaults. The
+// default templates are returned with the error if the custom templates are
+// invalid.
+func LoadTemplates() (*template.Template, error) {
+	t := template.Must(template.New("").Parse(defaultTemplates))
+
+	custom, err := bindata.GetAsset(TemplateAsset)
+	if err != nil {
+		return t, nil
+	}
+
+	withCustom, err := template.Must(t.Clone()).Parse(string(custom))
+	if err != nil {
+		return t, err
+	}
+	return withCustom, nil
+}
+
+// Render executes the alert templates for devices.
+func Render(t *template.Template, siteTitle string, devices []*Device) (*Alert, error) {
+	data := struct {
+		SiteTitle string
+		Devices   []*Device
+	}{
+		SiteTitle: siteTitle,
+		Devices:   devices,
+	}
+
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return nil, err
+	}
+	alert := &Alert{
+		Subject: buf.String(),
+		Devices: devices,
+	}
+
+	buf.Reset()
+	if err := t.ExecuteTemplate(&buf, "body", data); err != nil {
+		return nil, err
+	}
+	alert.Body = buf.String()
+
+	for _, d := range devices {
+		buf.Reset()
+		if err := t.ExecuteTemplate(&buf, "line", d); err != nil {
+			return nil, err
+		}
+		alert.Lines = append(alert.Lines, buf.String())
+	}
+	return alert, nil
+}
+
+// Route returns the names of the notifiers alerted about a device. Devices
+// in a silent flag category aren't alerted and a category with notifiers
+// overrides the routes. Every notifier is used when no routes are configured.
+func Route(c *common.Config, d *Device) []string {
+	if category, ok := c.FlagCategory(d.Category); ok {
+		if category.Silent {
+			return nil
+		}
+		if len(category.Notifiers) > 0 {
+			return category.Notifiers
+		}
+	}
+
+	var names []string
+	if len(c.Alerts.Routes) == 0 {
+		for _, n := range c.Alerts.Notifiers {
+			names = append(names, n.Name)
+		}
+		return names
+	}
+
+	seen := make(map[string]bool)
+	for _, r := range c.Alerts.Routes {
+		if !routeMatches(r, d) {
+			continue
+		}
+		for _, name := range r.Notifiers {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func routeMatches(r common.AlertRoute, d *Device) bool {
+	if len(r.Usernames) > 0 && !common.StringInSlice(d.Username, r.Usernames) {
+		return false
+	}
+	if len(r.Networks) > 0 && !common.StringInSlice(d.Network, r.Networks) {
+		return false
+	}
+	if len(r.Categories) > 0 && !common.StringInSlice(d.Category, r.Categories) {
+		return false
+	}
+	if len(r.Tags) > 0 {
+		for _, tag := range d.Tags {
+			if common.StringInSlice(tag, r.Tags) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/bindata"
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+func TestRoute(t *testing.T) {
+	c := common.NewEmptyConfig()
+	c.Alerts.Notifiers = []common.NotifierConfig{
+		{Name: "security", Type: common.NotifierEmail},
+		{Name: "lab", Type: common.NotifierWebhook},
+		{Name: "siem", Type: common.NotifierSyslog},
+	}
+
+	device := &Device{MAC: "12:34:56:12:34:56", Username: "alice", Network: "Lab", Tags: []string{"printer", "lab"}}
+	if names := Route(c, device); len(names) != 3 {
+		t.Errorf("Expected all notifiers without routes, got %v", names)
+	}
+
+	c.Alerts.Routes = []common.AlertRoute{
+		{Tags: []string{"lab"}, Networks: []string{"Lab"}, Notifiers: []string{"lab"}},
+		{Usernames: []string{"bob"}, Notifiers: []string{"security"}},
+		{Notifiers: []string{"siem", "lab"}},
+	}
+
+	tests := []struct {
+		device   *Device
+		expected []string
+	}{
+		{device, []string{"lab", "siem"}},
+		{&Device{Username: "bob", Network: "Lab"}, []string{"security", "siem", "lab"}},
+		{&Device{Username: "carol", Network: "Dorms", Tags: []string{"lab"}}, []string{"siem", "lab"}},
+	}
+
+	for _, test := range tests {
+		if names := Route(c, test.device); !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("Route(%s): expected %v, got %v", test.device.Username, test.expected, names)
+		}
+	}
+}
+
+func TestRouteFlagCategories(t *testing.T) {
+	c := common.NewEmptyConfig()
+	c.Alerts.Notifiers = []common.NotifierConfig{
+		{Name: "security", Type: common.NotifierEmail},
+		{Name: "pager", Type: common.NotifierWebhook},
+		{Name: "siem", Type: common.NotifierSyslog},
+	}
+	c.Alerts.Routes = []common.AlertRoute{
+		{Categories: []string{"compromised"}, Notifiers: []string{"security"}},
+		{Notifiers: []string{"siem"}},
+	}
+	c.Flags.Categories = []common.FlagCategory{
+		{Name: "stolen", Notifiers: []string{"pager"}},
+		{Name: "compromised"},
+		{Name: "investigation", Silent: true},
+	}
+
+	tests := []struct {
+		category string
+		expected []string
+	}{
+		{"stolen", []string{"pager"}},
+		{"compromised", []string{"security", "siem"}},
+		{"investigation", nil},
+		{"", []string{"siem"}},
+	}
+
+	for _, test := range tests {
+		if names := Route(c, &Device{Category: test.category}); !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("Route(%q): expected %v, got %v", test.category, test.expected, names)
+		}
+	}
+}
+
+func TestRenderFlagDetails(t *testing.T) {
+	tmpl, _ := LoadTemplates()
+	flaggedAt := time.Date(2026, time.March, 4, 9, 30, 0, 0, time.Local)
+	alert, err := Render(tmpl, "PG", []*Device{{
+		MAC:       "12:34:56:12:34:56",
+		Username:  "alice",
+		Network:   "Dorms",
+		Address:   "10.0.0.5",
+		Category:  "stolen",
+		Reason:    "Reported stolen by owner",
+		FlaggedBy: "admin",
+		FlaggedAt: flaggedAt,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"Category:   stolen", "Reason:     Reported stolen by owner", "Flagged By: admin on 2026-03-04 09:30"} {
+		if !strings.Contains(alert.Body, expected) {
+			t.Errorf("Expected body to contain %q, got:\n%s", expected, alert.Body)
+		}
+	}
+	if strings.Contains(alert.Body, "Clears:") {
+		t.Errorf("Expected no clear time in body, got:\n%s", alert.Body)
+	}
+	if alert.Lines[0] != `Flagged device 12:34:56:12:34:56 owned by alice seen on Dorms with address 10.0.0.5 category stolen reason "Reported stolen by owner"` {
+		t.Errorf("Wrong line %q", alert.Lines[0])
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var payload webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+
+	tmpl, _ := LoadTemplates()
+	alert, err := Render(tmpl, "PG", []*Device{{MAC: "12:34:56:12:34:56", Username: "alice", LastSeen: time.Now()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := newWebhookNotifier(common.NotifierConfig{URL: server.URL})
+	if err := n.Notify(alert); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Subject != alert.Subject || len(payload.Devices) != 1 || payload.Devices[0].Username != "alice" {
+		t.Errorf("Unexpected webhook payload %#v", payload)
+	}
+
+	n.url = server.URL + "/missing"
+	if err := n.Notify(alert); err == nil {
+		t.Error("Expected error status to fail the notification")
+	}
+}
+
+func TestCustomTemplates(t *testing.T) {
+	dir, err := os.MkdirTemp("", "pg-custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer bindata.SetCustomDir(bindata.CustomDir())
+
+	os.MkdirAll(filepath.Join(dir, "templates", "alerts"), 0755)
+	custom := `{{define "subject"}}{{.SiteTitle}}: {{len .Devices}} flagged devices{{end}}`
+	os.WriteFile(filepath.Join(dir, TemplateAsset), []byte(custom), 0644)
+	if err := bindata.SetCustomDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err := LoadTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alert, err := Render(tmpl, "PG", []*Device{{MAC: "12:34:56:12:34:56", Username: "alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if alert.Subject != "PG: 1 flagged devices" {
+		t.Errorf("Expected custom subject, got %q", alert.Subject)
+	}
+	if len(alert.Lines) != 1 || alert.Lines[0] != "Flagged device 12:34:56:12:34:56 owned by alice seen on  with address " {
+		t.Errorf("Expected default line template, got %q", alert.Lines)
+	}
+}
@@ -0,0 +1,60 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package notify
+
+import (
+	"log/syslog"
+	"sync"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+// syslogNotifier writes one warning per device to syslog. The connection is
+// opened on the first alert and reopened after a failed write.
+type syslogNotifier struct {
+	network string
+	address string
+	tag     string
+
+	mu sync.Mutex
+	w  *syslog.Writer
+}
+
+func newSyslogNotifier(nc common.NotifierConfig) *syslogNotifier {
+	tag := nc.Tag
+	if tag == "" {
+		tag = "packet-guardian"
+	}
+	return &syslogNotifier{
+		network: nc.Network,
+		address: nc.Address,
+		tag:     tag,
+	}
+}
+
+func (n *syslogNotifier) Notify(a *Alert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.w == nil {
+		w, err := syslog.Dial(n.network, n.address, syslog.LOG_WARNING|syslog.LOG_DAEMON, n.tag)
+		if err != nil {
+			return err
+		}
+		n.w = w
+	}
+
+	for _, line := range a.Lines {
+		if err := n.w.Warning(line); err != nil {
+			n.w.Close()
+			n.w = nil
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build windows || plan9
+// +build windows plan9
+
+package notify
+
+import (
+	"errors"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+type syslogNotifier struct{}
+
+func newSyslogNotifier(nc common.NotifierConfig) *syslogNotifier {
+	return &syslogNotifier{}
+}
+
+func (n *syslogNotifier) Notify(a *Alert) error {
+	return errors.New("Syslog isn't supported on this platform")
+}
@@ -0,0 +1,56 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+)
+
+// webhookNotifier posts alerts as JSON to a URL.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+type webhookPayload struct {
+	Subject string    `json:"subject"`
+	Text    string    `json:"text"`
+	Devices []*Device `json:"devices"`
+}
+
+func newWebhookNotifier(nc common.NotifierConfig) *webhookNotifier {
+	return &webhookNotifier{
+		url:    nc.URL,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *webhookNotifier) Notify(a *Alert) error {
+	body, err := json.Marshal(&webhookPayload{
+		Subject: a.Subject,
+		Text:    a.Body,
+		Devices: a.Devices,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
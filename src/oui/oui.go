@@ -0,0 +1,186 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package oui resolves MAC addresses to the manufacturer that registered
+// the address block with the IEEE.
+package oui
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/packet-guardian/packet-guardian/src/bindata"
+)
+
+// AssetName is the bindata asset containing the OUI database. A file at the
+// same path in the custom data directory replaces the builtin database.
+const AssetName = "data/oui.csv"
+
+// Assignment lengths in hex digits for the MA-S, MA-M, and MA-L registries
+var prefixLengths = []int{9, 7, 6}
+
+// Database maps IEEE assigned MAC prefixes to organization names.
+type Database struct {
+	vendors map[string]string
+}
+
+// Parse reads an IEEE registry CSV file. The MA-L, MA-M, and MA-S registry
+// files may be concatenated together, repeated headers are skipped.
+func Parse(r io.Reader) (*Database, error) {
+	csvr := csv.NewReader(r)
+	csvr.FieldsPerRecord = -1
+	csvr.ReuseRecord = true
+	csvr.LazyQuotes = true
+
+	db := &Database{vendors: make(map[string]string)}
+	header, err := csvr.Read()
+	if err == io.EOF {
+		return nil, errors.New("OUI data is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(header) < 3 || header[0] != "Registry" || header[1] != "Assignment" {
+		return nil, errors.New("OUI data is not an IEEE registry CSV file")
+	}
+
+	for {
+		record, err := csvr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 || record[0] == "Registry" {
+			continue
+		}
+
+		assignment := strings.ToUpper(strings.TrimSpace(record[1]))
+		if !validAssignment(assignment) {
+			line, _ := csvr.FieldPos(0)
+			return nil, fmt.Errorf("Invalid assignment '%s' on line %d", record[1], line)
+		}
+		db.vendors[assignment] = strings.TrimSpace(record[2])
+	}
+	return db, nil
+}
+
+func validAssignment(a string) bool {
+	if len(a) != 6 && len(a) != 7 && len(a) != 9 {
+		return false
+	}
+	_, err := hex.DecodeString(a + strings.Repeat("0", len(a)%2))
+	return err == nil
+}
+
+// Len returns the number of assignments in the database.
+func (db *Database) Len() int {
+	return len(db.vendors)
+}
+
+// Lookup returns the organization the MAC address is assigned to or an
+// empty string if the address block isn't registered. The most specific
+// assignment is used.
+func (db *Database) Lookup(mac net.HardwareAddr) string {
+	if len(mac) < 5 {
+		return ""
+	}
+	digits := strings.ToUpper(hex.EncodeToString(mac[:5]))
+	for _, l := range prefixLengths {
+		if vendor, ok := db.vendors[digits[:l]]; ok {
+			return vendor
+		}
+	}
+	return ""
+}
+
+// Prefixes returns the MAC address prefixes, formatted as in a MAC address
+// string, assigned to organizations with a name containing vendor.
+// Matching is case insensitive.
+func (db *Database) Prefixes(vendor string) []string {
+	vendor = strings.ToLower(strings.TrimSpace(vendor))
+	if vendor == "" {
+		return nil
+	}
+
+	prefixes := make([]string, 0, 10)
+	for assignment, name := range db.vendors {
+		if strings.Contains(strings.ToLower(name), vendor) {
+			prefixes = append(prefixes, FormatPrefix(assignment))
+		}
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// FormatPrefix formats a string of hex digits the same way they would appear
+// at the start of a MAC address string. "70B3D51" becomes "70:b3:d5:1".
+func FormatPrefix(digits string) string {
+	digits = strings.ToLower(digits)
+	var b strings.Builder
+	for i := 0; i < len(digits); i++ {
+		if i > 0 && i%2 == 0 {
+			b.WriteByte(':')
+		}
+		b.WriteByte(digits[i])
+	}
+	return b.String()
+}
+
+var (
+	defaultDB   = &Database{vendors: make(map[string]string)}
+	defaultLock sync.RWMutex
+)
+
+// Load reads the OUI database from bindata and makes it the default database.
+func Load() error {
+	data, err := bindata.GetAsset(AssetName)
+	if err != nil {
+		return err
+	}
+
+	db, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	SetDefault(db)
+	return nil
+}
+
+// SetDefault replaces the database used by the package level functions.
+func SetDefault(db *Database) {
+	defaultLock.Lock()
+	defaultDB = db
+	defaultLock.Unlock()
+}
+
+// Len returns the number of assignments in the default database.
+func Len() int {
+	defaultLock.RLock()
+	defer defaultLock.RUnlock()
+	return defaultDB.Len()
+}
+
+// Lookup resolves mac using the default database.
+func Lookup(mac net.HardwareAddr) string {
+	defaultLock.RLock()
+	defer defaultLock.RUnlock()
+	return defaultDB.Lookup(mac)
+}
+
+// Prefixes searches the default database for vendor.
+func Prefixes(vendor string) []string {
+	defaultLock.RLock()
+	defer defaultLock.RUnlock()
+	return defaultDB.Prefixes(vendor)
+}
@@ -0,0 +1,112 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oui
+
+import (
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testOUIData = `Registry,Assignment,Organization Name,Organization Address
+MA-L,240AC4,Espressif Inc.,"Room 204, Building 2, Shanghai CN 200120"
+MA-L,70B3D5,IEEE Registration Authority,"445 Hoes Lane Piscataway NJ US 08554"
+MA-L,A4CF12,Espressif Inc.,"Room 204, Building 2, Shanghai CN 200120"
+Registry,Assignment,Organization Name,Organization Address
+MA-M,70B3D51,Example Sensors Ltd,"1 Example Way"
+MA-S,70B3D5123,Tiny Devices LLC,"2 Example Way"
+`
+
+func TestParse(t *testing.T) {
+	db, err := Parse(strings.NewReader(testOUIData))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if db.Len() != 5 {
+		t.Errorf("Expected 5 assignments, got %d", db.Len())
+	}
+
+	if _, err := Parse(strings.NewReader("mac,vendor\n")); err == nil {
+		t.Error("Expected error for non-IEEE header")
+	}
+	if _, err := Parse(strings.NewReader("Registry,Assignment,Organization Name\nMA-L,XYZ123,Bad\n")); err == nil {
+		t.Error("Expected error for invalid assignment")
+	}
+}
+
+var lookupTests = []struct {
+	mac    string
+	vendor string
+}{
+	{"24:0a:c4:12:34:56", "Espressif Inc."},
+	{"70:b3:d5:00:00:01", "IEEE Registration Authority"},
+	{"70:b3:d5:1f:00:01", "Example Sensors Ltd"},
+	{"70:b3:d5:12:30:01", "Tiny Devices LLC"},
+	{"12:34:56:78:9a:bc", ""},
+}
+
+func TestLookup(t *testing.T) {
+	db, err := Parse(strings.NewReader(testOUIData))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	for _, test := range lookupTests {
+		mac, _ := net.ParseMAC(test.mac)
+		if vendor := db.Lookup(mac); vendor != test.vendor {
+			t.Errorf("Lookup(%s): expected %q, got %q", test.mac, test.vendor, vendor)
+		}
+	}
+}
+
+func TestPrefixes(t *testing.T) {
+	db, err := Parse(strings.NewReader(testOUIData))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := []string{"24:0a:c4", "a4:cf:12"}
+	if prefixes := db.Prefixes("espressif"); !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf("Expected %v, got %v", expected, prefixes)
+	}
+
+	expected = []string{"70:b3:d5:1", "70:b3:d5:12:3"}
+	if prefixes := db.Prefixes("Example Sensors"); len(prefixes) != 1 || prefixes[0] != expected[0] {
+		t.Errorf("Expected %v, got %v", expected[:1], prefixes)
+	}
+	if prefixes := db.Prefixes("tiny"); len(prefixes) != 1 || prefixes[0] != expected[1] {
+		t.Errorf("Expected %v, got %v", expected[1:], prefixes)
+	}
+
+	if prefixes := db.Prefixes(""); len(prefixes) != 0 {
+		t.Errorf("Expected no prefixes for empty vendor, got %v", prefixes)
+	}
+}
+
+func TestRegistryData(t *testing.T) {
+	f, err := os.Open("../../data/oui.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	db, err := Parse(f)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	known := map[string]string{
+		"00:03:93:12:34:56": "Apple",
+		"00:00:0c:12:34:56": "Cisco",
+	}
+	for mac, vendor := range known {
+		hw, _ := net.ParseMAC(mac)
+		if v := db.Lookup(hw); !strings.HasPrefix(v, vendor) {
+			t.Errorf("Lookup(%s): expected %s, got %q", mac, vendor, v)
+		}
+	}
+}
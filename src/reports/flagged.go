@@ -0,0 +1,79 @@
+package reports
+
+import (
+	"encoding/csv"
+	"net/http"
+	"time"
+
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+func init() {
+	RegisterReport("flagged-devices", "Flagged Devices", flaggedDevicesReport)
+}
+
+func flaggedDevicesReport(e *common.Environment, w http.ResponseWriter, r *http.Request, stores stores.StoreCollection) error {
+	category := r.URL.Query().Get("category")
+
+	where := `"flagged" = 1`
+	var vals []interface{}
+	if category != "" {
+		where += ` AND "flag_category" = ?`
+		vals = append(vals, category)
+	}
+	where += ` ORDER BY "flagged_at" DESC`
+
+	devices, err := stores.Devices.Search(where, vals...)
+	if err != nil {
+		e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "reports:flagged",
+		}).Error("Failed to get devices")
+		return nil
+	}
+
+	if r.URL.Query().Get("op") == "download-report" {
+		return downloadFlaggedDevicesReport(w, devices)
+	}
+
+	data := map[string]interface{}{
+		"devices":    devices,
+		"category":   category,
+		"categories": e.Config.Flags.Categories,
+	}
+
+	e.Views.NewView("admin-report-flagged-devices", r).Render(w, data)
+	return nil
+}
+
+func downloadFlaggedDevicesReport(w http.ResponseWriter, devices []*models.Device) error {
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Write([]string{"mac", "username", "category", "reason", "flagged-by", "flagged-at", "clears", "last-seen"})
+
+	for _, d := range devices {
+		flaggedAt := ""
+		if !d.FlaggedAt.IsZero() {
+			flaggedAt = d.FlaggedAt.Format(time.RFC3339)
+		}
+		clears := "never"
+		if !d.FlagClears.IsZero() {
+			clears = d.FlagClears.Format(time.RFC3339)
+		}
+
+		csvWriter.Write([]string{
+			d.MAC.String(),
+			d.Username,
+			d.FlagCategory,
+			d.FlagReason,
+			d.FlaggedBy,
+			flaggedAt,
+			clears,
+			d.LastSeen.Format(time.RFC3339),
+		})
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
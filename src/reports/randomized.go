@@ -0,0 +1,103 @@
+package reports
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+// Randomized MAC addresses have the locally administered bit set which makes
+// the second hex digit one of 2, 6, a, or e.
+const randomizedMACWhere = `SUBSTRING("mac", 2, 1) IN ('2', '6', 'a', 'e')`
+
+func init() {
+	RegisterReport("randomized-macs", "Randomized MAC Registrations", randomizedMACReport)
+}
+
+func randomizedMACReport(e *common.Environment, w http.ResponseWriter, r *http.Request, stores stores.StoreCollection) error {
+	if r.URL.Query().Get("op") == "download-report" {
+		return downloadRandomizedMACReport(w, stores.Devices)
+	}
+
+	pageNum := 1
+	if page, _ := strconv.Atoi(r.URL.Query().Get("page")); page > 0 {
+		pageNum = page
+	}
+
+	devices, err := stores.Devices.Search(
+		randomizedMACWhere+` ORDER BY "date_registered" DESC LIMIT ?,?`,
+		(common.PageSize*pageNum)-common.PageSize, common.PageSize,
+	)
+	if err != nil {
+		e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "reports:randomized",
+		}).Error("Failed to get devices")
+		return nil
+	}
+
+	var resultCnt int
+	row := e.DB.QueryRow(`SELECT count(*) FROM "device" WHERE ` + randomizedMACWhere)
+	if err := row.Scan(&resultCnt); err != nil {
+		e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "reports:randomized",
+		}).Error("Failed to get device count")
+		return nil
+	}
+
+	pageEnd := pageNum * common.PageSize
+	if resultCnt < pageEnd {
+		pageEnd = resultCnt
+	}
+
+	data := map[string]interface{}{
+		"devices":    devices,
+		"policy":     e.Config.Registration.RandomizedMAC.Policy,
+		"expiration": e.Config.Registration.RandomizedMAC.Expiration,
+
+		"resultCnt":   resultCnt,
+		"page":        pageNum,
+		"hasNextPage": pageNum*common.PageSize < resultCnt,
+		"pageStart":   ((pageNum - 1) * common.PageSize) + 1,
+		"pageEnd":     pageEnd,
+	}
+
+	e.Views.NewView("admin-report-randomized-macs", r).Render(w, data)
+	return nil
+}
+
+func downloadRandomizedMACReport(w http.ResponseWriter, dstore stores.DeviceStore) error {
+	devices, err := dstore.Search(randomizedMACWhere + ` ORDER BY "date_registered" DESC`)
+	if err != nil {
+		return err
+	}
+
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Write([]string{"mac", "username", "platform", "registered", "expires", "last-seen"})
+
+	for _, d := range devices {
+		expires := d.Expires.Format(time.RFC3339)
+		if d.Expires.Unix() == 0 {
+			expires = "never"
+		} else if d.Expires.Unix() == 1 {
+			expires = "rolling"
+		}
+
+		csvWriter.Write([]string{
+			d.MAC.String(),
+			d.Username,
+			d.Platform,
+			d.DateRegistered.Format(time.RFC3339),
+			expires,
+			d.LastSeen.Format(time.RFC3339),
+		})
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
@@ -0,0 +1,121 @@
+package reports
+
+import (
+	"encoding/csv"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+	"github.com/packet-guardian/packet-guardian/src/oui"
+)
+
+const (
+	vendorRandomized = "Randomized"
+	vendorUnknown    = "Unknown"
+)
+
+func init() {
+	RegisterReport("vendors", "Device Vendor Distribution", vendorReport)
+}
+
+type vendorCount struct {
+	Vendor  string
+	Count   int
+	Percent string
+	Known   bool
+}
+
+func vendorReport(e *common.Environment, w http.ResponseWriter, r *http.Request, stores stores.StoreCollection) error {
+	vendors, total, err := getVendorCounts(e)
+	if err != nil {
+		e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "reports:vendors",
+		}).Error("Failed to get vendor counts")
+		return err
+	}
+
+	if r.URL.Query().Get("op") == "download-report" {
+		return downloadVendorReport(w, vendors)
+	}
+
+	data := map[string]interface{}{
+		"vendors":     vendors,
+		"total":       total,
+		"ouiEntries":  oui.Len(),
+		"vendorCount": len(vendors),
+	}
+
+	e.Views.NewView("admin-report-vendors", r).Render(w, data)
+	return nil
+}
+
+// getVendorCounts returns the number of registered devices for each vendor
+// sorted by the number of devices descending.
+func getVendorCounts(e *common.Environment) ([]*vendorCount, int, error) {
+	// The first 9 hex digits cover the longest (MA-S) assignments
+	rows, err := e.DB.Query(`SELECT LEFT("mac", 13), count(*) FROM "device" WHERE "username" != '' GROUP BY LEFT("mac", 13)`)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	total := 0
+	for rows.Next() {
+		var prefix string
+		var count int
+		if err := rows.Scan(&prefix, &count); err != nil {
+			return nil, 0, err
+		}
+
+		vendor := vendorUnknown
+		mac, err := net.ParseMAC(prefix + "0:00")
+		if err == nil {
+			if common.IsLocallyAdministered(mac) {
+				vendor = vendorRandomized
+			} else if name := oui.Lookup(mac); name != "" {
+				vendor = name
+			}
+		}
+
+		counts[vendor] += count
+		total += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	vendors := make([]*vendorCount, 0, len(counts))
+	for vendor, count := range counts {
+		vendors = append(vendors, &vendorCount{
+			Vendor:  vendor,
+			Count:   count,
+			Percent: strconv.FormatFloat(float64(count)*100/float64(total), 'f', 1, 64),
+			Known:   vendor != vendorUnknown && vendor != vendorRandomized,
+		})
+	}
+
+	sort.Slice(vendors, func(i, j int) bool {
+		if vendors[i].Count == vendors[j].Count {
+			return vendors[i].Vendor < vendors[j].Vendor
+		}
+		return vendors[i].Count > vendors[j].Count
+	})
+	return vendors, total, nil
+}
+
+func downloadVendorReport(w http.ResponseWriter, vendors []*vendorCount) error {
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Write([]string{"vendor", "devices", "percent"})
+
+	for _, v := range vendors {
+		csvWriter.Write([]string{v.Vendor, strconv.Itoa(v.Count), v.Percent})
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
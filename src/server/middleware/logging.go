@@ -6,9 +6,11 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/metrics"
 )
 
 // responseWriter is an http.ResponseWriter that keeps track of the length
@@ -35,10 +37,12 @@ func (w *responseWriter) requestTime() time.Duration {
 	return time.Since(w.startTime)
 }
 
+// Logging logs requests when HTTP logging is enabled and records request
+// metrics when metrics are enabled.
 func Logging(next http.Handler, e *common.Environment) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// If HTTP logging is disabled, no need in wasting the space
-		if !e.Config.Logging.EnableHTTP {
+		// If HTTP logging and metrics are disabled, no need in wasting the space
+		if !e.Config.Logging.EnableHTTP && !e.Config.Metrics.Enabled {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -51,6 +55,16 @@ func Logging(next http.Handler, e *common.Environment) http.Handler {
 
 		next.ServeHTTP(newW, r)
 
+		if e.Config.Metrics.Enabled {
+			route := metrics.Route(r.Method, r.URL.Path)
+			metrics.HTTPRequests.Inc(route, r.Method, strconv.Itoa(newW.status))
+			metrics.HTTPDuration.Observe(newW.requestTime().Seconds(), route, r.Method)
+		}
+
+		if !e.Config.Logging.EnableHTTP {
+			return
+		}
+
 		if r.TLS != nil {
 			// If the server is running on TLS, tell the client to prefer it
 			w.Header().Add("Strict-Transport-Security", "max-age=63072000;")
@@ -0,0 +1,53 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/packet-guardian/packet-guardian/src/metrics"
+)
+
+// router is an httprouter.Router that registers its routes with the request
+// metrics so requests are counted by route pattern instead of by path.
+type router struct {
+	*httprouter.Router
+}
+
+func newRouter() *router {
+	return &router{Router: httprouter.New()}
+}
+
+func (r *router) Handle(method, path string, handle httprouter.Handle) {
+	metrics.AddRoute(method, path)
+	r.Router.Handle(method, path, handle)
+}
+
+func (r *router) Handler(method, path string, handler http.Handler) {
+	metrics.AddRoute(method, path)
+	r.Router.Handler(method, path, handler)
+}
+
+func (r *router) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	r.Handler(method, path, handler)
+}
+
+func (r *router) GET(path string, handle httprouter.Handle) {
+	r.Handle("GET", path, handle)
+}
+
+func (r *router) POST(path string, handle httprouter.Handle) {
+	r.Handle("POST", path, handle)
+}
+
+func (r *router) DELETE(path string, handle httprouter.Handle) {
+	r.Handle("DELETE", path, handle)
+}
+
+func (r *router) ServeFiles(path string, root http.FileSystem) {
+	metrics.AddRoute("GET", path)
+	r.Router.ServeFiles(path, root)
+}
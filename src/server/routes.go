@@ -14,7 +14,6 @@ import (
 	"github.com/dchest/captcha"
 	assetfs "github.com/elazarl/go-bindata-assetfs"
 	"github.com/gorilla/context"
-	"github.com/julienschmidt/httprouter"
 	"github.com/lfkeitel/verbose/v4"
 
 	"github.com/packet-guardian/dhcp-lib"
@@ -23,13 +22,14 @@ import (
 	"github.com/packet-guardian/packet-guardian/src/common"
 	"github.com/packet-guardian/packet-guardian/src/controllers"
 	"github.com/packet-guardian/packet-guardian/src/controllers/api"
+	"github.com/packet-guardian/packet-guardian/src/metrics"
 	"github.com/packet-guardian/packet-guardian/src/models"
 	"github.com/packet-guardian/packet-guardian/src/models/stores"
 	mid "github.com/packet-guardian/packet-guardian/src/server/middleware"
 )
 
 func LoadRoutes(e *common.Environment, stores stores.StoreCollection) http.Handler {
-	r := httprouter.New()
+	r := newRouter()
 	r.NotFound = http.HandlerFunc(notFoundHandler)
 
 	r.Handler("GET", "/", midStack(e, stores, &rootHandler{leases: stores.Leases}))
@@ -52,12 +52,12 @@ func LoadRoutes(e *common.Environment, stores stores.StoreCollection) http.Handl
 	casController := controllers.NewCASController(e, stores.Users)
 	r.Handler("GET", "/cas", midStack(e, stores, http.HandlerFunc(casController.CASHandler)))
 
-	manageController := controllers.NewManagerController(e, stores.Devices, stores.Leases, stores.Users)
+	manageController := controllers.NewManagerController(e, stores.Devices, stores.Leases, stores.Users, stores.Transfers, stores.Policies)
 	r.Handler("GET", "/register", midStack(e, stores, http.HandlerFunc(manageController.RegistrationHandler)))
 	r.Handler("GET", "/manage", midStack(e, stores, mid.CheckAuth(http.HandlerFunc(manageController.ManageHandler))))
 	r.Handler("GET", "/manage/*user", midStack(e, stores, mid.CheckAuth(http.HandlerFunc(manageController.DelegateManageHandler))))
 
-	guestController := controllers.NewGuestController(e, stores.Users, stores.Devices, stores.Leases)
+	guestController := controllers.NewGuestController(e, stores.Users, stores.Devices, stores.Leases, stores.Policies, stores.Webhooks)
 	r.Handler("GET", "/register/guest", midStack(e, stores, mid.CheckGuestReg(
 		http.HandlerFunc(guestController.RegistrationHandler), e, stores.Leases)))
 	r.Handler("POST", "/register/guest", midStack(e, stores, mid.CheckGuestReg(
@@ -76,6 +76,14 @@ func LoadRoutes(e *common.Environment, stores stores.StoreCollection) http.Handl
 
 	r.Handler("GET", "/captcha/*a", captcha.Server(captcha.StdWidth, captcha.StdHeight))
 
+	healthController := api.NewHealthController(e) // no authentication or session
+	r.GET("/healthz", healthController.LivenessHandler)
+	r.GET("/readyz", healthController.ReadinessHandler)
+
+	if e.Config.Metrics.Enabled {
+		r.Handler("GET", "/metrics", metrics.Handler(e)) // token or IP allowlist, no session
+	}
+
 	if e.IsDev() || e.Config.Core.Debug {
 		r.Handler("GET", "/debug/*a", midStack(e, stores, debugRouter(e)))
 		e.Log.Debug("Profiling enabled")
@@ -102,7 +110,7 @@ func midStack(e *common.Environment, stores stores.StoreCollection, h http.Handl
 }
 
 func debugRouter(_ *common.Environment) http.Handler {
-	r := httprouter.New()
+	r := newRouter()
 	r.NotFound = http.HandlerFunc(notFoundHandler)
 
 	r.HandlerFunc("GET", "/debug/pprof", pprof.Index)
@@ -136,21 +144,35 @@ func heapStats(w http.ResponseWriter, r *http.Request) {
 }
 
 func adminRouter(e *common.Environment, stores stores.StoreCollection) http.Handler {
-	r := httprouter.New()
+	r := newRouter()
 	r.NotFound = http.HandlerFunc(notFoundHandler)
 
 	adminController := controllers.NewAdminController(e, stores)
 	r.GET("/admin/", adminController.DashboardHandler)
 	r.GET("/admin/search", adminController.SearchHandler)
+	r.GET("/admin/attribution", adminController.AttributionHandler)
+	r.GET("/admin/trash", adminController.TrashHandler)
+	r.POST("/admin/trash/:entity/:id/restore", adminController.RestoreHandler)
+	r.GET("/admin/jobs", adminController.JobsHandler)
+	r.GET("/admin/jobs/:name", adminController.JobHistoryHandler)
+	r.POST("/admin/jobs/:name/run", adminController.RunJobHandler)
+	r.GET("/admin/webhooks", adminController.WebhooksHandler)
+	r.POST("/admin/webhooks/:id/retry", adminController.RetryWebhookHandler)
 	r.GET("/admin/manage/user/:username", adminController.ManageHandler)
 	r.GET("/admin/manage/device/:mac", adminController.ShowDeviceHandler)
 	r.GET("/admin/users", adminController.AdminUserListHandler)
 	r.GET("/admin/users/:username", adminController.AdminUserHandler)
 	r.GET("/admin/reports", adminController.ReportHandler)
 	r.GET("/admin/reports/:report", adminController.ReportHandler)
+	r.GET("/admin/terms", adminController.TermsHandler)
+	r.POST("/admin/terms", adminController.SaveTermHandler)
+	r.POST("/admin/terms/:id/delete", adminController.DeleteTermHandler)
+	r.GET("/admin/policy", adminController.PolicyHandler)
+	r.POST("/admin/policy", adminController.PublishPolicyHandler)
 
 	r.GET("/admin/import-export", adminController.RenderImportExportPage)
 	r.POST("/admin/import/:resource", adminController.Import)
+	r.GET("/admin/export/:resource", adminController.Export)
 
 	h := mid.CheckAdmin(r)
 	h = mid.CheckAuth(h)
@@ -158,11 +180,14 @@ func adminRouter(e *common.Environment, stores stores.StoreCollection) http.Hand
 }
 
 func apiRouter(e *common.Environment, stores stores.StoreCollection) http.Handler {
-	r := httprouter.New()
+	r := newRouter()
 
-	deviceAPIController := api.NewDeviceController(e, stores.Users, stores.Devices, stores.Leases)
+	deviceAPIController := api.NewDeviceController(e, stores.Users, stores.Devices, stores.Leases, stores.Policies, stores.Notes, stores.Webhooks)
 	r.POST("/api/device", deviceAPIController.RegistrationHandler)            // handles permission checks
 	r.DELETE("/api/device/user/:username", deviceAPIController.DeleteHandler) // handles permission checks
+	r.POST("/api/device/import",
+		mid.CheckPermissions(deviceAPIController.ImportHandler,
+			mid.PermsCanAny(models.CreateDevice)))
 	r.POST("/api/device/reassign",
 		mid.CheckPermissions(deviceAPIController.ReassignHandler,
 			mid.PermsCanAny(models.ReassignDevice)))
@@ -171,13 +196,37 @@ func apiRouter(e *common.Environment, stores stores.StoreCollection) http.Handle
 	r.POST("/api/device/mac/:mac/expiration",
 		mid.CheckPermissions(deviceAPIController.EditExpirationHandler,
 			mid.PermsCanAny(models.EditDevice)))
+	r.POST("/api/device/mac/:mac/attributes",
+		mid.CheckPermissions(deviceAPIController.EditAttributesHandler,
+			mid.PermsCanAny(models.EditDevice)))
 	r.POST("/api/device/mac/:mac/flag",
 		mid.CheckPermissions(deviceAPIController.EditFlaggedHandler,
 			mid.PermsCanAny(models.EditDevice)))
+	r.POST("/api/device/mac/:mac/renew", deviceAPIController.RenewHandler) // handles permission checks
 	r.GET("/api/device/:mac", deviceAPIController.GetDeviceHandler)        // handles permission checks
 	r.GET("/api/captive-status", deviceAPIController.GetSelfStatusHandler) // no permission checks, device self-check
 
-	blacklistController := api.NewBlacklistController(e, stores.Users, stores.Devices)
+	deviceHistoryAPIController := api.NewDeviceHistoryController(e, stores.Leases, stores.DeviceEvents)
+	r.GET("/api/device/:mac/history",
+		mid.CheckPermissions(deviceHistoryAPIController.GetHistoryHandler,
+			mid.PermsCanAny(models.ViewDevices)))
+
+	attributionAPIController := api.NewAttributionController(e, stores.Leases, stores.Devices, stores.DeviceEvents)
+	r.GET("/api/attribution",
+		mid.CheckPermissions(attributionAPIController.LookupHandler,
+			mid.PermsCanAny(models.ViewDevices)))
+
+	transferAPIController := api.NewTransferController(e, stores.Users, stores.Devices, stores.Transfers, stores.Webhooks)
+	r.POST("/api/device/mac/:mac/transfer", transferAPIController.OfferHandler)      // handles permission checks
+	r.GET("/api/transfer/user/:username", transferAPIController.GetTransfersHandler) // handles permission checks
+	r.POST("/api/transfer/id/:id/accept", transferAPIController.AcceptHandler)       // handles permission checks
+	r.POST("/api/transfer/id/:id/decline", transferAPIController.DeclineHandler)     // handles permission checks
+	r.DELETE("/api/transfer/id/:id", transferAPIController.CancelHandler)            // handles permission checks
+
+	policyAPIController := api.NewPolicyController(e, stores.Policies)
+	r.POST("/api/policy/accept", policyAPIController.AcceptHandler) // no permission checks, any user may accept
+
+	blacklistController := api.NewBlacklistController(e, stores.Users, stores.Devices, stores.Webhooks)
 	r.POST("/api/blacklist/user/:username",
 		mid.CheckPermissions(blacklistController.BlacklistUserHandler,
 			mid.PermsCanAny(models.ManageBlacklist)))
@@ -192,14 +241,44 @@ func apiRouter(e *common.Environment, stores stores.StoreCollection) http.Handle
 		mid.CheckPermissions(blacklistController.BlacklistDeviceHandler,
 			mid.PermsCanAny(models.ManageBlacklist)))
 
-	userAPIController := api.NewUserController(e, stores.Users, stores.Devices)
+	userAPIController := api.NewUserController(e, stores.Users, stores.Devices, stores.Notes)
 	r.POST("/api/user", userAPIController.SaveUserHandler)         // handles permission checks
 	r.GET("/api/user/:username", userAPIController.GetUserHandler) // handles permission checks
+	r.POST("/api/user/import",
+		mid.CheckPermissions(userAPIController.ImportHandler,
+			mid.PermsCanAny(models.CreateUser)))
 	r.DELETE("/api/user",
 		mid.CheckPermissions(userAPIController.DeleteUserHandler,
 			mid.PermsCanAny(models.DeleteUser)))
 
-	statusAPIController := api.NewStatusController(e)
+	trashAPIController := api.NewTrashController(e, stores.Trash)
+	r.GET("/api/trash",
+		mid.CheckPermissions(trashAPIController.GetTrashHandler,
+			mid.PermsCanAny(models.DeleteDevice, models.DeleteUser)))
+	r.POST("/api/trash/:entity/:id/restore", trashAPIController.RestoreHandler) // handles permission checks
+	r.GET("/api/archive/devices/:username",
+		mid.CheckPermissions(trashAPIController.GetArchivedDevicesHandler,
+			mid.PermsCanAny(models.ViewDevices)))
+
+	noteAPIController := api.NewNoteController(e, stores.Devices, stores.Notes)
+	r.GET("/api/notes/:entity/:key", noteAPIController.GetNotesHandler) // handles permission checks
+	r.POST("/api/notes/:entity/:key", noteAPIController.AddNoteHandler) // handles permission checks
+
+	exportAPIController := api.NewExportController(e, stores.Users, stores.Devices)
+	r.GET("/api/export/:resource", exportAPIController.ExportHandler) // handles permission checks
+
+	jobsAPIController := api.NewJobsController(e, stores)
+	r.GET("/api/jobs",
+		mid.CheckPermissions(jobsAPIController.GetJobsHandler,
+			mid.PermsCanAny(models.ManageJobs)))
+	r.GET("/api/jobs/:name",
+		mid.CheckPermissions(jobsAPIController.GetJobHandler,
+			mid.PermsCanAny(models.ManageJobs)))
+	r.POST("/api/jobs/:name/run",
+		mid.CheckPermissions(jobsAPIController.RunJobHandler,
+			mid.PermsCanAny(models.ManageJobs)))
+
+	statusAPIController := api.NewStatusController(e, stores.JobRuns, stores.TaskLocks)
 	r.GET("/api/status",
 		mid.CheckPermissions(statusAPIController.GetStatus,
 			mid.PermsCanAny(models.ViewDebugInfo)))
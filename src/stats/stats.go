@@ -75,3 +75,19 @@ func GetDeviceStats(e *common.Environment) (int, int) {
 	}
 	return total, (total / distinct)
 }
+
+// GetTotals returns the number of devices, users, and block list entries
+func GetTotals(e *common.Environment) (int, int, int) {
+	row := e.DB.QueryRow(`SELECT (SELECT COUNT(*) FROM "device"), (SELECT COUNT(*) FROM "user"), (SELECT COUNT(*) FROM "blacklist")`)
+	devices := 0
+	users := 0
+	blacklisted := 0
+	if err := row.Scan(&devices, &users, &blacklisted); err != nil {
+		e.Log.WithFields(verbose.Fields{
+			"error":   err,
+			"package": "stats",
+		}).Error("SQL statement failed")
+		return 0, 0, 0
+	}
+	return devices, users, blacklisted
+}
@@ -0,0 +1,56 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tasks
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+	"github.com/packet-guardian/packet-guardian/src/webhooks"
+)
+
+func init() {
+	RegisterJob("clear-flags", "", clearExpiredFlags)
+}
+
+// Removes flags whose clear time has passed
+func clearExpiredFlags(e *common.Environment, stores stores.StoreCollection) (string, int64, error) {
+	now := time.Now()
+
+	var expired []*models.Device
+	err := stores.Devices.Each(`"flagged" = 1 AND "flag_clears" > 0 AND "flag_clears" <= ?`, func(d *models.Device) error {
+		if d.FlagCleared(now) {
+			expired = append(expired, d)
+		}
+		return nil
+	}, now.Unix())
+	if err != nil {
+		return "", 0, err
+	}
+
+	if len(expired) == 0 {
+		return "No flags to clear", 0, nil
+	}
+
+	var cleared int64
+	for _, d := range expired {
+		e.Log.WithFields(verbose.Fields{
+			"mac":      d.MAC.String(),
+			"category": d.FlagCategory,
+		}).Info("TASK - Clearing device flag")
+
+		d.Unflag()
+		if err := d.Save(); err != nil {
+			return fmt.Sprintf("Cleared %d flags", cleared), cleared, err
+		}
+		webhooks.FireDevice(e, stores.Webhooks, common.WebhookDeviceUnflagged, "", d)
+		cleared++
+	}
+	return fmt.Sprintf("Cleared %d flags", cleared), cleared, nil
+}
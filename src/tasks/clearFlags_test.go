@@ -0,0 +1,44 @@
+package tasks
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+func TestClearExpiredFlags(t *testing.T) {
+	e := common.NewTestEnvironment()
+	devStore := &stores.TestDeviceStore{}
+
+	flag := func(mac string, clears time.Time) *models.Device {
+		d := models.NewDevice(devStore, nil, &stores.TestBlacklistItem{})
+		d.MAC, _ = net.ParseMAC(mac)
+		d.Username = "alice"
+		d.Flag("investigation", "Scanning", "admin", clears)
+		return d
+	}
+
+	expired := flag("12:34:56:00:00:01", time.Now().Add(-time.Minute))
+	pending := flag("12:34:56:00:00:02", time.Now().Add(time.Hour))
+	permanent := flag("12:34:56:00:00:03", time.Time{})
+	devStore.Devices = []*models.Device{expired, pending, permanent}
+
+	result, affected, err := clearExpiredFlags(e, stores.StoreCollection{Devices: devStore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "Cleared 1 flags" || affected != 1 {
+		t.Errorf("Wrong result %q, %d", result, affected)
+	}
+
+	if expired.Flagged || expired.FlagCategory != "" {
+		t.Error("Expected expired flag to be cleared")
+	}
+	if !pending.Flagged || !permanent.Flagged {
+		t.Error("Expected flags that haven't expired to be kept")
+	}
+}
@@ -0,0 +1,246 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tasks
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/bindata"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+
+	"gopkg.in/mail.v2"
+)
+
+const oneDay = 24 * time.Hour
+
+// noticeTemplateAsset is the path of the email body template in the custom
+// data directory.
+const noticeTemplateAsset = "templates/email/expiration-notice.tmpl"
+
+var defaultNoticeTemplate = template.Must(template.New("").Parse(`Hello {{.Username}},
+
+The following devices registered to you on {{.SiteTitle}} will expire soon.
+Expired devices lose network access until they are registered again.
+{{range .Devices}}
+==================================
+MAC:         {{.MAC}}
+Description: {{.Description}}
+Platform:    {{.Platform}}
+Expires:     {{.Expires.Format "2006-01-02 15:04"}}
+==================================
+{{end}}
+{{if .RenewalURL}}You can renew your devices at {{.RenewalURL}}
+{{end}}
+{{.CompanyName}}
+`))
+
+func init() {
+	RegisterJob("expiration-notices", "", sendExpirationNotices)
+}
+
+// expirationNotice is the data given to the notice email template.
+type expirationNotice struct {
+	Username    string
+	SiteTitle   string
+	CompanyName string
+	RenewalURL  string
+	Devices     []*models.Device
+
+	stages []int
+}
+
+// noticeStage returns the reminder a device expiring at expires is due for.
+// days must be sorted largest first. Zero is returned if no reminder is due.
+func noticeStage(days []int, expires, now time.Time) int {
+	stage := 0
+	for _, d := range days {
+		if expires.After(now.Add(time.Duration(d) * oneDay)) {
+			break
+		}
+		stage = d
+	}
+	return stage
+}
+
+// loadNoticeTemplate returns the notice template from the custom data
+// directory, or the builtin template if there isn't one.
+func loadNoticeTemplate() (*template.Template, error) {
+	custom, err := bindata.GetAsset(noticeTemplateAsset)
+	if err != nil {
+		return defaultNoticeTemplate, nil
+	}
+	return template.New("").Parse(string(custom))
+}
+
+func noticeKey(mac string, expires int64, days int) string {
+	return fmt.Sprintf("%s-%d-%d", mac, expires, days)
+}
+
+// Emails users whose devices will expire within one of the configured number
+// of days. Each reminder is sent once per device expiration.
+func sendExpirationNotices(e *common.Environment, stores stores.StoreCollection) (string, int64, error) {
+	c := e.Config.ExpirationNotice
+	if !c.Enabled {
+		return "Expiration notices disabled", 0, nil
+	}
+
+	tmpl, err := loadNoticeTemplate()
+	if err != nil {
+		return "", 0, err
+	}
+
+	now := time.Now()
+	devices, err := stores.Devices.Search(
+		`"expires" > ? AND "expires" <= ? ORDER BY "username", "expires"`,
+		now.Unix(),
+		now.Add(time.Duration(c.Days[0])*oneDay).Unix(),
+	)
+	if err != nil {
+		return "", 0, err
+	}
+
+	sent, err := getSentNotices(e)
+	if err != nil {
+		return "", 0, err
+	}
+
+	notices := make(map[string]*expirationNotice)
+	usernames := make([]string, 0)
+	for _, d := range devices {
+		if d.IsBlacklisted() {
+			continue
+		}
+
+		stage := noticeStage(c.Days, d.Expires, now)
+		if stage == 0 || sent[noticeKey(d.MAC.String(), d.Expires.Unix(), stage)] {
+			continue
+		}
+
+		notice, exists := notices[d.Username]
+		if !exists {
+			notice = &expirationNotice{
+				Username:    d.Username,
+				SiteTitle:   e.Config.Core.SiteTitle,
+				CompanyName: e.Config.Core.SiteCompanyName,
+				RenewalURL:  c.RenewalURL,
+			}
+			notices[d.Username] = notice
+			usernames = append(usernames, d.Username)
+		}
+		notice.Devices = append(notice.Devices, d)
+		notice.stages = append(notice.stages, stage)
+	}
+
+	if len(notices) == 0 {
+		return "No expiration notices to send", 0, nil
+	}
+	sort.Strings(usernames)
+
+	dialer := mail.NewDialer(
+		e.Config.Email.Address,
+		e.Config.Email.Port,
+		e.Config.Email.Username,
+		e.Config.Email.Password,
+	)
+
+	sentCount, failed, noAddress := 0, 0, 0
+	for _, username := range usernames {
+		notice := notices[username]
+
+		user, err := stores.Users.GetUserByUsername(username)
+		if err != nil {
+			e.Log.WithFields(verbose.Fields{
+				"package":  "tasks:expiration-notices",
+				"username": username,
+				"error":    err,
+			}).Error("Error getting user")
+			failed++
+			continue
+		}
+
+		address := user.EmailAddress()
+		if address == "" {
+			e.Log.WithFields(verbose.Fields{
+				"package":  "tasks:expiration-notices",
+				"username": username,
+			}).Debug("User has no email address")
+			noAddress++
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, notice); err != nil {
+			return "", 0, err
+		}
+
+		m := mail.NewMessage()
+		m.SetHeader("From", e.Config.Email.FromAddress)
+		m.SetHeader("To", address)
+		m.SetHeader("Subject", c.Subject)
+		m.SetBody("text/plain", buf.String())
+
+		if err := dialer.DialAndSend(m); err != nil {
+			e.Log.WithFields(verbose.Fields{
+				"package":  "tasks:expiration-notices",
+				"username": username,
+				"error":    err,
+			}).Error("Failed sending expiration notice")
+			failed++
+			continue // Try again on the next run
+		}
+		sentCount++
+
+		for i, d := range notice.Devices {
+			if err := saveSentNotice(e, d, notice.stages[i], now); err != nil {
+				e.Log.WithFields(verbose.Fields{
+					"package": "tasks:expiration-notices",
+					"mac":     d.MAC.String(),
+					"error":   err,
+				}).Error("Error saving expiration notice")
+			}
+		}
+	}
+
+	// Forget notices for expirations that have passed
+	if _, err := e.DB.Exec(`DELETE FROM "device_notice" WHERE "expires" < ?`, now.Unix()); err != nil {
+		return "", 0, err
+	}
+
+	return fmt.Sprintf("Sent %d expiration notices, %d failed, %d users without an email address",
+		sentCount, failed, noAddress), int64(sentCount), nil
+}
+
+func getSentNotices(e *common.Environment) (map[string]bool, error) {
+	rows, err := e.DB.Query(`SELECT "mac", "expires", "days" FROM "device_notice"`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sent := make(map[string]bool)
+	for rows.Next() {
+		var mac string
+		var expires int64
+		var days int
+		if err := rows.Scan(&mac, &expires, &days); err != nil {
+			continue
+		}
+		sent[noticeKey(mac, expires, days)] = true
+	}
+	return sent, nil
+}
+
+func saveSentNotice(e *common.Environment, d *models.Device, days int, now time.Time) error {
+	sql := `INSERT INTO "device_notice" ("mac", "expires", "days", "sent") VALUES (?,?,?,?)`
+	_, err := e.DB.Exec(sql, d.MAC.String(), d.Expires.Unix(), days, now.Unix())
+	return err
+}
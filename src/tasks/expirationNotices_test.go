@@ -0,0 +1,102 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tasks
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/bindata"
+	"github.com/packet-guardian/packet-guardian/src/models"
+)
+
+func TestNoticeStage(t *testing.T) {
+	now := time.Now()
+	days := []int{14, 3, 1}
+
+	tests := []struct {
+		expires  time.Duration
+		expected int
+	}{
+		{20 * oneDay, 0},
+		{14 * oneDay, 14},
+		{10 * oneDay, 14},
+		{3 * oneDay, 3},
+		{50 * time.Hour, 3},
+		{time.Hour, 1},
+	}
+
+	for _, test := range tests {
+		if stage := noticeStage(days, now.Add(test.expires), now); stage != test.expected {
+			t.Errorf("noticeStage(%s): expected %d, got %d", test.expires, test.expected, stage)
+		}
+	}
+}
+
+func TestDefaultNoticeTemplate(t *testing.T) {
+	d := models.NewDevice(nil, nil, nil)
+	d.MAC, _ = net.ParseMAC("12:34:56:78:9a:bc")
+	d.Description = "Laptop"
+	d.Expires = time.Date(2020, time.May, 1, 12, 0, 0, 0, time.Local)
+
+	notice := &expirationNotice{
+		Username:   "tester",
+		SiteTitle:  "Packet Guardian",
+		RenewalURL: "https://pg.example.com/manage",
+		Devices:    []*models.Device{d},
+	}
+
+	var buf bytes.Buffer
+	if err := defaultNoticeTemplate.Execute(&buf, notice); err != nil {
+		t.Fatal(err)
+	}
+
+	body := buf.String()
+	for _, expected := range []string{"Hello tester", "12:34:56:78:9a:bc", "2020-05-01 12:00", "https://pg.example.com/manage"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Notice doesn't contain %q:\n%s", expected, body)
+		}
+	}
+}
+
+func TestCustomNoticeTemplate(t *testing.T) {
+	dir, err := os.MkdirTemp("", "pg-custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer bindata.SetCustomDir(bindata.CustomDir())
+
+	if err := bindata.SetCustomDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := loadNoticeTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl != defaultNoticeTemplate {
+		t.Error("Expected the builtin template without a custom file")
+	}
+
+	os.MkdirAll(filepath.Join(dir, "templates", "email"), 0755)
+	os.WriteFile(filepath.Join(dir, noticeTemplateAsset), []byte("Hi {{.Username}}"), 0644)
+
+	tmpl, err = loadNoticeTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, &expirationNotice{Username: "tester"}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "Hi tester" {
+		t.Errorf("Expected custom template, got %q", buf.String())
+	}
+}
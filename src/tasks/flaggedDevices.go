@@ -1,153 +1,190 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
 package tasks
 
 import (
-	"bytes"
-	"html/template"
+	"text/template"
 	"time"
 
+	"github.com/lfkeitel/verbose/v4"
 	"github.com/packet-guardian/packet-guardian/src/common"
 	"github.com/packet-guardian/packet-guardian/src/models/stores"
-
-	"gopkg.in/mail.v2"
-)
-
-var (
-	mailServer  *mail.Dialer
-	mailMessage *mail.Message
-
-	deviceCache = make(map[string]time.Time)
-
-	emailTemplate = template.Must(template.New("").Parse(`
-The following flagged devices were detected on the network:
-
-{{range .}}
-==================================
-MAC:        {{.MAC}}
-Username:   {{.Username}}
-Last Seen:  {{.LastSeen.Format "2006-01-02 15:04"}}
-Network:    {{.Network}}
-IP Address: {{.Address}}
-==================================
-
-{{end}}
-`))
+	"github.com/packet-guardian/packet-guardian/src/notify"
 )
 
-type tempDevice struct {
-	MAC      string
-	Username string
-	LastSeen time.Time
-	Network  string
-	Address  string
-}
-
-func setupMailDialer(c *common.Config) {
-	mailServer = mail.NewDialer(
-		c.Email.Address,
-		c.Email.Port,
-		c.Email.Username,
-		c.Email.Password,
-	)
-}
-
-func setupMailMessage(c *common.Config) {
-	mailMessage = mail.NewMessage()
-	mailMessage.SetHeader("From", c.Email.FromAddress)
-	mailMessage.SetHeader("To", c.Email.ToAddresses...)
-	mailMessage.SetHeader("Subject", "A flagged devices has been detected")
-}
-
+// flaggedDevicesTask alerts the notifiers routed to flagged devices with an
+// active lease. A device is alerted again each time it's seen after the
+// last alert. Devices in a silent flag category are never alerted.
 func flaggedDevicesTask(e *common.Environment, stores stores.StoreCollection) {
-	if e.Config.Email.Address == "" {
-		e.Log.Info("SMTP server not set, won't alert about flagged devices")
+	if len(e.Config.Alerts.Notifiers) == 0 {
+		e.Log.Info("No alert notifiers configured, won't alert about flagged devices")
 		return
 	}
 
-	setupMailDialer(e.Config)
-	setupMailMessage(e.Config)
-
-	for {
-		time.Sleep(60 * time.Second)
-		now := time.Now()
-
-		// Get flagged devices
-		flaggedDevices, err := stores.Devices.GetFlaggedDevices()
+	notifiers := make(map[string]notify.Notifier, len(e.Config.Alerts.Notifiers))
+	for _, nc := range e.Config.Alerts.Notifiers {
+		n, err := notify.New(e.Config, nc)
 		if err != nil {
-			e.Log.WithField("error", err).Error("Failed to get flagged devices")
+			e.Log.WithFields(verbose.Fields{
+				"package":  "tasks:flagged-devices",
+				"notifier": nc.Name,
+				"error":    err,
+			}).Error("Failed to create alert notifier")
 			continue
 		}
+		notifiers[nc.Name] = n
+	}
+
+	tmpl, err := notify.LoadTemplates()
+	if err != nil {
+		e.Log.WithFields(verbose.Fields{
+			"package": "tasks:flagged-devices",
+			"error":   err,
+		}).Error("Invalid custom alert templates, using defaults")
+	}
 
-		if len(flaggedDevices) == 0 {
-			e.Log.Debug("No flagged devices, sleeping")
+	for {
+		time.Sleep(60 * time.Second)
+		if !IsLeader() {
 			continue
 		}
 
-		// Filter devices
-		filtered := make([]tempDevice, 0, len(flaggedDevices)/2)
+		if err := alertFlaggedDevices(e, stores, notifiers, tmpl, time.Now()); err != nil {
+			e.Log.WithFields(verbose.Fields{
+				"package": "tasks:flagged-devices",
+				"error":   err,
+			}).Error("Failed to alert about flagged devices")
+		}
+	}
+}
 
-		for _, d := range flaggedDevices {
-			cl := d.GetCurrentLease()
+func alertFlaggedDevices(e *common.Environment, stores stores.StoreCollection, notifiers map[string]notify.Notifier, tmpl *template.Template, now time.Time) error {
+	flaggedDevices, err := stores.Devices.GetFlaggedDevices()
+	if err != nil {
+		return err
+	}
 
-			// No current lease available
-			if cl == nil {
-				continue
-			}
+	alerted, err := getFlaggedAlerts(e)
+	if err != nil {
+		return err
+	}
 
-			// Current lease is expired
-			if now.After(cl.GetEndTime()) {
-				continue
-			}
+	flagged := make(map[string]bool, len(flaggedDevices))
+	pending := make(map[string][]*notify.Device)
+	for _, d := range flaggedDevices {
+		flagged[d.MAC.String()] = true
+		cl := d.GetCurrentLease()
 
-			// Already sent an alert on the device
-			if t, exists := deviceCache[d.MAC.String()]; exists {
-				if d.LastSeen.Equal(t) {
-					continue
-				}
-			}
+		// No current lease available or it's expired
+		if cl == nil || now.After(cl.GetEndTime()) {
+			continue
+		}
 
-			filtered = append(filtered, tempDevice{
-				MAC:      d.MAC.String(),
-				Username: d.Username,
-				LastSeen: d.LastSeen,
-				Network:  cl.GetNetworkName(),
-				Address:  cl.GetIP().String(),
-			})
+		device := &notify.Device{
+			MAC:       d.MAC.String(),
+			Username:  d.Username,
+			LastSeen:  d.LastSeen,
+			Network:   cl.GetNetworkName(),
+			Address:   cl.GetIP().String(),
+			Tags:      d.Tags,
+			Category:  d.FlagCategory,
+			Reason:    d.FlagReason,
+			FlaggedBy: d.FlaggedBy,
+			FlaggedAt: d.FlaggedAt,
+			Clears:    d.FlagClears,
 		}
 
-		if len(filtered) == 0 {
-			e.Log.Debug("No flagged devices after filtering, sleeping")
-			continue
+		for _, name := range notify.Route(e.Config, device) {
+			// Already sent an alert since the device was last seen
+			if lastSeen, exists := alerted[name][device.MAC]; exists && lastSeen == d.LastSeen.Unix() {
+				continue
+			}
+			pending[name] = append(pending[name], device)
 		}
+	}
 
-		// Compose email template
-		var buf bytes.Buffer
-		if err := emailTemplate.Execute(&buf, filtered); err != nil {
-			e.Log.WithField("error", err).Error("Failed to create email template")
+	for name, devices := range pending {
+		n, exists := notifiers[name]
+		if !exists {
 			continue
 		}
 
-		// Send email
-		mailMessage.SetBody("text/plain", buf.String())
-		e.Log.Debug("Sending flagged device email")
-		if err := mailServer.DialAndSend(mailMessage); err != nil {
-			e.Log.WithField("error", err).Error("Failed sending flagged device alert")
-			continue // Don't update cache for next try
+		alert, err := notify.Render(tmpl, e.Config.Core.SiteTitle, devices)
+		if err != nil {
+			return err
 		}
 
-		// Update memory cache of alerted devices
-		for _, d := range filtered {
-			deviceCache[d.MAC] = d.LastSeen
+		e.Log.WithFields(verbose.Fields{
+			"package":  "tasks:flagged-devices",
+			"notifier": name,
+			"devices":  len(devices),
+		}).Debug("Sending flagged device alert")
+		if err := n.Notify(alert); err != nil {
+			e.Log.WithFields(verbose.Fields{
+				"package":  "tasks:flagged-devices",
+				"notifier": name,
+				"error":    err,
+			}).Error("Failed sending flagged device alert")
+			continue // Try again on the next run
 		}
 
-		trimmap := make(map[string]bool, len(flaggedDevices))
-		for _, d := range flaggedDevices {
-			trimmap[d.MAC.String()] = true
+		for _, d := range devices {
+			if err := saveFlaggedAlert(e, d, name, now); err != nil {
+				e.Log.WithFields(verbose.Fields{
+					"package":  "tasks:flagged-devices",
+					"notifier": name,
+					"mac":      d.MAC,
+					"error":    err,
+				}).Error("Error saving flagged device alert")
+			}
 		}
+	}
 
-		for m := range deviceCache {
-			if !trimmap[m] {
-				delete(deviceCache, m)
+	// Forget alerts about devices that are no longer flagged
+	forgotten := make(map[string]bool)
+	for _, macs := range alerted {
+		for mac := range macs {
+			if flagged[mac] || forgotten[mac] {
+				continue
+			}
+			if _, err := e.DB.Exec(`DELETE FROM "flagged_alert" WHERE "mac" = ?`, mac); err != nil {
+				return err
 			}
+			forgotten[mac] = true
 		}
 	}
+	return nil
+}
+
+// getFlaggedAlerts returns the last seen time of devices when they were
+// last alerted keyed by notifier then MAC address.
+func getFlaggedAlerts(e *common.Environment) (map[string]map[string]int64, error) {
+	rows, err := e.DB.Query(`SELECT "mac", "notifier", "last_seen" FROM "flagged_alert"`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerted := make(map[string]map[string]int64)
+	for rows.Next() {
+		var mac string
+		var notifier string
+		var lastSeen int64
+		if err := rows.Scan(&mac, &notifier, &lastSeen); err != nil {
+			continue
+		}
+		if alerted[notifier] == nil {
+			alerted[notifier] = make(map[string]int64)
+		}
+		alerted[notifier][mac] = lastSeen
+	}
+	return alerted, rows.Err()
+}
+
+func saveFlaggedAlert(e *common.Environment, d *notify.Device, notifier string, now time.Time) error {
+	sql := `REPLACE INTO "flagged_alert" ("mac", "notifier", "last_seen", "sent") VALUES (?,?,?,?)`
+	_, err := e.DB.Exec(sql, d.MAC, notifier, d.LastSeen.Unix(), now.Unix())
+	return err
 }
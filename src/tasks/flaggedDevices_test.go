@@ -0,0 +1,87 @@
+package tasks
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	dhcp "github.com/packet-guardian/dhcp-lib"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+	"github.com/packet-guardian/packet-guardian/src/notify"
+)
+
+type testNotifier struct {
+	alerts []*notify.Alert
+}
+
+func (n *testNotifier) Notify(a *notify.Alert) error {
+	n.alerts = append(n.alerts, a)
+	return nil
+}
+
+func TestAlertFlaggedDevices(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	e := common.NewTestEnvironment()
+	e.DB = &common.DatabaseAccessor{DB: db}
+	e.Config.Alerts.Notifiers = []common.NotifierConfig{
+		{Name: "security", Type: common.NotifierEmail},
+		{Name: "lab", Type: common.NotifierWebhook},
+	}
+	e.Config.Alerts.Routes = []common.AlertRoute{
+		{Notifiers: []string{"security"}},
+		{Tags: []string{"lab"}, Notifiers: []string{"lab"}},
+	}
+
+	now := time.Now()
+	mac, _ := net.ParseMAC("12:34:56:12:34:56")
+	leases := &stores.TestLeaseStore{Leases: []*dhcp.Lease{
+		{IP: net.ParseIP("10.0.0.5"), MAC: mac, Network: "Lab", Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+	}}
+	device := models.NewDevice(&stores.TestDeviceStore{}, leases, &stores.TestBlacklistItem{})
+	device.MAC = mac
+	device.Username = "alice"
+	device.Flagged = true
+	device.LastSeen = now.Add(-time.Minute)
+	device.Tags = models.Tags{"lab"}
+	sc := stores.StoreCollection{Devices: &stores.TestDeviceStore{Devices: []*models.Device{device}}}
+
+	security, lab := &testNotifier{}, &testNotifier{}
+	notifiers := map[string]notify.Notifier{"security": security, "lab": lab}
+	tmpl, _ := notify.LoadTemplates()
+
+	// Security was alerted when the device was last seen, a device that's no
+	// longer flagged is forgotten
+	mock.ExpectQuery(`SELECT "mac", "notifier", "last_seen" FROM "flagged_alert"`).
+		WillReturnRows(sqlmock.NewRows([]string{"mac", "notifier", "last_seen"}).
+			AddRow("12:34:56:12:34:56", "security", device.LastSeen.Unix()).
+			AddRow("ab:cd:ef:12:34:56", "security", 1))
+	mock.ExpectExec(`REPLACE INTO "flagged_alert"`).
+		WithArgs("12:34:56:12:34:56", "lab", device.LastSeen.Unix(), now.Unix()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "flagged_alert" WHERE "mac" = ?`).
+		WithArgs("ab:cd:ef:12:34:56").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := alertFlaggedDevices(e, sc, notifiers, tmpl, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(security.alerts) != 0 {
+		t.Errorf("Expected no repeat alert to security, got %d", len(security.alerts))
+	}
+	if len(lab.alerts) != 1 || lab.alerts[0].Devices[0].Address != "10.0.0.5" {
+		t.Fatalf("Expected one alert to lab, got %#v", lab.alerts)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,128 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+// SchedulerLock is the lock held by the instance running scheduled jobs and
+// alert loops.
+const SchedulerLock = "scheduler"
+
+// leader is set while this instance holds the scheduler lock.
+var leader atomic.Bool
+
+// InstanceID identifies this process as a lock holder. The process ID keeps
+// instances on the same host apart.
+func InstanceID(c *common.Config) string {
+	return fmt.Sprintf("%s:%d", c.Cluster.InstanceName, os.Getpid())
+}
+
+// IsLeader returns if this instance runs scheduled jobs and alert loops.
+func IsLeader() bool {
+	return leader.Load()
+}
+
+func leaseTTL(c *common.Config) time.Duration {
+	if ttl := c.ClusterLeaseTTL(); ttl > 0 {
+		return ttl
+	}
+	return time.Minute
+}
+
+// electLeader keeps trying to take the scheduler lock and renews it while
+// it's held. If the lock can't be renewed this instance stops running
+// scheduled work until it gets the lock back.
+func electLeader(e *common.Environment, stores stores.StoreCollection) {
+	ttl := leaseTTL(e.Config)
+	for {
+		time.Sleep(ttl / 3)
+		campaign(e, stores)
+	}
+}
+
+// campaign tries to take or renew the scheduler lock once.
+func campaign(e *common.Environment, stores stores.StoreCollection) {
+	id := InstanceID(e.Config)
+	held, err := stores.TaskLocks.Acquire(SchedulerLock, id, leaseTTL(e.Config))
+	if err != nil {
+		e.Log.WithFields(verbose.Fields{
+			"package": "tasks",
+			"error":   err,
+		}).Error("Failed to renew scheduler lock")
+		held = false
+	}
+
+	if leader.Swap(held) == held {
+		return
+	}
+	if held {
+		e.Log.WithFields(verbose.Fields{
+			"package":  "tasks",
+			"instance": id,
+		}).Notice("This instance is now running scheduled jobs")
+	} else {
+		e.Log.WithFields(verbose.Fields{
+			"package":  "tasks",
+			"instance": id,
+		}).Notice("Another instance is now running scheduled jobs")
+	}
+}
+
+// lockJob takes the cluster wide lock of a job so a run can't overlap a run
+// on another instance. The lock is renewed until the returned release
+// function is called.
+func lockJob(e *common.Environment, stores stores.StoreCollection, name string) (func(), error) {
+	id := InstanceID(e.Config)
+	lockName := "job:" + name
+	ttl := leaseTTL(e.Config)
+
+	held, err := stores.TaskLocks.Acquire(lockName, id, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !held {
+		return nil, ErrJobRunning
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := stores.TaskLocks.Acquire(lockName, id, ttl); err != nil {
+					e.Log.WithFields(verbose.Fields{
+						"package": "tasks",
+						"job":     name,
+						"error":   err,
+					}).Error("Failed to renew job lock")
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		if err := stores.TaskLocks.Release(lockName, id); err != nil {
+			e.Log.WithFields(verbose.Fields{
+				"package": "tasks",
+				"job":     name,
+				"error":   err,
+			}).Error("Failed to release job lock")
+		}
+	}, nil
+}
@@ -0,0 +1,59 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+func TestSchedulerFailover(t *testing.T) {
+	e := common.NewTestEnvironment()
+	locks := &stores.TestTaskLockStore{}
+	sc := stores.StoreCollection{JobRuns: &stores.TestJobRunStore{}, TaskLocks: locks}
+
+	// Another instance holds the scheduler lock
+	locks.Acquire(SchedulerLock, "other:1", time.Minute)
+	campaign(e, sc)
+	if IsLeader() {
+		t.Fatal("Expected instance to wait for the scheduler lock")
+	}
+
+	ran := false
+	job := &scheduledJob{
+		name: "purge",
+		run: func(*common.Environment, stores.StoreCollection) (string, int64, error) {
+			ran = true
+			return "", 0, nil
+		},
+	}
+	if err := runJob(e, sc, job); err != ErrNotLeader || ran {
+		t.Errorf("Expected scheduled run to be skipped, got %v", err)
+	}
+
+	// The other instance died and its lock expired
+	locks.Release(SchedulerLock, "other:1")
+	locks.Acquire(SchedulerLock, "other:1", -time.Second)
+	campaign(e, sc)
+	if !IsLeader() {
+		t.Fatal("Expected instance to take over the expired scheduler lock")
+	}
+	if holder, _, _ := locks.GetHolder(SchedulerLock); holder != InstanceID(e.Config) {
+		t.Errorf("Expected this instance to hold the lock, got %s", holder)
+	}
+
+	// A manual run on another instance holds the job lock
+	locks.Acquire("job:purge", "other:1", time.Minute)
+	if err := runJob(e, sc, job); err != ErrJobRunning || ran {
+		t.Errorf("Expected run to be skipped while another instance runs the job, got %v", err)
+	}
+
+	locks.Release("job:purge", "other:1")
+	if err := runJob(e, sc, job); err != nil || !ran {
+		t.Errorf("Expected job to run, got %v", err)
+	}
+	if holder, _, _ := locks.GetHolder("job:purge"); holder != "" {
+		t.Errorf("Expected job lock to be released, held by %s", holder)
+	}
+}
@@ -0,0 +1,64 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tasks
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+func init() {
+	RegisterJob("purge-lease-history", "0 4 * * *", cleanUpLeaseHistory)
+}
+
+// Deletes lease history older than the configured retention
+func cleanUpLeaseHistory(e *common.Environment, stores stores.StoreCollection) (string, int64, error) {
+	retention := e.Config.LeaseHistoryRetention()
+	if retention == 0 {
+		return "Lease history is kept forever", 0, nil
+	}
+
+	n, err := stores.Leases.PurgeLeaseHistory(time.Now().Add(-retention))
+	if err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprintf("Deleted %d lease history records", n), n, nil
+}
+
+// leaseHistoryTask copies the lease table into the lease history. Leases are
+// recorded when they're saved, the snapshot fills in any that failed. Lease
+// rows are overwritten when an address is reused so this runs more often than
+// the job scheduler.
+func leaseHistoryTask(e *common.Environment, stores stores.StoreCollection) {
+	interval := e.Config.LeaseSnapshotInterval()
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+
+	for {
+		if !IsLeader() {
+			time.Sleep(interval)
+			continue
+		}
+
+		n, err := stores.Leases.SnapshotLeaseHistory()
+		if err != nil {
+			e.Log.WithFields(verbose.Fields{
+				"package": "tasks:lease-history",
+				"error":   err,
+			}).Error("Failed to snapshot leases")
+		} else {
+			e.Log.WithFields(verbose.Fields{
+				"package": "tasks:lease-history",
+				"changed": n,
+			}).Debug("Lease history updated")
+		}
+		time.Sleep(interval)
+	}
+}
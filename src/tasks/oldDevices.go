@@ -6,56 +6,101 @@ package tasks
 
 import (
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/lfkeitel/verbose/v4"
 	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
 	"github.com/packet-guardian/packet-guardian/src/models/stores"
+	"github.com/packet-guardian/packet-guardian/src/webhooks"
 )
 
 func init() {
-	RegisterJob("Purge old devices", cleanUpOldDevices)
+	RegisterJob("purge-devices", "0 3 * * *", cleanUpOldDevices)
 }
 
-// Deletes devices that haven't been seen in the last 6 months
-// and devices which expired 7 days ago
-func cleanUpOldDevices(e *common.Environment, stores stores.StoreCollection) (string, error) {
+// Moves devices that haven't been seen within Purge.DeviceUnseenFor and
+// devices which expired more than Purge.DeviceExpiredFor ago to the trash
+func cleanUpOldDevices(e *common.Environment, stores stores.StoreCollection) (string, int64, error) {
 	// Use a constant date
 	now := time.Now()
-	d, err := time.ParseDuration(e.Config.Registration.RollingExpirationLength)
-	if err != nil {
-		e.Log.WithFields(verbose.Fields{
-			"package": "tasks:old-devices",
-			"default": "4380h",
-		}).Notice("Invalid RollingExpirationLength setting, using default")
-		d = time.Duration(4380) * time.Hour
+
+	where := `"expires" != 1 AND "expires" < ?`
+	vals := []interface{}{now.Add(-e.Config.PurgeDeviceExpiredFor()).Unix()}
+	if unseen := e.Config.PurgeDeviceUnseenFor(); unseen > 0 {
+		where = `"last_seen" < ? OR (` + where + `)`
+		vals = append([]interface{}{now.Add(-unseen).Unix()}, vals...)
 	}
-	d = -d // This is how long ago a device was last seen, must be negative
+	where = `"expires" != 0 AND (` + where + `)`
 
-	sqlSel := `SELECT "mac" FROM "device" WHERE "expires" != 0 AND ("last_seen" < ? OR ("expires" != 1 AND "expires" < ?))`
-	rows, err := e.DB.Query(sqlSel, now.Add(d).Unix(), now.Unix())
+	rows, err := e.DB.Query(`SELECT "mac", "username" FROM "device" WHERE `+where, vals...)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 	defer rows.Close()
 
-	i := 0
+	var events []*models.DeviceEvent
 	for rows.Next() {
-		var mac string
-		rows.Scan(&mac)
-		e.Log.WithField("mac", mac).Info("TASK - Deleting device")
-		i++
+		var macStr, username string
+		rows.Scan(&macStr, &username)
+
+		mac, err := net.ParseMAC(macStr)
+		if err != nil {
+			continue
+		}
+		event := models.NewDeviceEvent(stores.DeviceEvents, mac, models.DeviceEventDeleted)
+		event.Username = username
+		event.Details = "Moved to trash by task"
+		events = append(events, event)
 	}
 
-	if i == 0 {
-		return "No devices to delete", nil
+	if len(events) == 0 {
+		return "No devices to delete", 0, nil
 	}
 
-	sql := `DELETE FROM "device" WHERE "expires" != 0 AND ("last_seen" < ? OR ("expires" != 1 AND "expires" < ?))`
-	results, err := e.DB.Exec(sql, now.Add(d).Unix(), now.Unix())
+	if e.Config.Purge.DryRun {
+		for _, event := range events {
+			e.Log.WithFields(verbose.Fields{
+				"mac":      event.MAC.String(),
+				"username": event.Username,
+			}).Info("TASK - Would delete device")
+		}
+		return fmt.Sprintf("Dry run, would move %d devices to the trash", len(events)), 0, nil
+	}
+
+	// Load the devices for webhooks before they're moved to the trash
+	var purged []*models.Device
+	if len(e.Config.Webhooks.Endpoints) > 0 {
+		purged, err = stores.Devices.Search(where, vals...)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+
+	numOfRows, err := stores.Trash.TrashDevices(where, "", vals...)
 	if err != nil {
-		return "", err
+		return "", 0, err
+	}
+
+	// Devices purged only for not being seen haven't expired
+	for _, d := range purged {
+		event := common.WebhookDeviceDeleted
+		if d.Expires.Unix() > 1 && d.Expires.Before(now) {
+			event = common.WebhookDeviceExpired
+		}
+		webhooks.FireDevice(e, stores.Webhooks, event, "", d)
+	}
+
+	for _, event := range events {
+		e.Log.WithField("mac", event.MAC.String()).Info("TASK - Deleting device")
+		if err := event.Save(); err != nil {
+			e.Log.WithFields(verbose.Fields{
+				"error":   err,
+				"package": "tasks:old-devices",
+				"mac":     event.MAC.String(),
+			}).Error("Error saving device event")
+		}
 	}
-	numOfRows, _ := results.RowsAffected()
-	return fmt.Sprintf("Deleted %d devices", numOfRows), nil
+	return fmt.Sprintf("Moved %d devices to the trash", numOfRows), numOfRows, nil
 }
@@ -17,28 +17,28 @@ import (
 var sessionExpiration = time.Duration(-24) * time.Hour
 
 func init() {
-	RegisterJob("Purge old web sessions", cleanUpExpiredSessions)
+	RegisterJob("purge-sessions", "", cleanUpExpiredSessions)
 }
 
-func cleanUpExpiredSessions(e *common.Environment, stores stores.StoreCollection) (string, error) {
+func cleanUpExpiredSessions(e *common.Environment, stores stores.StoreCollection) (string, int64, error) {
 	switch e.Config.Webserver.SessionStore {
 	case "filesystem":
 		return cleanFileSystemSessions(e)
 	case "database":
 		return cleanDBSessions(e)
 	}
-	return "", nil
+	return "", 0, nil
 }
 
-func cleanFileSystemSessions(e *common.Environment) (string, error) {
+func cleanFileSystemSessions(e *common.Environment) (string, int64, error) {
 	w := &sessionWalker{
 		n:           time.Now().Add(sessionExpiration),
 		sessionsDir: e.Config.Webserver.SessionsDir,
 	}
 	if err := w.walk(); err != nil {
-		return "", err
+		return "", 0, err
 	}
-	return fmt.Sprintf("Deleted %d sessions", w.c), nil
+	return fmt.Sprintf("Deleted %d sessions", w.c), int64(w.c), nil
 }
 
 type sessionWalker struct {
@@ -66,12 +66,12 @@ func (s *sessionWalker) sessionDirWalker(path string, info os.FileInfo, err erro
 	return nil
 }
 
-func cleanDBSessions(e *common.Environment) (string, error) {
+func cleanDBSessions(e *common.Environment) (string, int64, error) {
 	expired := time.Now().Add(sessionExpiration)
 	results, err := e.DB.Exec(`DELETE FROM "sessions" WHERE "modified_on" < ?`, expired.Unix())
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 	rowsAffected, _ := results.RowsAffected()
-	return fmt.Sprintf("Deleted %d sessions", rowsAffected), nil
+	return fmt.Sprintf("Deleted %d sessions", rowsAffected), rowsAffected, nil
 }
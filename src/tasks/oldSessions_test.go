@@ -16,7 +16,7 @@ func TestFilesystemSessionTaskEmptyDir(t *testing.T) {
 	os.MkdirAll("sessions", 0755)
 	defer os.RemoveAll("sessions")
 
-	_, err := cleanFileSystemSessions(fakeEnv)
+	_, _, err := cleanFileSystemSessions(fakeEnv)
 	if err != nil {
 		t.Fatal(err)
 	}
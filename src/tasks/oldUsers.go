@@ -13,36 +13,42 @@ import (
 )
 
 func init() {
-	RegisterJob("Purge old users", cleanUpExpiredUsers)
+	RegisterJob("purge-users", "30 3 * * *", cleanUpExpiredUsers)
 }
 
-// Deletes users that expired 7 days ago
-func cleanUpExpiredUsers(e *common.Environment, stores stores.StoreCollection) (string, error) {
-	now := time.Now().Add(time.Duration(-7) * 24 * time.Hour)
-	sqlSel := `SELECT "username" FROM "user" WHERE "valid_forever" = 0 AND "valid_end" < ?`
-	rows, err := e.DB.Query(sqlSel, now.Unix())
+// Moves users that expired more than Purge.UserExpiredFor ago to the trash
+func cleanUpExpiredUsers(e *common.Environment, stores stores.StoreCollection) (string, int64, error) {
+	expired := time.Now().Add(-e.Config.PurgeUserExpiredFor())
+	where := `"valid_forever" = 0 AND "valid_end" < ?`
+	rows, err := e.DB.Query(`SELECT "username" FROM "user" WHERE `+where, expired.Unix())
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 	defer rows.Close()
 
+	logMsg := "TASK - Deleting user"
+	if e.Config.Purge.DryRun {
+		logMsg = "TASK - Would delete user"
+	}
+
 	i := 0
 	for rows.Next() {
 		var username string
 		rows.Scan(&username)
-		e.Log.WithField("username", username).Info("TASK - Deleting user")
+		e.Log.WithField("username", username).Info(logMsg)
 		i++
 	}
 
 	if i == 0 {
-		return "No users to delete", nil
+		return "No users to delete", 0, nil
+	}
+	if e.Config.Purge.DryRun {
+		return fmt.Sprintf("Dry run, would move %d users to the trash", i), 0, nil
 	}
 
-	sql := `DELETE FROM "user" WHERE "valid_forever" = 0 AND "valid_end" < ?`
-	results, err := e.DB.Exec(sql, now.Unix())
+	numOfRows, err := stores.Trash.TrashUsers(where, "", expired.Unix())
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
-	numOfRows, _ := results.RowsAffected()
-	return fmt.Sprintf("Deleted %d users", numOfRows), nil
+	return fmt.Sprintf("Moved %d users to the trash", numOfRows), numOfRows, nil
 }
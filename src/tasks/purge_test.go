@@ -0,0 +1,128 @@
+package tasks
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+func TestPurgeDryRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	e := common.NewTestEnvironment()
+	e.DB = &common.DatabaseAccessor{DB: db}
+	e.Config.Purge.DryRun = true
+	e.Config.Purge.DeviceUnseenFor = "24h"
+	e.Config.Trash.Retention = "720h"
+
+	sc := stores.StoreCollection{
+		Trash: &stores.TestTrashStore{
+			Items: []*models.TrashItem{
+				{ID: 1, Entity: models.TrashEntityDevice, Deleted: time.Now().Add(-800 * time.Hour)},
+				{ID: 2, Entity: models.TrashEntityUser, Deleted: time.Now()},
+			},
+		},
+	}
+
+	mock.ExpectQuery(`SELECT "mac", "username" FROM "device" WHERE "expires" != 0 AND \("last_seen" < \? OR \("expires" != 1 AND "expires" < \?\)\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"mac", "username"}).
+			AddRow("ab:cd:ef:12:34:56", "alice").
+			AddRow("ab:cd:ef:12:34:57", "bob"))
+	mock.ExpectQuery(`SELECT "username" FROM "user" WHERE "valid_forever" = 0 AND "valid_end" < \?`).
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("carol"))
+
+	tests := []struct {
+		job      Job
+		expected string
+	}{
+		{cleanUpOldDevices, "Dry run, would move 2 devices to the trash"},
+		{cleanUpExpiredUsers, "Dry run, would move 1 users to the trash"},
+		{emptyTrash, "Dry run, would purge 1 records from the trash"},
+	}
+
+	for _, test := range tests {
+		result, affected, err := test.job(e, sc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != test.expected || affected != 0 {
+			t.Errorf("Expected %q with nothing changed, got %q, %d", test.expected, result, affected)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPurgeWebhookEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	e := common.NewTestEnvironment()
+	e.DB = &common.DatabaseAccessor{DB: db}
+	e.Config.Purge.DeviceUnseenFor = "24h"
+	e.Config.Trash.Retention = "720h"
+	e.Config.Webhooks.Endpoints = []common.WebhookEndpoint{{Name: "siem", URL: "http://example.com"}}
+
+	deviceStore := &stores.TestDeviceStore{}
+	expired := models.NewDevice(deviceStore, nil, &stores.TestBlacklistItem{})
+	expired.MAC, _ = net.ParseMAC("ab:cd:ef:12:34:56")
+	expired.Expires = time.Now().Add(-800 * time.Hour)
+	unseen := models.NewDevice(deviceStore, nil, &stores.TestBlacklistItem{})
+	unseen.MAC, _ = net.ParseMAC("ab:cd:ef:12:34:57")
+	unseen.Expires = time.Now().Add(time.Hour)
+	deviceStore.Devices = []*models.Device{expired, unseen}
+
+	queue := &stores.TestWebhookStore{}
+	sc := stores.StoreCollection{
+		Devices:      deviceStore,
+		DeviceEvents: &stores.TestDeviceEventStore{},
+		Webhooks:     queue,
+		Trash: &stores.TestTrashStore{
+			Items: []*models.TrashItem{
+				{ID: 3, Entity: models.TrashEntityDevice, Key: "ab:cd:ef:12:34:58", Deleted: time.Now().Add(-800 * time.Hour)},
+				{ID: 4, Entity: models.TrashEntityDevice, Key: "ab:cd:ef:12:34:59", Deleted: time.Now()},
+				{ID: 5, Entity: models.TrashEntityUser, Key: "carol", Deleted: time.Now().Add(-800 * time.Hour)},
+			},
+		},
+	}
+
+	mock.ExpectQuery(`SELECT "mac", "username" FROM "device"`).
+		WillReturnRows(sqlmock.NewRows([]string{"mac", "username"}).
+			AddRow("ab:cd:ef:12:34:56", "alice").
+			AddRow("ab:cd:ef:12:34:57", "bob"))
+
+	if _, _, err := cleanUpOldDevices(e, sc); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := emptyTrash(e, sc); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{common.WebhookDeviceExpired, common.WebhookDeviceDeleted, common.WebhookDeviceDeleted}
+	if len(queue.Deliveries) != len(expected) {
+		t.Fatalf("Expected %d webhook deliveries, got %d", len(expected), len(queue.Deliveries))
+	}
+	for i, event := range expected {
+		if queue.Deliveries[i].Event != event {
+			t.Errorf("Delivery %d: expected %s, got %s", i, event, queue.Deliveries[i].Event)
+		}
+	}
+	if payload := queue.Deliveries[2].Payload; !strings.Contains(payload, `"permanent":true`) || !strings.Contains(payload, "ab:cd:ef:12:34:58") {
+		t.Errorf("Expected permanent delete of the purged device, got %s", payload)
+	}
+}
@@ -6,73 +6,330 @@ package tasks
 
 import (
 	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/lfkeitel/verbose/v4"
 	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/cron"
+	"github.com/packet-guardian/packet-guardian/src/metrics"
+	"github.com/packet-guardian/packet-guardian/src/models"
 	"github.com/packet-guardian/packet-guardian/src/models/stores"
 )
 
-type Job func(*common.Environment, stores.StoreCollection) (string, error)
+// Job is a scheduled task. It returns a summary of what it did and the
+// number of records it changed or messages it sent.
+type Job func(*common.Environment, stores.StoreCollection) (result string, affected int64, err error)
 
-var jobs = make(map[string]Job)
+var (
+	// ErrJobRunning is returned when a job is started while a run of the same
+	// job hasn't finished.
+	ErrJobRunning = errors.New("Job is already running")
+	// ErrUnknownJob is returned when running a job that isn't registered.
+	ErrUnknownJob = errors.New("Job doesn't exist")
+	// ErrNotLeader is returned when a scheduled run is skipped because
+	// another instance runs scheduled jobs.
+	ErrNotLeader = errors.New("Another instance runs scheduled jobs")
+)
+
+type scheduledJob struct {
+	name     string
+	schedule string
+	run      Job
+	running  sync.Mutex
+
+	// Scheduler state shown on the jobs page
+	stateLock sync.Mutex
+	isRunning bool
+	nextRun   time.Time
+}
+
+var jobs = make(map[string]*scheduledJob)
+
+// JobInfo describes a registered job. NextRun is zero if the job isn't
+// scheduled by this instance.
+type JobInfo struct {
+	Name     string
+	Schedule string
+	Disabled bool
+	Running  bool
+	NextRun  time.Time
+}
 
-func RegisterJob(name string, job Job) error {
+// RegisterJob adds a job to the scheduler. Schedule is the default cron
+// schedule of the job and can be changed in the [jobs] configuration table
+// using the job name. An empty schedule runs the job every
+// Core.JobSchedulerWakeUp.
+func RegisterJob(name, schedule string, job Job) error {
 	if _, exists := jobs[name]; exists {
 		return errors.New("Job already exists")
 	}
-	jobs[name] = job
+	jobs[name] = &scheduledJob{
+		name:     name,
+		schedule: schedule,
+		run:      job,
+	}
 	return nil
 }
 
-func StartTaskScheduler(e *common.Environment, stores stores.StoreCollection) {
-	d, err := time.ParseDuration(e.Config.Core.JobSchedulerWakeUp)
+// RegisteredJobs returns all registered jobs sorted by name.
+func RegisteredJobs(c *common.Config) []*JobInfo {
+	infos := make([]*JobInfo, 0, len(jobs))
+	for _, job := range jobs {
+		spec, disabled := job.specFor(c)
+
+		job.stateLock.Lock()
+		infos = append(infos, &JobInfo{
+			Name:     job.name,
+			Schedule: spec,
+			Disabled: disabled,
+			Running:  job.isRunning,
+			NextRun:  job.nextRun,
+		})
+		job.stateLock.Unlock()
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// RunJob starts a job in the background. TriggeredBy is recorded with the
+// run. Disabled jobs may be run manually and from any instance.
+func RunJob(e *common.Environment, stores stores.StoreCollection, name, triggeredBy string) error {
+	job, exists := jobs[name]
+	if !exists {
+		return ErrUnknownJob
+	}
+
+	release, err := job.lock(e, stores)
 	if err != nil {
-		e.Log.WithFields(verbose.Fields{
-			"package": "tasks:old-devices",
-			"default": "1h",
-		}).Notice("Invalid JobSchedulerWakeUp setting, using default")
-		d = time.Hour
+		return err
 	}
 
+	go func() {
+		defer release()
+		job.execute(e, stores, triggeredBy)
+	}()
+	return nil
+}
+
+// StartTaskScheduler starts the scheduled jobs and alert loops. Every
+// instance sharing the database schedules the jobs but only the instance
+// holding the scheduler lock runs them.
+func StartTaskScheduler(e *common.Environment, stores stores.StoreCollection) {
+	campaign(e, stores)
+	go electLeader(e, stores)
+
 	go flaggedDevicesTask(e, stores)
+	go leaseHistoryTask(e, stores)
+	go webhookDeliveryTask(e, stores)
+
+	for name := range e.Config.Jobs {
+		if _, exists := jobs[name]; !exists {
+			e.Log.WithFields(verbose.Fields{
+				"package": "tasks",
+				"job":     name,
+			}).Warning("Unknown job in configuration")
+		}
+	}
+
+	for _, job := range jobs {
+		schedule, err := job.scheduleFor(e.Config)
+		if err != nil {
+			e.Log.WithFields(verbose.Fields{
+				"package": "tasks",
+				"job":     job.name,
+				"error":   err,
+				"default": "@every 1h",
+			}).Notice("Invalid job schedule, using default")
+			schedule, _ = cron.Parse("@every 1h")
+		}
+		if schedule == nil {
+			e.Log.WithFields(verbose.Fields{
+				"package": "tasks",
+				"job":     job.name,
+			}).Info("Job disabled")
+			continue
+		}
+		go scheduleJob(e, stores, job, schedule)
+	}
+}
+
+// specFor returns the schedule of a job from the configuration and if the
+// job is disabled.
+func (j *scheduledJob) specFor(c *common.Config) (string, bool) {
+	spec := j.schedule
+	if jc, ok := c.Jobs[j.name]; ok {
+		if jc.Disabled {
+			return spec, true
+		}
+		if jc.Schedule != "" {
+			spec = jc.Schedule
+		}
+	}
+
+	if spec == "" {
+		spec = "@every " + c.Core.JobSchedulerWakeUp
+	}
+	return spec, false
+}
+
+// scheduleFor returns the schedule of a job from the configuration, or nil
+// if the job is disabled.
+func (j *scheduledJob) scheduleFor(c *common.Config) (cron.Schedule, error) {
+	spec, disabled := j.specFor(c)
+	if disabled {
+		return nil, nil
+	}
+	return cron.Parse(spec)
+}
+
+// scheduleJob runs a job on its schedule. The next run is calculated after
+// the previous run finishes so missed runs aren't made up.
+func scheduleJob(e *common.Environment, stores stores.StoreCollection, job *scheduledJob, schedule cron.Schedule) {
 	for {
+		next := schedule.Next(time.Now())
+		job.stateLock.Lock()
+		job.nextRun = next
+		job.stateLock.Unlock()
+
+		if next.IsZero() {
+			e.Log.WithFields(verbose.Fields{
+				"package": "tasks",
+				"job":     job.name,
+			}).Error("Job schedule has no next run")
+			return
+		}
+
 		e.Log.WithFields(verbose.Fields{
 			"package":  "tasks",
-			"duration": d.String(),
-		}).Info("Job scheduler sleeping")
-		time.Sleep(d)
-		runJobs(e, stores)
+			"job":      job.name,
+			"next-run": next.Format(common.TimeFormat),
+		}).Debug("Job scheduled")
+		time.Sleep(time.Until(next))
+		runJob(e, stores, job)
+	}
+}
+
+// runJob runs a job if this instance runs scheduled jobs and the job isn't
+// already running.
+func runJob(e *common.Environment, stores stores.StoreCollection, job *scheduledJob) error {
+	if !IsLeader() {
+		e.Log.WithFields(verbose.Fields{
+			"package": "tasks",
+			"job":     job.name,
+		}).Debug("Another instance runs scheduled jobs, skipping run")
+		return ErrNotLeader
+	}
+
+	release, err := job.lock(e, stores)
+	if err == ErrJobRunning {
+		e.Log.WithFields(verbose.Fields{
+			"package": "tasks",
+			"job":     job.name,
+		}).Notice("Job is still running, skipping run")
+		return err
+	} else if err != nil {
+		e.Log.WithFields(verbose.Fields{
+			"package": "tasks",
+			"job":     job.name,
+			"error":   err,
+		}).Error("Failed to lock job")
+		return err
+	}
+	defer release()
+
+	return job.execute(e, stores, "")
+}
+
+// lock takes the local and cluster wide locks of the job. The returned
+// function releases both.
+func (j *scheduledJob) lock(e *common.Environment, stores stores.StoreCollection) (func(), error) {
+	if !j.running.TryLock() {
+		return nil, ErrJobRunning
 	}
+
+	release, err := lockJob(e, stores, j.name)
+	if err != nil {
+		j.running.Unlock()
+		return nil, err
+	}
+
+	return func() {
+		release()
+		j.running.Unlock()
+	}, nil
 }
 
-func runJobs(e *common.Environment, stores stores.StoreCollection) {
+// execute runs the job and records the run. The caller must hold the job
+// locks.
+func (j *scheduledJob) execute(e *common.Environment, stores stores.StoreCollection, triggeredBy string) (err error) {
+	run := models.NewJobRun(stores.JobRuns, j.name)
+	run.TriggeredBy = triggeredBy
+	run.Started = time.Now()
+
+	j.stateLock.Lock()
+	j.isRunning = true
+	j.stateLock.Unlock()
+
 	defer func() {
 		if r := recover(); r != nil {
-			e.Log.WithField("Err", r).
-				Alert("Recovered from panic running scheduled jobs")
+			e.Log.WithFields(verbose.Fields{
+				"package": "tasks",
+				"job":     j.name,
+				"Err":     r,
+			}).Alert("Recovered from panic running scheduled job")
+			err = fmt.Errorf("Job panicked: %v", r)
+			run.Error = err.Error()
 		}
-	}()
 
-	// Run through a list of tasks
-	for name, job := range jobs {
-		e.Log.WithFields(verbose.Fields{
-			"package": "tasks",
-			"job":     name,
-		}).Info("Running scheduled job")
-		result, err := job(e, stores)
-		if err != nil {
+		j.stateLock.Lock()
+		j.isRunning = false
+		j.stateLock.Unlock()
+
+		run.Finished = time.Now()
+		result := metrics.ResultSuccess
+		if run.Failed() {
+			result = metrics.ResultFailure
+		}
+		metrics.JobRuns.Inc(j.name, result)
+		metrics.JobDuration.Observe(run.Finished.Sub(run.Started).Seconds(), j.name)
+
+		if saveErr := run.Save(); saveErr != nil {
 			e.Log.WithFields(verbose.Fields{
 				"package": "tasks",
-				"job":     name,
-				"error":   err,
-			}).Error("Job failed")
-			continue
+				"job":     j.name,
+				"error":   saveErr,
+			}).Error("Error saving job run")
 		}
+	}()
+
+	e.Log.WithFields(verbose.Fields{
+		"package":      "tasks",
+		"job":          j.name,
+		"triggered-by": triggeredBy,
+	}).Info("Running scheduled job")
+
+	run.Result, run.Affected, err = j.run(e, stores)
+	if err != nil {
+		run.Error = err.Error()
 		e.Log.WithFields(verbose.Fields{
 			"package": "tasks",
-			"job":     name,
-			"result":  result,
-		}).Info("Job finished")
+			"job":     j.name,
+			"error":   err,
+		}).Error("Job failed")
+		return err
 	}
+
+	e.Log.WithFields(verbose.Fields{
+		"package":  "tasks",
+		"job":      j.name,
+		"result":   run.Result,
+		"affected": run.Affected,
+	}).Info("Job finished")
+	return nil
 }
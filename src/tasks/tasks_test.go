@@ -0,0 +1,120 @@
+package tasks
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+func TestJobScheduleFromConfig(t *testing.T) {
+	c := common.NewEmptyConfig()
+	c.Core.JobSchedulerWakeUp = "2h"
+	c.Jobs = map[string]common.JobConfig{
+		"nightly":  {Schedule: "0 3 * * *"},
+		"disabled": {Disabled: true},
+	}
+
+	start := time.Date(2026, time.March, 4, 10, 30, 0, 0, time.Local)
+	tests := []struct {
+		job      *scheduledJob
+		expected time.Time
+	}{
+		{&scheduledJob{name: "nightly", schedule: "@hourly"}, time.Date(2026, time.March, 5, 3, 0, 0, 0, time.Local)},
+		{&scheduledJob{name: "default", schedule: "@hourly"}, time.Date(2026, time.March, 4, 11, 0, 0, 0, time.Local)},
+		{&scheduledJob{name: "wakeup"}, start.Add(2 * time.Hour)},
+	}
+
+	for _, test := range tests {
+		schedule, err := test.job.scheduleFor(c)
+		if err != nil {
+			t.Fatalf("Job %s: %s", test.job.name, err)
+		}
+		if next := schedule.Next(start); !next.Equal(test.expected) {
+			t.Errorf("Job %s: expected next run %s, got %s", test.job.name, test.expected, next)
+		}
+	}
+
+	schedule, err := (&scheduledJob{name: "disabled", schedule: "@hourly"}).scheduleFor(c)
+	if err != nil || schedule != nil {
+		t.Errorf("Expected disabled job to have no schedule, got %v, %v", schedule, err)
+	}
+}
+
+func TestRunJobDoesNotOverlap(t *testing.T) {
+	e := common.NewTestEnvironment()
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	job := &scheduledJob{
+		name: "slow",
+		run: func(*common.Environment, stores.StoreCollection) (string, int64, error) {
+			close(started)
+			<-finish
+			return "", 0, nil
+		},
+	}
+	sc := stores.StoreCollection{JobRuns: &stores.TestJobRunStore{}, TaskLocks: &stores.TestTaskLockStore{}}
+	campaign(e, sc)
+
+	done := make(chan error)
+	go func() { done <- runJob(e, sc, job) }()
+	<-started
+
+	if err := runJob(e, sc, job); err != ErrJobRunning {
+		t.Errorf("Expected second run to be skipped, got %v", err)
+	}
+
+	close(finish)
+	if err := <-done; err != nil {
+		t.Errorf("First run failed: %s", err)
+	}
+}
+
+func TestRunJobRecordsRun(t *testing.T) {
+	e := common.NewTestEnvironment()
+	runStore := &stores.TestJobRunStore{}
+	sc := stores.StoreCollection{JobRuns: runStore, TaskLocks: &stores.TestTaskLockStore{}}
+	campaign(e, sc)
+
+	fail := true
+	job := &scheduledJob{
+		name: "purge",
+		run: func(*common.Environment, stores.StoreCollection) (string, int64, error) {
+			if fail {
+				return "", 0, errors.New("database gone")
+			}
+			return "Purged 3 devices", 3, nil
+		},
+	}
+
+	if err := runJob(e, sc, job); err == nil {
+		t.Fatal("Expected failing job to return an error")
+	}
+	fail = false
+	release, err := job.lock(e, sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := job.execute(e, sc, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	if len(runStore.Runs) != 2 {
+		t.Fatalf("Expected 2 recorded runs, got %d", len(runStore.Runs))
+	}
+	if failed := runStore.Runs[0]; failed.Error != "database gone" || failed.TriggeredBy != "" {
+		t.Errorf("Expected scheduled failed run, got %#v", failed)
+	}
+	if ok := runStore.Runs[1]; ok.Failed() || ok.Affected != 3 || ok.Result != "Purged 3 devices" || ok.TriggeredBy != "admin" {
+		t.Errorf("Expected manual successful run, got %#v", ok)
+	}
+
+	status, _ := runStore.GetJobStatus("purge")
+	if status.LastRun != runStore.Runs[1] || !status.FailingSince.IsZero() {
+		t.Errorf("Expected job to be healthy after a successful run, got %#v", status)
+	}
+}
@@ -0,0 +1,65 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tasks
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+	"github.com/packet-guardian/packet-guardian/src/webhooks"
+)
+
+func init() {
+	RegisterJob("empty-trash", "30 4 * * *", emptyTrash)
+}
+
+// Permanently deletes devices and users that have been in the trash longer
+// than the configured retention, archiving them first if enabled
+func emptyTrash(e *common.Environment, stores stores.StoreCollection) (string, int64, error) {
+	retention := e.Config.TrashRetention()
+	if retention == 0 {
+		return "Trash is kept until restored", 0, nil
+	}
+	before := time.Now().Add(-retention)
+
+	var purged []*models.TrashItem
+	if e.Config.Purge.DryRun || len(e.Config.Webhooks.Endpoints) > 0 {
+		items, err := stores.Trash.GetTrash()
+		if err != nil {
+			return "", 0, err
+		}
+
+		for _, item := range items {
+			if item.Deleted.Before(before) {
+				purged = append(purged, item)
+			}
+		}
+	}
+
+	if e.Config.Purge.DryRun {
+		return fmt.Sprintf("Dry run, would purge %d records from the trash", len(purged)), 0, nil
+	}
+
+	n, err := stores.Trash.Purge(before, e.Config.Purge.Archive)
+	if err != nil {
+		return "", 0, err
+	}
+
+	for _, item := range purged {
+		if item.Entity == models.TrashEntityDevice {
+			webhooks.Fire(e, stores.Webhooks, common.WebhookDeviceDeleted, "", &webhooks.TrashedDeviceData{
+				Device:    item,
+				Permanent: true,
+			})
+		}
+	}
+	if e.Config.Purge.Archive {
+		return fmt.Sprintf("Archived and purged %d records from the trash", n), n, nil
+	}
+	return fmt.Sprintf("Purged %d records from the trash", n), n, nil
+}
@@ -0,0 +1,102 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tasks
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+	"github.com/packet-guardian/packet-guardian/src/webhooks"
+)
+
+// Maximum number of deliveries sent each run
+const webhookBatchSize = 50
+
+func init() {
+	RegisterJob("purge-webhook-log", "0 5 * * *", purgeWebhookLog)
+}
+
+// webhookDeliveryTask sends queued webhook deliveries that are due.
+func webhookDeliveryTask(e *common.Environment, stores stores.StoreCollection) {
+	if len(e.Config.Webhooks.Endpoints) == 0 {
+		e.Log.Info("No webhook endpoints configured, won't deliver webhooks")
+		return
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	for {
+		time.Sleep(10 * time.Second)
+		if !IsLeader() {
+			continue
+		}
+
+		if err := deliverWebhooks(e, stores, client, time.Now()); err != nil {
+			e.Log.WithFields(verbose.Fields{
+				"package": "tasks:webhooks",
+				"error":   err,
+			}).Error("Failed to deliver webhooks")
+		}
+	}
+}
+
+func deliverWebhooks(e *common.Environment, stores stores.StoreCollection, client *http.Client, now time.Time) error {
+	due, err := stores.Webhooks.GetDue(now, webhookBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range due {
+		d.Attempts++
+
+		ep, exists := e.Config.WebhookEndpoint(d.Endpoint)
+		if !exists {
+			d.Status = models.WebhookFailed
+			d.LastError = "Endpoint no longer configured"
+		} else if code, err := webhooks.Deliver(client, ep, d); err != nil {
+			d.ResponseCode = code
+			d.LastError = err.Error()
+			if d.Attempts >= e.Config.Webhooks.MaxAttempts {
+				d.Status = models.WebhookFailed
+			} else {
+				d.NextAttempt = now.Add(webhooks.Backoff(d.Attempts))
+			}
+		} else {
+			d.ResponseCode = code
+			d.LastError = ""
+			d.Status = models.WebhookDelivered
+			d.Delivered = now
+		}
+
+		if d.Status == models.WebhookFailed {
+			e.Log.WithFields(verbose.Fields{
+				"package":  "tasks:webhooks",
+				"endpoint": d.Endpoint,
+				"event":    d.Event,
+				"delivery": d.ID,
+				"error":    d.LastError,
+			}).Error("Webhook delivery failed")
+		}
+
+		if err := stores.Webhooks.SaveAttempt(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deletes finished webhook deliveries older than the log retention
+func purgeWebhookLog(e *common.Environment, stores stores.StoreCollection) (string, int64, error) {
+	before := time.Now().Add(-e.Config.WebhookLogRetention())
+	purged, err := stores.Webhooks.PurgeDeliveries(before)
+	if err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprintf("Purged %d webhook deliveries", purged), purged, nil
+}
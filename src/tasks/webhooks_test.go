@@ -0,0 +1,66 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tasks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+func TestDeliverWebhooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	e := common.NewTestEnvironment()
+	e.Config.Webhooks.MaxAttempts = 2
+	e.Config.Webhooks.Endpoints = []common.WebhookEndpoint{
+		{Name: "up", URL: server.URL},
+		{Name: "down", URL: server.URL + "/down"},
+	}
+
+	queue := &stores.TestWebhookStore{}
+	up := models.NewWebhookDelivery("up", common.WebhookDeviceRegistered, `{}`)
+	down := models.NewWebhookDelivery("down", common.WebhookDeviceRegistered, `{}`)
+	removed := models.NewWebhookDelivery("removed", common.WebhookDeviceRegistered, `{}`)
+	queue.Enqueue(up)
+	queue.Enqueue(down)
+	queue.Enqueue(removed)
+	sc := stores.StoreCollection{Webhooks: queue}
+
+	now := time.Now()
+	if err := deliverWebhooks(e, sc, server.Client(), now); err != nil {
+		t.Fatal(err)
+	}
+
+	if up.Status != models.WebhookDelivered || up.ResponseCode != http.StatusOK || up.Delivered.IsZero() {
+		t.Errorf("Expected delivery to succeed, got %#v", up)
+	}
+	if removed.Status != models.WebhookFailed {
+		t.Errorf("Expected delivery to a removed endpoint to fail, got %s", removed.Status)
+	}
+	if down.Status != models.WebhookPending || down.ResponseCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected failed delivery to be retried, got %#v", down)
+	}
+	if !down.NextAttempt.After(now) {
+		t.Error("Expected retry to back off")
+	}
+
+	if err := deliverWebhooks(e, sc, server.Client(), down.NextAttempt); err != nil {
+		t.Fatal(err)
+	}
+	if down.Status != models.WebhookFailed || down.Attempts != 2 {
+		t.Errorf("Expected delivery to fail after max attempts, got %s after %d", down.Status, down.Attempts)
+	}
+}
@@ -0,0 +1,146 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package webhooks queues and delivers events to the configured webhook
+// endpoints. Events are queued in the database by Fire and delivered in the
+// background by the task scheduler so a slow or unavailable endpoint never
+// holds up a request.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lfkeitel/verbose/v4"
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+const (
+	backoffBase = 30 * time.Second
+	backoffMax  = time.Hour
+)
+
+// Payload is the JSON body posted to webhook endpoints. Actor is the user
+// who caused the event, or empty for events caused by the system.
+type Payload struct {
+	Event   string      `json:"event"`
+	Created time.Time   `json:"created"`
+	Actor   string      `json:"actor"`
+	Data    interface{} `json:"data"`
+}
+
+// DeviceData is the payload data of device events.
+type DeviceData struct {
+	Device           *models.Device `json:"device"`
+	PreviousUsername string         `json:"previous_username,omitempty"`
+}
+
+// TrashedDeviceData is the payload data of devices permanently deleted from
+// the trash. Only the details kept in the trash listing are available.
+type TrashedDeviceData struct {
+	Device    *models.TrashItem `json:"device"`
+	Permanent bool              `json:"permanent"`
+}
+
+// Fire queues event for each endpoint subscribed to it. Errors are logged
+// rather than returned, a webhook failing should never fail the action that
+// caused it.
+func Fire(e *common.Environment, queue stores.WebhookStore, event, actor string, data interface{}) {
+	if queue == nil || len(e.Config.Webhooks.Endpoints) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(&Payload{
+		Event:   event,
+		Created: time.Now().UTC(),
+		Actor:   actor,
+		Data:    data,
+	})
+	if err != nil {
+		e.Log.WithFields(verbose.Fields{
+			"package": "webhooks",
+			"event":   event,
+			"error":   err,
+		}).Error("Failed to build webhook payload")
+		return
+	}
+
+	for _, ep := range e.Config.Webhooks.Endpoints {
+		if !ep.Subscribes(event) {
+			continue
+		}
+		if err := queue.Enqueue(models.NewWebhookDelivery(ep.Name, event, string(body))); err != nil {
+			e.Log.WithFields(verbose.Fields{
+				"package":  "webhooks",
+				"event":    event,
+				"endpoint": ep.Name,
+				"error":    err,
+			}).Error("Failed to queue webhook delivery")
+		}
+	}
+}
+
+// FireDevice queues a device event.
+func FireDevice(e *common.Environment, queue stores.WebhookStore, event, actor string, d *models.Device) {
+	Fire(e, queue, event, actor, &DeviceData{Device: d})
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliver posts a delivery to its endpoint. The response code is returned
+// along with an error if the endpoint didn't respond with a 2xx status.
+func Deliver(client *http.Client, ep common.WebhookEndpoint, d *models.WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequest(http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "packet-guardian")
+	req.Header.Set("X-PG-Event", d.Event)
+	req.Header.Set("X-PG-Delivery", strconv.Itoa(d.ID))
+	if ep.Secret != "" {
+		req.Header.Set("X-PG-Signature", "sha256="+Sign(ep.Secret, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("Webhook returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Backoff returns how long to wait before retrying a delivery after
+// attempts failed attempts. The wait doubles each attempt up to an hour.
+func Backoff(attempts int) time.Duration {
+	wait := backoffBase
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= backoffMax {
+			return backoffMax
+		}
+	}
+	return wait
+}
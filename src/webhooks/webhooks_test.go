@@ -0,0 +1,103 @@
+// This source file is part of the Packet Guardian project.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/packet-guardian/packet-guardian/src/common"
+	"github.com/packet-guardian/packet-guardian/src/models"
+	"github.com/packet-guardian/packet-guardian/src/models/stores"
+)
+
+func TestFire(t *testing.T) {
+	e := common.NewTestEnvironment()
+	e.Config.Webhooks.Endpoints = []common.WebhookEndpoint{
+		{Name: "all", URL: "http://example.com/all"},
+		{Name: "flags", URL: "http://example.com/flags", Events: []string{common.WebhookDeviceFlagged}},
+	}
+	queue := &stores.TestWebhookStore{}
+
+	Fire(e, queue, common.WebhookDeviceRegistered, "alice", map[string]string{"mac": "12:34:56:12:34:56"})
+	Fire(e, queue, common.WebhookDeviceFlagged, "admin", map[string]string{"mac": "12:34:56:12:34:56"})
+
+	if len(queue.Deliveries) != 3 {
+		t.Fatalf("Expected 3 deliveries, got %d", len(queue.Deliveries))
+	}
+	d := queue.Deliveries[2]
+	if d.Endpoint != "flags" || d.Event != common.WebhookDeviceFlagged || d.Status != models.WebhookPending {
+		t.Errorf("Unexpected delivery %#v", d)
+	}
+
+	var payload struct {
+		Event string            `json:"event"`
+		Actor string            `json:"actor"`
+		Data  map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(d.Payload), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != common.WebhookDeviceFlagged || payload.Actor != "admin" || payload.Data["mac"] != "12:34:56:12:34:56" {
+		t.Errorf("Unexpected payload %s", d.Payload)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	var gotSignature, gotEvent string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		gotSignature = r.Header.Get("X-PG-Signature")
+		gotEvent = r.Header.Get("X-PG-Event")
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	ep := common.WebhookEndpoint{Name: "siem", URL: server.URL, Secret: "s3cret"}
+	d := models.NewWebhookDelivery("siem", common.WebhookDeviceDeleted, `{"event":"device.deleted"}`)
+
+	code, err := Deliver(server.Client(), ep, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", code)
+	}
+	if string(gotBody) != d.Payload || gotEvent != common.WebhookDeviceDeleted {
+		t.Errorf("Unexpected request %s %q", gotEvent, gotBody)
+	}
+	if gotSignature != "sha256="+Sign("s3cret", gotBody) {
+		t.Errorf("Wrong signature %q", gotSignature)
+	}
+
+	ep.URL = server.URL + "/down"
+	code, err = Deliver(server.Client(), ep, d)
+	if err == nil || code != http.StatusBadGateway {
+		t.Errorf("Expected failed delivery with 502, got %d %v", code, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		4:  4 * time.Minute,
+		8:  time.Hour,
+		20: time.Hour,
+	}
+	for attempts, expected := range cases {
+		if b := Backoff(attempts); b != expected {
+			t.Errorf("Backoff(%d): expected %s, got %s", attempts, expected, b)
+		}
+	}
+}